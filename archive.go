@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/boatilus/peppercorn/archive"
+)
+
+// export runs the `export` command, writing an archive of the forum to the file named by the
+// last argument, or to stdout if it's "-".
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	secrets := fs.Bool("secrets", false, "include password hashes and MFA secrets")
+	sessions := fs.Bool("sessions", false, "include sessions")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: peppercorn export [-secrets] [-sessions] <file>")
+	}
+
+	var w io.Writer = os.Stdout
+
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		w = f
+	}
+
+	counts, err := archive.Export(w, archive.Opts{Secrets: *secrets, Sessions: *sessions})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Exported %d users, %d posts and %d sessions", counts.Users, counts.Posts, counts.Sessions)
+
+	return nil
+}
+
+// restore runs the `import` command, restoring the archive named by the only argument, or read
+// from stdin if it's "-", into an empty database.
+func restore(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: peppercorn import <file>")
+	}
+
+	var r io.Reader = os.Stdin
+
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		r = f
+	}
+
+	counts, err := archive.Import(r)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported %d users, %d posts and %d sessions", counts.Users, counts.Posts, counts.Sessions)
+
+	return nil
+}
@@ -0,0 +1,460 @@
+// Package archive exports the whole forum to, and restores it from, a JSON Lines archive. The
+// first line of an archive is a Header, and each line after it is a single user, attachment, post,
+// post revision, reaction, notification, draft, invite, pending email change, moderation log entry
+// or session. Archives record attachments, but not their files.
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/boatilus/peppercorn/attachments"
+	"github.com/boatilus/peppercorn/drafts"
+	"github.com/boatilus/peppercorn/emailchange"
+	"github.com/boatilus/peppercorn/invites"
+	"github.com/boatilus/peppercorn/moderation"
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/reactions"
+	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/users"
+)
+
+// Format identifies a file as a peppercorn archive.
+const Format = "peppercorn-archive"
+
+// Version is the version of the archive format written by Export. Import reads archives of this
+// version or older. Version 2 added post revisions, version 3 reactions, version 4 attachments,
+// version 5 the moderation log, version 6 notifications, version 7 drafts, version 8 invites and
+// version 9 pending email changes.
+const Version = 9
+
+// Record types, as given in each line's `type` field.
+const (
+	typeUser         = "user"
+	typeAttachment   = "attachment"
+	typePost         = "post"
+	typeRevision     = "revision"
+	typeReaction     = "reaction"
+	typeNotification = "notification"
+	typeDraft        = "draft"
+	typeInvite       = "invite"
+	typeEmailChange  = "email_change"
+	typeModeration   = "moderation"
+	typeSession      = "session"
+)
+
+// Header is the first line of every archive.
+type Header struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Secrets is true if the archive includes users' password hashes and MFA secrets.
+	Secrets bool `json:"secrets"`
+}
+
+// record is a line of the archive following the header.
+type record struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Opts specifies what to include in an export.
+type Opts struct {
+	// Secrets includes users' password hashes, TOTP secrets and recovery codes. Without them,
+	// restored users will need to reset their passwords and set up MFA again.
+	Secrets bool
+	// Sessions includes every user's sessions, so that they remain signed in after a restore.
+	Sessions bool
+}
+
+// Counts are the number of each kind of record exported or imported.
+type Counts struct {
+	Users         int
+	Attachments   int
+	Posts         int
+	Revisions     int
+	Reactions     int
+	Notifications int
+	Drafts        int
+	Invites       int
+	EmailChanges  int
+	Moderation    int
+	Sessions      int
+}
+
+// Export writes every user, every attachment, every post, including inactive posts, every revision
+// of and reaction to those posts, every notification, draft, invite and pending email change, and
+// the whole moderation log to `w`, along with sessions if `opts.Sessions` is set.
+// The attachments' files aren't written, and must be copied from their blob store separately.
+func Export(w io.Writer, opts Opts) (Counts, error) {
+	var counts Counts
+
+	enc := json.NewEncoder(w)
+
+	h := Header{Format: Format, Version: Version, ExportedAt: time.Now().UTC(), Secrets: opts.Secrets}
+	if err := enc.Encode(h); err != nil {
+		return counts, err
+	}
+
+	us, err := users.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, u := range us {
+		if !opts.Secrets {
+			u.Hash = ""
+			u.TOTPSecret = ""
+			u.RecoveryCodes = nil
+			u.Has2FAEnabled = false
+		}
+
+		if err := write(enc, typeUser, u); err != nil {
+			return counts, err
+		}
+
+		counts.Users++
+	}
+
+	as, err := attachments.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, a := range as {
+		if err := write(enc, typeAttachment, a); err != nil {
+			return counts, err
+		}
+
+		counts.Attachments++
+	}
+
+	ps, err := posts.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, p := range ps {
+		if err := write(enc, typePost, p); err != nil {
+			return counts, err
+		}
+
+		counts.Posts++
+	}
+
+	rs, err := posts.AllRevisions()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, r := range rs {
+		if err := write(enc, typeRevision, r); err != nil {
+			return counts, err
+		}
+
+		counts.Revisions++
+	}
+
+	rcs, err := reactions.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, r := range rcs {
+		if err := write(enc, typeReaction, r); err != nil {
+			return counts, err
+		}
+
+		counts.Reactions++
+	}
+
+	ns, err := notifications.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, n := range ns {
+		if err := write(enc, typeNotification, n); err != nil {
+			return counts, err
+		}
+
+		counts.Notifications++
+	}
+
+	ds, err := drafts.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, d := range ds {
+		if err := write(enc, typeDraft, d); err != nil {
+			return counts, err
+		}
+
+		counts.Drafts++
+	}
+
+	is, err := invites.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, i := range is {
+		if err := write(enc, typeInvite, i); err != nil {
+			return counts, err
+		}
+
+		counts.Invites++
+	}
+
+	cs, err := emailchange.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, c := range cs {
+		if err := write(enc, typeEmailChange, c); err != nil {
+			return counts, err
+		}
+
+		counts.EmailChanges++
+	}
+
+	es, err := moderation.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, e := range es {
+		if err := write(enc, typeModeration, e); err != nil {
+			return counts, err
+		}
+
+		counts.Moderation++
+	}
+
+	if !opts.Sessions {
+		return counts, nil
+	}
+
+	ss, err := session.All()
+	if err != nil {
+		return counts, err
+	}
+
+	for _, s := range ss {
+		if err := write(enc, typeSession, s); err != nil {
+			return counts, err
+		}
+
+		counts.Sessions++
+	}
+
+	return counts, nil
+}
+
+func write(enc *json.Encoder, recordType string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return enc.Encode(record{Type: recordType, Data: data})
+}
+
+// Import restores an archive written by Export, keeping every record's ID and timestamps. It
+// refuses to import into a database that already has users or posts.
+func Import(r io.Reader) (Counts, error) {
+	var counts Counts
+
+	if err := checkEmpty(); err != nil {
+		return counts, err
+	}
+
+	dec := json.NewDecoder(r)
+
+	var h Header
+	if err := dec.Decode(&h); err != nil {
+		return counts, fmt.Errorf("archive: reading header: %s", err)
+	}
+
+	if h.Format != Format {
+		return counts, errors.New("archive: not a peppercorn archive")
+	}
+
+	if h.Version < 1 || h.Version > Version {
+		return counts, fmt.Errorf("archive: unsupported archive version %d", h.Version)
+	}
+
+	for line := 2; ; line++ {
+		var rec record
+
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return counts, nil
+		}
+
+		if err != nil {
+			return counts, fmt.Errorf("archive: line %d: %s", line, err)
+		}
+
+		if err := restore(&rec, &counts); err != nil {
+			return counts, fmt.Errorf("archive: line %d: %s", line, err)
+		}
+	}
+}
+
+// restore inserts the user, attachment, post, revision, reaction, notification, draft, invite, email
+// change, moderation log entry or session held by `rec`, incrementing its count in `counts`.
+func restore(rec *record, counts *Counts) error {
+	switch rec.Type {
+	case typeUser:
+		var u users.User
+		if err := json.Unmarshal(rec.Data, &u); err != nil {
+			return err
+		}
+
+		if err := users.Restore(&u); err != nil {
+			return err
+		}
+
+		counts.Users++
+	case typeAttachment:
+		var a attachments.Attachment
+		if err := json.Unmarshal(rec.Data, &a); err != nil {
+			return err
+		}
+
+		if err := attachments.Restore(&a); err != nil {
+			return err
+		}
+
+		counts.Attachments++
+	case typePost:
+		var p posts.Post
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+
+		if err := posts.Restore(&p); err != nil {
+			return err
+		}
+
+		counts.Posts++
+	case typeRevision:
+		var r posts.Revision
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return err
+		}
+
+		if err := posts.RestoreRevision(&r); err != nil {
+			return err
+		}
+
+		counts.Revisions++
+	case typeReaction:
+		var r reactions.Reaction
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return err
+		}
+
+		if err := reactions.Restore(&r); err != nil {
+			return err
+		}
+
+		counts.Reactions++
+	case typeNotification:
+		var n notifications.Notification
+		if err := json.Unmarshal(rec.Data, &n); err != nil {
+			return err
+		}
+
+		if err := notifications.Restore(&n); err != nil {
+			return err
+		}
+
+		counts.Notifications++
+	case typeDraft:
+		var d drafts.Draft
+		if err := json.Unmarshal(rec.Data, &d); err != nil {
+			return err
+		}
+
+		if err := drafts.Restore(&d); err != nil {
+			return err
+		}
+
+		counts.Drafts++
+	case typeInvite:
+		var i invites.Invite
+		if err := json.Unmarshal(rec.Data, &i); err != nil {
+			return err
+		}
+
+		if err := invites.Restore(&i); err != nil {
+			return err
+		}
+
+		counts.Invites++
+	case typeEmailChange:
+		var c emailchange.Change
+		if err := json.Unmarshal(rec.Data, &c); err != nil {
+			return err
+		}
+
+		if err := emailchange.Restore(&c); err != nil {
+			return err
+		}
+
+		counts.EmailChanges++
+	case typeModeration:
+		var e moderation.Entry
+		if err := json.Unmarshal(rec.Data, &e); err != nil {
+			return err
+		}
+
+		if err := moderation.RestoreEntry(&e); err != nil {
+			return err
+		}
+
+		counts.Moderation++
+	case typeSession:
+		var s session.Session
+		if err := json.Unmarshal(rec.Data, &s); err != nil {
+			return err
+		}
+
+		if err := session.Restore(&s); err != nil {
+			return err
+		}
+
+		counts.Sessions++
+	default:
+		return fmt.Errorf("unknown record type %q", rec.Type)
+	}
+
+	return nil
+}
+
+// checkEmpty returns an error if there are any users or posts in the database.
+func checkEmpty() error {
+	us, err := users.All()
+	if err != nil {
+		return err
+	}
+
+	n, err := posts.CountAll()
+	if err != nil {
+		return err
+	}
+
+	if len(us) > 0 || n > 0 {
+		return fmt.Errorf("archive: can only import into an empty database, but found %d users and %d posts", len(us), n)
+	}
+
+	return nil
+}
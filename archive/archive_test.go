@@ -0,0 +1,296 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/attachments"
+	"github.com/boatilus/peppercorn/drafts"
+	"github.com/boatilus/peppercorn/emailchange"
+	"github.com/boatilus/peppercorn/invites"
+	"github.com/boatilus/peppercorn/moderation"
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/reactions"
+	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+}
+
+// reset swaps in empty in-memory stores.
+func reset() {
+	users.SetStore(users.NewMemoryStore())
+	posts.SetStore(posts.NewMemoryStore())
+	session.SetStore(session.NewMemoryStore())
+	reactions.SetStore(reactions.NewMemoryStore())
+	attachments.SetStore(attachments.NewMemoryStore())
+	attachments.SetBlobStore(attachments.NewMemoryBlobStore())
+	moderation.SetStore(moderation.NewMemoryStore())
+	notifications.SetStore(notifications.NewMemoryStore())
+	drafts.SetStore(drafts.NewMemoryStore())
+	invites.SetStore(invites.NewMemoryStore())
+	emailchange.SetStore(emailchange.NewMemoryStore())
+	users.Users = users.NewCache()
+}
+
+// seed fills the stores with a user, an active post with a single revision, a reaction and an
+// attachment, a notification, a draft, an invite, a pending email change, a post deactivated by an
+// admin, and a session.
+func seed(t *testing.T) {
+	reset()
+
+	u := users.User{
+		Email:         "user@example.com",
+		Name:          "user",
+		Hash:          "hash",
+		Has2FAEnabled: true,
+		TOTPSecret:    "secret",
+		RecoveryCodes: []string{"a", "b"},
+	}
+
+	if err := users.Create(&u); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := attachments.Upload(u.ID, "notes.txt", strings.NewReader("some notes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+
+	ps := []posts.Post{
+		{Active: true, Author: u.ID, Content: "first", Time: now.Add(-time.Hour), Attachments: []string{a.ID}},
+		{Active: true, Author: u.ID, Content: "second", Time: now},
+	}
+
+	ids := make([]string, len(ps))
+
+	for i := range ps {
+		id, err := posts.Submit(&ps[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids[i] = id
+	}
+
+	if err := posts.Edit(ids[0], u.ID, "first, edited"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reactions.Add(ids[0], u.ID, reactions.Default[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := notifications.Mention(u.ID, u.ID, ids[0], 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := drafts.Save(u.ID, "a reply"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := invites.New(u.ID, "friend@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := emailchange.Restore(&emailchange.Change{ID: "change", UserID: u.ID, Email: "new@example.com", Created: now, Expires: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := moderation.Deactivate(u.ID, ids[1], "spam"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := session.Create(&u, "127.0.0.1", "UA"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	assert := assert.New(t)
+
+	seed(t)
+
+	wantUsers, _ := users.All()
+	wantAttachments, _ := attachments.All()
+	wantPosts, _ := posts.All()
+	wantRevisions, _ := posts.AllRevisions()
+	wantReactions, _ := reactions.All()
+	wantNotifications, _ := notifications.All()
+	wantDrafts, _ := drafts.All()
+	wantInvites, _ := invites.All()
+	wantChanges, _ := emailchange.All()
+	wantEntries, _ := moderation.All()
+	wantSessions, _ := session.All()
+
+	var buf bytes.Buffer
+
+	counts, err := Export(&buf, Opts{Secrets: true, Sessions: true})
+	assert.NoError(err)
+	assert.Equal(Counts{Users: 1, Attachments: 1, Posts: 2, Revisions: 1, Reactions: 1, Notifications: 1, Drafts: 1, Invites: 1, EmailChanges: 1, Moderation: 1, Sessions: 1}, counts)
+
+	reset()
+
+	counts, err = Import(&buf)
+	assert.NoError(err)
+	assert.Equal(Counts{Users: 1, Attachments: 1, Posts: 2, Revisions: 1, Reactions: 1, Notifications: 1, Drafts: 1, Invites: 1, EmailChanges: 1, Moderation: 1, Sessions: 1}, counts)
+
+	gotUsers, _ := users.All()
+	assert.Equal(wantUsers, gotUsers)
+	assert.Equal(1, users.Users.Len())
+
+	gotAttachments, _ := attachments.All()
+	if assert.Len(gotAttachments, 1) {
+		assert.Equal(wantAttachments[0].ID, gotAttachments[0].ID)
+		assert.Equal(wantAttachments[0].Name, gotAttachments[0].Name)
+		assert.True(wantAttachments[0].Time.Equal(gotAttachments[0].Time))
+	}
+
+	gotPosts, _ := posts.All()
+	if assert.Len(gotPosts, len(wantPosts)) {
+		for i := range wantPosts {
+			assert.Equal(wantPosts[i].ID, gotPosts[i].ID)
+			assert.Equal(wantPosts[i].Attachments, gotPosts[i].Attachments)
+			assert.Equal(wantPosts[i].Active, gotPosts[i].Active)
+			assert.Equal(wantPosts[i].Content, gotPosts[i].Content)
+			assert.True(wantPosts[i].Time.Equal(gotPosts[i].Time))
+		}
+	}
+
+	gotRevisions, _ := posts.AllRevisions()
+	if assert.Len(gotRevisions, 1) {
+		assert.Equal(wantRevisions[0].ID, gotRevisions[0].ID)
+		assert.Equal(wantRevisions[0].PostID, gotRevisions[0].PostID)
+		assert.Equal("first", gotRevisions[0].Content)
+		assert.Equal(wantRevisions[0].EditorID, gotRevisions[0].EditorID)
+		assert.True(wantRevisions[0].Time.Equal(gotRevisions[0].Time))
+	}
+
+	gotReactions, _ := reactions.All()
+	if assert.Len(gotReactions, 1) {
+		assert.Equal(wantReactions[0].ID, gotReactions[0].ID)
+		assert.Equal(wantReactions[0].PostID, gotReactions[0].PostID)
+		assert.Equal(wantReactions[0].Reaction, gotReactions[0].Reaction)
+		assert.True(wantReactions[0].Time.Equal(gotReactions[0].Time))
+	}
+
+	gotNotifications, _ := notifications.All()
+	assert.Equal(wantNotifications, gotNotifications)
+
+	gotDrafts, _ := drafts.All()
+	if assert.Len(gotDrafts, 1) {
+		assert.Equal(wantDrafts[0].UserID, gotDrafts[0].UserID)
+		assert.Equal("a reply", gotDrafts[0].Content)
+		assert.True(wantDrafts[0].UpdatedAt.Equal(gotDrafts[0].UpdatedAt))
+	}
+
+	gotInvites, _ := invites.All()
+	if assert.Len(gotInvites, 1) {
+		assert.Equal(wantInvites[0].ID, gotInvites[0].ID)
+		assert.Equal("friend@example.com", gotInvites[0].Email)
+		assert.Equal(wantInvites[0].InviterID, gotInvites[0].InviterID)
+		assert.True(wantInvites[0].Expires.Equal(gotInvites[0].Expires))
+	}
+
+	gotChanges, _ := emailchange.All()
+	if assert.Len(gotChanges, 1) {
+		assert.Equal(wantChanges[0].ID, gotChanges[0].ID)
+		assert.Equal(wantChanges[0].UserID, gotChanges[0].UserID)
+		assert.Equal("new@example.com", gotChanges[0].Email)
+		assert.True(wantChanges[0].Expires.Equal(gotChanges[0].Expires))
+	}
+
+	gotEntries, _ := moderation.All()
+	if assert.Len(gotEntries, 1) {
+		assert.Equal(wantEntries[0].ID, gotEntries[0].ID)
+		assert.Equal(wantEntries[0].PostID, gotEntries[0].PostID)
+		assert.Equal(moderation.ActionDeactivate, gotEntries[0].Action)
+		assert.Equal("spam", gotEntries[0].Reason)
+		assert.True(wantEntries[0].Time.Equal(gotEntries[0].Time))
+	}
+
+	gotSessions, _ := session.All()
+	if assert.Len(gotSessions, 1) {
+		assert.Equal(wantSessions[0].ID, gotSessions[0].ID)
+		assert.True(wantSessions[0].Timestamp.Equal(gotSessions[0].Timestamp))
+	}
+}
+
+func TestExport_withoutSecrets(t *testing.T) {
+	assert := assert.New(t)
+
+	seed(t)
+
+	var buf bytes.Buffer
+
+	counts, err := Export(&buf, Opts{})
+	assert.NoError(err)
+	assert.Equal(0, counts.Sessions)
+
+	reset()
+
+	_, err = Import(&buf)
+	assert.NoError(err)
+
+	us, _ := users.All()
+	if assert.Len(us, 1) {
+		assert.Empty(us[0].Hash)
+		assert.Empty(us[0].TOTPSecret)
+		assert.Empty(us[0].RecoveryCodes)
+		assert.False(us[0].Has2FAEnabled)
+		assert.Equal("user@example.com", us[0].Email)
+	}
+
+	ss, _ := session.All()
+	assert.Empty(ss)
+}
+
+func TestImport_notEmpty(t *testing.T) {
+	seed(t)
+
+	var buf bytes.Buffer
+
+	_, err := Export(&buf, Opts{})
+	assert.NoError(t, err)
+
+	_, err = Import(&buf)
+	assert.Error(t, err)
+}
+
+func TestImport_badHeader(t *testing.T) {
+	cases := []string{
+		``,
+		`{"format":"something-else","version":1}`,
+		`{"format":"peppercorn-archive","version":0}`,
+		fmt.Sprintf(`{"format":"peppercorn-archive","version":%d}`, Version+1),
+	}
+
+	for _, c := range cases {
+		reset()
+
+		_, err := Import(strings.NewReader(c))
+		assert.Error(t, err, c)
+	}
+}
+
+func TestImport_unknownType(t *testing.T) {
+	reset()
+
+	in := `{"format":"peppercorn-archive","version":1}
+{"type":"widget","data":{}}
+`
+
+	_, err := Import(strings.NewReader(in))
+	assert.Error(t, err)
+}
@@ -0,0 +1,357 @@
+// Package attachments keeps the files attached to posts. An attachment's contents, and those of any
+// thumbnail made of it, are kept in a BlobStore, while its name, type and size are kept alongside
+// the rest of the forum's data. Users' avatars are kept in the same BlobStore.
+package attachments
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/spf13/viper"
+)
+
+// Attachment describes a single uploaded file. Width and Height are set only for images, and
+// Thumbnail is true if a thumbnail was made of it.
+type Attachment struct {
+	ID        string    `gorethink:"id" json:"id"`
+	UserID    string    `gorethink:"user_id" json:"user_id"`
+	Name      string    `gorethink:"name" json:"name"`
+	Type      string    `gorethink:"type" json:"type"`
+	Size      int64     `gorethink:"size" json:"size"`
+	Width     int       `gorethink:"width" json:"width,omitempty"`
+	Height    int       `gorethink:"height" json:"height,omitempty"`
+	Thumbnail bool      `gorethink:"thumbnail" json:"thumbnail"`
+	Time      time.Time `gorethink:"time" json:"time"`
+}
+
+// DefaultTypes are the media types that can be uploaded unless the `attachments.types` config value
+// gives others.
+var DefaultTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"text/plain",
+	"application/pdf",
+	"application/zip",
+}
+
+func init() {
+	viper.SetDefault("attachments.dir", "attachments")
+	viper.SetDefault("attachments.max_size", 10<<20)
+	viper.SetDefault("attachments.max_per_post", 10)
+	viper.SetDefault("attachments.types", DefaultTypes)
+}
+
+// MaxSize returns the size, in bytes, of the largest file that can be uploaded.
+func MaxSize() int64 {
+	return viper.GetInt64("attachments.max_size")
+}
+
+// MaxPerPost returns the most attachments a single post can have.
+func MaxPerPost() int {
+	return viper.GetInt("attachments.max_per_post")
+}
+
+// isAllowed reports whether files of media type `mediaType` can be uploaded.
+func isAllowed(mediaType string) bool {
+	for _, t := range viper.GetStringSlice("attachments.types") {
+		if t == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// URL returns the path from which the attachment is served.
+func (a Attachment) URL() string {
+	return "/attachments/" + a.ID
+}
+
+// ThumbnailURL returns the path from which the attachment's thumbnail is served, or an empty string
+// if it has none.
+func (a Attachment) ThumbnailURL() string {
+	if !a.Thumbnail {
+		return ""
+	}
+
+	return a.URL() + "/thumbnail"
+}
+
+// IsImage reports whether the attachment is an image.
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.Type, "image/")
+}
+
+// PrettySize returns the attachment's size as displayed, as in "12.3 KB".
+func (a Attachment) PrettySize() string {
+	const unit = 1024
+
+	if a.Size < unit {
+		return fmt.Sprintf("%d B", a.Size)
+	}
+
+	size := float64(a.Size) / unit
+	for _, suffix := range []string{"KB", "MB"} {
+		if size < unit {
+			return fmt.Sprintf("%.1f %s", size, suffix)
+		}
+
+		size /= unit
+	}
+
+	return fmt.Sprintf("%.1f GB", size)
+}
+
+// thumbnailKey returns the key under which the thumbnail of the attachment with `id` is kept.
+func thumbnailKey(id string) string {
+	return id + ".thumbnail"
+}
+
+// cleanName returns `name`, as given by a client, reduced to a file name that's safe to show and to
+// send back in a Content-Disposition header.
+func cleanName(name string) string {
+	name = path.Base(strings.Replace(name, "\\", "/", -1))
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' || r == utf8.RuneError {
+			return -1
+		}
+
+		return r
+	}, name)
+
+	name = strings.TrimSpace(name)
+
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "attachment"
+	}
+
+	// Keep names to 255 bytes without splitting a character.
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name
+}
+
+// Upload keeps the file named `name` with contents read from `r` as an attachment uploaded by the
+// user with `userID`. The file must be no larger than MaxSize, and of one of the media types
+// allowed by the `attachments.types` config value, as sniffed from its contents rather than taken
+// from its name. Metadata such as EXIF is stripped from images, and a thumbnail is made of images
+// of the types we can decode.
+func Upload(userID string, name string, r io.Reader) (*Attachment, error) {
+	if len(userID) == 0 {
+		return nil, errors.New("attachments: user ID cannot be empty")
+	}
+
+	if blobs == nil {
+		return nil, errNoBlobStore
+	}
+
+	max := MaxSize()
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New("attachments: file is empty")
+	}
+
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("attachments: file is larger than the limit of %d bytes", max)
+	}
+
+	contentType := http.DetectContentType(data)
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !isAllowed(mediaType) {
+		return nil, fmt.Errorf("attachments: files of type %q cannot be attached", mediaType)
+	}
+
+	a := Attachment{
+		ID:     utility.GenerateUUID(),
+		UserID: userID,
+		Name:   cleanName(name),
+		Type:   contentType,
+		Time:   time.Now().UTC(),
+	}
+
+	var thumbnail []byte
+
+	if a.IsImage() {
+		img, err := processImage(mediaType, data)
+		if err != nil {
+			return nil, fmt.Errorf("attachments: couldn't read image: %s", err)
+		}
+
+		data = img.Data
+		a.Width = img.Width
+		a.Height = img.Height
+		thumbnail = img.Thumbnail
+	}
+
+	a.Size = int64(len(data))
+
+	if err := blobs.Put(a.ID, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	if thumbnail != nil {
+		if err := blobs.Put(thumbnailKey(a.ID), bytes.NewReader(thumbnail)); err != nil {
+			blobs.Delete(a.ID)
+			return nil, err
+		}
+
+		a.Thumbnail = true
+	}
+
+	if err := store.Insert(&a); err != nil {
+		blobs.Delete(a.ID)
+		blobs.Delete(thumbnailKey(a.ID))
+
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// Get returns the attachment with `id`, or an error if there's none.
+func Get(id string) (*Attachment, error) {
+	if len(id) == 0 {
+		return nil, errors.New("attachments: ID cannot be empty")
+	}
+
+	a, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if a == nil {
+		return nil, fmt.Errorf("No attachment found with ID %q", id)
+	}
+
+	return a, nil
+}
+
+// GetMany returns the attachments with `ids`, keyed by ID. IDs with no attachment are left out.
+func GetMany(ids []string) (map[string]Attachment, error) {
+	if len(ids) == 0 {
+		return map[string]Attachment{}, nil
+	}
+
+	as, err := store.GetMany(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]Attachment, len(as))
+	for _, a := range as {
+		byID[a.ID] = a
+	}
+
+	return byID, nil
+}
+
+// CheckOwner returns an error unless each of `ids` is an attachment uploaded by the user with
+// `userID`, and there are no more than MaxPerPost of them, so that they can be attached to a post
+// by that user.
+func CheckOwner(userID string, ids []string) error {
+	if max := MaxPerPost(); len(ids) > max {
+		return fmt.Errorf("attachments: a post can't have more than %d attachments", max)
+	}
+
+	as, err := GetMany(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		a, ok := as[id]
+		if !ok || a.UserID != userID {
+			return fmt.Errorf("No attachment found with ID %q", id)
+		}
+	}
+
+	return nil
+}
+
+// Open returns the contents of the attachment with `id`. The caller must close it.
+func Open(id string) (ReadSeekCloser, error) {
+	if blobs == nil {
+		return nil, errNoBlobStore
+	}
+
+	return blobs.Open(id)
+}
+
+// OpenThumbnail returns the thumbnail of the attachment with `id`. The caller must close it.
+func OpenThumbnail(id string) (ReadSeekCloser, error) {
+	if blobs == nil {
+		return nil, errNoBlobStore
+	}
+
+	return blobs.Open(thumbnailKey(id))
+}
+
+// ThumbnailType returns the media type of the attachment's thumbnail. Thumbnails of JPEGs are
+// JPEGs, while those of other images are PNGs so as to keep any transparency.
+func (a Attachment) ThumbnailType() string {
+	if strings.HasPrefix(a.Type, "image/jpeg") {
+		return "image/jpeg"
+	}
+
+	return "image/png"
+}
+
+// Delete deletes the attachment with `id`, along with its contents and any thumbnail of it.
+func Delete(id string) error {
+	if len(id) == 0 {
+		return errors.New("attachments: ID cannot be empty")
+	}
+
+	if blobs == nil {
+		return errNoBlobStore
+	}
+
+	// Delete the metadata first, so the attachment's never listed without its contents.
+	if err := store.Delete(id); err != nil {
+		return err
+	}
+
+	if err := blobs.Delete(id); err != nil {
+		return err
+	}
+
+	return blobs.Delete(thumbnailKey(id))
+}
+
+// All returns the metadata of every attachment, oldest first.
+func All() ([]Attachment, error) {
+	return store.All()
+}
+
+// Restore inserts an attachment's metadata exactly as given, keeping its ID and time. It's intended
+// for restoring attachments from an archive, and leaves their contents to be copied separately.
+func Restore(a *Attachment) error {
+	if a == nil || a.ID == "" || a.UserID == "" || a.Type == "" {
+		return errors.New("attachments: invalid Attachment supplied")
+	}
+
+	return store.Insert(a)
+}
@@ -0,0 +1,488 @@
+package attachments
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/db/dbtest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableName = "attachments_test"
+
+func init() {
+	viper.Set("db.attachments_table", tableName)
+	viper.Set("attachments.max_size", 1<<20)
+	viper.Set("attachments.max_per_post", 3)
+
+	SetBlobStore(NewMemoryBlobStore())
+
+	switch backend, conn := dbtest.Setup("attachments", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
+	}
+}
+
+// makePNG returns a PNG `w` by `h` pixels, with a tEXt chunk holding `text` after its header.
+func makePNG(t *testing.T, w int, h int, text string) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	// The signature is 8 bytes, and the IHDR chunk 25. The CRC isn't checked by the decoder.
+	chunk := []byte{0, 0, 0, byte(len(text)), 't', 'E', 'X', 't'}
+	chunk = append(chunk, text...)
+	chunk = append(chunk, 0, 0, 0, 0)
+
+	return append(data[:33:33], append(chunk, data[33:]...)...)
+}
+
+// makeJPEG returns a JPEG `w` by `h` pixels, with EXIF giving `orientation` and a comment holding
+// `comment`.
+func makeJPEG(t *testing.T, w int, h int, orientation int, comment string) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	com := []byte{0xFF, 0xFE, 0, byte(len(comment) + 2)}
+	com = append(com, comment...)
+
+	extra := append(orientationSegment(orientation), com...)
+
+	return append(data[:2:2], append(extra, data[2:]...)...)
+}
+
+func TestUpload(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Upload("", "notes.txt", strings.NewReader("notes"))
+	assert.Error(err)
+
+	_, err = Upload("user", "empty.txt", strings.NewReader(""))
+	assert.Error(err)
+
+	_, err = Upload("user", "big.txt", strings.NewReader(strings.Repeat("a", 1<<20+1)))
+	assert.Error(err, "files larger than the limit should be refused")
+
+	_, err = Upload("user", "page.txt", strings.NewReader("<html><body>hello</body></html>"))
+	assert.Error(err, "types are sniffed from contents, not names")
+
+	a, err := Upload("user", "../notes.txt", strings.NewReader("some notes"))
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.Equal("notes.txt", a.Name)
+	assert.Equal("text/plain; charset=utf-8", a.Type)
+	assert.Equal(int64(10), a.Size)
+	assert.False(a.Thumbnail)
+	assert.False(a.IsImage())
+
+	got, err := Get(a.ID)
+	if assert.NoError(err) {
+		assert.Equal(a.UserID, got.UserID)
+		assert.Equal(a.Name, got.Name)
+	}
+
+	f, err := Open(a.ID)
+	if assert.NoError(err) {
+		data, _ := ioutil.ReadAll(f)
+		f.Close()
+
+		assert.Equal("some notes", string(data))
+	}
+
+	_, err = OpenThumbnail(a.ID)
+	assert.True(os.IsNotExist(err))
+
+	_, err = Get("nonexistent")
+	assert.Error(err)
+}
+
+func TestUpload_png(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := Upload("user", "image.png", bytes.NewReader(makePNG(t, 640, 480, "Author\x00secret")))
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.Equal(640, a.Width)
+	assert.Equal(480, a.Height)
+	assert.True(a.Thumbnail)
+	assert.Equal("image/png", a.ThumbnailType())
+
+	f, err := Open(a.ID)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	data, _ := ioutil.ReadAll(f)
+	f.Close()
+
+	assert.False(bytes.Contains(data, []byte("secret")), "text chunks should be stripped")
+	assert.Equal(int64(len(data)), a.Size)
+
+	f, err = OpenThumbnail(a.ID)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	config, err := png.DecodeConfig(f)
+	f.Close()
+
+	if assert.NoError(err) {
+		assert.Equal(320, config.Width)
+		assert.Equal(240, config.Height)
+	}
+}
+
+func TestUpload_jpeg(t *testing.T) {
+	assert := assert.New(t)
+
+	// Orientation 6 has the image turned a quarter to be shown upright, so its width and height
+	// swap.
+	a, err := Upload("user", "photo.jpg", bytes.NewReader(makeJPEG(t, 640, 320, 6, "secret")))
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.Equal(320, a.Width)
+	assert.Equal(640, a.Height)
+	assert.Equal("image/jpeg", a.ThumbnailType())
+
+	f, err := Open(a.ID)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	data, _ := ioutil.ReadAll(f)
+	f.Close()
+
+	assert.False(bytes.Contains(data, []byte("secret")), "comments should be stripped")
+
+	if i := bytes.Index(data, []byte("Exif\x00\x00")); assert.True(i >= 0, "the orientation should be kept") {
+		assert.Equal(6, exifOrientation(data[i+6:]))
+	}
+
+	f, err = OpenThumbnail(a.ID)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	config, err := jpeg.DecodeConfig(f)
+	f.Close()
+
+	if assert.NoError(err) {
+		assert.Equal(160, config.Width)
+		assert.Equal(320, config.Height)
+	}
+
+	_, err = Upload("user", "broken.jpg", bytes.NewReader([]byte("\xFF\xD8\xFF\xE0\x00")))
+	assert.Error(err, "malformed images should be refused")
+}
+
+func TestStripWebP(t *testing.T) {
+	assert := assert.New(t)
+
+	chunk := func(kind string, data string) string {
+		return kind + string([]byte{byte(len(data)), 0, 0, 0}) + data
+	}
+
+	body := "WEBP" + chunk("VP8X", "\x0C\x00\x00\x00\x00\x00\x00\x00\x00\x00") + chunk("VP8L", "data") + chunk("EXIF", "secret")
+	data := []byte("RIFF" + string([]byte{byte(len(body)), 0, 0, 0}) + body)
+
+	got, err := stripWebP(data)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	want := "WEBP" + chunk("VP8X", "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00") + chunk("VP8L", "data")
+	assert.Equal("RIFF"+string([]byte{byte(len(want)), 0, 0, 0})+want, string(got))
+
+	_, err = stripWebP([]byte("RIFF\x00\x00\x00\x00WEBPVP8"))
+	assert.Error(err)
+}
+
+func TestCheckOwner(t *testing.T) {
+	assert := assert.New(t)
+
+	var ids []string
+
+	for i := 0; i < 3; i++ {
+		a, err := Upload("owner", "notes.txt", strings.NewReader("notes"))
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+
+		ids = append(ids, a.ID)
+	}
+
+	other, err := Upload("other", "notes.txt", strings.NewReader("notes"))
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.NoError(CheckOwner("owner", ids))
+	assert.NoError(CheckOwner("owner", nil))
+	assert.Error(CheckOwner("owner", []string{ids[0], other.ID}), "attachments by others can't be used")
+	assert.Error(CheckOwner("owner", []string{"nonexistent"}))
+	assert.Error(CheckOwner("owner", append(ids, ids[0])), "posts can't have more than max_per_post")
+
+	got, err := GetMany([]string{ids[0], other.ID, "nonexistent"})
+	if assert.NoError(err) && assert.Len(got, 2) {
+		assert.Equal("owner", got[ids[0]].UserID)
+		assert.Equal("other", got[other.ID].UserID)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := Upload("user", "image.png", bytes.NewReader(makePNG(t, 640, 480, "")))
+	if !assert.NoError(err) || !assert.True(a.Thumbnail) {
+		t.FailNow()
+	}
+
+	assert.Error(Delete(""))
+	assert.NoError(Delete(a.ID))
+
+	_, err = Get(a.ID)
+	assert.Error(err)
+
+	// Both the contents and the thumbnail are gone.
+	_, err = blobs.Open(a.ID)
+	assert.True(os.IsNotExist(err))
+
+	_, err = blobs.Open(thumbnailKey(a.ID))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestUploadAvatar(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := UploadAvatar(strings.NewReader(""))
+	assert.Error(err)
+
+	_, err = UploadAvatar(strings.NewReader("some notes"))
+	assert.Error(err, "only images can be avatars")
+
+	// Orientation 6 turns the 640 by 320 image on its side, and the avatar is cropped square.
+	id, err := UploadAvatar(bytes.NewReader(makeJPEG(t, 640, 320, 6, "secret")))
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	for small, size := range map[bool]int{false: AvatarSize, true: SmallAvatarSize} {
+		f, err := OpenAvatar(id, small)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		data, _ := ioutil.ReadAll(f)
+		f.Close()
+
+		assert.False(bytes.Contains(data, []byte("secret")), "metadata should be stripped")
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		if assert.NoError(err) {
+			assert.Equal(size, config.Width)
+			assert.Equal(size, config.Height)
+		}
+	}
+
+	// Images smaller than an avatar are cropped but not enlarged.
+	id2, err := UploadAvatar(bytes.NewReader(makePNG(t, 100, 60, "")))
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.NotEqual(id, id2)
+
+	f, err := OpenAvatar(id2, false)
+	if assert.NoError(err) {
+		config, err := png.DecodeConfig(f)
+		f.Close()
+
+		if assert.NoError(err) {
+			assert.Equal(60, config.Width)
+			assert.Equal(60, config.Height)
+		}
+	}
+
+	assert.Equal("/avatars/"+id, AvatarURL(id))
+	assert.Equal("/avatars/"+id+"/small", SmallAvatarURL(id))
+	assert.Equal("", AvatarURL(""))
+
+	assert.Error(DeleteAvatar(""))
+	assert.NoError(DeleteAvatar(id))
+
+	_, err = OpenAvatar(id, false)
+	assert.True(os.IsNotExist(err))
+
+	_, err = OpenAvatar(id, true)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestFetchAvatar(t *testing.T) {
+	assert := assert.New(t)
+
+	image := makePNG(t, 200, 200, "")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/avatar.png":
+			w.Write(image)
+		case "/page.html":
+			w.Write([]byte("<html><body>Not an image</body></html>"))
+		case "/unavailable.png":
+			http.Error(w, "Try again later", http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	id, err := FetchAvatar(srv.URL + "/avatar.png")
+	if assert.NoError(err) {
+		f, err := OpenAvatar(id, false)
+		if assert.NoError(err) {
+			config, err := png.DecodeConfig(f)
+			f.Close()
+
+			if assert.NoError(err) {
+				assert.Equal(AvatarSize, config.Width)
+			}
+		}
+	}
+
+	// Avatars that are gone or aren't images are no use, while others may yet be fetched.
+	for _, path := range []string{"/missing.png", "/page.html"} {
+		_, err = FetchAvatar(srv.URL + path)
+		assert.IsType(UnusableAvatarError{}, err, path)
+	}
+
+	_, err = FetchAvatar(srv.URL + "/unavailable.png")
+	if assert.Error(err) {
+		_, unusable := err.(UnusableAvatarError)
+		assert.False(unusable, "server errors may pass")
+	}
+
+	assert.True(IsRemoteAvatar(srv.URL + "/avatar.png"))
+	assert.False(IsRemoteAvatar(id))
+	assert.Empty(AvatarURL(srv.URL + "/avatar.png"))
+}
+
+func TestRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(Restore(nil))
+	assert.Error(Restore(&Attachment{ID: "restored"}))
+
+	at := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := Attachment{ID: "restored", UserID: "user", Name: "notes.txt", Type: "text/plain", Size: 5, Time: at}
+
+	if !assert.NoError(Restore(&a)) {
+		t.FailNow()
+	}
+
+	assert.Error(Restore(&a), "restoring an attachment twice should fail")
+
+	got, err := Get(a.ID)
+	if assert.NoError(err) {
+		assert.Equal(a.Name, got.Name)
+		assert.True(at.Equal(got.Time))
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	cases := map[string]string{
+		"notes.txt":              "notes.txt",
+		"../../etc/passwd":       "passwd",
+		`C:\Users\me\photo.jpg`:  "photo.jpg",
+		"  \"quoted\"\x00.txt  ": "quoted.txt",
+		"":                       "attachment",
+		"..":                     "attachment",
+		strings.Repeat("é", 200): strings.Repeat("é", 127),
+	}
+
+	for name, want := range cases {
+		assert.Equal(t, want, cleanName(name), name)
+	}
+}
+
+func TestPrettySize(t *testing.T) {
+	cases := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1536:            "1.5 KB",
+		10 << 20:        "10.0 MB",
+		5<<30 + 512<<20: "5.5 GB",
+	}
+
+	for size, want := range cases {
+		assert.Equal(t, want, Attachment{Size: size}.PrettySize())
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "peppercorn-blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s, err := NewLocalBlobStore(dir)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.Error(s.Put("../escape", strings.NewReader("data")))
+	assert.Error(s.Put(".hidden", strings.NewReader("data")))
+
+	assert.NoError(s.Put("abc-123", strings.NewReader("first")))
+	assert.NoError(s.Put("abc-123", strings.NewReader("second")))
+
+	f, err := s.Open("abc-123")
+	if assert.NoError(err) {
+		data, _ := ioutil.ReadAll(f)
+		f.Close()
+
+		assert.Equal("second", string(data))
+	}
+
+	assert.NoError(s.Delete("abc-123"))
+	assert.NoError(s.Delete("abc-123"), "deleting a missing blob shouldn't fail")
+
+	_, err = s.Open("abc-123")
+	assert.True(os.IsNotExist(err))
+}
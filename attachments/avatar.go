@@ -0,0 +1,280 @@
+package attachments
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// AvatarSize is the width and height, in pixels, of the avatar shown beside posts on wide screens,
+// and SmallAvatarSize that of the avatar shown elsewhere. Each is twice the size it's displayed at,
+// so as to stay sharp on high-density screens.
+const (
+	AvatarSize      = 160
+	SmallAvatarSize = 80
+)
+
+// avatarFetchTimeout is how long FetchAvatar waits for an avatar to be downloaded.
+const avatarFetchTimeout = 15 * time.Second
+
+// avatarKey returns the key under which the avatar with `id` is kept, at its large size or, if
+// `small` is true, its small size.
+func avatarKey(id string, small bool) string {
+	if small {
+		return id + ".avatar-small"
+	}
+
+	return id + ".avatar"
+}
+
+// IsRemoteAvatar reports whether `id` is in fact the URL of an avatar on another host, as avatars
+// were given before they were uploaded, which has yet to be fetched. Avatar IDs never contain a
+// scheme, so anything that does is a URL.
+func IsRemoteAvatar(id string) bool {
+	return strings.Contains(id, "://")
+}
+
+// AvatarURL returns the path from which the avatar with `id` is served, or an empty string if `id`
+// is empty or the URL of an avatar yet to be fetched, which isn't served from other hosts.
+func AvatarURL(id string) string {
+	if id == "" || IsRemoteAvatar(id) {
+		return ""
+	}
+
+	return "/avatars/" + id
+}
+
+// SmallAvatarURL returns the path from which the small size of the avatar with `id` is served, or
+// an empty string if `id` is empty.
+func SmallAvatarURL(id string) string {
+	if id == "" || IsRemoteAvatar(id) {
+		return ""
+	}
+
+	return AvatarURL(id) + "/small"
+}
+
+// UploadAvatar makes an avatar of the image read from `r`, which must be a PNG, JPEG or GIF no
+// larger than MaxSize. The image is cropped to a square about its center, turned upright and kept
+// at both AvatarSize and SmallAvatarSize, with any metadata left behind. It returns the new
+// avatar's ID, which changes with each upload so that avatars can be cached for good.
+func UploadAvatar(r io.Reader) (string, error) {
+	if blobs == nil {
+		return "", errNoBlobStore
+	}
+
+	data, err := readAvatar(r)
+	if err != nil {
+		return "", err
+	}
+
+	src, mediaType, orientation, err := decodeAvatar(data)
+	if err != nil {
+		return "", err
+	}
+
+	return putAvatar(src, mediaType, orientation)
+}
+
+// readAvatar reads an avatar from `r`, up to one byte more than MaxSize, so that one too large can be
+// told apart.
+func readAvatar(r io.Reader) ([]byte, error) {
+	return ioutil.ReadAll(io.LimitReader(r, MaxSize()+1))
+}
+
+// decodeAvatar checks that `data` is a PNG, JPEG or GIF no larger than MaxSize, returning the image
+// cropped to a square about its center, its media type and its EXIF orientation.
+func decodeAvatar(data []byte) (image.Image, string, int, error) {
+	if len(data) == 0 {
+		return nil, "", 0, errors.New("attachments: avatar is empty")
+	}
+
+	if max := MaxSize(); int64(len(data)) > max {
+		return nil, "", 0, fmt.Errorf("attachments: avatar is larger than the limit of %d bytes", max)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil || (mediaType != "image/png" && mediaType != "image/jpeg" && mediaType != "image/gif") {
+		return nil, "", 0, errors.New("attachments: avatars must be PNG, JPEG or GIF images")
+	}
+
+	orientation := 1
+
+	switch mediaType {
+	case "image/jpeg":
+		data, orientation, err = stripJPEG(data)
+	case "image/png":
+		data, err = stripPNG(data)
+	}
+
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("attachments: couldn't read avatar: %s", err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("attachments: couldn't read avatar: %s", err)
+	}
+
+	if config.Width*config.Height > maxThumbnailPixels {
+		return nil, "", 0, errors.New("attachments: avatar has too many pixels")
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("attachments: couldn't read avatar: %s", err)
+	}
+
+	return cropSquare(src), mediaType, orientation, nil
+}
+
+// putAvatar keeps `src`, a square image of `mediaType`, at both AvatarSize and SmallAvatarSize,
+// turned upright from `orientation`, returning the new avatar's ID.
+func putAvatar(src image.Image, mediaType string, orientation int) (string, error) {
+	id := utility.GenerateUUID()
+
+	for _, small := range []bool{false, true} {
+		size := AvatarSize
+		if small {
+			size = SmallAvatarSize
+		}
+
+		// Cropping about the center commutes with turning the image, so it's turned only once it's
+		// been scaled down.
+		img := orient(scale(src, size), orientation)
+
+		var buf bytes.Buffer
+		var err error
+
+		// JPEGs stay JPEGs, while other images become PNGs so as to keep any transparency.
+		if mediaType == "image/jpeg" {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, img)
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if err := blobs.Put(avatarKey(id, small), &buf); err != nil {
+			DeleteAvatar(id)
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+// cropSquare returns the largest square of `src` about its center.
+func cropSquare(src image.Image) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w == h {
+		return src
+	}
+
+	sub, ok := src.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return src
+	}
+
+	if w > h {
+		x := b.Min.X + (w-h)/2
+		return sub.SubImage(image.Rect(x, b.Min.Y, x+h, b.Max.Y))
+	}
+
+	y := b.Min.Y + (h-w)/2
+	return sub.SubImage(image.Rect(b.Min.X, y, b.Max.X, y+w))
+}
+
+// UnusableAvatarError is returned by FetchAvatar when the host refuses the avatar with a 4xx
+// status, or sends something that can't be made an avatar, so that there's no use fetching it again.
+// Any other error, such as a timeout or a 5xx status, may well pass.
+type UnusableAvatarError struct {
+	URL    string
+	Reason string
+}
+
+func (e UnusableAvatarError) Error() string {
+	return fmt.Sprintf("attachments: avatar %q can't be used: %s", e.URL, e.Reason)
+}
+
+// FetchAvatar downloads the image at `url` and makes an avatar of it as UploadAvatar does,
+// returning the new avatar's ID. It's intended for moving avatars given as URLs to other hosts
+// into the blob store.
+func FetchAvatar(url string) (string, error) {
+	if blobs == nil {
+		return "", errNoBlobStore
+	}
+
+	client := http.Client{Timeout: avatarFetchTimeout}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return "", UnusableAvatarError{URL: url, Reason: resp.Status}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("attachments: fetching avatar %q: %s", url, resp.Status)
+	}
+
+	data, err := readAvatar(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	src, mediaType, orientation, err := decodeAvatar(data)
+	if err != nil {
+		return "", UnusableAvatarError{URL: url, Reason: err.Error()}
+	}
+
+	return putAvatar(src, mediaType, orientation)
+}
+
+// OpenAvatar returns the avatar with `id`, at its small size if `small` is true. The caller must
+// close it.
+func OpenAvatar(id string, small bool) (ReadSeekCloser, error) {
+	if blobs == nil {
+		return nil, errNoBlobStore
+	}
+
+	return blobs.Open(avatarKey(id, small))
+}
+
+// DeleteAvatar deletes both sizes of the avatar with `id`.
+func DeleteAvatar(id string) error {
+	if len(id) == 0 {
+		return errors.New("attachments: avatar ID cannot be empty")
+	}
+
+	if blobs == nil {
+		return errNoBlobStore
+	}
+
+	if err := blobs.Delete(avatarKey(id, false)); err != nil {
+		return err
+	}
+
+	return blobs.Delete(avatarKey(id, true))
+}
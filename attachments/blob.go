@@ -0,0 +1,200 @@
+package attachments
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ReadSeekCloser is the contents of a blob, as returned by a BlobStore.
+type ReadSeekCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// BlobStore is the interface through which the contents of attachments and their thumbnails are
+// read and written, each by a key. Keys are made only of letters, digits, `-` and `.`.
+type BlobStore interface {
+	// Put keeps the contents read from `r` under `key`, replacing any already kept there.
+	Put(key string, r io.Reader) error
+	// Open returns the contents kept under `key`, or an error satisfying os.IsNotExist if there are
+	// none.
+	Open(key string) (ReadSeekCloser, error)
+	// Delete removes the contents kept under `key`, doing nothing if there are none.
+	Delete(key string) error
+}
+
+// blobs is the BlobStore used by the package-level functions. There's none until one is set.
+var blobs BlobStore
+
+// errNoBlobStore is returned when attachments are read or written before a BlobStore is set.
+var errNoBlobStore = errors.New("attachments: no BlobStore set")
+
+// SetBlobStore replaces the BlobStore used by the package-level functions. It should be called
+// before the server starts handling requests.
+func SetBlobStore(b BlobStore) {
+	blobs = b
+}
+
+// checkKey returns an error if `key` isn't a valid blob key.
+func checkKey(key string) error {
+	valid := len(key) > 0 && key[0] != '.' && strings.IndexFunc(key, func(r rune) bool {
+		return !(r == '-' || r == '.' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'))
+	}) == -1
+
+	if !valid {
+		return fmt.Errorf("attachments: invalid blob key %q", key)
+	}
+
+	return nil
+}
+
+// localBlobStore is a BlobStore that keeps each blob as a file in a directory on the local
+// filesystem, under a subdirectory named for the first two characters of its key so that no one
+// directory grows too large.
+type localBlobStore struct {
+	dir string
+}
+
+// NewLocalBlobStore returns a BlobStore that keeps blobs under the directory `dir`, creating it if
+// need be.
+func NewLocalBlobStore(dir string) (BlobStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &localBlobStore{dir: dir}, nil
+}
+
+func (s *localBlobStore) path(key string) string {
+	prefix := key
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+
+	return filepath.Join(s.dir, prefix, key)
+}
+
+func (s *localBlobStore) Put(key string, r io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	p := s.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first and rename it into place, so that a blob is never seen
+	// half-written.
+	f, err := ioutil.TempFile(filepath.Dir(p), ".upload-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), p); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (s *localBlobStore) Open(key string) (ReadSeekCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+
+	return os.Open(s.path(key))
+}
+
+func (s *localBlobStore) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// memoryBlobStore is a BlobStore that keeps all blobs in process memory. Nothing is persisted, so
+// it's useful only for development and tests.
+type memoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewMemoryBlobStore returns an empty, in-memory BlobStore.
+func NewMemoryBlobStore() BlobStore {
+	return &memoryBlobStore{blobs: make(map[string][]byte)}
+}
+
+// memoryBlob is the contents of a blob kept in memory.
+type memoryBlob struct {
+	*bytes.Reader
+}
+
+func (memoryBlob) Close() error {
+	return nil
+}
+
+func (s *memoryBlobStore) Put(key string, r io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs[key] = data
+
+	return nil
+}
+
+func (s *memoryBlobStore) Open(key string) (ReadSeekCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: key, Err: os.ErrNotExist}
+	}
+
+	return memoryBlob{bytes.NewReader(data)}, nil
+}
+
+func (s *memoryBlobStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blobs, key)
+
+	return nil
+}
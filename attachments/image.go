@@ -0,0 +1,439 @@
+package attachments
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	// Registered so that image.Decode can read GIFs.
+	_ "image/gif"
+)
+
+// thumbnailSize is the most pixels wide or high a thumbnail is.
+const thumbnailSize = 320
+
+// maxThumbnailPixels is the largest image, in pixels, we'll decode to make a thumbnail, as decoding
+// takes memory in proportion to it. Larger images are kept without one.
+const maxThumbnailPixels = 25000000
+
+// processedImage is an uploaded image with its metadata stripped, and its size as displayed.
+// Thumbnail is nil if no thumbnail could be made.
+type processedImage struct {
+	Data      []byte
+	Width     int
+	Height    int
+	Thumbnail []byte
+}
+
+// processImage strips the metadata from image `data` of media type `mediaType`, and makes a
+// thumbnail of it if it's of a type we can decode. It errs if the image is malformed.
+func processImage(mediaType string, data []byte) (*processedImage, error) {
+	orientation := 1
+
+	var err error
+
+	switch mediaType {
+	case "image/jpeg":
+		data, orientation, err = stripJPEG(data)
+	case "image/png":
+		data, err = stripPNG(data)
+	case "image/webp":
+		// We can't decode WebP images, so they're kept without a size or a thumbnail.
+		data, err = stripWebP(data)
+		return &processedImage{Data: data}, err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	img := processedImage{Data: data, Width: config.Width, Height: config.Height}
+
+	// Orientations 5 to 8 turn the image on its side.
+	if orientation >= 5 {
+		img.Width, img.Height = img.Height, img.Width
+	}
+
+	if config.Width*config.Height > maxThumbnailPixels {
+		return &img, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnail := orient(scale(src, thumbnailSize), orientation)
+
+	var buf bytes.Buffer
+
+	if mediaType == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, thumbnail)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	img.Thumbnail = buf.Bytes()
+
+	return &img, nil
+}
+
+// scale returns `src` scaled down to fit within `size` pixels square, keeping its aspect ratio.
+// Each pixel is the average of up to 16 samples of the area of `src` it covers. Images already small
+// enough are copied at their own size.
+func scale(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if w > size || h > size {
+		if w >= h {
+			dw, dh = size, h*size/w
+		} else {
+			dw, dh = w*size/h, size
+		}
+	}
+
+	if dw < 1 {
+		dw = 1
+	}
+
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, (y+1)*h/dh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, (x+1)*w/dw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, bl, a, n uint32
+
+			for sy := 0; sy < 4 && sy < y1-y0; sy++ {
+				py := y0 + sy*(y1-y0)/min(4, y1-y0)
+
+				for sx := 0; sx < 4 && sx < x1-x0; sx++ {
+					px := x0 + sx*(x1-x0)/min(4, x1-x0)
+
+					pr, pg, pb, pa := src.At(b.Min.X+px, b.Min.Y+py).RGBA()
+					r, g, bl, a = r+pr, g+pg, bl+pb, a+pa
+					n++
+				}
+			}
+
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+
+	return dst
+}
+
+// orient returns `src` turned as given by EXIF orientation `orientation`, so that it's displayed
+// upright without the orientation.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // Mirrored along the top-left to bottom-right diagonal
+				sx, sy = y, x
+			case 6: // Needs turning 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // Mirrored along the top-right to bottom-left diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // Needs turning 90° counterclockwise
+				sx, sy = w-1-y, x
+			}
+
+			dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+
+	return dst
+}
+
+var errMalformed = errors.New("malformed image")
+
+// stripJPEG returns JPEG `data` without its EXIF, XMP, IPTC and comment segments, along with the
+// orientation given by its EXIF, if any. So that the image is still displayed upright, the
+// orientation is kept in a minimal EXIF segment of its own.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+
+	orientation := 1
+
+	// The orientation segment goes after the JFIF segment, if there is one, which must come first.
+	insertAt := len(out)
+
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, 0, errMalformed
+		}
+
+		// Markers may be preceded by any number of fill bytes.
+		for i < len(data) && data[i] == 0xFF {
+			i++
+		}
+
+		if i >= len(data) {
+			return nil, 0, errMalformed
+		}
+
+		marker := data[i]
+		start := i - 1
+		i++
+
+		if marker == 0xD9 { // End of image
+			out = append(out, 0xFF, marker)
+			break
+		}
+
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) { // Markers without a length
+			out = append(out, 0xFF, marker)
+			continue
+		}
+
+		if i+2 > len(data) {
+			return nil, 0, errMalformed
+		}
+
+		end := i + int(binary.BigEndian.Uint16(data[i:]))
+		if end > len(data) || end < i+2 {
+			return nil, 0, errMalformed
+		}
+
+		payload := data[i+2 : end]
+
+		switch {
+		case marker == 0xDA: // Start of scan, after which comes the compressed image
+			out = append(out, data[start:]...)
+			i = len(data)
+		case marker == 0xE1: // EXIF or XMP
+			if bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				if o := exifOrientation(payload[6:]); o != 0 {
+					orientation = o
+				}
+			}
+		case marker == 0xED || marker == 0xFE: // IPTC or a comment
+		default:
+			out = append(out, data[start:end]...)
+
+			if marker == 0xE0 && insertAt == 2 {
+				insertAt = len(out)
+			}
+		}
+
+		if marker != 0xDA {
+			i = end
+		}
+	}
+
+	if orientation > 1 {
+		segment := orientationSegment(orientation)
+
+		out = append(out[:insertAt], append(segment, out[insertAt:]...)...)
+	}
+
+	return out, orientation, nil
+}
+
+// exifOrientation returns the orientation given in the first IFD of EXIF data `tiff`, or zero if
+// there's none.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) || offset < 8 {
+		return 0
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+
+	for e := 0; e < count; e++ {
+		entry := offset + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+
+		// The orientation is tag 0x0112, a single SHORT.
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+
+			return 0
+		}
+	}
+
+	return 0
+}
+
+// orientationSegment returns a JPEG APP1 segment holding EXIF with nothing but `orientation`.
+func orientationSegment(orientation int) []byte {
+	exif := []byte{
+		'E', 'x', 'i', 'f', 0, 0,
+		// A big-endian TIFF header, with the first IFD at offset 8.
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		// An IFD of one entry: tag 0x0112, type SHORT, count 1, value.
+		0, 1,
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0,
+		// No next IFD.
+		0, 0, 0, 0,
+	}
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+
+	return append(segment, exif...)
+}
+
+// strippedPNGChunks are the PNG chunks holding metadata, which are left out of uploaded PNGs.
+var strippedPNGChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripPNG returns PNG `data` without its EXIF, text and time chunks.
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, signature...)
+
+	i := len(signature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+
+		// The chunk's length, type, data and CRC.
+		end := i + 12 + length
+		if length < 0 || end > len(data) || end < i {
+			return nil, errMalformed
+		}
+
+		if !strippedPNGChunks[kind] {
+			out = append(out, data[i:end]...)
+		}
+
+		i = end
+
+		if kind == "IEND" {
+			break
+		}
+	}
+
+	return out, nil
+}
+
+// stripWebP returns WebP `data` without its EXIF and XMP chunks.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+
+	i := 12
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+
+		kind := string(data[i : i+4])
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+
+		// Chunks are padded to an even length.
+		end := i + 8 + length + length%2
+		if length < 0 || end > len(data) || end < i {
+			return nil, errMalformed
+		}
+
+		switch kind {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+
+			// Clear the flags saying the image has EXIF and XMP metadata.
+			if length > 0 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+
+		i = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package attachments
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// memoryStore is a Store that keeps all attachments' metadata in process memory. Nothing is
+// persisted, so it's useful only for development and tests.
+type memoryStore struct {
+	mu          sync.RWMutex
+	attachments map[string]Attachment
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{attachments: make(map[string]Attachment)}
+}
+
+func (s *memoryStore) Insert(a *Attachment) error {
+	if a == nil {
+		return errors.New("attachments: cannot insert nil attachment")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.attachments[a.ID]; ok {
+		return fmt.Errorf("attachments: an attachment already has ID %q", a.ID)
+	}
+
+	s.attachments[a.ID] = *a
+
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (*Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.attachments[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &a, nil
+}
+
+func (s *memoryStore) GetMany(ids []string) ([]Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var as []Attachment
+	for _, id := range ids {
+		if a, ok := s.attachments[id]; ok {
+			as = append(as, a)
+		}
+	}
+
+	return as, nil
+}
+
+// byTime sorts attachments oldest first, breaking ties by ID.
+type byTime []Attachment
+
+func (as byTime) Len() int      { return len(as) }
+func (as byTime) Swap(i, j int) { as[i], as[j] = as[j], as[i] }
+func (as byTime) Less(i, j int) bool {
+	if as[i].Time.Equal(as[j].Time) {
+		return as[i].ID < as[j].ID
+	}
+
+	return as[i].Time.Before(as[j].Time)
+}
+
+func (s *memoryStore) All() ([]Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	as := make([]Attachment, 0, len(s.attachments))
+	for _, a := range s.attachments {
+		as = append(as, a)
+	}
+
+	sort.Sort(byTime(as))
+
+	return as, nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attachments, id)
+
+	return nil
+}
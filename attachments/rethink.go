@@ -0,0 +1,87 @@
+package attachments
+
+import (
+	"sort"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by the
+// `db.attachments_table` config value.
+type rethinkStore struct{}
+
+// getTable returns the table term for the attachments table.
+func getTable() rethink.Term {
+	return db.Get().Table(viper.GetString("db.attachments_table"))
+}
+
+func (rethinkStore) Insert(a *Attachment) error {
+	_, err := getTable().Insert(a).RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) Get(id string) (*Attachment, error) {
+	cursor, err := getTable().Get(id).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var a Attachment
+	if err := cursor.One(&a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (rethinkStore) all(t rethink.Term) ([]Attachment, error) {
+	cursor, err := t.Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var as []Attachment
+	if err := cursor.All(&as); err != nil {
+		return nil, err
+	}
+
+	return as, nil
+}
+
+func (s rethinkStore) GetMany(ids []string) ([]Attachment, error) {
+	keys := make([]interface{}, len(ids))
+	for i := range ids {
+		keys[i] = ids[i]
+	}
+
+	return s.all(getTable().GetAll(keys...))
+}
+
+func (s rethinkStore) All() ([]Attachment, error) {
+	// Ordering a whole table without an index is limited to 100,000 documents, so sort here instead.
+	as, err := s.all(getTable())
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(byTime(as))
+
+	return as, nil
+}
+
+func (rethinkStore) Delete(id string) error {
+	_, err := getTable().Get(id).Delete().RunWrite(db.Session)
+
+	return err
+}
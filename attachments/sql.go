@@ -0,0 +1,100 @@
+package attachments
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by the
+// `db.attachments_table` config value.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+func getTableName() string {
+	return viper.GetString("db.attachments_table")
+}
+
+const columns = "id, user_id, name, type, size, width, height, thumbnail, time"
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scan(row scanner) (*Attachment, error) {
+	var a Attachment
+
+	if err := row.Scan(&a.ID, &a.UserID, &a.Name, &a.Type, &a.Size, &a.Width, &a.Height, &a.Thumbnail, &a.Time); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *sqlStore) query(where string, args ...interface{}) ([]Attachment, error) {
+	rows, err := s.conn.Query("SELECT "+columns+" FROM "+getTableName()+where+" ORDER BY time, id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var as []Attachment
+	for rows.Next() {
+		a, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		as = append(as, *a)
+	}
+
+	return as, rows.Err()
+}
+
+func (s *sqlStore) Insert(a *Attachment) error {
+	q := "INSERT INTO " + getTableName() + " (" + columns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	_, err := s.conn.Exec(q, a.ID, a.UserID, a.Name, a.Type, a.Size, a.Width, a.Height, a.Thumbnail, a.Time.UTC())
+
+	return err
+}
+
+func (s *sqlStore) Get(id string) (*Attachment, error) {
+	a, err := scan(s.conn.QueryRow("SELECT "+columns+" FROM "+getTableName()+" WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return a, err
+}
+
+func (s *sqlStore) GetMany(ids []string) ([]Attachment, error) {
+	args := make([]interface{}, len(ids))
+	for i := range ids {
+		args[i] = ids[i]
+	}
+
+	params := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	return s.query(" WHERE id IN ("+params+")", args...)
+}
+
+func (s *sqlStore) All() ([]Attachment, error) {
+	return s.query("")
+}
+
+func (s *sqlStore) Delete(id string) error {
+	_, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE id = ?", id)
+
+	return err
+}
@@ -0,0 +1,26 @@
+package attachments
+
+// Store is the interface through which attachments' metadata is read and written. The
+// package-level functions validate their arguments and delegate to the current Store, so callers
+// need never know which backend is in use.
+type Store interface {
+	// Insert adds an attachment, erring if there's already one with the same ID.
+	Insert(a *Attachment) error
+	// Get returns the attachment with `id`, or nil if there's none.
+	Get(id string) (*Attachment, error)
+	// GetMany returns the attachments with any of `ids`, in no particular order.
+	GetMany(ids []string) ([]Attachment, error)
+	// All returns every attachment, oldest first.
+	All() ([]Attachment, error)
+	// Delete deletes the attachment with `id`, doing nothing if there's none.
+	Delete(id string) error
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/boatilus/peppercorn/attachments"
+	"github.com/boatilus/peppercorn/users"
+)
+
+// fetchAvatars moves any avatars still given as URLs to other hosts, as they were before avatars
+// were uploaded, into the blob store, so that readers' browsers never fetch them from elsewhere.
+// Until then, such an avatar isn't shown. An avatar its host refuses, or that can't be made an
+// avatar, is dropped, and its user can upload another. Any other failure, such as a timeout,
+// leaves the avatar to be fetched when this is next run.
+func fetchAvatars() error {
+	us, err := users.All()
+	if err != nil {
+		return err
+	}
+
+	var fetched, dropped, failed int
+
+	for i := range us {
+		u := &us[i]
+
+		if !attachments.IsRemoteAvatar(u.Avatar) {
+			continue
+		}
+
+		url := u.Avatar
+
+		id, err := attachments.FetchAvatar(url)
+		if err != nil {
+			if _, ok := err.(attachments.UnusableAvatarError); !ok {
+				log.Printf("Could not fetch avatar %q of user %q, so it's been left to try again: %s", url, u.Name, err)
+				failed++
+
+				continue
+			}
+
+			log.Printf("Could not use avatar %q of user %q, so it's been dropped: %s", url, u.Name, err)
+			dropped++
+		} else {
+			log.Printf("Fetched avatar %q of user %q", url, u.Name)
+			fetched++
+		}
+
+		u.Avatar = id
+
+		if err := users.Update(u); err != nil {
+			if id != "" {
+				attachments.DeleteAvatar(id)
+			}
+
+			return err
+		}
+	}
+
+	fmt.Printf("Fetched %d avatars, dropped %d and left %d to try again\n", fetched, dropped, failed)
+
+	return nil
+}
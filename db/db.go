@@ -13,13 +13,38 @@ var Session *rethink.Session
 // Opts defines our Rethink connection options
 var Opts rethink.ConnectOpts
 
-// Name is the hard-coded database name
-const Name = "peppercorn"
+// Name is the database name. Only the tests change it, so that each package's tests can have a
+// database to itself.
+var Name = "peppercorn"
 
 // CountType is the universal type to which we'll resolve any integral data in the DB.
 type CountType int32
 
-// Connect should be called on entry to the application
+// Driver names the default storage backend.
+const Driver = "rethinkdb"
+
+func init() {
+	viper.SetDefault("db.driver", Driver)
+	viper.SetDefault("db.users_table", "users")
+	viper.SetDefault("db.posts_table", "posts")
+	viper.SetDefault("db.sessions_table", "sessions")
+	viper.SetDefault("db.password_resets_table", "password_resets")
+	viper.SetDefault("db.counters_table", "counters")
+	viper.SetDefault("db.revisions_table", "revisions")
+	viper.SetDefault("db.references_table", "post_references")
+	viper.SetDefault("db.reactions_table", "reactions")
+	viper.SetDefault("db.notifications_table", "notifications")
+	viper.SetDefault("db.attachments_table", "attachments")
+	viper.SetDefault("db.post_attachments_table", "post_attachments")
+	viper.SetDefault("db.drafts_table", "drafts")
+	viper.SetDefault("db.moderation_log_table", "moderation_log")
+	viper.SetDefault("db.invites_table", "invites")
+	viper.SetDefault("db.email_changes_table", "email_changes")
+	viper.SetDefault("db.failed_attempts_table", "failed_attempts")
+}
+
+// Connect should be called on entry to the application. Tables and indices are left to the
+// migrations; see Up.
 func Connect() error {
 	// DB address will default to 28015
 	Opts = rethink.ConnectOpts{
@@ -44,8 +69,6 @@ func Connect() error {
 	res, _ := rethink.DBCreate(Name).RunWrite(Session)
 	log.Printf("%d database(s) created", res.DBsCreated)
 
-	createIndices()
-
 	return nil
 }
 
@@ -53,64 +76,3 @@ func Connect() error {
 func Get() rethink.Term {
 	return rethink.DB(Name)
 }
-
-func createIndices() {
-	db := rethink.DB(Name)
-
-	usersTable := viper.GetString("db.users_table")
-	postsTable := viper.GetString("db.posts_table")
-	sessionsTable := viper.GetString("db.sessions_table")
-	passwordResetTable := viper.GetString("db.password_resets_table")
-
-	res, _ := db.TableCreate(usersTable).RunWrite(Session)
-	if res.TablesCreated == 1 {
-		log.Printf("users table [%s] created", usersTable)
-	}
-
-	res, _ = db.TableCreate(postsTable).RunWrite(Session)
-	if res.TablesCreated == 1 {
-		log.Printf("posts table [%s] created", postsTable)
-	}
-
-	res, _ = db.TableCreate(sessionsTable).RunWrite(Session)
-	if res.TablesCreated == 1 {
-		log.Printf("sessions table [%s] created", sessionsTable)
-	}
-
-	res, _ = db.TableCreate(passwordResetTable).RunWrite(Session)
-	if res.TablesCreated == 1 {
-		log.Printf("password_resets table [%s] created", passwordResetTable)
-	}
-
-	createIndex(postsTable, "active")
-	createIndex(postsTable, "user_id")
-
-	// The `active_time` compound index can be used to sort active posts by date efficiently, as this
-	// can't be achieved in RethinkDB by indexed calls to both `getAll` and `orderBy`.
-	res, _ = rethink.DB(Name).Table(postsTable).IndexCreateFunc("active_time", func(row rethink.Term) interface{} {
-		return []interface{}{row.Field("active"), row.Field("time")}
-	}).RunWrite(Session)
-	if res.Created == 1 {
-		log.Printf("Created %q compound index on %q table", "active_time", postsTable)
-	}
-
-	db.Table(postsTable).IndexWait().RunWrite(Session)
-
-	createIndex(usersTable, "email")
-	createIndex(usersTable, "name")
-	db.Table(usersTable).IndexWait().RunWrite(Session)
-
-	createIndex(sessionsTable, "user_id")
-	createIndex(sessionsTable, "timestamp")
-	db.Table(sessionsTable).IndexWait().RunWrite(Session)
-
-	createIndex(passwordResetTable, "user_id")
-	db.Table(passwordResetTable).IndexWait().RunWrite(Session)
-}
-
-func createIndex(table string, field string) {
-	res, _ := rethink.DB(Name).Table(table).IndexCreate(field).RunWrite(Session)
-	if res.Created == 1 {
-		log.Printf("Created %q index on %q table", field, table)
-	}
-}
@@ -0,0 +1,89 @@
+// Package dbtest sets up the database a package's tests run against, as chosen by the environment.
+package dbtest
+
+import (
+	"os"
+
+	"github.com/boatilus/peppercorn/db"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// RethinkEnv names the environment variable holding the address of a RethinkDB server to test
+// against. Failing that, SQLDriverEnv and SQLDSNEnv name a SQL database to test against. If none
+// are set, the tests run against the in-memory stores.
+const (
+	RethinkEnv   = "PEPPERCORN_TEST_RETHINKDB"
+	SQLDriverEnv = "PEPPERCORN_TEST_SQL_DRIVER"
+	SQLDSNEnv    = "PEPPERCORN_TEST_SQL_DSN"
+)
+
+// Backend identifies the kind of database the tests run against.
+type Backend int
+
+const (
+	Memory Backend = iota
+	Rethink
+	SQL
+)
+
+// Setup connects to the database named by the environment and migrates it, returning the kind of
+// database it is and, if it's SQL, the connection. The migrations create the tables configured at
+// the time, so test tables should be configured first.
+//
+// RethinkDB tests get a new database of their own named after `pkg`, dropping any left by an
+// earlier run. As a SQL database can't be created portably, each of `tables` is emptied instead.
+//
+// Setup is meant to be called from a test package's init, so it panics on any error.
+func Setup(pkg string, tables ...string) (Backend, *db.SQL) {
+	if address := os.Getenv(RethinkEnv); address != "" {
+		setupRethink(address, pkg)
+
+		return Rethink, nil
+	}
+
+	if driver := os.Getenv(SQLDriverEnv); driver != "" {
+		return SQL, setupSQL(driver, os.Getenv(SQLDSNEnv), tables)
+	}
+
+	return Memory, nil
+}
+
+func setupRethink(address string, pkg string) {
+	var err error
+
+	if db.Session, err = rethink.Connect(rethink.ConnectOpts{Address: address}); err != nil {
+		panic(err)
+	}
+
+	db.Name = "peppercorn_test_" + pkg
+
+	// The database won't exist on the first run.
+	rethink.DBDrop(db.Name).RunWrite(db.Session)
+
+	if _, err := rethink.DBCreate(db.Name).RunWrite(db.Session); err != nil {
+		panic(err)
+	}
+
+	if _, err := db.Up(db.RethinkMigrator{}); err != nil {
+		panic(err)
+	}
+}
+
+func setupSQL(driver string, dsn string, tables []string) *db.SQL {
+	conn, err := db.ConnectSQL(driver, dsn)
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err := db.Up(db.NewSQLMigrator(conn)); err != nil {
+		panic(err)
+	}
+
+	for _, t := range tables {
+		if _, err := conn.Exec("DELETE FROM " + t); err != nil {
+			panic(err)
+		}
+	}
+
+	return conn
+}
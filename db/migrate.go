@@ -0,0 +1,335 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// MigrationsTable is the table recording which migrations have been applied to a database.
+const MigrationsTable = "schema_migrations"
+
+// Migration is a single, numbered change to the schema or data. Once released, a migration must
+// never change; further changes belong in a new migration appended to Migrations.
+type Migration struct {
+	Version     int
+	Description string
+	// Rethink applies the migration to RethinkDB.
+	Rethink func() error
+	// SQL applies the migration to SQLite or PostgreSQL. It runs within the same transaction that
+	// records the migration as applied.
+	SQL func(tx *Tx) error
+}
+
+// Migrator applies migrations to, and reports the migrations applied to, a single database.
+type Migrator interface {
+	// Applied returns the time at which each applied migration was applied, keyed by version.
+	Applied() (map[int]time.Time, error)
+	// Apply runs `m` and records it as applied.
+	Apply(m Migration) error
+}
+
+// MigrationStatus describes a migration and whether it's been applied.
+type MigrationStatus struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// AheadError is returned when a database has migrations applied that this build doesn't know
+// about, meaning it's been migrated by a newer version of peppercorn.
+type AheadError struct {
+	Version int
+	Latest  int
+}
+
+func (e AheadError) Error() string {
+	return fmt.Sprintf("db: database is at schema version %d, but this build only knows versions up to %d", e.Version, e.Latest)
+}
+
+func init() {
+	for i, m := range Migrations {
+		if m.Version != i+1 {
+			panic(fmt.Sprintf("db: migration %d is numbered %d", i+1, m.Version))
+		}
+	}
+}
+
+// Latest returns the version of the newest migration this build knows.
+func Latest() int {
+	return len(Migrations)
+}
+
+// Status returns the status of every migration, in order. Any applied migrations unknown to this
+// build are listed last, without a description.
+func Status(m Migrator) ([]MigrationStatus, error) {
+	applied, err := m.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	ss := make([]MigrationStatus, len(Migrations))
+	for i, mig := range Migrations {
+		at, ok := applied[mig.Version]
+
+		ss[i] = MigrationStatus{Version: mig.Version, Description: mig.Description, Applied: ok, AppliedAt: at}
+	}
+
+	var unknown []int
+	for v := range applied {
+		if v > Latest() {
+			unknown = append(unknown, v)
+		}
+	}
+
+	sort.Ints(unknown)
+
+	for _, v := range unknown {
+		ss = append(ss, MigrationStatus{Version: v, Applied: true, AppliedAt: applied[v]})
+	}
+
+	return ss, nil
+}
+
+// Up applies every pending migration in order, returning those it applied. It refuses to apply
+// anything, returning an AheadError, if the database is ahead of this build.
+func Up(m Migrator) ([]Migration, error) {
+	applied, err := m.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	if v := maxVersion(applied); v > Latest() {
+		return nil, AheadError{Version: v, Latest: Latest()}
+	}
+
+	var done []Migration
+
+	for _, mig := range Migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+
+		if err := m.Apply(mig); err != nil {
+			return done, fmt.Errorf("db: applying migration %d (%s): %s", mig.Version, mig.Description, err)
+		}
+
+		log.Printf("Applied migration %d: %s", mig.Version, mig.Description)
+
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+func maxVersion(applied map[int]time.Time) int {
+	max := 0
+	for v := range applied {
+		if v > max {
+			max = v
+		}
+	}
+
+	return max
+}
+
+// migrationRecord is the document or row recording an applied migration.
+type migrationRecord struct {
+	Version     int       `gorethink:"id"`
+	Description string    `gorethink:"description"`
+	AppliedAt   time.Time `gorethink:"applied_at"`
+}
+
+// RethinkMigrator is the Migrator for the RethinkDB database opened by Connect.
+type RethinkMigrator struct{}
+
+func (RethinkMigrator) Applied() (map[int]time.Time, error) {
+	if err := createTable(MigrationsTable); err != nil {
+		return nil, err
+	}
+
+	cursor, err := Get().Table(MigrationsTable).Run(Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	applied := make(map[int]time.Time)
+
+	var r migrationRecord
+	for cursor.Next(&r) {
+		applied[r.Version] = r.AppliedAt
+	}
+
+	return applied, cursor.Err()
+}
+
+func (RethinkMigrator) Apply(m Migration) error {
+	if m.Rethink != nil {
+		if err := m.Rethink(); err != nil {
+			return err
+		}
+	}
+
+	r := migrationRecord{Version: m.Version, Description: m.Description, AppliedAt: time.Now().UTC()}
+
+	_, err := Get().Table(MigrationsTable).Insert(r).RunWrite(Session)
+
+	return err
+}
+
+// createTable creates the table `name` in the peppercorn database, if it doesn't already exist.
+func createTable(name string) error {
+	cursor, err := Get().TableList().Contains(name).Run(Session)
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close()
+
+	var exists bool
+	if err := cursor.One(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	if _, err := Get().TableCreate(name).RunWrite(Session); err != nil {
+		return err
+	}
+
+	log.Printf("Created table [%s]", name)
+
+	return nil
+}
+
+// createIndex creates the index `name` on `table`, if it doesn't already exist. If `fn` is
+// non-nil, it computes the index's value for each row, and otherwise the index is on the field of
+// the same name. Any `opts` are passed on to RethinkDB.
+func createIndex(table string, name string, fn func(row rethink.Term) interface{}, opts ...rethink.IndexCreateOpts) error {
+	t := Get().Table(table)
+
+	cursor, err := t.IndexList().Contains(name).Run(Session)
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close()
+
+	var exists bool
+	if err := cursor.One(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	create := t.IndexCreate(name, opts...)
+	if fn != nil {
+		create = t.IndexCreateFunc(name, fn, opts...)
+	}
+
+	if _, err := create.RunWrite(Session); err != nil {
+		return err
+	}
+
+	log.Printf("Created %q index on %q table", name, table)
+
+	_, err = t.IndexWait().RunWrite(Session)
+
+	return err
+}
+
+// SQLMigrator is the Migrator for a SQLite or PostgreSQL database.
+type SQLMigrator struct {
+	conn *SQL
+}
+
+// NewSQLMigrator returns a Migrator for the database opened by `conn`.
+func NewSQLMigrator(conn *SQL) *SQLMigrator {
+	return &SQLMigrator{conn: conn}
+}
+
+func (s *SQLMigrator) Applied() (map[int]time.Time, error) {
+	_, err := s.conn.Exec(`CREATE TABLE IF NOT EXISTS ` + MigrationsTable + ` (
+		version     INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at  TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn.Query("SELECT version, applied_at FROM " + MigrationsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+
+	for rows.Next() {
+		var r migrationRecord
+		if err := rows.Scan(&r.Version, &r.AppliedAt); err != nil {
+			return nil, err
+		}
+
+		applied[r.Version] = r.AppliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (s *SQLMigrator) Apply(m Migration) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	if m.SQL != nil {
+		if err := m.SQL(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	q := "INSERT INTO " + MigrationsTable + " (version, description, applied_at) VALUES (?, ?, ?)"
+
+	if _, err := tx.Exec(q, m.Version, m.Description, time.Now().UTC()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Tx wraps a database/sql transaction, rebinding placeholders as SQL does.
+type Tx struct {
+	*sql.Tx
+	Driver string
+}
+
+// Exec rebinds `query` and executes it without returning any rows.
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(rebind(tx.Driver, query), args...)
+}
+
+// Query rebinds `query` and executes it, returning the resulting rows.
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(rebind(tx.Driver, query), args...)
+}
+
+// QueryRow rebinds `query` and executes it, returning at most one row.
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(rebind(tx.Driver, query), args...)
+}
@@ -0,0 +1,309 @@
+package db
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+}
+
+func newTestMigrator(t *testing.T) *SQLMigrator {
+	conn, err := ConnectSQL(SQLite, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLMigrator(conn)
+}
+
+func TestUp(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMigrator(t)
+	defer m.conn.Close()
+
+	done, err := Up(m)
+	assert.NoError(err)
+	assert.Len(done, Latest())
+
+	// Migration 1 should have created the posts table.
+	_, err = m.conn.Exec("SELECT COUNT(*) FROM posts")
+	assert.NoError(err)
+
+	// Nothing's left to apply the second time around.
+	done, err = Up(m)
+	assert.NoError(err)
+	assert.Empty(done)
+}
+
+func TestUp_ahead(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMigrator(t)
+	defer m.conn.Close()
+
+	_, err := Up(m)
+	assert.NoError(err)
+
+	// Record a migration from some future build.
+	_, err = m.conn.Exec("INSERT INTO "+MigrationsTable+" (version, description, applied_at) VALUES (?, ?, ?)", Latest()+1, "future", time.Now().UTC())
+	assert.NoError(err)
+
+	_, err = Up(m)
+	assert.Equal(AheadError{Version: Latest() + 1, Latest: Latest()}, err)
+}
+
+func TestStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMigrator(t)
+	defer m.conn.Close()
+
+	ss, err := Status(m)
+	assert.NoError(err)
+	assert.Len(ss, Latest())
+
+	for _, s := range ss {
+		assert.False(s.Applied)
+	}
+
+	_, err = Up(m)
+	assert.NoError(err)
+
+	_, err = m.conn.Exec("INSERT INTO "+MigrationsTable+" (version, description, applied_at) VALUES (?, ?, ?)", Latest()+1, "future", time.Now().UTC())
+	assert.NoError(err)
+
+	ss, err = Status(m)
+	assert.NoError(err)
+	assert.Len(ss, Latest()+1)
+
+	for _, s := range ss {
+		assert.True(s.Applied)
+	}
+
+	assert.Equal(Latest()+1, ss[len(ss)-1].Version)
+	assert.Empty(ss[len(ss)-1].Description)
+}
+
+func TestNumberPosts(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMigrator(t)
+	defer m.conn.Close()
+
+	// Applied creates the migrations table, which Apply expects.
+	_, err := m.Applied()
+	assert.NoError(err)
+
+	assert.NoError(m.Apply(Migrations[0]))
+
+	// Posts made at the same instant are numbered in order of ID.
+	now := time.Now().UTC()
+	posts := []struct {
+		id   string
+		time time.Time
+	}{
+		{"c", now},
+		{"a", now.Add(-time.Hour)},
+		{"b", now},
+	}
+
+	for _, p := range posts {
+		_, err := m.conn.Exec("INSERT INTO posts (id, active, user_id, content, time) VALUES (?, ?, ?, ?, ?)", p.id, true, "user", "content", p.time)
+		assert.NoError(err)
+	}
+
+	assert.NoError(m.Apply(Migrations[1]))
+
+	for id, want := range map[string]int{"a": 1, "b": 2, "c": 3} {
+		var n int
+		assert.NoError(m.conn.QueryRow("SELECT number FROM posts WHERE id = ?", id).Scan(&n))
+		assert.Equal(want, n, id)
+	}
+
+	var last int
+	assert.NoError(m.conn.QueryRow("SELECT value FROM counters WHERE name = ?", "posts").Scan(&last))
+	assert.Equal(3, last)
+}
+
+func TestUserActivity(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMigrator(t)
+	defer m.conn.Close()
+
+	_, err := m.Applied()
+	assert.NoError(err)
+
+	for _, mg := range Migrations[:12] {
+		if !assert.NoError(m.Apply(mg), "migration %d", mg.Version) {
+			return
+		}
+	}
+
+	for _, id := range []string{"poster", "lurker"} {
+		_, err := m.conn.Exec("INSERT INTO users (id, email, name, hash) VALUES (?, ?, ?, ?)", id, id+"@example.com", id, "hash")
+		assert.NoError(err)
+	}
+
+	// Users are taken to have joined when they first posted.
+	first := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, at := range []time.Time{first.Add(time.Hour), first} {
+		_, err := m.conn.Exec("INSERT INTO posts (id, active, number, user_id, content, time) VALUES (?, ?, ?, ?, ?, ?)", string('a'+rune(i)), true, i+1, "poster", "content", at)
+		assert.NoError(err)
+	}
+
+	assert.NoError(m.Apply(Migrations[12]))
+
+	var joined *time.Time
+	assert.NoError(m.conn.QueryRow("SELECT joined FROM users WHERE id = ?", "poster").Scan(&joined))
+	if assert.NotNil(joined) {
+		assert.True(first.Equal(*joined), "got %s", joined)
+	}
+
+	assert.NoError(m.conn.QueryRow("SELECT joined FROM users WHERE id = ?", "lurker").Scan(&joined))
+	assert.Nil(joined, "users who've never posted have no known join date")
+
+	var lastSeen *time.Time
+	assert.NoError(m.conn.QueryRow("SELECT last_seen FROM users WHERE id = ?", "poster").Scan(&lastSeen))
+	assert.Nil(lastSeen)
+}
+
+func TestBackfillReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMigrator(t)
+	defer m.conn.Close()
+
+	_, err := m.Applied()
+	assert.NoError(err)
+
+	for _, mg := range Migrations[:16] {
+		if !assert.NoError(m.Apply(mg), "migration %d", mg.Version) {
+			return
+		}
+	}
+
+	posts := []struct {
+		id      string
+		content string
+	}{
+		{"a", "first"},
+		{"b", ">>1 and >>3"},
+		{"c", "`>>1` isn't a reference, but >>2 and >>1 are"},
+	}
+
+	at := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, p := range posts {
+		_, err := m.conn.Exec("INSERT INTO posts (id, active, number, user_id, content, time) VALUES (?, ?, ?, ?, ?, ?)", p.id, true, i+1, "poster", p.content, at.Add(time.Duration(i)*time.Minute))
+		assert.NoError(err)
+	}
+
+	// Posts already given references keep them.
+	_, err = m.conn.Exec("INSERT INTO post_references (post_id, number) VALUES (?, ?)", "b", 1)
+	assert.NoError(err)
+
+	assert.NoError(m.Apply(Migrations[16]))
+
+	refs := make(map[string][]int)
+
+	rows, err := m.conn.Query("SELECT post_id, number FROM post_references ORDER BY post_id, number")
+	if !assert.NoError(err) {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var n int
+
+		assert.NoError(rows.Scan(&id, &n))
+		refs[id] = append(refs[id], n)
+	}
+
+	// Posts can only refer to earlier posts.
+	assert.Equal(map[string][]int{"b": {1}, "c": {1, 2}}, refs)
+}
+
+func TestRenumberPosts(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMigrator(t)
+	defer m.conn.Close()
+
+	_, err := m.Applied()
+	assert.NoError(err)
+
+	assert.NoError(m.Apply(Migrations[0]))
+
+	// Before migration 2, "b" had been removed, so "c" was shown, and quoted, as post 2.
+	posts := []struct {
+		id      string
+		active  bool
+		content string
+	}{
+		{"a", true, "first"},
+		{"b", false, "removed"},
+		{"c", true, ">>1 and >>2"},
+	}
+
+	at := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, p := range posts {
+		_, err := m.conn.Exec("INSERT INTO posts (id, active, user_id, content, time) VALUES (?, ?, ?, ?, ?)", p.id, p.active, "poster", p.content, at.Add(time.Duration(i)*time.Minute))
+		assert.NoError(err)
+	}
+
+	for _, mg := range Migrations[1:17] {
+		if !assert.NoError(m.Apply(mg), "migration %d", mg.Version) {
+			return
+		}
+	}
+
+	// A post made since migration 2 keeps the number it was given.
+	_, err = m.conn.Exec("INSERT INTO posts (id, active, number, user_id, content, time) VALUES (?, ?, ?, ?, ?, ?)", "d", true, 4, "poster", ">>2", time.Now().UTC().Add(time.Hour))
+	assert.NoError(err)
+
+	_, err = m.conn.Exec("INSERT INTO post_references (post_id, number) VALUES (?, ?)", "d", 2)
+	assert.NoError(err)
+
+	assert.NoError(m.Apply(Migrations[17]))
+
+	for id, want := range map[string]int{"a": 1, "c": 2, "b": 3, "d": 4} {
+		var n int
+		assert.NoError(m.conn.QueryRow("SELECT number FROM posts WHERE id = ?", id).Scan(&n))
+		assert.Equal(want, n, id)
+	}
+
+	var last int
+	assert.NoError(m.conn.QueryRow("SELECT value FROM counters WHERE name = ?", "posts").Scan(&last))
+	assert.Equal(3, last, "the counter is left as it was")
+
+	refs := make(map[string][]int)
+
+	rows, err := m.conn.Query("SELECT post_id, number FROM post_references ORDER BY post_id, number")
+	if !assert.NoError(err) {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var n int
+
+		assert.NoError(rows.Scan(&id, &n))
+		refs[id] = append(refs[id], n)
+	}
+
+	assert.Equal(map[string][]int{"c": {1}, "d": {2}}, refs)
+}
@@ -0,0 +1,1045 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boatilus/peppercorn/markdown"
+	"github.com/spf13/viper"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// Migrations lists every migration in order. Append new migrations to the end, numbered one past
+// the last.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create tables and indices",
+		Rethink:     createRethinkTables,
+		SQL:         createSQLTables,
+	},
+	{
+		Version:     2,
+		Description: "number posts",
+		Rethink:     numberRethinkPosts,
+		SQL:         numberSQLPosts,
+	},
+	{
+		Version:     3,
+		Description: "index active posts by time and ID",
+		Rethink:     indexRethinkPostsByTimeAndID,
+		// The SQL schema has had this index since migration 1.
+	},
+	{
+		Version:     4,
+		Description: "record post revisions",
+		Rethink:     createRethinkRevisions,
+		SQL:         createSQLRevisions,
+	},
+	{
+		Version:     5,
+		Description: "record post references",
+		Rethink:     indexRethinkPostReferences,
+		SQL:         createSQLReferences,
+	},
+	{
+		Version:     6,
+		Description: "record reactions to posts",
+		Rethink:     createRethinkReactions,
+		SQL:         createSQLReactions,
+	},
+	{
+		Version:     7,
+		Description: "record notifications",
+		Rethink:     createRethinkNotifications,
+		SQL:         createSQLNotifications,
+	},
+	{
+		Version:     8,
+		Description: "record attachments",
+		Rethink:     createRethinkAttachments,
+		SQL:         createSQLAttachments,
+	},
+	{
+		Version:     9,
+		Description: "record drafts",
+		Rethink:     createRethinkDrafts,
+		SQL:         createSQLDrafts,
+	},
+	{
+		Version:     10,
+		Description: "record moderation",
+		Rethink:     createRethinkModeration,
+		SQL:         createSQLModeration,
+	},
+	{
+		Version:     11,
+		Description: "record user suspensions",
+		// RethinkDB documents need no change, as a missing `is_suspended` field reads as false.
+		SQL: addSQLUserSuspensions,
+	},
+	{
+		Version:     12,
+		Description: "record invites",
+		Rethink:     createRethinkInvites,
+		SQL:         createSQLInvites,
+	},
+	{
+		Version:     13,
+		Description: "record when users joined and were last seen",
+		Rethink:     backfillRethinkUsersJoined,
+		SQL:         addSQLUserActivity,
+	},
+	{
+		Version:     14,
+		Description: "record email address changes",
+		Rethink:     createRethinkEmailChanges,
+		SQL:         createSQLEmailChanges,
+	},
+	{
+		Version:     15,
+		Description: "record failed sign-in, code and password reset attempts",
+		Rethink:     createRethinkFailedAttempts,
+		SQL:         createSQLFailedAttempts,
+	},
+	{
+		Version:     16,
+		Description: "index posts by attachment",
+		Rethink:     indexRethinkPostAttachments,
+		SQL:         indexSQLPostAttachments,
+	},
+	{
+		Version:     17,
+		Description: "record the references of earlier posts",
+		Rethink:     backfillRethinkReferences,
+		SQL:         backfillSQLReferences,
+	},
+	{
+		Version:     18,
+		Description: "renumber posts made before migration 2 by their offsets",
+		Rethink:     renumberRethinkPosts,
+		SQL:         renumberSQLPosts,
+	},
+}
+
+// tableKeys are the config values naming each of our tables.
+var tableKeys = []string{
+	"db.users_table",
+	"db.posts_table",
+	"db.sessions_table",
+	"db.password_resets_table",
+}
+
+// createRethinkTables is migration 1 for RethinkDB. As it predates the migrations, it tolerates
+// tables and indices that already exist.
+func createRethinkTables() error {
+	for _, key := range tableKeys {
+		if err := createTable(viper.GetString(key)); err != nil {
+			return err
+		}
+	}
+
+	postsTable := viper.GetString("db.posts_table")
+	usersTable := viper.GetString("db.users_table")
+	sessionsTable := viper.GetString("db.sessions_table")
+	passwordResetTable := viper.GetString("db.password_resets_table")
+
+	indices := []struct {
+		table string
+		name  string
+		fn    func(row rethink.Term) interface{}
+	}{
+		{postsTable, "active", nil},
+		{postsTable, "user_id", nil},
+		// The `active_time` compound index can be used to sort active posts by date efficiently, as
+		// this can't be achieved in RethinkDB by indexed calls to both `getAll` and `orderBy`.
+		{postsTable, "active_time", func(row rethink.Term) interface{} {
+			return []interface{}{row.Field("active"), row.Field("time")}
+		}},
+		{usersTable, "email", nil},
+		{usersTable, "name", nil},
+		{sessionsTable, "user_id", nil},
+		{sessionsTable, "timestamp", nil},
+		{passwordResetTable, "user_id", nil},
+	}
+
+	for _, i := range indices {
+		if err := createIndex(i.table, i.name, i.fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createSQLTables is migration 1 for SQLite and PostgreSQL. The types are limited to those the two
+// have in common. Each statement is a format string taking the configured table name.
+func createSQLTables(tx *Tx) error {
+	schema := map[string][]string{
+		"db.users_table": {
+			`CREATE TABLE IF NOT EXISTS %[1]s (
+				id              TEXT PRIMARY KEY,
+				avatar          TEXT NOT NULL DEFAULT '',
+				email           TEXT NOT NULL UNIQUE,
+				name            TEXT NOT NULL UNIQUE,
+				posts_per_page  INTEGER NOT NULL DEFAULT 10,
+				title           TEXT NOT NULL DEFAULT '',
+				timezone        TEXT NOT NULL DEFAULT '',
+				last_viewed     TEXT NOT NULL DEFAULT '',
+				hash            TEXT NOT NULL,
+				has_2fa_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+				auth_duration   INTEGER NOT NULL DEFAULT 0,
+				totp_secret     TEXT NOT NULL DEFAULT '',
+				recovery_codes  TEXT NOT NULL DEFAULT '',
+				is_admin        BOOLEAN NOT NULL DEFAULT FALSE
+			)`,
+		},
+		"db.posts_table": {
+			`CREATE TABLE IF NOT EXISTS %[1]s (
+				id      TEXT PRIMARY KEY,
+				active  BOOLEAN NOT NULL,
+				user_id TEXT NOT NULL,
+				content TEXT NOT NULL,
+				time    TIMESTAMP NOT NULL
+			)`,
+			// The equivalent of RethinkDB's `active_time` compound index, with the ID appended so that
+			// posts made at the same instant still have a stable order.
+			`CREATE INDEX IF NOT EXISTS %[1]s_active_time ON %[1]s (active, time, id)`,
+			`CREATE INDEX IF NOT EXISTS %[1]s_user_id ON %[1]s (user_id)`,
+		},
+		"db.sessions_table": {
+			`CREATE TABLE IF NOT EXISTS %[1]s (
+				id          TEXT PRIMARY KEY,
+				user_id     TEXT NOT NULL,
+				ip          TEXT NOT NULL DEFAULT '',
+				user_agent  TEXT NOT NULL DEFAULT '',
+				timestamp   TIMESTAMP NOT NULL,
+				mfa_expires TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS %[1]s_user_id ON %[1]s (user_id)`,
+			`CREATE INDEX IF NOT EXISTS %[1]s_timestamp ON %[1]s (timestamp)`,
+		},
+		"db.password_resets_table": {
+			`CREATE TABLE IF NOT EXISTS %[1]s (
+				id      TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				browser TEXT NOT NULL DEFAULT '',
+				os      TEXT NOT NULL DEFAULT '',
+				expires TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS %[1]s_user_id ON %[1]s (user_id)`,
+		},
+	}
+
+	for _, key := range tableKeys {
+		name := viper.GetString(key)
+
+		for _, stmt := range schema[key] {
+			if _, err := tx.Exec(fmt.Sprintf(stmt, name)); err != nil {
+				return fmt.Errorf("creating table %q: %s", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// numberRethinkPosts is migration 2 for RethinkDB. It numbers the existing posts in the order
+// they're displayed, records the last number allocated in the counters table and indexes the
+// numbers.
+func numberRethinkPosts() error {
+	postsTable := viper.GetString("db.posts_table")
+	countersTable := viper.GetString("db.counters_table")
+
+	if err := createTable(countersTable); err != nil {
+		return err
+	}
+
+	posts := Get().Table(postsTable)
+
+	cursor, err := posts.OrderBy("time", "id").Pluck("id").Run(Session)
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close()
+
+	var row struct {
+		ID string `gorethink:"id"`
+	}
+
+	n := 0
+	for cursor.Next(&row) {
+		n++
+
+		if _, err := posts.Get(row.ID).Update(map[string]interface{}{"number": n}).RunWrite(Session); err != nil {
+			return err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	// The counter's ID is the name of the table it numbers.
+	counter := map[string]interface{}{"id": postsTable, "value": n}
+
+	if _, err := Get().Table(countersTable).Insert(counter, rethink.InsertOpts{Conflict: "replace"}).RunWrite(Session); err != nil {
+		return err
+	}
+
+	if err := createIndex(postsTable, "number", nil); err != nil {
+		return err
+	}
+
+	// As with `active_time`, the `active_number` compound index lets us fetch a range of active posts
+	// by number efficiently.
+	return createIndex(postsTable, "active_number", func(row rethink.Term) interface{} {
+		return []interface{}{row.Field("active"), row.Field("number")}
+	})
+}
+
+// numberSQLPosts is migration 2 for SQLite and PostgreSQL. It numbers the existing posts in the
+// order they're displayed and records the last number allocated in the counters table.
+func numberSQLPosts(tx *Tx) error {
+	postsTable := viper.GetString("db.posts_table")
+	countersTable := viper.GetString("db.counters_table")
+
+	stmts := []string{
+		`ALTER TABLE %[1]s ADD COLUMN number INTEGER NOT NULL DEFAULT 0`,
+		`UPDATE %[1]s SET number = (
+			SELECT COUNT(*) FROM %[1]s q WHERE q.time < %[1]s.time OR (q.time = %[1]s.time AND q.id <= %[1]s.id)
+		)`,
+		`CREATE UNIQUE INDEX %[1]s_number ON %[1]s (number)`,
+		`CREATE INDEX %[1]s_active_number ON %[1]s (active, number)`,
+		`CREATE TABLE IF NOT EXISTS %[2]s (
+			name  TEXT PRIMARY KEY,
+			value INTEGER NOT NULL
+		)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, postsTable, countersTable)); err != nil {
+			return fmt.Errorf("numbering posts: %s", err)
+		}
+	}
+
+	// Each counter is named for the table it numbers.
+	if _, err := tx.Exec("INSERT INTO "+countersTable+" (name, value) VALUES (?, 0)", postsTable); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec("UPDATE "+countersTable+" SET value = (SELECT COALESCE(MAX(number), 0) FROM "+postsTable+") WHERE name = ?", postsTable)
+
+	return err
+}
+
+// indexRethinkPostsByTimeAndID is migration 3 for RethinkDB. The `active_time_id` compound index
+// orders active posts by time, then by ID, for paging through them by cursor.
+func indexRethinkPostsByTimeAndID() error {
+	return createIndex(viper.GetString("db.posts_table"), "active_time_id", func(row rethink.Term) interface{} {
+		return []interface{}{row.Field("active"), row.Field("time"), row.Field("id")}
+	})
+}
+
+// createRethinkRevisions is migration 4 for RethinkDB, creating the table of post revisions.
+func createRethinkRevisions() error {
+	revisionsTable := viper.GetString("db.revisions_table")
+
+	if err := createTable(revisionsTable); err != nil {
+		return err
+	}
+
+	return createIndex(revisionsTable, "post_id", nil)
+}
+
+// createSQLRevisions is migration 4 for SQLite and PostgreSQL, creating the table of post revisions
+// and recording when each post was last edited.
+func createSQLRevisions(tx *Tx) error {
+	stmts := []string{
+		`ALTER TABLE %[1]s ADD COLUMN edited_at TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS %[2]s (
+			id        TEXT PRIMARY KEY,
+			post_id   TEXT NOT NULL,
+			content   TEXT NOT NULL,
+			editor_id TEXT NOT NULL,
+			time      TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS %[2]s_post_id ON %[2]s (post_id, time)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.posts_table"), viper.GetString("db.revisions_table"))); err != nil {
+			return fmt.Errorf("creating revisions: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// indexRethinkPostReferences is migration 5 for RethinkDB. The `references` multi index finds the
+// posts referring to each post. Posts made before this migration aren't given references.
+func indexRethinkPostReferences() error {
+	return createIndex(viper.GetString("db.posts_table"), "references", nil, rethink.IndexCreateOpts{Multi: true})
+}
+
+// createSQLReferences is migration 5 for SQLite and PostgreSQL, creating the table recording which
+// posts each post refers to. As with RethinkDB, posts made before this migration have none.
+func createSQLReferences(tx *Tx) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+			post_id TEXT NOT NULL,
+			number  INTEGER NOT NULL,
+			PRIMARY KEY (post_id, number)
+		)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_number ON %[1]s (number)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.references_table"))); err != nil {
+			return fmt.Errorf("creating references: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// createRethinkReactions is migration 6 for RethinkDB, creating the table of reactions to posts.
+func createRethinkReactions() error {
+	reactionsTable := viper.GetString("db.reactions_table")
+
+	if err := createTable(reactionsTable); err != nil {
+		return err
+	}
+
+	return createIndex(reactionsTable, "post_id", nil)
+}
+
+// createSQLReactions is migration 6 for SQLite and PostgreSQL, creating the table of reactions to
+// posts.
+func createSQLReactions(tx *Tx) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+			id       TEXT PRIMARY KEY,
+			post_id  TEXT NOT NULL,
+			user_id  TEXT NOT NULL,
+			reaction TEXT NOT NULL,
+			time     TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_post_id ON %[1]s (post_id, time)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.reactions_table"))); err != nil {
+			return fmt.Errorf("creating reactions: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// createRethinkNotifications is migration 7 for RethinkDB, creating the table of notifications.
+func createRethinkNotifications() error {
+	notificationsTable := viper.GetString("db.notifications_table")
+
+	if err := createTable(notificationsTable); err != nil {
+		return err
+	}
+
+	return createIndex(notificationsTable, "user_id", nil)
+}
+
+// createSQLNotifications is migration 7 for SQLite and PostgreSQL, creating the table of
+// notifications.
+func createSQLNotifications(tx *Tx) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+			id       TEXT PRIMARY KEY,
+			user_id  TEXT NOT NULL,
+			actor_id TEXT NOT NULL,
+			post_id  TEXT NOT NULL,
+			number   INTEGER NOT NULL,
+			time     TIMESTAMP NOT NULL,
+			read     BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_user_id ON %[1]s (user_id, time)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.notifications_table"))); err != nil {
+			return fmt.Errorf("creating notifications: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// createRethinkAttachments is migration 8 for RethinkDB, creating the table of attachments. A post's
+// attachments are kept with the post.
+func createRethinkAttachments() error {
+	return createTable(viper.GetString("db.attachments_table"))
+}
+
+// createSQLAttachments is migration 8 for SQLite and PostgreSQL, creating the table of attachments
+// and that recording the attachments of each post, in order.
+func createSQLAttachments(tx *Tx) error {
+	schema := map[string][]string{
+		"db.attachments_table": {
+			`CREATE TABLE IF NOT EXISTS %[1]s (
+				id        TEXT PRIMARY KEY,
+				user_id   TEXT NOT NULL,
+				name      TEXT NOT NULL,
+				type      TEXT NOT NULL,
+				size      INTEGER NOT NULL,
+				width     INTEGER NOT NULL DEFAULT 0,
+				height    INTEGER NOT NULL DEFAULT 0,
+				thumbnail BOOLEAN NOT NULL DEFAULT FALSE,
+				time      TIMESTAMP NOT NULL
+			)`,
+		},
+		"db.post_attachments_table": {
+			`CREATE TABLE IF NOT EXISTS %[1]s (
+				post_id       TEXT NOT NULL,
+				position      INTEGER NOT NULL,
+				attachment_id TEXT NOT NULL,
+				PRIMARY KEY (post_id, position)
+			)`,
+		},
+	}
+
+	for _, key := range []string{"db.attachments_table", "db.post_attachments_table"} {
+		for _, stmt := range schema[key] {
+			if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString(key))); err != nil {
+				return fmt.Errorf("creating attachments: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// createRethinkDrafts is migration 9 for RethinkDB, creating the table of drafts. Each user has at
+// most one draft, kept under their ID.
+func createRethinkDrafts() error {
+	return createTable(viper.GetString("db.drafts_table"))
+}
+
+// createSQLDrafts is migration 9 for SQLite and PostgreSQL, creating the table of drafts.
+func createSQLDrafts(tx *Tx) error {
+	stmt := `CREATE TABLE IF NOT EXISTS %s (
+		user_id    TEXT PRIMARY KEY,
+		content    TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`
+
+	if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.drafts_table"))); err != nil {
+		return fmt.Errorf("creating drafts: %s", err)
+	}
+
+	return nil
+}
+
+// createRethinkModeration is migration 10 for RethinkDB. The `time_id` compound index orders all
+// posts, active or not, as `active_time_id` does active posts, so that admins can page through them
+// all. The moderation log is ordered by its `time` index, and looked up by post with `post_id`.
+func createRethinkModeration() error {
+	err := createIndex(viper.GetString("db.posts_table"), "time_id", func(row rethink.Term) interface{} {
+		return []interface{}{row.Field("time"), row.Field("id")}
+	})
+	if err != nil {
+		return err
+	}
+
+	logTable := viper.GetString("db.moderation_log_table")
+
+	if err := createTable(logTable); err != nil {
+		return err
+	}
+
+	if err := createIndex(logTable, "time", nil); err != nil {
+		return err
+	}
+
+	return createIndex(logTable, "post_id", nil)
+}
+
+// createSQLModeration is migration 10 for SQLite and PostgreSQL, indexing all posts by time and
+// creating the moderation log.
+func createSQLModeration(tx *Tx) error {
+	stmts := []string{
+		`CREATE INDEX IF NOT EXISTS %[1]s_time ON %[1]s (time, id)`,
+		`CREATE TABLE IF NOT EXISTS %[2]s (
+			id           TEXT PRIMARY KEY,
+			time         TIMESTAMP NOT NULL,
+			moderator_id TEXT NOT NULL,
+			action       TEXT NOT NULL,
+			post_id      TEXT NOT NULL,
+			number       INTEGER NOT NULL,
+			author_id    TEXT NOT NULL,
+			reason       TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS %[2]s_time ON %[2]s (time, id)`,
+		`CREATE INDEX IF NOT EXISTS %[2]s_post_id ON %[2]s (post_id)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.posts_table"), viper.GetString("db.moderation_log_table"))); err != nil {
+			return fmt.Errorf("creating moderation log: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// addSQLUserSuspensions is migration 11 for SQLite and PostgreSQL, adding the column recording
+// whether an admin has suspended each user.
+func addSQLUserSuspensions(tx *Tx) error {
+	stmt := `ALTER TABLE %s ADD COLUMN is_suspended BOOLEAN NOT NULL DEFAULT FALSE`
+
+	if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.users_table"))); err != nil {
+		return fmt.Errorf("adding user suspensions: %s", err)
+	}
+
+	return nil
+}
+
+// createRethinkInvites is migration 12 for RethinkDB, creating the table of invites, ordered by its
+// `created` index and looked up by who sent them with `inviter_id`.
+func createRethinkInvites() error {
+	table := viper.GetString("db.invites_table")
+
+	if err := createTable(table); err != nil {
+		return err
+	}
+
+	if err := createIndex(table, "created", nil); err != nil {
+		return err
+	}
+
+	return createIndex(table, "inviter_id", nil)
+}
+
+// createSQLInvites is migration 12 for SQLite and PostgreSQL, creating the table of invites.
+func createSQLInvites(tx *Tx) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+			id          TEXT PRIMARY KEY,
+			email       TEXT NOT NULL,
+			inviter_id  TEXT NOT NULL,
+			created     TIMESTAMP NOT NULL,
+			expires     TIMESTAMP NOT NULL,
+			redeemed_by TEXT NOT NULL DEFAULT '',
+			redeemed_at TIMESTAMP,
+			revoked_at  TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_created ON %[1]s (created)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_inviter_id ON %[1]s (inviter_id, created)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.invites_table"))); err != nil {
+			return fmt.Errorf("creating invites: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// backfillRethinkUsersJoined is migration 13 for RethinkDB. Users created from then on record when
+// they joined; for those created before, the time of their first post is the best we know.
+func backfillRethinkUsersJoined() error {
+	// Ordering a whole table without an index is limited to 100,000 documents, so the posts are
+	// read in no particular order, keeping the earliest by each user.
+	cursor, err := Get().Table(viper.GetString("db.posts_table")).Pluck("user_id", "time").Run(Session)
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close()
+
+	var row struct {
+		UserID string    `gorethink:"user_id"`
+		Time   time.Time `gorethink:"time"`
+	}
+
+	first := make(map[string]time.Time)
+	for cursor.Next(&row) {
+		if t, ok := first[row.UserID]; !ok || row.Time.Before(t) {
+			first[row.UserID] = row.Time
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	usersTable := Get().Table(viper.GetString("db.users_table"))
+
+	for id, t := range first {
+		data := rethink.Branch(rethink.Row.HasFields("joined"), map[string]interface{}{}, map[string]interface{}{"joined": t})
+
+		if _, err := usersTable.Get(id).Update(data).RunWrite(Session); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addSQLUserActivity is migration 13 for SQLite and PostgreSQL, adding the columns recording when
+// each user joined and was last seen. Users created before then are taken to have joined at the
+// time of their first post.
+func addSQLUserActivity(tx *Tx) error {
+	stmts := []string{
+		`ALTER TABLE %[1]s ADD COLUMN joined TIMESTAMP`,
+		`ALTER TABLE %[1]s ADD COLUMN last_seen TIMESTAMP`,
+		`UPDATE %[1]s SET joined = (SELECT MIN(p.time) FROM %[2]s p WHERE p.user_id = %[1]s.id)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.users_table"), viper.GetString("db.posts_table"))); err != nil {
+			return fmt.Errorf("adding user activity: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// createRethinkEmailChanges is migration 14 for RethinkDB, creating the table of email address
+// changes awaiting confirmation, looked up by whose they are with `user_id`.
+func createRethinkEmailChanges() error {
+	table := viper.GetString("db.email_changes_table")
+
+	if err := createTable(table); err != nil {
+		return err
+	}
+
+	return createIndex(table, "user_id", nil)
+}
+
+// createSQLEmailChanges is migration 14 for SQLite and PostgreSQL, creating the table of email
+// address changes awaiting confirmation.
+func createSQLEmailChanges(tx *Tx) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+			id      TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			email   TEXT NOT NULL,
+			created TIMESTAMP NOT NULL,
+			expires TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_user_id ON %[1]s (user_id)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.email_changes_table"))); err != nil {
+			return fmt.Errorf("creating email changes: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// createRethinkFailedAttempts is migration 15 for RethinkDB, creating the table of failed attempts.
+// They're counted by account and by address through the `action_account_created` and
+// `action_ip_created` compound indices, and listed and pruned through `created`.
+func createRethinkFailedAttempts() error {
+	table := viper.GetString("db.failed_attempts_table")
+
+	if err := createTable(table); err != nil {
+		return err
+	}
+
+	for _, field := range []string{"account", "ip"} {
+		field := field
+
+		err := createIndex(table, "action_"+field+"_created", func(row rethink.Term) interface{} {
+			return []interface{}{row.Field("action"), row.Field(field), row.Field("created")}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return createIndex(table, "created", nil)
+}
+
+// createSQLFailedAttempts is migration 15 for SQLite and PostgreSQL, creating the table of failed
+// attempts.
+func createSQLFailedAttempts(tx *Tx) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+			id              TEXT PRIMARY KEY,
+			action          TEXT NOT NULL,
+			account         TEXT NOT NULL,
+			ip              TEXT NOT NULL,
+			created         TIMESTAMP NOT NULL,
+			account_cleared BOOLEAN NOT NULL DEFAULT FALSE,
+			ip_cleared      BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_action_account ON %[1]s (action, account, created)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_action_ip ON %[1]s (action, ip, created)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_created ON %[1]s (created)`,
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(fmt.Sprintf(stmt, viper.GetString("db.failed_attempts_table"))); err != nil {
+			return fmt.Errorf("creating failed attempts: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// indexRethinkPostAttachments is migration 16 for RethinkDB. The `attachments` multi index finds the
+// posts each attachment is attached to, so that purging a post leaves those of its attachments that
+// another post shares.
+func indexRethinkPostAttachments() error {
+	return createIndex(viper.GetString("db.posts_table"), "attachments", nil, rethink.IndexCreateOpts{Multi: true})
+}
+
+// indexSQLPostAttachments is migration 16 for SQLite and PostgreSQL, indexing the attachments of
+// each post by attachment.
+func indexSQLPostAttachments(tx *Tx) error {
+	table := viper.GetString("db.post_attachments_table")
+
+	if _, err := tx.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_attachment_id ON %[1]s (attachment_id)`, table)); err != nil {
+		return fmt.Errorf("indexing post attachments: %s", err)
+	}
+
+	return nil
+}
+
+// earlierReferences returns the numbers of the posts referred to in `content`, the content of the
+// post numbered `number`, in ascending order, leaving out any not before it as posts do.
+func earlierReferences(content string, number CountType) []CountType {
+	var ns []CountType
+
+	for _, n := range markdown.References(content) {
+		if CountType(n) < number {
+			ns = append(ns, CountType(n))
+		}
+	}
+
+	sort.Slice(ns, func(i, j int) bool { return ns[i] < ns[j] })
+
+	return ns
+}
+
+// backfillRethinkReferences is migration 17 for RethinkDB. Migration 5 recorded references only as
+// posts were submitted or edited, so this records those of the posts before it. A post's references
+// depend only on its content and number, so any post without them is given them.
+func backfillRethinkReferences() error {
+	posts := Get().Table(viper.GetString("db.posts_table"))
+
+	cursor, err := posts.Filter(rethink.Row.HasFields("references").Not()).Pluck("id", "number", "content").Run(Session)
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close()
+
+	var row struct {
+		ID      string    `gorethink:"id"`
+		Number  CountType `gorethink:"number"`
+		Content string    `gorethink:"content"`
+	}
+
+	for cursor.Next(&row) {
+		refs := earlierReferences(row.Content, row.Number)
+		if len(refs) == 0 {
+			continue
+		}
+
+		if _, err := posts.Get(row.ID).Update(map[string]interface{}{"references": refs}).RunWrite(Session); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// backfillSQLReferences is migration 17 for SQLite and PostgreSQL, recording the references of the
+// posts made before migration 5, as for RethinkDB.
+func backfillSQLReferences(tx *Tx) error {
+	postsTable := viper.GetString("db.posts_table")
+	referencesTable := viper.GetString("db.references_table")
+
+	rows, err := tx.Query(fmt.Sprintf(`SELECT id, number, content FROM %[1]s p
+		WHERE NOT EXISTS (SELECT 1 FROM %[2]s r WHERE r.post_id = p.id)`, postsTable, referencesTable))
+	if err != nil {
+		return fmt.Errorf("recording references: %s", err)
+	}
+
+	// Only the references are kept, rather than every post's content, and they're inserted once
+	// the rows are read, as not every driver can run a statement while another's rows are open.
+	refs := make(map[string][]CountType)
+
+	for rows.Next() {
+		var id, content string
+		var number CountType
+
+		if err := rows.Scan(&id, &number, &content); err != nil {
+			rows.Close()
+			return err
+		}
+
+		if ns := earlierReferences(content, number); len(ns) > 0 {
+			refs[id] = ns
+		}
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	q := "INSERT INTO " + referencesTable + " (post_id, number) VALUES (?, ?)"
+
+	for id, ns := range refs {
+		for _, n := range ns {
+			if _, err := tx.Exec(q, id, n); err != nil {
+				return fmt.Errorf("recording references of post %q: %s", id, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// numberedPost is a post made before migration 2, as renumbered by migration 18.
+type numberedPost struct {
+	ID      string `gorethink:"id"`
+	Active  bool   `gorethink:"active"`
+	Content string `gorethink:"content"`
+}
+
+// offsetNumbers returns the number of each of `ps`, which are in order of time, then ID. Active
+// posts are numbered from 1, so that each has the number its offset gave it, and inactive posts
+// after them, so that the numbers are those migration 2 gave out.
+func offsetNumbers(ps []numberedPost) map[string]CountType {
+	numbers := make(map[string]CountType, len(ps))
+
+	n := CountType(0)
+	for _, active := range []bool{true, false} {
+		for _, p := range ps {
+			if p.Active == active {
+				n++
+				numbers[p.ID] = n
+			}
+		}
+	}
+
+	return numbers
+}
+
+// renumberRethinkPosts is migration 18 for RethinkDB. Migration 2 numbered the posts before it by
+// time, deactivated or not, while links and quotes to them gave their offsets among active posts,
+// so this gives them the numbers from offsetNumbers. Later posts and the counter are unaffected,
+// and the references of the renumbered posts are recorded again, as which are earlier may differ.
+func renumberRethinkPosts() error {
+	applied, err := RethinkMigrator{}.Applied()
+	if err != nil {
+		return err
+	}
+
+	posts := Get().Table(viper.GetString("db.posts_table"))
+
+	// The `time_id` index, from migration 10, orders the posts, as ordering a whole table without an
+	// index is limited to 100,000 documents.
+	t := posts.Between(rethink.MinVal, []interface{}{applied[2], rethink.MinVal}, rethink.BetweenOpts{Index: "time_id"})
+
+	cursor, err := t.OrderBy(rethink.OrderByOpts{Index: rethink.Asc("time_id")}).Pluck("id", "active", "content").Run(Session)
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close()
+
+	var ps []numberedPost
+	if err := cursor.All(&ps); err != nil {
+		return err
+	}
+
+	numbers := offsetNumbers(ps)
+
+	for _, p := range ps {
+		n := numbers[p.ID]
+
+		// An empty list, rather than null, for a post with no earlier references.
+		refs := earlierReferences(p.Content, n)
+		if refs == nil {
+			refs = []CountType{}
+		}
+
+		if _, err := posts.Get(p.ID).Update(map[string]interface{}{"number": n, "references": refs}).RunWrite(Session); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renumberSQLPosts is migration 18 for SQLite and PostgreSQL, renumbering the posts made before
+// migration 2 as for RethinkDB.
+func renumberSQLPosts(tx *Tx) error {
+	postsTable := viper.GetString("db.posts_table")
+	referencesTable := viper.GetString("db.references_table")
+
+	var numberedAt time.Time
+	if err := tx.QueryRow("SELECT applied_at FROM "+MigrationsTable+" WHERE version = ?", 2).Scan(&numberedAt); err != nil {
+		return fmt.Errorf("renumbering posts: %s", err)
+	}
+
+	rows, err := tx.Query("SELECT id, active, content FROM "+postsTable+" WHERE time < ? ORDER BY time, id", numberedAt)
+	if err != nil {
+		return fmt.Errorf("renumbering posts: %s", err)
+	}
+
+	var ps []numberedPost
+
+	for rows.Next() {
+		var p numberedPost
+		if err := rows.Scan(&p.ID, &p.Active, &p.Content); err != nil {
+			rows.Close()
+			return err
+		}
+
+		ps = append(ps, p)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The numbers are first moved out of the way, as each must stay unique as they're shared out.
+	if _, err := tx.Exec("UPDATE "+postsTable+" SET number = -number WHERE time < ?", numberedAt); err != nil {
+		return fmt.Errorf("renumbering posts: %s", err)
+	}
+
+	numbers := offsetNumbers(ps)
+
+	for _, p := range ps {
+		n := numbers[p.ID]
+
+		if _, err := tx.Exec("UPDATE "+postsTable+" SET number = ? WHERE id = ?", n, p.ID); err != nil {
+			return fmt.Errorf("renumbering post %q: %s", p.ID, err)
+		}
+
+		if _, err := tx.Exec("DELETE FROM "+referencesTable+" WHERE post_id = ?", p.ID); err != nil {
+			return fmt.Errorf("recording references of post %q: %s", p.ID, err)
+		}
+
+		for _, ref := range earlierReferences(p.Content, n) {
+			if _, err := tx.Exec("INSERT INTO "+referencesTable+" (post_id, number) VALUES (?, ?)", p.ID, ref); err != nil {
+				return fmt.Errorf("recording references of post %q: %s", p.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"strconv"
+
+	// Register the drivers we support with database/sql.
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Names of the SQL drivers we support, as registered with database/sql.
+const (
+	SQLite   = "sqlite3"
+	Postgres = "postgres"
+)
+
+// SQL wraps a database/sql connection pool with the name of its driver. All our SQL is written
+// with `?` placeholders, which SQL's query methods rebind to `$1`, `$2`, ... for PostgreSQL.
+type SQL struct {
+	*sql.DB
+	Driver string
+}
+
+// ConnectSQL opens a connection pool for the named driver and data source. The schema is left to
+// the migrations; see Up.
+func ConnectSQL(driverName string, dsn string) (*SQL, error) {
+	pool, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows only a single writer at a time, and each connection to an in-memory database
+	// gets its own database, so we'll keep to one connection.
+	if driverName == SQLite {
+		pool.SetMaxOpenConns(1)
+	}
+
+	if err := pool.Ping(); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &SQL{DB: pool, Driver: driverName}, nil
+}
+
+// Rebind rewrites the `?` placeholders in `query` to the form the driver expects.
+func (s *SQL) Rebind(query string) string {
+	return rebind(s.Driver, query)
+}
+
+func rebind(driverName string, query string) string {
+	if driverName != Postgres {
+		return query
+	}
+
+	var buf bytes.Buffer
+	n := 0
+
+	for _, r := range query {
+		if r != '?' {
+			buf.WriteRune(r)
+			continue
+		}
+
+		n++
+		buf.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return buf.String()
+}
+
+// Begin starts a transaction whose queries are rebound as SQL's are.
+func (s *SQL) Begin() (*Tx, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, Driver: s.Driver}, nil
+}
+
+// Exec rebinds `query` and executes it without returning any rows.
+func (s *SQL) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.DB.Exec(s.Rebind(query), args...)
+}
+
+// Query rebinds `query` and executes it, returning the resulting rows.
+func (s *SQL) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.DB.Query(s.Rebind(query), args...)
+}
+
+// QueryRow rebinds `query` and executes it, returning at most one row.
+func (s *SQL) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.DB.QueryRow(s.Rebind(query), args...)
+}
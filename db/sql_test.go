@@ -0,0 +1,17 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebind(t *testing.T) {
+	const q = "SELECT * FROM posts WHERE active = ? AND time < ? LIMIT ?"
+
+	sqlite := &SQL{Driver: SQLite}
+	assert.Equal(t, q, sqlite.Rebind(q))
+
+	postgres := &SQL{Driver: Postgres}
+	assert.Equal(t, "SELECT * FROM posts WHERE active = $1 AND time < $2 LIMIT $3", postgres.Rebind(q))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+
+	"github.com/boatilus/peppercorn/attachments"
+	"github.com/boatilus/peppercorn/drafts"
+	"github.com/boatilus/peppercorn/emailchange"
+	"github.com/boatilus/peppercorn/invites"
+	"github.com/boatilus/peppercorn/moderation"
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/pwreset"
+	"github.com/boatilus/peppercorn/reactions"
+	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/throttle"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/spf13/viper"
+)
+
+// Defaults for the user we create in `--dev` mode, unless overridden by the `dev.*` config values.
+const (
+	defaultDevEmail    = "dev@localhost"
+	defaultDevName     = "dev"
+	defaultDevPassword = "password"
+)
+
+// useMemoryStores swaps every package's store for an in-memory one and creates an admin user to
+// sign in with, as there's otherwise no way to get into an empty forum.
+func useMemoryStores() error {
+	posts.SetStore(posts.NewMemoryStore())
+	users.SetStore(users.NewMemoryStore())
+	session.SetStore(session.NewMemoryStore())
+	pwreset.SetStore(pwreset.NewMemoryStore())
+	reactions.SetStore(reactions.NewMemoryStore())
+	notifications.SetStore(notifications.NewMemoryStore())
+	attachments.SetStore(attachments.NewMemoryStore())
+	attachments.SetBlobStore(attachments.NewMemoryBlobStore())
+	drafts.SetStore(drafts.NewMemoryStore())
+	moderation.SetStore(moderation.NewMemoryStore())
+	invites.SetStore(invites.NewMemoryStore())
+	emailchange.SetStore(emailchange.NewMemoryStore())
+	throttle.SetStore(throttle.NewMemoryStore())
+
+	viper.SetDefault("dev.email", defaultDevEmail)
+	viper.SetDefault("dev.name", defaultDevName)
+	viper.SetDefault("dev.password", defaultDevPassword)
+
+	email := viper.GetString("dev.email")
+	password := viper.GetString("dev.password")
+
+	u, err := users.New(users.UserOpts{
+		Email:   email,
+		Name:    viper.GetString("dev.name"),
+		IsAdmin: true,
+	}, password)
+	if err != nil {
+		return err
+	}
+
+	if err := users.Create(u); err != nil {
+		return err
+	}
+
+	log.Printf("dev: using in-memory storage; sign in as %q with password %q", email, password)
+
+	return nil
+}
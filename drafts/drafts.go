@@ -0,0 +1,78 @@
+// Package drafts keeps the reply each user is writing but hasn't yet submitted, so that it survives
+// a closed tab or a switch to another device. Each user has at most one draft.
+package drafts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Draft is the content of a user's reply box as last saved.
+type Draft struct {
+	// UserID is the ID of the user whose draft this is, and so is also the draft's own ID.
+	UserID    string    `gorethink:"id"`
+	Content   string    `gorethink:"content"`
+	UpdatedAt time.Time `gorethink:"updated_at"`
+}
+
+// MaxLength is the longest draft, in bytes, that can be saved.
+const MaxLength = 1 << 16
+
+// Get returns the draft of the user with `userID`, or nil if they have none.
+func Get(userID string) (*Draft, error) {
+	if len(userID) == 0 {
+		return nil, errors.New("drafts: user ID cannot be empty")
+	}
+
+	return store.Get(userID)
+}
+
+// Save replaces the draft of the user with `userID` with `content`, returning the draft as saved.
+// Saving a draft of nothing but whitespace deletes it instead, and returns nil.
+func Save(userID string, content string) (*Draft, error) {
+	if len(userID) == 0 {
+		return nil, errors.New("drafts: user ID cannot be empty")
+	}
+
+	if len(content) > MaxLength {
+		return nil, fmt.Errorf("drafts: draft is longer than the limit of %d bytes", MaxLength)
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return nil, store.Delete(userID)
+	}
+
+	d := Draft{UserID: userID, Content: content, UpdatedAt: time.Now().UTC()}
+
+	if err := store.Put(&d); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// Delete deletes the draft of the user with `userID`. Deleting a draft they don't have does nothing.
+func Delete(userID string) error {
+	if len(userID) == 0 {
+		return errors.New("drafts: user ID cannot be empty")
+	}
+
+	return store.Delete(userID)
+}
+
+// All returns every user's draft, in order of user ID.
+func All() ([]Draft, error) {
+	return store.All()
+}
+
+// Restore saves a draft exactly as given, keeping the time it was last saved. It's intended for
+// restoring drafts from an archive.
+func Restore(d *Draft) error {
+	if d == nil || d.UserID == "" || strings.TrimSpace(d.Content) == "" || len(d.Content) > MaxLength {
+		return errors.New("drafts: invalid Draft supplied")
+	}
+
+	return store.Put(d)
+}
@@ -0,0 +1,104 @@
+package drafts
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/db/dbtest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableName = "drafts_test"
+
+func init() {
+	viper.Set("db.drafts_table", tableName)
+
+	switch backend, conn := dbtest.Setup("drafts", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
+	}
+}
+
+func TestSave(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Save("", "content")
+	assert.Error(err)
+
+	_, err = Save("user", strings.Repeat("a", MaxLength+1))
+	assert.Error(err, "drafts longer than the limit should be refused")
+
+	first, err := Save("user", "first")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	// Saving again replaces the draft, as each user has only one.
+	second, err := Save("user", "second")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.True(second.UpdatedAt.After(first.UpdatedAt))
+
+	got, err := Get("user")
+	if assert.NoError(err) && assert.NotNil(got) {
+		assert.Equal("user", got.UserID)
+		assert.Equal("second", got.Content)
+		assert.True(second.UpdatedAt.Equal(got.UpdatedAt))
+	}
+
+	// Saving a blank draft deletes it.
+	d, err := Save("user", " \n\t")
+	assert.NoError(err)
+	assert.Nil(d)
+
+	got, err = Get("user")
+	assert.NoError(err)
+	assert.Nil(got)
+}
+
+func TestGet(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Get("")
+	assert.Error(err)
+
+	got, err := Get("nobody")
+	assert.NoError(err)
+	assert.Nil(got)
+
+	_, err = Save("get-a", "a's draft")
+	assert.NoError(err)
+	_, err = Save("get-b", "b's draft")
+	assert.NoError(err)
+
+	got, err = Get("get-a")
+	if assert.NoError(err) && assert.NotNil(got) {
+		assert.Equal("a's draft", got.Content)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(Delete(""))
+
+	_, err := Save("delete", "draft")
+	assert.NoError(err)
+
+	assert.NoError(Delete("delete"))
+	assert.NoError(Delete("delete"), "deleting a missing draft shouldn't fail")
+
+	got, err := Get("delete")
+	assert.NoError(err)
+	assert.Nil(got)
+}
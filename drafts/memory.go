@@ -0,0 +1,67 @@
+package drafts
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// memoryStore is a Store that keeps all drafts in process memory. Nothing is persisted, so it's
+// useful only for development and tests.
+type memoryStore struct {
+	mu     sync.RWMutex
+	drafts map[string]Draft
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{drafts: make(map[string]Draft)}
+}
+
+func (s *memoryStore) Get(userID string) (*Draft, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.drafts[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	return &d, nil
+}
+
+func (s *memoryStore) Put(d *Draft) error {
+	if d == nil {
+		return errors.New("drafts: cannot put nil draft")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.drafts[d.UserID] = *d
+
+	return nil
+}
+
+func (s *memoryStore) Delete(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.drafts, userID)
+
+	return nil
+}
+
+func (s *memoryStore) All() ([]Draft, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ds := make([]Draft, 0, len(s.drafts))
+	for _, d := range s.drafts {
+		ds = append(ds, d)
+	}
+
+	sort.Slice(ds, func(i, j int) bool { return ds[i].UserID < ds[j].UserID })
+
+	return ds, nil
+}
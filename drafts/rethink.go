@@ -0,0 +1,64 @@
+package drafts
+
+import (
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by the
+// `db.drafts_table` config value.
+type rethinkStore struct{}
+
+// getTable returns the table term for the drafts table.
+func getTable() rethink.Term {
+	return db.Get().Table(viper.GetString("db.drafts_table"))
+}
+
+func (rethinkStore) Get(userID string) (*Draft, error) {
+	cursor, err := getTable().Get(userID).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var d Draft
+	if err := cursor.One(&d); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func (rethinkStore) Put(d *Draft) error {
+	_, err := getTable().Insert(d, rethink.InsertOpts{Conflict: "replace"}).RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) Delete(userID string) error {
+	_, err := getTable().Get(userID).Delete().RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) All() ([]Draft, error) {
+	cursor, err := getTable().OrderBy(rethink.OrderByOpts{Index: "id"}).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var ds []Draft
+	if err := cursor.All(&ds); err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
@@ -0,0 +1,77 @@
+package drafts
+
+import (
+	"database/sql"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by the
+// `db.drafts_table` config value.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+func getTableName() string {
+	return viper.GetString("db.drafts_table")
+}
+
+func (s *sqlStore) Get(userID string) (*Draft, error) {
+	q := "SELECT user_id, content, updated_at FROM " + getTableName() + " WHERE user_id = ?"
+
+	var d Draft
+
+	err := s.conn.QueryRow(q, userID).Scan(&d.UserID, &d.Content, &d.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func (s *sqlStore) Put(d *Draft) error {
+	// Both SQLite and PostgreSQL replace the content of a conflicting row this way.
+	q := "INSERT INTO " + getTableName() + " (user_id, content, updated_at) VALUES (?, ?, ?) " +
+		"ON CONFLICT (user_id) DO UPDATE SET content = excluded.content, updated_at = excluded.updated_at"
+
+	_, err := s.conn.Exec(q, d.UserID, d.Content, d.UpdatedAt.UTC())
+
+	return err
+}
+
+func (s *sqlStore) Delete(userID string) error {
+	_, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE user_id = ?", userID)
+
+	return err
+}
+
+func (s *sqlStore) All() ([]Draft, error) {
+	rows, err := s.conn.Query("SELECT user_id, content, updated_at FROM " + getTableName() + " ORDER BY user_id")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ds []Draft
+	for rows.Next() {
+		var d Draft
+		if err := rows.Scan(&d.UserID, &d.Content, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		ds = append(ds, d)
+	}
+
+	return ds, rows.Err()
+}
@@ -0,0 +1,24 @@
+package drafts
+
+// Store is the interface through which all draft data is read and written. The package-level
+// functions validate their arguments and delegate to the current Store, so callers need never know
+// which backend is in use.
+type Store interface {
+	// Get returns the draft of the user with `userID`, or nil if they have none.
+	Get(userID string) (*Draft, error)
+	// Put adds a draft, replacing any the same user already has.
+	Put(d *Draft) error
+	// Delete deletes the draft of the user with `userID`, doing nothing if they have none.
+	Delete(userID string) error
+	// All returns every user's draft, in order of user ID.
+	All() ([]Draft, error)
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
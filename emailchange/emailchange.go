@@ -0,0 +1,170 @@
+// Package emailchange is how users change the email address they sign in with. A change is
+// requested with the user's current password, and the new address takes effect only once the link
+// sent to it is followed, before the change expires.
+package emailchange
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/spf13/viper"
+)
+
+// Change is a change of the email of the user with UserID to Email, awaiting confirmation.
+type Change struct {
+	// ID is the random token in the confirmation link sent to the new address.
+	ID      string    `gorethink:"id"`
+	UserID  string    `gorethink:"user_id"`
+	Email   string    `gorethink:"email"`
+	Created time.Time `gorethink:"created"`
+	Expires time.Time `gorethink:"expires"`
+}
+
+// DefaultExpiry is how long a change can be confirmed for unless the `email_change.expiry` config
+// value gives another duration.
+const DefaultExpiry = 24 * time.Hour
+
+func init() {
+	viper.SetDefault("email_change.expiry", DefaultExpiry)
+}
+
+// IsExpired returns true if the change can no longer be confirmed at `now`.
+func (c *Change) IsExpired(now time.Time) bool {
+	return !now.Before(c.Expires)
+}
+
+// Request asks to change the email of `u` to `email`, with `password` their current password,
+// returning the change whose ID is to be sent to the new address. Any change they already had
+// pending is replaced. Errs with "invalid_password" or "invalid_email" if either is wrong, or if
+// the email already belongs to a user.
+func Request(u *users.User, password string, email string) (*Change, error) {
+	if u == nil {
+		return nil, errors.New("emailchange: user cannot be nil")
+	}
+
+	if !users.Validate(u.Hash, password) {
+		return nil, errors.New("invalid_password")
+	}
+
+	email = strings.TrimSpace(email)
+	if len(email) == 0 || !strings.Contains(email, "@") || email == u.Email {
+		return nil, errors.New("invalid_email")
+	}
+
+	// Names are never empty, so this matches on the email alone.
+	exists, err := users.Exists(&users.User{Email: email})
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, fmt.Errorf("A user already exists with email %q", email)
+	}
+
+	if err := store.DeleteByUser(u.ID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	c := Change{
+		ID:      utility.GenerateUUID(),
+		UserID:  u.ID,
+		Email:   email,
+		Created: now,
+		Expires: now.Add(viper.GetDuration("email_change.expiry")),
+	}
+
+	if err := store.Insert(&c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Pending returns the change the user with `userID` has awaiting confirmation, or nil if they have
+// none that's yet to expire.
+func Pending(userID string) (*Change, error) {
+	if len(userID) == 0 {
+		return nil, errors.New("emailchange: userID cannot be empty")
+	}
+
+	c, err := store.GetByUser(userID)
+	if err != nil || c == nil {
+		return nil, err
+	}
+
+	if c.IsExpired(time.Now()) {
+		return nil, store.DeleteByUser(userID)
+	}
+
+	return c, nil
+}
+
+// Cancel withdraws any change the user with `userID` has pending.
+func Cancel(userID string) error {
+	if len(userID) == 0 {
+		return errors.New("emailchange: userID cannot be empty")
+	}
+
+	return store.DeleteByUser(userID)
+}
+
+// Usable returns the change with `id` if it can still be confirmed. Otherwise, the error says why
+// it can't be, in words fit to show whoever followed the link.
+func Usable(id string) (*Change, error) {
+	c, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		return nil, errors.New("This link doesn't exist, or has already been used")
+	}
+
+	if c.IsExpired(time.Now()) {
+		return nil, errors.New("This link has expired. Please ask to change your email again")
+	}
+
+	return c, nil
+}
+
+// Confirm makes the change with `id`, returning the user with their new email. The change is
+// claimed before the email is changed so that it can't be used twice. The new email is checked
+// again for uniqueness, as another user may have taken it since the change was requested.
+func Confirm(id string) (*users.User, error) {
+	c, err := Usable(id)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed, err := store.Delete(c.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !claimed {
+		return nil, errors.New("This link has already been used")
+	}
+
+	return users.SetEmail(c.UserID, c.Email)
+}
+
+// All returns every pending change, oldest first, whether or not it's expired.
+func All() ([]Change, error) {
+	return store.All()
+}
+
+// Restore inserts a change exactly as given, keeping its ID and times. It's intended for restoring
+// changes from an archive.
+func Restore(c *Change) error {
+	if c == nil || c.ID == "" || c.UserID == "" || c.Email == "" {
+		return errors.New("emailchange: invalid Change supplied")
+	}
+
+	return store.Insert(c)
+}
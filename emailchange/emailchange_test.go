@@ -0,0 +1,169 @@
+package emailchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/db/dbtest"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableName = "email_changes_test"
+
+func init() {
+	viper.Set("db.email_changes_table", tableName)
+
+	users.SetStore(users.NewMemoryStore())
+
+	switch backend, conn := dbtest.Setup("emailchange", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
+	}
+}
+
+// createUser creates a user named `name`, with an email at example.com and the password "password".
+func createUser(t *testing.T, name string) *users.User {
+	u, err := users.New(users.UserOpts{Email: name + "@example.com", Name: name}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func TestRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	u := createUser(t, "requester")
+	createUser(t, "taken")
+
+	_, err := Request(nil, "password", "new@example.com")
+	assert.Error(err)
+
+	_, err = Request(u, "wrong password", "new@example.com")
+	assert.EqualError(err, "invalid_password")
+
+	_, err = Request(u, "password", "not an email")
+	assert.EqualError(err, "invalid_email")
+
+	_, err = Request(u, "password", u.Email)
+	assert.EqualError(err, "invalid_email", "the email must change")
+
+	_, err = Request(u, "password", "taken@example.com")
+	assert.Error(err, "a user already has that email")
+
+	first, err := Request(u, "password", " new@example.com ")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.NotEmpty(first.ID)
+	assert.Equal(u.ID, first.UserID)
+	assert.Equal("new@example.com", first.Email)
+	assert.Equal(DefaultExpiry, first.Expires.Sub(first.Created))
+
+	got, _ := users.GetByID(u.ID)
+	assert.Equal("requester@example.com", got.Email, "the email doesn't change until it's confirmed")
+
+	pending, err := Pending(u.ID)
+	if assert.NoError(err) && assert.NotNil(pending) {
+		assert.Equal(first.ID, pending.ID)
+	}
+
+	// Asking again replaces the first change.
+	second, err := Request(u, "password", "newer@example.com")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	_, err = Usable(first.ID)
+	assert.Error(err)
+
+	pending, err = Pending(u.ID)
+	if assert.NoError(err) && assert.NotNil(pending) {
+		assert.Equal(second.ID, pending.ID)
+	}
+
+	assert.NoError(Cancel(u.ID))
+
+	pending, err = Pending(u.ID)
+	assert.NoError(err)
+	assert.Nil(pending)
+}
+
+func TestConfirm(t *testing.T) {
+	assert := assert.New(t)
+
+	u := createUser(t, "confirmer")
+
+	c, err := Request(u, "password", "confirmed@example.com")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	_, err = Confirm("nonexistent")
+	assert.Error(err)
+
+	confirmed, err := Confirm(c.ID)
+	if assert.NoError(err) {
+		assert.Equal("confirmed@example.com", confirmed.Email)
+	}
+
+	got, _ := users.GetByID(u.ID)
+	assert.Equal("confirmed@example.com", got.Email)
+
+	_, err = Confirm(c.ID)
+	assert.Error(err, "a change can only be confirmed once")
+
+	// Someone else may take the new email in the meantime.
+	other := createUser(t, "other")
+
+	c, err = Request(other, "password", "contested@example.com")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	createUser(t, "contested")
+
+	_, err = Confirm(c.ID)
+	assert.Error(err)
+
+	got, _ = users.GetByID(other.ID)
+	assert.Equal("other@example.com", got.Email)
+}
+
+func TestConfirm_expired(t *testing.T) {
+	assert := assert.New(t)
+
+	u := createUser(t, "expirer")
+
+	viper.Set("email_change.expiry", -time.Minute)
+	defer viper.Set("email_change.expiry", DefaultExpiry)
+
+	c, err := Request(u, "password", "expired@example.com")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.True(c.IsExpired(time.Now()))
+
+	_, err = Confirm(c.ID)
+	assert.Error(err)
+
+	pending, err := Pending(u.ID)
+	assert.NoError(err)
+	assert.Nil(pending, "expired changes aren't pending")
+
+	got, _ := users.GetByID(u.ID)
+	assert.Equal("expirer@example.com", got.Email)
+}
@@ -0,0 +1,114 @@
+package emailchange
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// memoryStore is a Store that keeps email changes in process memory. Nothing is persisted, so it's
+// useful only for development and tests.
+type memoryStore struct {
+	mu      sync.RWMutex
+	changes map[string]Change
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{changes: make(map[string]Change)}
+}
+
+// byCreated sorts changes oldest first, breaking ties by ID.
+type byCreated []Change
+
+func (cs byCreated) Len() int      { return len(cs) }
+func (cs byCreated) Swap(i, j int) { cs[i], cs[j] = cs[j], cs[i] }
+func (cs byCreated) Less(i, j int) bool {
+	if cs[i].Created.Equal(cs[j].Created) {
+		return cs[i].ID < cs[j].ID
+	}
+
+	return cs[i].Created.Before(cs[j].Created)
+}
+
+func (s *memoryStore) Insert(c *Change) error {
+	if c == nil {
+		return errors.New("emailchange: cannot insert nil change")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.changes[c.ID]; ok {
+		return errors.New("emailchange: a change already exists with that ID")
+	}
+
+	s.changes[c.ID] = *c
+
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (*Change, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.changes[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &c, nil
+}
+
+func (s *memoryStore) GetByUser(userID string) (*Change, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.changes {
+		if c.UserID == userID {
+			return &c, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *memoryStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.changes[id]; !ok {
+		return false, nil
+	}
+
+	delete(s.changes, id)
+
+	return true, nil
+}
+
+func (s *memoryStore) DeleteByUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, c := range s.changes {
+		if c.UserID == userID {
+			delete(s.changes, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) All() ([]Change, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cs := make([]Change, 0, len(s.changes))
+	for _, c := range s.changes {
+		cs = append(cs, c)
+	}
+
+	sort.Sort(byCreated(cs))
+
+	return cs, nil
+}
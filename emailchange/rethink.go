@@ -0,0 +1,87 @@
+package emailchange
+
+import (
+	"sort"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by the
+// `db.email_changes_table` config value.
+type rethinkStore struct{}
+
+// getTable returns the table term for the email changes table.
+func getTable() rethink.Term {
+	return db.Get().Table(viper.GetString("db.email_changes_table"))
+}
+
+// one runs `t`, reading the single change it yields, if any.
+func (rethinkStore) one(t rethink.Term) (*Change, error) {
+	cursor, err := t.Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var c Change
+	if err := cursor.One(&c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (rethinkStore) Insert(c *Change) error {
+	_, err := getTable().Insert(c).RunWrite(db.Session)
+
+	return err
+}
+
+func (s rethinkStore) Get(id string) (*Change, error) {
+	return s.one(getTable().Get(id))
+}
+
+func (s rethinkStore) GetByUser(userID string) (*Change, error) {
+	return s.one(getTable().GetAllByIndex("user_id", userID).Limit(1))
+}
+
+func (rethinkStore) Delete(id string) (bool, error) {
+	res, err := getTable().Get(id).Delete().RunWrite(db.Session)
+	if err != nil {
+		return false, err
+	}
+
+	return res.Deleted == 1, nil
+}
+
+func (rethinkStore) DeleteByUser(userID string) error {
+	_, err := getTable().GetAllByIndex("user_id", userID).Delete().RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) All() ([]Change, error) {
+	// Ordering a whole table without an index is limited to 100,000 documents, so sort here instead.
+	cursor, err := getTable().Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var cs []Change
+	if err := cursor.All(&cs); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(byCreated(cs))
+
+	return cs, nil
+}
@@ -0,0 +1,99 @@
+package emailchange
+
+import (
+	"database/sql"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by the
+// `db.email_changes_table` config value.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+func getTableName() string {
+	return viper.GetString("db.email_changes_table")
+}
+
+const columns = "id, user_id, email, created, expires"
+
+func (s *sqlStore) getBy(column string, value string) (*Change, error) {
+	var c Change
+
+	q := "SELECT " + columns + " FROM " + getTableName() + " WHERE " + column + " = ?"
+
+	err := s.conn.QueryRow(q, value).Scan(&c.ID, &c.UserID, &c.Email, &c.Created, &c.Expires)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *sqlStore) Insert(c *Change) error {
+	q := "INSERT INTO " + getTableName() + " (" + columns + ") VALUES (?, ?, ?, ?, ?)"
+
+	_, err := s.conn.Exec(q, c.ID, c.UserID, c.Email, c.Created.UTC(), c.Expires.UTC())
+
+	return err
+}
+
+func (s *sqlStore) Get(id string) (*Change, error) {
+	return s.getBy("id", id)
+}
+
+func (s *sqlStore) GetByUser(userID string) (*Change, error) {
+	return s.getBy("user_id", userID)
+}
+
+func (s *sqlStore) Delete(id string) (bool, error) {
+	res, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (s *sqlStore) DeleteByUser(userID string) error {
+	_, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE user_id = ?", userID)
+
+	return err
+}
+
+func (s *sqlStore) All() ([]Change, error) {
+	rows, err := s.conn.Query("SELECT " + columns + " FROM " + getTableName() + " ORDER BY created, id")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var cs []Change
+	for rows.Next() {
+		var c Change
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Email, &c.Created, &c.Expires); err != nil {
+			return nil, err
+		}
+
+		cs = append(cs, c)
+	}
+
+	return cs, rows.Err()
+}
@@ -0,0 +1,31 @@
+package emailchange
+
+// Store is the interface through which email changes are read and written. The package-level
+// functions validate their arguments and delegate to the current Store, so callers need never know
+// which backend is in use.
+//
+// Single-document lookups return a nil value and a nil error if no document matches, leaving it to
+// the caller to decide whether that's an error.
+type Store interface {
+	Insert(c *Change) error
+	Get(id string) (*Change, error)
+	// GetByUser returns the change of the user with `userID`. We rely on there being no more than
+	// one per user at any given time.
+	GetByUser(userID string) (*Change, error)
+	// Delete removes the change with `id`, returning false if there was none to remove. Only one
+	// caller can remove a given change, so that no change is confirmed twice.
+	Delete(id string) (bool, error)
+	// DeleteByUser removes every change of the user with `userID`, doing nothing if there are none.
+	DeleteByUser(userID string) error
+	// All returns every change, oldest first.
+	All() ([]Change, error)
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
@@ -0,0 +1,243 @@
+// Package invites is how new users join: an admin, or any member if the config allows, invites
+// someone by email, and they follow the link they're sent to choose a name and password. Each
+// invite can be used once, before it expires, and can be revoked until then.
+package invites
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/spf13/viper"
+)
+
+// Invite is a single invitation to join, sent to Email. Once redeemed, RedeemedBy holds the ID of
+// the user created with it.
+type Invite struct {
+	// ID is the random token in the link sent with the invite.
+	ID         string     `gorethink:"id"`
+	Email      string     `gorethink:"email"`
+	InviterID  string     `gorethink:"inviter_id"`
+	Created    time.Time  `gorethink:"created"`
+	Expires    time.Time  `gorethink:"expires"`
+	RedeemedBy string     `gorethink:"redeemed_by"`
+	RedeemedAt *time.Time `gorethink:"redeemed_at"`
+	RevokedAt  *time.Time `gorethink:"revoked_at"`
+}
+
+// Status describes where an invite stands.
+type Status string
+
+const (
+	// StatusPending is an invite that can still be used.
+	StatusPending Status = "pending"
+	// StatusRedeemed is an invite that's been used to join.
+	StatusRedeemed Status = "redeemed"
+	// StatusRevoked is an invite withdrawn before it was used.
+	StatusRevoked Status = "revoked"
+	// StatusExpired is an invite that went unused until it expired.
+	StatusExpired Status = "expired"
+)
+
+// DefaultExpiry is how long an invite can be used for unless the `invites.expiry` config value
+// gives another duration.
+const DefaultExpiry = 7 * 24 * time.Hour
+
+func init() {
+	viper.SetDefault("invites.expiry", DefaultExpiry)
+	viper.SetDefault("invites.members_can_invite", false)
+}
+
+// Status returns where the invite stands at `now`.
+func (i *Invite) Status(now time.Time) Status {
+	switch {
+	case i.RedeemedAt != nil:
+		return StatusRedeemed
+	case i.RevokedAt != nil:
+		return StatusRevoked
+	case !now.Before(i.Expires):
+		return StatusExpired
+	default:
+		return StatusPending
+	}
+}
+
+// CanInvite returns true if `u` may send invites: admins always can, and other users can if the
+// `invites.members_can_invite` config value is true.
+func CanInvite(u *users.User) bool {
+	if u == nil || u.IsSuspended {
+		return false
+	}
+
+	return u.IsAdmin || viper.GetBool("invites.members_can_invite")
+}
+
+// New invites `email` on behalf of the user with `inviterID`, returning the invite to send. Errs if
+// the email is invalid or already belongs to a user.
+func New(inviterID string, email string) (*Invite, error) {
+	if len(inviterID) == 0 {
+		return nil, errors.New("invites: inviterID cannot be empty")
+	}
+
+	email = strings.TrimSpace(email)
+	if len(email) == 0 || !strings.Contains(email, "@") {
+		return nil, errors.New("invalid_email")
+	}
+
+	// Names are never empty, so this matches on the email alone.
+	exists, err := users.Exists(&users.User{Email: email})
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, fmt.Errorf("A user already exists with email %q", email)
+	}
+
+	now := time.Now().UTC()
+
+	i := Invite{
+		ID:        utility.GenerateUUID(),
+		Email:     email,
+		InviterID: inviterID,
+		Created:   now,
+		Expires:   now.Add(viper.GetDuration("invites.expiry")),
+	}
+
+	if err := store.Insert(&i); err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+// Get returns the invite with `id`, whatever its status.
+func Get(id string) (*Invite, error) {
+	if len(id) == 0 {
+		return nil, errors.New("invites: id cannot be empty")
+	}
+
+	i, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if i == nil {
+		return nil, fmt.Errorf("invites: no invite exists with ID %q", id)
+	}
+
+	return i, nil
+}
+
+// Usable returns the invite with `id` if it's pending. Otherwise, the error says why it can't be
+// used, in words fit to show whoever followed the link.
+func Usable(id string) (*Invite, error) {
+	i, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if i == nil {
+		return nil, errors.New("This invite doesn't exist")
+	}
+
+	switch i.Status(time.Now()) {
+	case StatusRedeemed:
+		return nil, errors.New("This invite has already been used")
+	case StatusRevoked:
+		return nil, errors.New("This invite has been withdrawn")
+	case StatusExpired:
+		return nil, errors.New("This invite has expired")
+	}
+
+	return i, nil
+}
+
+// All returns every invite, newest first.
+func All() ([]Invite, error) {
+	return store.All()
+}
+
+// Restore inserts an invite exactly as given, keeping its ID, times and whether it's been used or
+// revoked. It's intended for restoring invites from an archive.
+func Restore(i *Invite) error {
+	if i == nil || i.ID == "" || i.Email == "" || i.InviterID == "" {
+		return errors.New("invites: invalid Invite supplied")
+	}
+
+	return store.Insert(i)
+}
+
+// ByInviter returns every invite sent by the user with `inviterID`, newest first.
+func ByInviter(inviterID string) ([]Invite, error) {
+	return store.ByInviter(inviterID)
+}
+
+// Redeem uses the pending invite with `id` to create a user with its email and the given name and
+// password, which are validated as for any new user. The invite is claimed before the user is
+// created so that it can't be used twice; should creating the user then fail, the claim is
+// released so the invite can be tried again.
+func Redeem(id string, name string, password string) (*users.User, error) {
+	i, err := Usable(id)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := users.New(users.UserOpts{Email: i.Email, Name: strings.TrimSpace(name)}, password)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := users.Exists(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, fmt.Errorf("A user already exists with email %q or name %q", u.Email, u.Name)
+	}
+
+	// The ID is chosen ahead of creating the user so the invite can record it when it's claimed.
+	u.ID = utility.GenerateUUID()
+
+	claimed, err := store.Redeem(i.ID, u.ID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	if !claimed {
+		return nil, errors.New("This invite can no longer be used")
+	}
+
+	if err := users.Create(u); err != nil {
+		if _, uerr := store.Unredeem(i.ID, u.ID); uerr != nil {
+			log.Printf("invites: releasing invite %q: %s", i.ID, uerr)
+		}
+
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// Revoke withdraws the pending invite with `id`. Errs if it's already been used or revoked.
+func Revoke(id string) error {
+	if len(id) == 0 {
+		return errors.New("invites: id cannot be empty")
+	}
+
+	revoked, err := store.Revoke(id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return fmt.Errorf("invites: invite %q has already been used or revoked", id)
+	}
+
+	return nil
+}
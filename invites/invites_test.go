@@ -0,0 +1,295 @@
+package invites
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/db/dbtest"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableName = "invites_test"
+
+func init() {
+	viper.Set("db.invites_table", tableName)
+
+	users.SetStore(users.NewMemoryStore())
+
+	switch backend, conn := dbtest.Setup("invites", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
+	}
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New("", "invited@example.com")
+	assert.Error(err)
+
+	_, err = New("inviter", "  ")
+	assert.EqualError(err, "invalid_email")
+
+	_, err = New("inviter", "not an email")
+	assert.EqualError(err, "invalid_email")
+
+	member := users.User{Email: "member@example.com", Name: "member", PPP: 10, Hash: "hash"}
+	if err := users.Create(&member); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = New("inviter", "member@example.com")
+	assert.Error(err, "a user already has that email")
+
+	i, err := New("inviter", " invited@example.com ")
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.NotEmpty(i.ID)
+	assert.Equal("invited@example.com", i.Email)
+	assert.Equal("inviter", i.InviterID)
+	assert.Equal(DefaultExpiry, i.Expires.Sub(i.Created))
+	assert.Equal(StatusPending, i.Status(time.Now()))
+
+	got, err := Get(i.ID)
+	if assert.NoError(err) {
+		assert.Equal(i.Email, got.Email)
+		assert.Nil(got.RedeemedAt)
+		assert.Nil(got.RevokedAt)
+	}
+
+	_, err = Get("missing")
+	assert.Error(err)
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	cases := []struct {
+		invite Invite
+		want   Status
+	}{
+		{Invite{Expires: future}, StatusPending},
+		{Invite{Expires: past}, StatusExpired},
+		{Invite{Expires: now}, StatusExpired},
+		{Invite{Expires: future, RedeemedAt: &past}, StatusRedeemed},
+		{Invite{Expires: past, RedeemedAt: &past}, StatusRedeemed},
+		{Invite{Expires: future, RevokedAt: &past}, StatusRevoked},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.want, c.invite.Status(now))
+	}
+}
+
+func TestCanInvite(t *testing.T) {
+	assert := assert.New(t)
+
+	defer viper.Set("invites.members_can_invite", false)
+
+	admin := &users.User{IsAdmin: true}
+	member := &users.User{}
+
+	assert.False(CanInvite(nil))
+	assert.True(CanInvite(admin))
+	assert.False(CanInvite(member))
+	assert.False(CanInvite(&users.User{IsAdmin: true, IsSuspended: true}))
+
+	viper.Set("invites.members_can_invite", true)
+	assert.True(CanInvite(member))
+}
+
+func TestRedeem(t *testing.T) {
+	assert := assert.New(t)
+
+	i, err := New("inviter", "joining@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Redeem(i.ID, "", "password")
+	assert.EqualError(err, "invalid_name")
+
+	_, err = Redeem(i.ID, "joiner", "short")
+	assert.EqualError(err, "invalid_hash")
+
+	_, err = Usable(i.ID)
+	assert.NoError(err, "a failed attempt shouldn't use the invite")
+
+	u, err := Redeem(i.ID, " joiner ", "password")
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal("joining@example.com", u.Email)
+	assert.Equal("joiner", u.Name)
+	assert.True(users.Validate(u.Hash, "password"))
+
+	created, err := users.GetByEmail("joining@example.com")
+	if assert.NoError(err) {
+		assert.Equal(u.ID, created.ID)
+	}
+
+	got, err := Get(i.ID)
+	if assert.NoError(err) {
+		assert.Equal(StatusRedeemed, got.Status(time.Now()))
+		assert.Equal(u.ID, got.RedeemedBy)
+	}
+
+	_, err = Redeem(i.ID, "another", "password")
+	assert.EqualError(err, "This invite has already been used")
+
+	_, err = Redeem("missing", "another", "password")
+	assert.EqualError(err, "This invite doesn't exist")
+
+	// The name must be free as well as valid.
+	other, err := New("inviter", "other@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Redeem(other.ID, "joiner", "password")
+	assert.Error(err)
+}
+
+func TestRedeem_expired(t *testing.T) {
+	assert := assert.New(t)
+
+	viper.Set("invites.expiry", -time.Minute)
+	defer viper.Set("invites.expiry", DefaultExpiry)
+
+	i, err := New("inviter", "late@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Redeem(i.ID, "late", "password")
+	assert.EqualError(err, "This invite has expired")
+
+	// The store checks the expiry for itself, too.
+	claimed, err := store.Redeem(i.ID, "late", time.Now().UTC())
+	assert.NoError(err)
+	assert.False(claimed)
+}
+
+// failingUserStore is a users.Store that can't add users.
+type failingUserStore struct {
+	users.Store
+}
+
+func (failingUserStore) Insert(*users.User) (string, error) {
+	return "", errors.New("insert failed")
+}
+
+func TestRedeem_createFails(t *testing.T) {
+	assert := assert.New(t)
+
+	i, err := New("inviter", "unlucky@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users.SetStore(failingUserStore{users.NewMemoryStore()})
+
+	_, err = Redeem(i.ID, "unlucky", "password")
+	assert.EqualError(err, "insert failed")
+
+	users.SetStore(users.NewMemoryStore())
+
+	// The invite is left to be tried again.
+	got, err := Get(i.ID)
+	if assert.NoError(err) {
+		assert.Equal(StatusPending, got.Status(time.Now()))
+		assert.Empty(got.RedeemedBy)
+	}
+
+	u, err := Redeem(i.ID, "unlucky", "password")
+	if assert.NoError(err) {
+		assert.Equal("unlucky@example.com", u.Email)
+	}
+
+	// Only the user an invite was claimed for can release it.
+	released, err := store.Unredeem(i.ID, "someone else")
+	assert.NoError(err)
+	assert.False(released)
+}
+
+func TestRevoke(t *testing.T) {
+	assert := assert.New(t)
+
+	i, err := New("inviter", "revoked@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Error(Revoke(""))
+	assert.Error(Revoke("missing"))
+
+	assert.NoError(Revoke(i.ID))
+	assert.Error(Revoke(i.ID), "an invite can only be revoked once")
+
+	_, err = Redeem(i.ID, "revoked", "password")
+	assert.EqualError(err, "This invite has been withdrawn")
+
+	got, err := Get(i.ID)
+	if assert.NoError(err) {
+		assert.Equal(StatusRevoked, got.Status(time.Now()))
+		assert.NotNil(got.RevokedAt)
+	}
+
+	redeemed, err := New("inviter", "kept@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Redeem(redeemed.ID, "kept", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Error(Revoke(redeemed.ID), "a used invite can't be revoked")
+}
+
+func TestAllAndByInviter(t *testing.T) {
+	assert := assert.New(t)
+
+	first, err := New("lister", "first@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	second, err := New("lister", "second@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New("someone else", "third@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	is, err := ByInviter("lister")
+	if assert.NoError(err) && assert.Len(is, 2) {
+		assert.Equal(second.ID, is[0].ID, "newest first")
+		assert.Equal(first.ID, is[1].ID)
+	}
+
+	all, err := All()
+	if assert.NoError(err) {
+		assert.True(len(all) >= 3)
+
+		for j := 1; j < len(all); j++ {
+			assert.False(all[j].Created.After(all[j-1].Created), "newest first")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package invites
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store that keeps invites in process memory. Nothing is persisted, so it's
+// useful only for development and tests.
+type memoryStore struct {
+	mu      sync.RWMutex
+	invites map[string]Invite
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{invites: make(map[string]Invite)}
+}
+
+func (s *memoryStore) Insert(i *Invite) error {
+	if i == nil {
+		return errors.New("invites: cannot insert nil invite")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invites[i.ID]; ok {
+		return errors.New("invites: an invite already exists with that ID")
+	}
+
+	s.invites[i.ID] = *i
+
+	return nil
+}
+
+func (s *memoryStore) Get(id string) (*Invite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.invites[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &i, nil
+}
+
+// filter returns every invite for which `keep` is true, newest first.
+func (s *memoryStore) filter(keep func(i *Invite) bool) []Invite {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var is []Invite
+	for _, i := range s.invites {
+		if keep(&i) {
+			is = append(is, i)
+		}
+	}
+
+	sort.Slice(is, func(a, b int) bool {
+		return is[a].Created.After(is[b].Created)
+	})
+
+	return is
+}
+
+func (s *memoryStore) All() ([]Invite, error) {
+	return s.filter(func(*Invite) bool { return true }), nil
+}
+
+func (s *memoryStore) ByInviter(inviterID string) ([]Invite, error) {
+	return s.filter(func(i *Invite) bool { return i.InviterID == inviterID }), nil
+}
+
+func (s *memoryStore) Redeem(id string, userID string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.invites[id]
+	if !ok || i.Status(at) != StatusPending {
+		return false, nil
+	}
+
+	i.RedeemedBy = userID
+	i.RedeemedAt = &at
+	s.invites[id] = i
+
+	return true, nil
+}
+
+func (s *memoryStore) Unredeem(id string, userID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.invites[id]
+	if !ok || i.RedeemedAt == nil || i.RedeemedBy != userID {
+		return false, nil
+	}
+
+	i.RedeemedBy = ""
+	i.RedeemedAt = nil
+	s.invites[id] = i
+
+	return true, nil
+}
+
+func (s *memoryStore) Revoke(id string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.invites[id]
+	if !ok || i.RedeemedAt != nil || i.RevokedAt != nil {
+		return false, nil
+	}
+
+	i.RevokedAt = &at
+	s.invites[id] = i
+
+	return true, nil
+}
@@ -0,0 +1,102 @@
+package invites
+
+import (
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by the
+// `db.invites_table` config value.
+type rethinkStore struct{}
+
+// getTable returns the table term for the invites table.
+func getTable() rethink.Term {
+	return db.Get().Table(viper.GetString("db.invites_table"))
+}
+
+// all runs `t`, reading every invite it yields.
+func (rethinkStore) all(t rethink.Term) ([]Invite, error) {
+	cursor, err := t.Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var is []Invite
+	if err := cursor.All(&is); err != nil {
+		return nil, err
+	}
+
+	return is, nil
+}
+
+func (rethinkStore) Insert(i *Invite) error {
+	_, err := getTable().Insert(i).RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) Get(id string) (*Invite, error) {
+	cursor, err := getTable().Get(id).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var i Invite
+	if err := cursor.One(&i); err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (s rethinkStore) All() ([]Invite, error) {
+	return s.all(getTable().OrderBy(rethink.OrderByOpts{Index: rethink.Desc("created")}))
+}
+
+func (s rethinkStore) ByInviter(inviterID string) ([]Invite, error) {
+	return s.all(getTable().GetAllByIndex("inviter_id", inviterID).OrderBy(rethink.Desc("created")))
+}
+
+// update applies `data` to the invite with `id` if `cond` holds for it, returning true if it did.
+// The check and the change are made in a single write.
+func (rethinkStore) update(id string, cond rethink.Term, data map[string]interface{}) (bool, error) {
+	res, err := getTable().Get(id).Update(rethink.Branch(cond, data, map[string]interface{}{})).RunWrite(db.Session)
+	if err != nil {
+		return false, err
+	}
+
+	return res.Replaced == 1, nil
+}
+
+func (s rethinkStore) Redeem(id string, userID string, at time.Time) (bool, error) {
+	cond := rethink.And(
+		rethink.Row.Field("redeemed_at").Eq(nil),
+		rethink.Row.Field("revoked_at").Eq(nil),
+		rethink.Row.Field("expires").Gt(at),
+	)
+
+	return s.update(id, cond, map[string]interface{}{"redeemed_by": userID, "redeemed_at": at})
+}
+
+func (s rethinkStore) Unredeem(id string, userID string) (bool, error) {
+	cond := rethink.And(rethink.Row.Field("redeemed_at").Ne(nil), rethink.Row.Field("redeemed_by").Eq(userID))
+
+	return s.update(id, cond, map[string]interface{}{"redeemed_by": "", "redeemed_at": nil})
+}
+
+func (s rethinkStore) Revoke(id string, at time.Time) (bool, error) {
+	cond := rethink.And(rethink.Row.Field("redeemed_at").Eq(nil), rethink.Row.Field("revoked_at").Eq(nil))
+
+	return s.update(id, cond, map[string]interface{}{"revoked_at": at})
+}
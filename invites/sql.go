@@ -0,0 +1,133 @@
+package invites
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by the
+// `db.invites_table` config value.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+func getTableName() string {
+	return viper.GetString("db.invites_table")
+}
+
+const columns = "id, email, inviter_id, created, expires, redeemed_by, redeemed_at, revoked_at"
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInvite(row scanner) (*Invite, error) {
+	var i Invite
+	if err := row.Scan(&i.ID, &i.Email, &i.InviterID, &i.Created, &i.Expires, &i.RedeemedBy, &i.RedeemedAt, &i.RevokedAt); err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+// query runs a SELECT of every column with `clause` appended, newest first.
+func (s *sqlStore) query(clause string, args ...interface{}) ([]Invite, error) {
+	rows, err := s.conn.Query("SELECT "+columns+" FROM "+getTableName()+clause+" ORDER BY created DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var is []Invite
+	for rows.Next() {
+		i, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		is = append(is, *i)
+	}
+
+	return is, rows.Err()
+}
+
+// utc returns `t` in UTC, or nil if `t` is nil.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	u := t.UTC()
+
+	return &u
+}
+
+func (s *sqlStore) Insert(i *Invite) error {
+	q := "INSERT INTO " + getTableName() + " (" + columns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+
+	_, err := s.conn.Exec(q, i.ID, i.Email, i.InviterID, i.Created.UTC(), i.Expires.UTC(), i.RedeemedBy, utc(i.RedeemedAt), utc(i.RevokedAt))
+
+	return err
+}
+
+func (s *sqlStore) Get(id string) (*Invite, error) {
+	i, err := scanInvite(s.conn.QueryRow("SELECT "+columns+" FROM "+getTableName()+" WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return i, err
+}
+
+func (s *sqlStore) All() ([]Invite, error) {
+	return s.query("")
+}
+
+func (s *sqlStore) ByInviter(inviterID string) ([]Invite, error) {
+	return s.query(" WHERE inviter_id = ?", inviterID)
+}
+
+// update runs `q`, returning true if it changed exactly one row.
+func (s *sqlStore) update(q string, args ...interface{}) (bool, error) {
+	res, err := s.conn.Exec(q, args...)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (s *sqlStore) Redeem(id string, userID string, at time.Time) (bool, error) {
+	q := "UPDATE " + getTableName() + " SET redeemed_by = ?, redeemed_at = ? " +
+		"WHERE id = ? AND redeemed_at IS NULL AND revoked_at IS NULL AND expires > ?"
+
+	return s.update(q, userID, at.UTC(), id, at.UTC())
+}
+
+func (s *sqlStore) Unredeem(id string, userID string) (bool, error) {
+	q := "UPDATE " + getTableName() + " SET redeemed_by = '', redeemed_at = NULL " +
+		"WHERE id = ? AND redeemed_at IS NOT NULL AND redeemed_by = ?"
+
+	return s.update(q, id, userID)
+}
+
+func (s *sqlStore) Revoke(id string, at time.Time) (bool, error) {
+	q := "UPDATE " + getTableName() + " SET revoked_at = ? WHERE id = ? AND redeemed_at IS NULL AND revoked_at IS NULL"
+
+	return s.update(q, at.UTC(), id)
+}
@@ -0,0 +1,37 @@
+package invites
+
+import "time"
+
+// Store is the interface through which invites are read and written. The package-level functions
+// validate their arguments and delegate to the current Store, so callers need never know which
+// backend is in use.
+//
+// Single-document lookups return a nil value and a nil error if no document matches, leaving it to
+// the caller to decide whether that's an error.
+type Store interface {
+	Insert(i *Invite) error
+	Get(id string) (*Invite, error)
+	// All returns every invite, newest first.
+	All() ([]Invite, error)
+	// ByInviter returns every invite sent by the user with `inviterID`, newest first.
+	ByInviter(inviterID string) ([]Invite, error)
+	// Redeem records that the invite with `id` was used at `at` to create the user with `userID`,
+	// returning false if it was already used or revoked, or had expired by `at`. The check and the
+	// change must be made together, so that no invite is used twice.
+	Redeem(id string, userID string, at time.Time) (bool, error)
+	// Unredeem releases the invite with `id` claimed by Redeem for the user with `userID`, so that it
+	// can be used again, returning false if it isn't claimed for that user.
+	Unredeem(id string, userID string) (bool, error)
+	// Revoke records that the invite with `id` was revoked at `at`, returning false if it was
+	// already used or revoked.
+	Revoke(id string, at time.Time) (bool, error)
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
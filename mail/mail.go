@@ -18,9 +18,14 @@ func CreateMailer() {
 	client = postmark.NewClient(serverToken, accountToken)
 }
 
-// SendForgottenPassword delivers a password reset email to `to`.
-func SendForgottenPassword(to string, token string) error {
+// link returns the absolute URL of `path` on this forum. With no domain configured, as in
+// development, it returns just the path.
+func link(path string) string {
 	domain := viper.GetString("domain")
+	if domain == "" {
+		return path
+	}
+
 	useTLS := viper.GetBool("use_tls")
 
 	root := "http"
@@ -28,7 +33,27 @@ func SendForgottenPassword(to string, token string) error {
 		root = "https"
 	}
 
-	body := fmt.Sprintf("Your password reset link: %s://%s/reset-password?token=%s", root, domain, token)
+	return fmt.Sprintf("%s://%s%s", root, domain, path)
+}
+
+// ResetLink returns the absolute URL at which the password reset with `token` is completed.
+func ResetLink(token string) string {
+	return link("/reset-password?token=" + token)
+}
+
+// InviteLink returns the absolute URL at which the invite with `token` is accepted.
+func InviteLink(token string) string {
+	return link("/invite?token=" + token)
+}
+
+// EmailChangeLink returns the absolute URL at which the email change with `token` is confirmed.
+func EmailChangeLink(token string) string {
+	return link("/confirm-email?token=" + token)
+}
+
+// SendForgottenPassword delivers a password reset email to `to`.
+func SendForgottenPassword(to string, token string) error {
+	body := "Your password reset link: " + ResetLink(token)
 
 	email := postmark.Email{
 		From:       viper.GetString("postmark.from"),
@@ -48,3 +73,105 @@ func SendForgottenPassword(to string, token string) error {
 
 	return nil
 }
+
+// SendInvite delivers an invite to join, sent by `inviterName`, to `to`.
+func SendInvite(to string, inviterName string, token string) error {
+	title := viper.GetString("title")
+	body := fmt.Sprintf("%s has invited you to join %s. Choose a name and password here: %s", inviterName, title, InviteLink(token))
+
+	email := postmark.Email{
+		From:       viper.GetString("postmark.from"),
+		To:         to,
+		Subject:    "You're invited to " + title,
+		TextBody:   body,
+		Tag:        "invite",
+		TrackOpens: false,
+	}
+
+	res, err := client.SendEmail(email)
+	if err != nil || res.ErrorCode != 0 {
+		log.Print(err)
+
+		return fmt.Errorf("mail: invite email to %q failed to send: %s", to, err)
+	}
+
+	return nil
+}
+
+// SendEmailChangeConfirmation delivers the link confirming the change of a user's email to `to`,
+// their new address.
+func SendEmailChangeConfirmation(to string, token string) error {
+	title := viper.GetString("title")
+	body := fmt.Sprintf("To use this address to sign in to %s, confirm it here: %s", title, EmailChangeLink(token))
+
+	email := postmark.Email{
+		From:       viper.GetString("postmark.from"),
+		To:         to,
+		Subject:    "Confirm your new email address for " + title,
+		TextBody:   body,
+		Tag:        "email-change",
+		TrackOpens: false,
+	}
+
+	res, err := client.SendEmail(email)
+	if err != nil || res.ErrorCode != 0 {
+		log.Print(err)
+
+		return fmt.Errorf("mail: email change confirmation to %q failed to send: %s", to, err)
+	}
+
+	return nil
+}
+
+// SendEmailChangeNotice tells `to`, a user's current address, that a change of their email to
+// `newEmail` has been asked for, so that they'll know should it not have been them.
+func SendEmailChangeNotice(to string, newEmail string) error {
+	title := viper.GetString("title")
+	body := fmt.Sprintf("Someone signed in to your %s account has asked to change its email address to %s. "+
+		"It will change once the link sent there is followed. If this wasn't you, change your password "+
+		"and sign out your other sessions.", title, newEmail)
+
+	email := postmark.Email{
+		From:       viper.GetString("postmark.from"),
+		To:         to,
+		Subject:    "Your email address for " + title + " is changing",
+		TextBody:   body,
+		Tag:        "email-change-notice",
+		TrackOpens: false,
+	}
+
+	res, err := client.SendEmail(email)
+	if err != nil || res.ErrorCode != 0 {
+		log.Print(err)
+
+		return fmt.Errorf("mail: email change notice to %q failed to send: %s", to, err)
+	}
+
+	return nil
+}
+
+// SendPasswordChanged tells `to` that the password of their account was changed, so that they'll
+// know should it not have been them.
+func SendPasswordChanged(to string) error {
+	title := viper.GetString("title")
+	body := fmt.Sprintf("The password of your %s account was just changed. If this wasn't you, reset "+
+		"your password now: %s", title, link("/forgot"))
+
+	email := postmark.Email{
+		From:       viper.GetString("postmark.from"),
+		To:         to,
+		Subject:    "Your password for " + title + " was changed",
+		TextBody:   body,
+		Tag:        "password-changed",
+		TrackOpens: false,
+	}
+
+	res, err := client.SendEmail(email)
+	if err != nil || res.ErrorCode != 0 {
+		log.Print(err)
+
+		return fmt.Errorf("mail: password change notice to %q failed to send: %s", to, err)
+	}
+
+	return nil
+}
@@ -1 +1,39 @@
 package mail
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResetLink(t *testing.T) {
+	viper.Set("domain", "forum.example.com")
+
+	viper.Set("use_tls", true)
+	assert.Equal(t, "https://forum.example.com/reset-password?token=abc", ResetLink("abc"))
+
+	viper.Set("use_tls", false)
+	assert.Equal(t, "http://forum.example.com/reset-password?token=abc", ResetLink("abc"))
+
+	viper.Set("domain", "")
+	assert.Equal(t, "/reset-password?token=abc", ResetLink("abc"))
+}
+
+func TestInviteLink(t *testing.T) {
+	viper.Set("domain", "forum.example.com")
+	viper.Set("use_tls", true)
+	assert.Equal(t, "https://forum.example.com/invite?token=abc", InviteLink("abc"))
+
+	viper.Set("domain", "")
+	assert.Equal(t, "/invite?token=abc", InviteLink("abc"))
+}
+
+func TestEmailChangeLink(t *testing.T) {
+	viper.Set("domain", "forum.example.com")
+	viper.Set("use_tls", true)
+	assert.Equal(t, "https://forum.example.com/confirm-email?token=abc", EmailChangeLink("abc"))
+
+	viper.Set("domain", "")
+	assert.Equal(t, "/confirm-email?token=abc", EmailChangeLink("abc"))
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"flag"
+
+	"github.com/boatilus/peppercorn/attachments"
 	"github.com/boatilus/peppercorn/cookie"
 	"github.com/boatilus/peppercorn/db"
 	"github.com/boatilus/peppercorn/mail"
@@ -11,18 +14,76 @@ import (
 	"github.com/spf13/viper"
 )
 
+var dev = flag.Bool("dev", false, "run against an in-memory store instead of the configured database; nothing is persisted")
+
 func init() {
+	viper.SetDefault("user_cache.refresh_interval", users.DefaultRefreshInterval)
+
 	viper.SetConfigName("config")
 	viper.AddConfigPath(".")
 
 	utility.Must(viper.ReadInConfig())
 }
 
+// connect opens the database named by `db.driver` and returns the Migrator for it.
+func connect() (db.Migrator, error) {
+	driver := viper.GetString("db.driver")
+
+	if driver == db.Driver {
+		if err := db.Connect(); err != nil {
+			return nil, err
+		}
+
+		return db.RethinkMigrator{}, nil
+	}
+
+	conn, err := useSQLStores(driver, viper.GetString("db.dsn"))
+	if err != nil {
+		return nil, err
+	}
+
+	return db.NewSQLMigrator(conn), nil
+}
+
 func main() {
-	utility.Must(db.Connect())
+	flag.Parse()
+
+	if *dev {
+		utility.Must(useMemoryStores())
+	} else {
+		m, err := connect()
+		utility.Must(err)
+
+		blobs, err := attachments.NewLocalBlobStore(viper.GetString("attachments.dir"))
+		utility.Must(err)
+
+		attachments.SetBlobStore(blobs)
+
+		if flag.Arg(0) == "migrate" {
+			utility.Must(migrate(m, flag.Args()[1:]))
+			return
+		}
+
+		// Apply any pending migrations, refusing to start if the database has been migrated by a
+		// newer build.
+		_, err = db.Up(m)
+		utility.Must(err)
+	}
+
+	switch flag.Arg(0) {
+	case "export":
+		utility.Must(export(flag.Args()[1:]))
+		return
+	case "import":
+		utility.Must(restore(flag.Args()[1:]))
+		return
+	}
 
 	utility.Must(users.Populate())
 
+	// Keep the user cache current with changes made by any other instances.
+	users.Users.Watch(viper.GetDuration("user_cache.refresh_interval"))
+
 	// Instantiate the secure cookie generator
 	cookie.CreateGenerator()
 
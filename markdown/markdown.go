@@ -0,0 +1,81 @@
+// Package markdown renders post content to HTML on the server, matching the rendering done in the
+// browser by markdown-it: CommonMark with tables, strikethrough, raw HTML, bare links, typographic
+// replacements and `::: spoiler` containers, along with `>>1234` references to other posts. Its
+// output is sanitized against an allowlist, so it's safe to include in a page as is.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// md converts Markdown to unsanitized HTML. As with markdown-it's `html` option, raw HTML in the
+// source is passed through, and left to policy to clean up.
+var md = goldmark.New(
+	goldmark.WithParser(parser.NewParser(
+		parser.WithBlockParsers(blockParsers()...),
+		parser.WithInlineParsers(parser.DefaultInlineParsers()...),
+		parser.WithParagraphTransformers(parser.DefaultParagraphTransformers()...),
+	)),
+	goldmark.WithExtensions(
+		extension.Table,
+		extension.Strikethrough,
+		extension.Linkify,
+		extension.NewTypographer(extension.WithTypographicSubstitutions(map[extension.TypographicPunctuation][]byte{
+			// markdown-it doesn't replace `<<` and `>>`.
+			extension.LeftAngleQuote:  nil,
+			extension.RightAngleQuote: nil,
+		})),
+		spoilers,
+		references,
+	),
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(replacements{}, 100)),
+	),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// policy is the allowlist applied to rendered HTML. It's bluemonday's policy for user-generated
+// content, plus the alignment of table columns, the classes naming the language of code blocks and
+// the elements and classes that make up spoilers and references.
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// Links are rendered as they are in the browser, without rel="nofollow".
+	p.RequireNoFollowOnLinks(false)
+
+	// Fenced code blocks name their language in a class, as they do in the browser.
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	// Table columns are aligned by style.
+	p.AllowStyles("text-align").MatchingEnum("left", "center", "right").OnElements("th", "td")
+
+	p.AllowElements("button")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^article-spoiler-button$`)).OnElements("button")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^article-spoiler$`)).OnElements("div")
+
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^article-reference$`)).OnElements("a")
+
+	return p
+}
+
+// Render renders Markdown `source` to sanitized HTML.
+func Render(source string) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
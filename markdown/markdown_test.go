@@ -0,0 +1,123 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"Hello *world*", "<p>Hello <em>world</em></p>\n"},
+		{"> quoted\n\n- a\n- b", "<blockquote>\n<p>quoted</p>\n</blockquote>\n<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"~~struck~~", "<p><del>struck</del></p>\n"},
+		{"```go\nx := 1\n```", "<pre><code class=\"language-go\">x := 1\n</code></pre>\n"},
+		{"see https://example.com", "<p>see <a href=\"https://example.com\">https://example.com</a></p>\n"},
+		{"| a |\n|:-:|\n| 1 |", "<table>\n<thead>\n<tr>\n<th style=\"text-align: center\">a</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td style=\"text-align: center\">1</td>\n</tr>\n</tbody>\n</table>\n"},
+
+		// Typographic replacements
+		{`"Quoted" -- it's... (c) (TM) (r) (p) +-`, "<p>“Quoted” – it’s… © ™ ® § ±</p>\n"},
+		{"(c) once\n(C) twice", "<p>© once\n© twice</p>\n"},
+		{"`(c)`", "<p><code>(c)</code></p>\n"},
+		{"a << b >> c", "<p>a &lt;&lt; b &gt;&gt; c</p>\n"},
+
+		// Sanitization
+		{"<b>raw</b> <script>alert(1)</script>", "<p><b>raw</b> </p>\n"},
+		{`<a href="javascript:alert(1)" onclick="alert(1)">x</a>`, "<p>x</p>\n"},
+		{`<div class="evil" style="color: red">x</div>`, "<div>x</div>"},
+		{`<code class="language-go">x</code>`, `<p><code class="language-go">x</code></p>` + "\n"},
+	}
+
+	for _, c := range cases {
+		got, err := Render(c.in)
+		assert.NoError(t, err, c.in)
+		assert.Equal(t, c.want, string(got), c.in)
+	}
+}
+
+func TestRender_spoilers(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{
+			"::: spoiler The <b>end</b>\nHe was **dead**\n:::\nafter",
+			"<button class=\"article-spoiler-button\">Spoiler: The &lt;b&gt;end&lt;/b&gt;</button><div class=\"article-spoiler\">\n<p>He was <strong>dead</strong></p>\n</div>\n<p>after</p>\n",
+		},
+		{
+			"before\n::: spoiler   padded title  \ninside\n:::",
+			"<p>before</p>\n<button class=\"article-spoiler-button\">Spoiler: padded title</button><div class=\"article-spoiler\">\n<p>inside</p>\n</div>\n",
+		},
+		{
+			":::: spoiler outer\n::: spoiler inner\nx\n:::\ny\n::::",
+			"<button class=\"article-spoiler-button\">Spoiler: outer</button><div class=\"article-spoiler\">\n<button class=\"article-spoiler-button\">Spoiler: inner</button><div class=\"article-spoiler\">\n<p>x</p>\n</div>\n<p>y</p>\n</div>\n",
+		},
+		{
+			// An unclosed spoiler runs to the end of the post.
+			"::: spoiler t\nx",
+			"<button class=\"article-spoiler-button\">Spoiler: t</button><div class=\"article-spoiler\">\n<p>x</p>\n</div>\n",
+		},
+
+		// Not spoilers
+		{"::: spoiler\nx\n:::", "<p>::: spoiler\nx\n:::</p>\n"},
+		{":: spoiler t\nx", "<p>:: spoiler t\nx</p>\n"},
+		{"::: spoilers t", "<p>::: spoilers t</p>\n"},
+		{"::: warning t", "<p>::: warning t</p>\n"},
+	}
+
+	for _, c := range cases {
+		got, err := Render(c.in)
+		assert.NoError(t, err, c.in)
+		assert.Equal(t, c.want, string(got), c.in)
+	}
+}
+
+func TestRender_references(t *testing.T) {
+	link := func(n string) string {
+		return `<a class="article-reference" href="/posts/` + n + `/jump">&gt;&gt;` + n + `</a>`
+	}
+
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"see >>12, and >>3.", "<p>see " + link("12") + ", and " + link("3") + ".</p>\n"},
+		{">>1234\nagreed", "<p>" + link("1234") + "\nagreed</p>\n"},
+		{"> # boat (>>7):\n> quoted\n\nreply", "<blockquote>\n<h1>boat (" + link("7") + "):</h1>\n<p>quoted</p>\n</blockquote>\n<p>reply</p>\n"},
+		{"> quoted\n\n>>7 reply", "<blockquote>\n<p>quoted</p>\n</blockquote>\n<p>" + link("7") + " reply</p>\n"},
+		// As with any other text, a reference continues a quoted paragraph lazily.
+		{"> quoted\n>>7 reply", "<blockquote>\n<p>quoted\n" + link("7") + " reply</p>\n</blockquote>\n"},
+		{"> >>7", "<blockquote>\n<p>" + link("7") + "</p>\n</blockquote>\n"},
+
+		// Not references
+		{">>> quoted", "<blockquote>\n<blockquote>\n<blockquote>\n<p>quoted</p>\n</blockquote>\n</blockquote>\n</blockquote>\n"},
+		{"a>>12 >>12ab >>0 >>", "<p>a&gt;&gt;12 &gt;&gt;12ab &gt;&gt;0 &gt;&gt;</p>\n"},
+		{"`>>12`", "<p><code>&gt;&gt;12</code></p>\n"},
+	}
+
+	for _, c := range cases {
+		got, err := Render(c.in)
+		assert.NoError(t, err, c.in)
+		assert.Equal(t, c.want, string(got), c.in)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]int{12, 3}, References(">>12\n\n> # boat (>>3):\n> x\n\nand >>12 again, not `>>4`"))
+	assert.Empty(References("nothing >>here"))
+}
+
+func TestMentions(t *testing.T) {
+	assert := assert.New(t)
+
+	source := "Thanks @boat_ilus and **@Ann**.\n\n> @carl-b. said\n\n@boat_ilus again, " +
+		"not `@code`, [@link](/x), me@example.com or <dave@example.com>"
+
+	assert.Equal([]string{"boat_ilus", "Ann", "carl-b"}, Mentions(source))
+	assert.Empty(Mentions("nobody @ all"))
+}
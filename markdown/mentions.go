@@ -0,0 +1,111 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Mentions returns the names mentioned in Markdown `source`, written `@name`, in the order they're
+// first mentioned. A name is made of letters, digits, `_`, `-` and `.`, though it can't end with
+// `-` or `.`, so that a mention can end a sentence. Mentions in code, links and raw HTML aren't
+// counted, nor is an `@` preceded by a letter or digit, as in an email address.
+func Mentions(source string) []string {
+	src := []byte(source)
+	doc := md.Parser().Parse(text.NewReader(src))
+
+	var names []string
+	seen := make(map[string]bool)
+
+	// Adjacent text nodes are joined before looking for mentions, as goldmark splits text wherever
+	// an inline might have begun, as at the `_` in `@some_name`.
+	var run strings.Builder
+
+	flush := func() {
+		for _, name := range findMentions(run.String()) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+
+		run.Reset()
+	}
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch n := n.(type) {
+		case *ast.Text:
+			if entering {
+				run.Write(n.Segment.Value(src))
+
+				if n.SoftLineBreak() || n.HardLineBreak() {
+					flush()
+				}
+			}
+
+			return ast.WalkContinue, nil
+		case *ast.String:
+			if entering {
+				run.Write(n.Value)
+			}
+
+			return ast.WalkContinue, nil
+		}
+
+		flush()
+
+		switch n.(type) {
+		case *ast.CodeSpan, *ast.Link, *ast.AutoLink, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	flush()
+
+	return names
+}
+
+// findMentions returns the names mentioned in plain text `s`, in order.
+func findMentions(s string) []string {
+	var names []string
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '@' {
+			continue
+		}
+
+		if i > 0 {
+			if r, _ := utf8.DecodeLastRuneInString(s[:i]); isNameRune(r) || r == '@' {
+				continue
+			}
+		}
+
+		end := i + 1
+		for end < len(s) {
+			r, size := utf8.DecodeRuneInString(s[end:])
+			if !isNameRune(r) {
+				break
+			}
+
+			end += size
+		}
+
+		name := strings.TrimRight(s[i+1:end], ".-")
+		if name != "" {
+			names = append(names, name)
+		}
+
+		i = end - 1
+	}
+
+	return names
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
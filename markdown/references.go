@@ -0,0 +1,194 @@
+package markdown
+
+import (
+	"strconv"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// references extends goldmark with references to earlier posts by number, written `>>1234`. Each
+// is rendered as a link that jumps to the post wherever it's seen in the thread.
+//
+// A line beginning with a reference isn't taken as a nested blockquote, as it otherwise would be,
+// so that a reply can begin `>>1234` as is usual elsewhere.
+var references = referenceExtension{}
+
+// kindReference is the AST node kind of a reference.
+var kindReference = ast.NewNodeKind("Reference")
+
+// reference is a reference to a post in the AST.
+type reference struct {
+	ast.BaseInline
+	// Number is the number of the post referred to.
+	Number int
+}
+
+func (n *reference) Kind() ast.NodeKind {
+	return kindReference
+}
+
+func (n *reference) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Number": strconv.Itoa(n.Number)}, nil)
+}
+
+// maxReferenceDigits is the most digits a reference may have, keeping its number in range of the
+// numbers given to posts.
+const maxReferenceDigits = 9
+
+// parseReference returns the number referred to by a reference at the start of `line`, and the
+// reference's length. The length is zero if `line` doesn't begin with a reference.
+func parseReference(line []byte) (int, int) {
+	if len(line) < 3 || line[0] != '>' || line[1] != '>' {
+		return 0, 0
+	}
+
+	end := 2
+	for end < len(line) && end-2 < maxReferenceDigits && line[end] >= '0' && line[end] <= '9' {
+		end++
+	}
+
+	// A reference must be followed by something other than a letter or digit, so that `>>12ab` isn't
+	// taken to refer to post 12.
+	if end == 2 || (end < len(line) && isWordByte(line[end])) {
+		return 0, 0
+	}
+
+	n, err := strconv.Atoi(string(line[2:end]))
+	if err != nil || n < 1 {
+		return 0, 0
+	}
+
+	return n, end
+}
+
+func isWordByte(b byte) bool {
+	return b >= 0x80 || b == '_' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// referenceParser parses references within text.
+type referenceParser struct{}
+
+func (referenceParser) Trigger() []byte {
+	return []byte{'>'}
+}
+
+func (referenceParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	// `a>>12` and `>>>12` aren't references.
+	if prev := block.PrecendingCharacter(); prev == '>' || prev == '_' || unicode.IsLetter(prev) || unicode.IsDigit(prev) {
+		return nil
+	}
+
+	line, _ := block.PeekLine()
+
+	n, length := parseReference(line)
+	if length == 0 {
+		return nil
+	}
+
+	block.Advance(length)
+
+	return &reference{Number: n}
+}
+
+// blockquoteParser parses blockquotes as goldmark does, except that a line beginning with a
+// reference neither opens nor continues one.
+type blockquoteParser struct {
+	parser.BlockParser
+}
+
+// startsWithReference reports whether the line being read begins with a reference, after any
+// indentation.
+func startsWithReference(reader text.Reader) bool {
+	line, _ := reader.PeekLine()
+
+	w, pos := util.IndentWidth(line, reader.LineOffset())
+	if w > 3 {
+		return false
+	}
+
+	_, length := parseReference(line[pos:])
+
+	return length > 0
+}
+
+func (b blockquoteParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	if startsWithReference(reader) {
+		return nil, parser.NoChildren
+	}
+
+	return b.BlockParser.Open(parent, reader, pc)
+}
+
+func (b blockquoteParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if startsWithReference(reader) {
+		return parser.Close
+	}
+
+	return b.BlockParser.Continue(node, reader, pc)
+}
+
+// blockParsers returns goldmark's default block parsers, with its blockquote parser replaced by
+// blockquoteParser.
+func blockParsers() []util.PrioritizedValue {
+	ps := parser.DefaultBlockParsers()
+
+	for i := range ps {
+		if bp, ok := ps[i].Value.(parser.BlockParser); ok && bp == parser.NewBlockquoteParser() {
+			ps[i].Value = blockquoteParser{bp}
+		}
+	}
+
+	return ps
+}
+
+// referenceRenderer renders references as links to the `/posts/:num/jump` route.
+type referenceRenderer struct{}
+
+func (r referenceRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindReference, r.render)
+}
+
+func (referenceRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		n := strconv.Itoa(node.(*reference).Number)
+		w.WriteString(`<a class="article-reference" href="/posts/` + n + `/jump">&gt;&gt;` + n + `</a>`)
+	}
+
+	return ast.WalkSkipChildren, nil
+}
+
+// referenceExtension adds referenceParser and referenceRenderer to a goldmark.Markdown. It relies on
+// the Markdown having been created with a parser using blockParsers.
+type referenceExtension struct{}
+
+func (referenceExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(referenceParser{}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(referenceRenderer{}, 500)))
+}
+
+// References returns the numbers of the posts referred to in Markdown `source`, in the order they're
+// first referred to.
+func References(source string) []int {
+	src := []byte(source)
+	doc := md.Parser().Parse(text.NewReader(src))
+
+	var ns []int
+	seen := make(map[int]bool)
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if r, ok := n.(*reference); ok && entering && !seen[r.Number] {
+			seen[r.Number] = true
+			ns = append(ns, r.Number)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return ns
+}
@@ -0,0 +1,111 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// replaceable matches the typographic replacements made by markdown-it that goldmark's Typographer
+// extension doesn't make.
+var replaceable = regexp.MustCompile(`(?i)\((?:c|tm|r|p)\)|\+-`)
+
+// replacementFor gives the symbol for each match of replaceable, in lowercase.
+var replacementFor = map[string][]byte{
+	"(c)":  []byte("©"),
+	"(tm)": []byte("™"),
+	"(r)":  []byte("®"),
+	"(p)":  []byte("§"),
+	"+-":   []byte("±"),
+}
+
+// replacements is an AST transformer making the replacements matched by replaceable in text,
+// except in code spans.
+type replacements struct{}
+
+func (replacements) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var texts []*ast.Text
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.CodeSpan:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			join(n)
+			texts = append(texts, n)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	for _, t := range texts {
+		replace(t, source)
+	}
+}
+
+// join merges into `t` the text following it that's adjacent in the source. Inline parsers can split
+// text at the characters that trigger them, such as `-`, which would otherwise split `+-`.
+func join(t *ast.Text) {
+	for {
+		next, ok := t.NextSibling().(*ast.Text)
+		if !ok || t.SoftLineBreak() || t.HardLineBreak() || t.IsRaw() != next.IsRaw() {
+			return
+		}
+
+		if next.Segment.Start != t.Segment.Stop || next.Segment.Padding != 0 {
+			return
+		}
+
+		t.Segment = t.Segment.WithStop(next.Segment.Stop)
+		t.SetSoftLineBreak(next.SoftLineBreak())
+		t.SetHardLineBreak(next.HardLineBreak())
+
+		t.Parent().RemoveChild(t.Parent(), next)
+	}
+}
+
+// replace splits `t` around each match of replaceable, putting the symbol for the match between
+// the pieces. The last piece keeps the line break, if any, that ended `t`.
+func replace(t *ast.Text, source []byte) {
+	seg := t.Segment
+	value := source[seg.Start:seg.Stop]
+
+	matches := replaceable.FindAllIndex(value, -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	parent := t.Parent()
+	last := 0
+
+	for i, m := range matches {
+		piece := text.NewSegment(seg.Start+last, seg.Start+m[0])
+		if i == 0 {
+			// Only the first piece keeps the padding of the line it started.
+			piece = seg.WithStop(seg.Start + m[0])
+		}
+
+		parent.InsertBefore(parent, t, ast.NewTextSegment(piece))
+
+		symbol := replacementFor[string(bytes.ToLower(value[m[0]:m[1]]))]
+		parent.InsertBefore(parent, t, ast.NewString(symbol))
+
+		last = m[1]
+	}
+
+	rest := ast.NewTextSegment(text.NewSegment(seg.Start+last, seg.Stop))
+	rest.SetSoftLineBreak(t.SoftLineBreak())
+	rest.SetHardLineBreak(t.HardLineBreak())
+	rest.SetRaw(t.IsRaw())
+
+	parent.ReplaceChild(parent, t, rest)
+}
@@ -0,0 +1,143 @@
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// spoilers extends goldmark with spoiler containers, written as they are for markdown-it-container:
+//
+//	::: spoiler Title
+//	Hidden *Markdown* content
+//	:::
+//
+// Each is rendered as a button, labelled with the title, followed by the hidden content. Spoilers
+// can be nested by fencing the outer spoiler with more colons than the inner.
+var spoilers = spoilerExtension{}
+
+// kindSpoiler is the AST node kind of a spoiler.
+var kindSpoiler = ast.NewNodeKind("Spoiler")
+
+// spoiler is a spoiler container in the AST.
+type spoiler struct {
+	ast.BaseBlock
+	// Title is the text following `spoiler` on the opening line.
+	Title []byte
+	// fence is the number of colons that opened the spoiler, and so the least that can close it.
+	fence int
+}
+
+func (n *spoiler) Kind() ast.NodeKind {
+	return kindSpoiler
+}
+
+func (n *spoiler) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Title": string(n.Title)}, nil)
+}
+
+// spoilerParser parses spoiler containers.
+type spoilerParser struct{}
+
+func (spoilerParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (spoilerParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, _ := reader.PeekLine()
+
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, parser.NoChildren
+	}
+
+	fence := fenceLength(line[pos:])
+	if fence < 3 {
+		return nil, parser.NoChildren
+	}
+
+	// As with markdown-it, a container's only a spoiler if it's given a title.
+	params := bytes.TrimSpace(line[pos+fence:])
+	if !bytes.HasPrefix(params, []byte("spoiler")) {
+		return nil, parser.NoChildren
+	}
+
+	title := params[len("spoiler"):]
+	if len(title) == 0 || !util.IsSpace(title[0]) {
+		return nil, parser.NoChildren
+	}
+
+	reader.AdvanceToEOL()
+
+	return &spoiler{Title: bytes.TrimSpace(title), fence: fence}, parser.HasChildren
+}
+
+func (spoilerParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, _ := reader.PeekLine()
+
+	w, pos := util.IndentWidth(line, reader.LineOffset())
+	if w < 4 {
+		fence := fenceLength(line[pos:])
+
+		if fence >= node.(*spoiler).fence && util.IsBlank(line[pos+fence:]) {
+			reader.AdvanceToEOL()
+			return parser.Close
+		}
+	}
+
+	return parser.Continue | parser.HasChildren
+}
+
+func (spoilerParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (spoilerParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (spoilerParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// fenceLength returns the number of colons at the start of `line`.
+func fenceLength(line []byte) int {
+	n := 0
+	for n < len(line) && line[n] == ':' {
+		n++
+	}
+
+	return n
+}
+
+// spoilerRenderer renders spoilers as the browser does, but with the button and the content
+// adjacent, so that the content is the button's next sibling.
+type spoilerRenderer struct{}
+
+func (r spoilerRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindSpoiler, r.render)
+}
+
+func (spoilerRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		w.WriteString("</div>\n")
+		return ast.WalkContinue, nil
+	}
+
+	w.WriteString(`<button class="article-spoiler-button">Spoiler: `)
+	w.Write(util.EscapeHTML(node.(*spoiler).Title))
+	w.WriteString(`</button><div class="article-spoiler">` + "\n")
+
+	return ast.WalkContinue, nil
+}
+
+// spoilerExtension adds spoilerParser and spoilerRenderer to a goldmark.Markdown.
+type spoilerExtension struct{}
+
+func (spoilerExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(spoilerParser{}, 750)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(spoilerRenderer{}, 500)))
+}
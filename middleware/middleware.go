@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -64,6 +65,25 @@ func Validate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Suspended users are signed out and turned away, whichever session they're using.
+		if u.IsSuspended {
+			if err := session.Destroy(sid); err != nil {
+				log.Printf("Could not destroy session of suspended user %q: %s", u.ID, err)
+			}
+
+			c.MaxAge = -1
+			c.Expires = time.Date(2000, time.January, 1, 1, 0, 0, 0, time.UTC)
+
+			http.SetCookie(w, c)
+			http.Error(w, "This account has been suspended", http.StatusForbidden)
+			return
+		}
+
+		// When the user was last seen is non-essential, so simply log the error.
+		if err := users.Seen(u, time.Now().UTC()); err != nil {
+			log.Printf("Could not record when user %q was last seen: %s", u.ID, err)
+		}
+
 		// We'll want to bind the user's data to the context so we needn't make another DB request for
 		// it. We'll also add this session to the context.
 		ctx := users.NewContext(req.Context(), u)
@@ -103,6 +123,26 @@ func ValidateMFA(next http.Handler) http.Handler {
 	})
 }
 
+// RequireAdmin refuses the request with a 403 unless the user is an admin. It needs to follow
+// Validate, which places the user in the request context.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		u := users.FromContext(req.Context())
+		if u == nil {
+			msg := "RequireAdmin: could not read user data from request context"
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+
+		if !u.IsAdmin {
+			http.Error(w, "You must be an admin to do that", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
 var cspString string
 
 // InitCSP initializes the Content Security Policy string from the Viper config. It needs to be
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+)
+
+const migrateUsage = "usage: peppercorn migrate up|status|avatars"
+
+// migrate runs the `migrate` command. `migrate up` applies any pending migrations,
+// `migrate status` lists every migration and whether it's been applied, and `migrate avatars`
+// applies any pending migrations, then fetches the avatars still given as URLs to other hosts.
+func migrate(m db.Migrator, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := db.Up(m)
+		if err != nil {
+			return err
+		}
+
+		if len(done) == 0 {
+			fmt.Printf("Database is up to date at version %d\n", db.Latest())
+		}
+
+		return nil
+	case "status":
+		ss, err := db.Status(m)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+
+		for _, s := range ss {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+
+			description := s.Description
+			if s.Version > db.Latest() {
+				description = "(unknown to this build)"
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, applied, description)
+		}
+
+		return w.Flush()
+	case "avatars":
+		if _, err := db.Up(m); err != nil {
+			return err
+		}
+
+		return fetchAvatars()
+	}
+
+	return errors.New(migrateUsage)
+}
@@ -0,0 +1,93 @@
+package moderation
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// memoryStore is a Store that keeps the moderation log in process memory. Nothing is persisted, so
+// it's useful only for development and tests.
+type memoryStore struct {
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) Insert(e *Entry) error {
+	if e == nil {
+		return errors.New("moderation: cannot insert nil entry")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, *e)
+
+	return nil
+}
+
+func (s *memoryStore) List(limit int) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	es := make([]Entry, len(s.entries))
+	copy(es, s.entries)
+
+	// Newest first, breaking ties by ID.
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].Time.Equal(es[j].Time) {
+			return es[i].ID > es[j].ID
+		}
+
+		return es[i].Time.After(es[j].Time)
+	})
+
+	if len(es) > limit {
+		es = es[:limit]
+	}
+
+	return es, nil
+}
+
+func (s *memoryStore) All() ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	es := make([]Entry, len(s.entries))
+	copy(es, s.entries)
+
+	// Oldest first, breaking ties by ID.
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].Time.Equal(es[j].Time) {
+			return es[i].ID < es[j].ID
+		}
+
+		return es[i].Time.Before(es[j].Time)
+	})
+
+	return es, nil
+}
+
+func (s *memoryStore) ForPosts(postIDs []string) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(postIDs))
+	for _, id := range postIDs {
+		wanted[id] = true
+	}
+
+	var es []Entry
+	for _, e := range s.entries {
+		if wanted[e.PostID] {
+			es = append(es, e)
+		}
+	}
+
+	return es, nil
+}
@@ -0,0 +1,200 @@
+// Package moderation lets admins act on any user's posts: deactivating them with a reason,
+// restoring them, and purging them for good. Every action is recorded in a log that admins can
+// read.
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// Action is the kind of moderation an Entry records.
+type Action string
+
+const (
+	// ActionDeactivate records the removal of a post from the thread.
+	ActionDeactivate Action = "deactivate"
+	// ActionRestore records the return of a deactivated post to the thread.
+	ActionRestore Action = "restore"
+	// ActionPurge records the deletion of a deactivated post for good.
+	ActionPurge Action = "purge"
+)
+
+// Entry is a record in the moderation log of a single action an admin took on a post. The post's
+// number and author are copied into it so that the entry still reads sensibly once the post has
+// been purged.
+type Entry struct {
+	ID          string       `gorethink:"id"`
+	Time        time.Time    `gorethink:"time"`
+	ModeratorID string       `gorethink:"moderator_id"`
+	Action      Action       `gorethink:"action"`
+	PostID      string       `gorethink:"post_id"`
+	Number      db.CountType `gorethink:"number"`
+	AuthorID    string       `gorethink:"author_id"`
+	Reason      string       `gorethink:"reason"`
+}
+
+// MaxReasonLength is the longest reason, in bytes, that can be given for an action.
+const MaxReasonLength = 500
+
+// Deactivate removes the post with `postID` from the thread on behalf of the admin with
+// `moderatorID`, who must give a reason. Errs if the post doesn't exist or is already inactive.
+func Deactivate(moderatorID string, postID string, reason string) (*Entry, error) {
+	reason = strings.TrimSpace(reason)
+	if len(reason) == 0 {
+		return nil, errors.New("moderation: a reason is required to deactivate a post")
+	}
+
+	p, err := getPost(moderatorID, postID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.Active {
+		return nil, fmt.Errorf("moderation: post %d is already inactive", p.Number)
+	}
+
+	if err := posts.Deactivate(postID); err != nil {
+		return nil, err
+	}
+
+	return record(moderatorID, ActionDeactivate, p, reason)
+}
+
+// Restore returns the deactivated post with `postID` to the thread on behalf of the admin with
+// `moderatorID`. Errs if the post doesn't exist or is already active.
+func Restore(moderatorID string, postID string) (*Entry, error) {
+	p, err := getPost(moderatorID, postID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Active {
+		return nil, fmt.Errorf("moderation: post %d is already active", p.Number)
+	}
+
+	if err := posts.Activate(postID); err != nil {
+		return nil, err
+	}
+
+	return record(moderatorID, ActionRestore, p, "")
+}
+
+// Purge deletes the deactivated post with `postID` for good on behalf of the admin with
+// `moderatorID`, as posts.Purge does. The reason is optional, as the post will already have been
+// deactivated with one.
+func Purge(moderatorID string, postID string, reason string) (*Entry, error) {
+	reason = strings.TrimSpace(reason)
+
+	p, err := getPost(moderatorID, postID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := posts.Purge(postID); err != nil {
+		return nil, err
+	}
+
+	return record(moderatorID, ActionPurge, p, reason)
+}
+
+// Log returns up to `limit` entries from the moderation log, newest first.
+func Log(limit int) ([]Entry, error) {
+	if limit < 1 {
+		return nil, errors.New("moderation: limit must be at least 1")
+	}
+
+	return store.List(limit)
+}
+
+// All returns every entry in the moderation log, oldest first.
+func All() ([]Entry, error) {
+	return store.All()
+}
+
+// RestoreEntry inserts an entry exactly as given, keeping its ID and time, whether or not its post
+// still exists. It's intended for restoring the log from an archive.
+func RestoreEntry(e *Entry) error {
+	if e == nil || e.ID == "" || e.ModeratorID == "" || e.PostID == "" {
+		return errors.New("moderation: invalid Entry supplied")
+	}
+
+	return store.Insert(e)
+}
+
+// Deactivations returns, keyed by post ID, the entry recording why each inactive post of `ps` was
+// last deactivated. Posts deactivated by their authors have no entry.
+func Deactivations(ps []posts.Zip) (map[string]Entry, error) {
+	var ids []string
+	for i := range ps {
+		if !ps[i].Active {
+			ids = append(ids, ps[i].ID)
+		}
+	}
+
+	m := make(map[string]Entry)
+
+	if len(ids) == 0 {
+		return m, nil
+	}
+
+	es, err := store.ForPosts(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range es {
+		if e.Action != ActionDeactivate {
+			continue
+		}
+
+		if last, ok := m[e.PostID]; !ok || e.Time.After(last.Time) {
+			m[e.PostID] = e
+		}
+	}
+
+	return m, nil
+}
+
+// getPost validates the arguments common to each action and returns the post to act upon.
+func getPost(moderatorID string, postID string, reason string) (*posts.Post, error) {
+	if len(moderatorID) == 0 {
+		return nil, errors.New("moderation: moderator ID cannot be empty")
+	}
+
+	if len(postID) == 0 {
+		return nil, errors.New("moderation: post ID cannot be empty")
+	}
+
+	if len(reason) > MaxReasonLength {
+		return nil, fmt.Errorf("moderation: reason is longer than the limit of %d bytes", MaxReasonLength)
+	}
+
+	return posts.GetByID(postID)
+}
+
+// record adds an entry for `action` on `p` to the log, returning it.
+func record(moderatorID string, action Action, p *posts.Post, reason string) (*Entry, error) {
+	e := Entry{
+		ID:          utility.GenerateUUID(),
+		Time:        time.Now().UTC(),
+		ModeratorID: moderatorID,
+		Action:      action,
+		PostID:      p.ID,
+		Number:      p.Number,
+		AuthorID:    p.Author,
+		Reason:      reason,
+	}
+
+	if err := store.Insert(&e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
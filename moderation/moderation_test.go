@@ -0,0 +1,198 @@
+package moderation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/attachments"
+	"github.com/boatilus/peppercorn/db/dbtest"
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/reactions"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableName = "moderation_log_test"
+
+func init() {
+	viper.Set("db.moderation_log_table", tableName)
+
+	posts.SetStore(posts.NewMemoryStore())
+	reactions.SetStore(reactions.NewMemoryStore())
+	notifications.SetStore(notifications.NewMemoryStore())
+	attachments.SetStore(attachments.NewMemoryStore())
+	attachments.SetBlobStore(attachments.NewMemoryBlobStore())
+
+	switch backend, conn := dbtest.Setup("moderation", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
+	}
+}
+
+// submit adds an active post by `author`, returning its ID.
+func submit(t *testing.T, author string) string {
+	id, err := posts.Submit(&posts.Post{Active: true, Author: author, Content: "content", Time: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func TestDeactivateAndRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	id := submit(t, "author")
+
+	_, err := Deactivate("mod", id, "  ")
+	assert.Error(err, "a reason is required")
+
+	_, err = Deactivate("", id, "spam")
+	assert.Error(err)
+
+	_, err = Deactivate("mod", "missing", "spam")
+	assert.Error(err)
+
+	_, err = Deactivate("mod", id, string(make([]byte, MaxReasonLength+1)))
+	assert.Error(err)
+
+	_, err = Restore("mod", id)
+	assert.Error(err, "an active post cannot be restored")
+
+	e, err := Deactivate("mod", id, " spam ")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.Equal(ActionDeactivate, e.Action)
+	assert.Equal("mod", e.ModeratorID)
+	assert.Equal("author", e.AuthorID)
+	assert.Equal("spam", e.Reason)
+
+	p, err := posts.GetByID(id)
+	if assert.NoError(err) {
+		assert.False(p.Active)
+		assert.Equal(p.Number, e.Number)
+	}
+
+	_, err = Deactivate("mod", id, "spam")
+	assert.Error(err, "an inactive post cannot be deactivated again")
+
+	e, err = Restore("mod", id)
+	if assert.NoError(err) {
+		assert.Equal(ActionRestore, e.Action)
+		assert.Empty(e.Reason)
+	}
+
+	p, err = posts.GetByID(id)
+	if assert.NoError(err) {
+		assert.True(p.Active)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	assert := assert.New(t)
+
+	id := submit(t, "author")
+
+	_, err := Purge("mod", id, "")
+	assert.Error(err, "an active post cannot be purged")
+
+	if _, err := Deactivate("mod", id, "spam"); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Purge("mod", id, "")
+	if assert.NoError(err) {
+		assert.Equal(ActionPurge, e.Action)
+		assert.Equal(id, e.PostID)
+		assert.Equal("author", e.AuthorID)
+	}
+
+	_, err = posts.GetByID(id)
+	assert.Error(err)
+
+	_, err = Purge("mod", id, "")
+	assert.Error(err)
+}
+
+func TestLog(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Log(0)
+	assert.Error(err)
+
+	id := submit(t, "author")
+
+	if _, err := Deactivate("mod", id, "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the entries' times apart, as not every store keeps sub-second precision.
+	time.Sleep(time.Second)
+
+	if _, err := Restore("mod", id); err != nil {
+		t.Fatal(err)
+	}
+
+	es, err := Log(2)
+	if assert.NoError(err) && assert.Len(es, 2) {
+		assert.Equal(ActionRestore, es[0].Action, "newest first")
+		assert.Equal(ActionDeactivate, es[1].Action)
+		assert.Equal(id, es[0].PostID)
+	}
+
+	es, err = Log(1)
+	if assert.NoError(err) {
+		assert.Len(es, 1)
+	}
+}
+
+func TestDeactivations(t *testing.T) {
+	assert := assert.New(t)
+
+	id := submit(t, "author")
+	other := submit(t, "author")
+
+	if _, err := Deactivate("mod", id, "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second)
+
+	if _, err := Restore("mod", id); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second)
+
+	if _, err := Deactivate("mod", id, "second"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Deactivate("mod", other, "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore("mod", other); err != nil {
+		t.Fatal(err)
+	}
+
+	zs := []posts.Zip{{ID: id, Active: false}, {ID: other, Active: true}, {ID: "by-author", Active: false}}
+
+	m, err := Deactivations(zs)
+	if assert.NoError(err) {
+		assert.Len(m, 1, "only inactive posts deactivated by an admin have an entry")
+		assert.Equal("second", m[id].Reason, "the latest deactivation is used")
+	}
+
+	m, err = Deactivations(nil)
+	if assert.NoError(err) {
+		assert.Empty(m)
+	}
+}
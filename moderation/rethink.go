@@ -0,0 +1,56 @@
+package moderation
+
+import (
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by the
+// `db.moderation_log_table` config value.
+type rethinkStore struct{}
+
+// getTable returns the table term for the moderation log table.
+func getTable() rethink.Term {
+	return db.Get().Table(viper.GetString("db.moderation_log_table"))
+}
+
+// all runs `t`, reading every entry it yields.
+func (rethinkStore) all(t rethink.Term) ([]Entry, error) {
+	cursor, err := t.Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var es []Entry
+	if err := cursor.All(&es); err != nil {
+		return nil, err
+	}
+
+	return es, nil
+}
+
+func (rethinkStore) Insert(e *Entry) error {
+	_, err := getTable().Insert(e).RunWrite(db.Session)
+
+	return err
+}
+
+func (s rethinkStore) List(limit int) ([]Entry, error) {
+	return s.all(getTable().OrderBy(rethink.OrderByOpts{Index: rethink.Desc("time")}).Limit(limit))
+}
+
+func (s rethinkStore) ForPosts(postIDs []string) ([]Entry, error) {
+	keys := make([]interface{}, len(postIDs))
+	for i := range postIDs {
+		keys[i] = postIDs[i]
+	}
+
+	return s.all(getTable().GetAllByIndex("post_id", keys...))
+}
+
+func (s rethinkStore) All() ([]Entry, error) {
+	return s.all(getTable().OrderBy(rethink.OrderByOpts{Index: rethink.Asc("time")}))
+}
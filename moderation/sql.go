@@ -0,0 +1,74 @@
+package moderation
+
+import (
+	"strings"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by the
+// `db.moderation_log_table` config value.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+func getTableName() string {
+	return viper.GetString("db.moderation_log_table")
+}
+
+const columns = "id, time, moderator_id, action, post_id, number, author_id, reason"
+
+// query runs a SELECT of every column with `clause` appended, scanning each row into an Entry.
+func (s *sqlStore) query(clause string, args ...interface{}) ([]Entry, error) {
+	rows, err := s.conn.Query("SELECT "+columns+" FROM "+getTableName()+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var es []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.Time, &e.ModeratorID, &e.Action, &e.PostID, &e.Number, &e.AuthorID, &e.Reason); err != nil {
+			return nil, err
+		}
+
+		es = append(es, e)
+	}
+
+	return es, rows.Err()
+}
+
+func (s *sqlStore) Insert(e *Entry) error {
+	q := "INSERT INTO " + getTableName() + " (" + columns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+
+	_, err := s.conn.Exec(q, e.ID, e.Time.UTC(), e.ModeratorID, e.Action, e.PostID, e.Number, e.AuthorID, e.Reason)
+
+	return err
+}
+
+func (s *sqlStore) List(limit int) ([]Entry, error) {
+	return s.query(" ORDER BY time DESC, id DESC LIMIT ?", limit)
+}
+
+func (s *sqlStore) ForPosts(postIDs []string) ([]Entry, error) {
+	args := make([]interface{}, len(postIDs))
+	for i := range postIDs {
+		args[i] = postIDs[i]
+	}
+
+	params := strings.TrimSuffix(strings.Repeat("?, ", len(postIDs)), ", ")
+
+	return s.query(" WHERE post_id IN ("+params+")", args...)
+}
+
+func (s *sqlStore) All() ([]Entry, error) {
+	return s.query(" ORDER BY time, id")
+}
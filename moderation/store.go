@@ -0,0 +1,24 @@
+package moderation
+
+// Store is the interface through which the moderation log is read and written. The package-level
+// functions validate their arguments and delegate to the current Store, so callers need never know
+// which backend is in use.
+type Store interface {
+	// Insert adds an entry to the log.
+	Insert(e *Entry) error
+	// List returns up to `limit` entries, newest first.
+	List(limit int) ([]Entry, error)
+	// ForPosts returns every entry for any of the posts with `postIDs`, in no particular order.
+	ForPosts(postIDs []string) ([]Entry, error)
+	// All returns every entry, oldest first.
+	All() ([]Entry, error)
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
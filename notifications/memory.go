@@ -0,0 +1,144 @@
+package notifications
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// memoryStore is a Store that keeps all notifications in process memory. Nothing is persisted, so
+// it's useful only for development and tests.
+type memoryStore struct {
+	mu            sync.RWMutex
+	notifications map[string]Notification
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{notifications: make(map[string]Notification)}
+}
+
+// byTime sorts notifications oldest first, breaking ties by ID.
+type byTime []Notification
+
+func (ns byTime) Len() int      { return len(ns) }
+func (ns byTime) Swap(i, j int) { ns[i], ns[j] = ns[j], ns[i] }
+func (ns byTime) Less(i, j int) bool {
+	if ns[i].Time.Equal(ns[j].Time) {
+		return ns[i].ID < ns[j].ID
+	}
+
+	return ns[i].Time.Before(ns[j].Time)
+}
+
+func (s *memoryStore) Insert(n *Notification) error {
+	if n == nil {
+		return errors.New("notifications: cannot insert nil notification")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notifications[n.ID]; !ok {
+		s.notifications[n.ID] = *n
+	}
+
+	return nil
+}
+
+func (s *memoryStore) ForUser(userID string, limit int) ([]Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ns []Notification
+	for _, n := range s.notifications {
+		if n.UserID == userID {
+			ns = append(ns, n)
+		}
+	}
+
+	// Newest first, breaking ties by ID.
+	sort.Slice(ns, func(i, j int) bool {
+		if ns[i].Time.Equal(ns[j].Time) {
+			return ns[i].ID > ns[j].ID
+		}
+
+		return ns[i].Time.After(ns[j].Time)
+	})
+
+	if len(ns) > limit {
+		ns = ns[:limit]
+	}
+
+	return ns, nil
+}
+
+func (s *memoryStore) Unread(userID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, n := range s.notifications {
+		if n.UserID == userID && !n.Read {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *memoryStore) MarkRead(userID string, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notifications[id]
+	if !ok || n.UserID != userID {
+		return false, nil
+	}
+
+	n.Read = true
+	s.notifications[id] = n
+
+	return true, nil
+}
+
+func (s *memoryStore) MarkAllRead(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, n := range s.notifications {
+		if n.UserID == userID {
+			n.Read = true
+			s.notifications[id] = n
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) DeleteForPost(postID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, n := range s.notifications {
+		if n.PostID == postID {
+			delete(s.notifications, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) All() ([]Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ns := make([]Notification, 0, len(s.notifications))
+	for _, n := range s.notifications {
+		ns = append(ns, n)
+	}
+
+	sort.Sort(byTime(ns))
+
+	return ns, nil
+}
@@ -0,0 +1,129 @@
+// Package notifications records the notifications shown to users, such as when another user
+// mentions them in a post. Each user is notified at most once of being mentioned in a given post,
+// however often it's edited.
+package notifications
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+)
+
+// Notification tells the user with UserID that the user with ActorID mentioned them in the post
+// with PostID and Number.
+type Notification struct {
+	ID      string       `gorethink:"id"`
+	UserID  string       `gorethink:"user_id"`
+	ActorID string       `gorethink:"actor_id"`
+	PostID  string       `gorethink:"post_id"`
+	Number  db.CountType `gorethink:"number"`
+	Time    time.Time    `gorethink:"time"`
+	Read    bool         `gorethink:"read"`
+}
+
+// Link returns the path that leads to the post the notification is about.
+func (n *Notification) Link() string {
+	return fmt.Sprintf("/posts/%d/jump", n.Number)
+}
+
+// id returns the ID of the notification to the user with `userID` about the post with `postID`.
+func id(userID string, postID string) string {
+	sum := sha1.Sum([]byte(userID + "\x00" + postID))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Mention notifies the user with `userID` that the user with `actorID` mentioned them in the post
+// with `postID` and `number`. A user already notified of the post isn't notified again, and the
+// earlier notification is left as it was, read or not.
+func Mention(userID string, actorID string, postID string, number db.CountType) error {
+	if len(userID) == 0 || len(actorID) == 0 || len(postID) == 0 {
+		return errors.New("notifications: user, actor and post IDs cannot be empty")
+	}
+
+	n := Notification{
+		ID:      id(userID, postID),
+		UserID:  userID,
+		ActorID: actorID,
+		PostID:  postID,
+		Number:  number,
+		Time:    time.Now().UTC(),
+	}
+
+	return store.Insert(&n)
+}
+
+// ForUser returns up to `limit` of the notifications to the user with `userID`, newest first.
+func ForUser(userID string, limit int) ([]Notification, error) {
+	if len(userID) == 0 {
+		return nil, errors.New("notifications: user ID cannot be empty")
+	}
+
+	return store.ForUser(userID, limit)
+}
+
+// Unread returns how many of the notifications to the user with `userID` are unread.
+func Unread(userID string) (int, error) {
+	if len(userID) == 0 {
+		return 0, errors.New("notifications: user ID cannot be empty")
+	}
+
+	return store.Unread(userID)
+}
+
+// MarkRead marks the notification with `id` to the user with `userID` as read. It's an error if the
+// user has no such notification.
+func MarkRead(userID string, id string) error {
+	if len(userID) == 0 || len(id) == 0 {
+		return errors.New("notifications: user and notification IDs cannot be empty")
+	}
+
+	found, err := store.MarkRead(userID, id)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("No notification found with ID %q", id)
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every notification to the user with `userID` as read.
+func MarkAllRead(userID string) error {
+	if len(userID) == 0 {
+		return errors.New("notifications: user ID cannot be empty")
+	}
+
+	return store.MarkAllRead(userID)
+}
+
+// DeleteForPost deletes every notification about the post with `postID`, as when it's purged and
+// there's no longer anything to link to.
+func DeleteForPost(postID string) error {
+	if len(postID) == 0 {
+		return errors.New("notifications: post ID cannot be empty")
+	}
+
+	return store.DeleteForPost(postID)
+}
+
+// All returns every notification to every user, oldest first.
+func All() ([]Notification, error) {
+	return store.All()
+}
+
+// Restore inserts a notification exactly as given, keeping its ID, time and whether it's been read.
+// It's intended for restoring notifications from an archive.
+func Restore(n *Notification) error {
+	if n == nil || n.ID == "" || n.UserID == "" || n.ActorID == "" || n.PostID == "" {
+		return errors.New("notifications: invalid Notification supplied")
+	}
+
+	return store.Insert(n)
+}
@@ -0,0 +1,124 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/db/dbtest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableName = "notifications_test"
+
+func init() {
+	viper.Set("db.notifications_table", tableName)
+
+	switch backend, conn := dbtest.Setup("notifications", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
+	}
+}
+
+func TestMention(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(Mention("", "actor", "post", 1))
+	assert.Error(Mention("user", "", "post", 1))
+	assert.Error(Mention("user", "actor", "", 1))
+
+	if !assert.NoError(Mention("mention", "actor", "post-1", 1)) {
+		t.FailNow()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	assert.NoError(Mention("mention", "actor", "post-2", 2))
+	assert.NoError(Mention("mention", "actor", "post-1", 1), "a second mention in a post shouldn't fail")
+
+	got, err := ForUser("mention", 10)
+	if !assert.NoError(err) || !assert.Len(got, 2) {
+		t.FailNow()
+	}
+
+	// Newest first.
+	assert.Equal("post-2", got[0].PostID)
+	assert.Equal("/posts/2/jump", got[0].Link())
+	assert.Equal("post-1", got[1].PostID)
+
+	got, err = ForUser("mention", 1)
+	assert.NoError(err)
+	assert.Len(got, 1)
+
+	_, err = ForUser("", 10)
+	assert.Error(err)
+}
+
+func TestMarkRead(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(Mention("read", "actor", "post-1", 1))
+	assert.NoError(Mention("read", "actor", "post-2", 2))
+	assert.NoError(Mention("other", "actor", "post-1", 1))
+
+	n, err := Unread("read")
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	got, _ := ForUser("read", 10)
+	if !assert.Len(got, 2) {
+		t.FailNow()
+	}
+
+	assert.NoError(MarkRead("read", got[0].ID))
+	assert.NoError(MarkRead("read", got[0].ID), "marking a notification read twice shouldn't fail")
+	assert.Error(MarkRead("read", "missing"))
+
+	others, _ := ForUser("other", 10)
+	if assert.Len(others, 1) {
+		assert.Error(MarkRead("read", others[0].ID), "a user shouldn't mark another's notification read")
+	}
+
+	n, _ = Unread("read")
+	assert.Equal(1, n)
+
+	// A notification marked read stays read when mentioned again.
+	assert.NoError(Mention("read", "actor", got[0].PostID, got[0].Number))
+
+	n, _ = Unread("read")
+	assert.Equal(1, n)
+
+	assert.NoError(MarkAllRead("read"))
+
+	n, _ = Unread("read")
+	assert.Zero(n)
+
+	n, _ = Unread("other")
+	assert.Equal(1, n)
+}
+
+func TestDeleteForPost(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(DeleteForPost(""))
+
+	assert.NoError(Mention("delete", "actor", "delete-1", 1))
+	assert.NoError(Mention("delete", "actor", "delete-2", 2))
+	assert.NoError(Mention("delete-other", "actor", "delete-1", 1))
+
+	assert.NoError(DeleteForPost("delete-1"))
+
+	got, err := ForUser("delete", 10)
+	if assert.NoError(err) && assert.Len(got, 1) {
+		assert.Equal("delete-2", got[0].PostID)
+	}
+
+	got, err = ForUser("delete-other", 10)
+	if assert.NoError(err) {
+		assert.Empty(got)
+	}
+}
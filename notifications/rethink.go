@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"sort"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by the
+// `db.notifications_table` config value.
+type rethinkStore struct{}
+
+// getTable returns the table term for the notifications table.
+func getTable() rethink.Term {
+	return db.Get().Table(viper.GetString("db.notifications_table"))
+}
+
+func (rethinkStore) Insert(n *Notification) error {
+	// Keeping the existing document on a conflict leaves an earlier notification read, if it was.
+	keep := func(id rethink.Term, existing rethink.Term, inserted rethink.Term) interface{} {
+		return existing
+	}
+
+	_, err := getTable().Insert(n, rethink.InsertOpts{Conflict: keep}).RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) ForUser(userID string, limit int) ([]Notification, error) {
+	cursor, err := getTable().
+		GetAllByIndex("user_id", userID).
+		OrderBy(rethink.Desc("time"), rethink.Desc("id")).
+		Limit(limit).
+		Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var ns []Notification
+	if err := cursor.All(&ns); err != nil {
+		return nil, err
+	}
+
+	return ns, nil
+}
+
+func (rethinkStore) Unread(userID string) (int, error) {
+	cursor, err := getTable().
+		GetAllByIndex("user_id", userID).
+		Filter(map[string]interface{}{"read": false}).
+		Count().
+		Run(db.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	defer cursor.Close()
+
+	var count int
+	if err := cursor.One(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (rethinkStore) MarkRead(userID string, id string) (bool, error) {
+	res, err := getTable().
+		GetAllByIndex("user_id", userID).
+		Filter(map[string]interface{}{"id": id}).
+		Update(map[string]interface{}{"read": true}).
+		RunWrite(db.Session)
+	if err != nil {
+		return false, err
+	}
+
+	return res.Replaced+res.Unchanged == 1, nil
+}
+
+func (rethinkStore) MarkAllRead(userID string) error {
+	_, err := getTable().
+		GetAllByIndex("user_id", userID).
+		Update(map[string]interface{}{"read": true}).
+		RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) DeleteForPost(postID string) error {
+	// Notifications are indexed by user rather than post, but posts are purged rarely enough that
+	// scanning the table is fine.
+	_, err := getTable().Filter(map[string]interface{}{"post_id": postID}).Delete().RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) All() ([]Notification, error) {
+	// Ordering a whole table without an index is limited to 100,000 documents, so sort here instead.
+	cursor, err := getTable().Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var ns []Notification
+	if err := cursor.All(&ns); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(byTime(ns))
+
+	return ns, nil
+}
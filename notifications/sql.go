@@ -0,0 +1,100 @@
+package notifications
+
+import (
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by the
+// `db.notifications_table` config value.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+func getTableName() string {
+	return viper.GetString("db.notifications_table")
+}
+
+const columns = "id, user_id, actor_id, post_id, number, time, read"
+
+func (s *sqlStore) Insert(n *Notification) error {
+	// Both SQLite and PostgreSQL skip a row that conflicts with an existing one this way.
+	q := "INSERT INTO " + getTableName() + " (" + columns + ") VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING"
+
+	_, err := s.conn.Exec(q, n.ID, n.UserID, n.ActorID, n.PostID, n.Number, n.Time.UTC(), n.Read)
+
+	return err
+}
+
+// query runs a SELECT of every column with `clause` appended, scanning each row into a
+// Notification.
+func (s *sqlStore) query(clause string, args ...interface{}) ([]Notification, error) {
+	rows, err := s.conn.Query("SELECT "+columns+" FROM "+getTableName()+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ns []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.PostID, &n.Number, &n.Time, &n.Read); err != nil {
+			return nil, err
+		}
+
+		ns = append(ns, n)
+	}
+
+	return ns, rows.Err()
+}
+
+func (s *sqlStore) ForUser(userID string, limit int) ([]Notification, error) {
+	return s.query(" WHERE user_id = ? ORDER BY time DESC, id DESC LIMIT ?", userID, limit)
+}
+
+func (s *sqlStore) Unread(userID string) (int, error) {
+	var count int
+
+	q := "SELECT COUNT(*) FROM " + getTableName() + " WHERE user_id = ? AND read = ?"
+	if err := s.conn.QueryRow(q, userID, false).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *sqlStore) MarkRead(userID string, id string) (bool, error) {
+	res, err := s.conn.Exec("UPDATE "+getTableName()+" SET read = ? WHERE id = ? AND user_id = ?", true, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (s *sqlStore) MarkAllRead(userID string) error {
+	_, err := s.conn.Exec("UPDATE "+getTableName()+" SET read = ? WHERE user_id = ?", true, userID)
+
+	return err
+}
+
+func (s *sqlStore) DeleteForPost(postID string) error {
+	_, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE post_id = ?", postID)
+
+	return err
+}
+
+func (s *sqlStore) All() ([]Notification, error) {
+	return s.query(" ORDER BY time, id")
+}
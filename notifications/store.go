@@ -0,0 +1,31 @@
+package notifications
+
+// Store is the interface through which all notification data is read and written. The
+// package-level functions validate their arguments and delegate to the current Store, so callers
+// need never know which backend is in use.
+type Store interface {
+	// Insert adds a notification, doing nothing if there's already one with the same ID.
+	Insert(n *Notification) error
+	// ForUser returns up to `limit` of the notifications to the user with `userID`, newest first.
+	ForUser(userID string, limit int) ([]Notification, error)
+	// Unread counts the unread notifications to the user with `userID`.
+	Unread(userID string) (int, error)
+	// MarkRead marks the notification with `id` to the user with `userID` as read, and reports
+	// whether there was one.
+	MarkRead(userID string, id string) (bool, error)
+	// MarkAllRead marks every notification to the user with `userID` as read.
+	MarkAllRead(userID string) error
+	// DeleteForPost deletes every notification about the post with `postID`.
+	DeleteForPost(postID string) error
+	// All returns every notification to every user, oldest first.
+	All() ([]Notification, error)
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
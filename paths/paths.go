@@ -8,12 +8,22 @@ var Get struct {
 	SignOut string
 	// Page is the path to a single page of posts
 	Page string
+	// Posts is the path to a page of posts as JSON, selected by cursor
+	Posts string
 	// Single is the path to a single post at :num
 	Single string
 	// SingleRemove is the path to remove a single post
 	SingleRemove string
+	// SingleJump is the path that redirects to the page on which the post at :num is seen
+	SingleJump string
+	// Revisions is the path to every version of a single post
+	Revisions string
+	// RevisionsDiff is the path to the differences between two versions of a single post
+	RevisionsDiff string
 	// TotalPostCount is the path to a single number reflecting the total number of posts
 	TotalPostCount string
+	// PostsStream is the path to the Server-Sent Events stream of new, edited and removed posts
+	PostsStream string
 	// Me is the path to the user's info page and settings
 	Me string
 	// MeRevoke is the path to remove a single session
@@ -31,6 +41,35 @@ var Get struct {
 	// RecoveryCodes is the path to display account recovery codes if the user's lost his/her
 	// authenticator.
 	RecoveryCodes string
+	// Search is the path to search the posts
+	Search string
+	// Notifications is the path to the user's notifications
+	Notifications string
+	// Attachment is the path to the contents of the attachment at :num
+	Attachment string
+	// AttachmentThumbnail is the path to the thumbnail of the image attachment at :num
+	AttachmentThumbnail string
+	// Avatar is the path to the avatar at :num
+	Avatar string
+	// SmallAvatar is the path to the small size of the avatar at :num
+	SmallAvatar string
+	// Moderation is the path to the moderation log, seen only by admins
+	Moderation string
+	// AdminUsers is the path to the list of users, seen only by admins
+	AdminUsers string
+	// AdminUser is the path to manage the user whose ID is at :num, seen only by admins
+	AdminUser string
+	// AdminLocks is the path to the accounts and addresses locked out after too many failed
+	// attempts, seen only by admins
+	AdminLocks string
+	// Invites is the path to the list of invites the user has sent
+	Invites string
+	// Invite is the path at which an invite, given by its token, is accepted
+	Invite string
+	// User is the path to the profile of the user named :name
+	User string
+	// ConfirmEmail is the path at which a change of email, given by its token, is confirmed
+	ConfirmEmail string
 }
 
 // Post is a struct containing routing paths to POST requests
@@ -51,21 +90,83 @@ var Post struct {
 	EnableTwoFactorAuthentication string
 	// EnterCode is the path to which a TOTP code is POSTed to reverify the MFA session
 	EnterCode string
+	// Reactions is the path to which reactions to a single post are POSTed
+	Reactions string
+	// NotificationRead is the path to which a single notification at :num is POSTed to mark it read
+	NotificationRead string
+	// NotificationsRead is the path to which all the user's notifications are POSTed to mark them
+	// read
+	NotificationsRead string
+	// Attachments is the path to which files are POSTed to be attached to posts
+	Attachments string
+	// SingleDeactivate is the path to which an admin POSTs the reason for deactivating any post
+	SingleDeactivate string
+	// SingleRestore is the path to which an admin POSTs to restore a deactivated post
+	SingleRestore string
+	// SinglePurge is the path to which an admin POSTs to delete a deactivated post for good
+	SinglePurge string
+	// AdminUsers is the path to which an admin POSTs a new user's details
+	AdminUsers string
+	// AdminUser is the path to which an admin POSTs changes to the details of the user at :num
+	AdminUser string
+	// AdminUserSuspend is the path to which an admin POSTs to suspend the user at :num
+	AdminUserSuspend string
+	// AdminUserUnsuspend is the path to which an admin POSTs to lift the suspension of the user at
+	// :num
+	AdminUserUnsuspend string
+	// AdminUserResetPassword is the path to which an admin POSTs to force the user at :num to reset
+	// their password
+	AdminUserResetPassword string
+	// AdminUserResetTwoFactor is the path to which an admin POSTs to turn off 2FA for the user at
+	// :num
+	AdminUserResetTwoFactor string
+	// AdminUserRevokeSessions is the path to which an admin POSTs to sign the user at :num out
+	// everywhere
+	AdminUserRevokeSessions string
+	// AdminLocksClear is the path to which an admin POSTs an account or address to lift its lock
+	AdminLocksClear string
+	// Invites is the path to which the email address to invite is POSTed
+	Invites string
+	// InviteRevoke is the path to which a POST revokes the invite at :num
+	InviteRevoke string
+	// Invite is the path to which a new user POSTs the name and password they've chosen
+	Invite string
+	// MeEmail is the path to which the user POSTs the new email they'd like to sign in with
+	MeEmail string
+	// MeEmailCancel is the path to which a POST withdraws the user's pending change of email
+	MeEmailCancel string
+	// MePassword is the path to which the user POSTs their current password and a new one
+	MePassword string
+	// ConfirmEmail is the path to which a change of email, given by its token, is POSTed to confirm it
+	ConfirmEmail string
 }
 
 // Patch is a struct containing routing paths to PATCH requests
 var Patch struct {
 	// Single is the path to which edited post contents are PACTHed
 	Single string
+	// Drafts is the path to which the user's draft reply is PATCHed
+	Drafts string
+}
+
+// Delete is a struct containing routing paths to DELETE requests
+var Delete struct {
+	// Reactions is the path from which the user's reactions to a single post are DELETEd
+	Reactions string
 }
 
 func init() {
 	Get.SignIn = "/sign-in"
 	Get.SignOut = "/sign-out"
 	Get.Page = "/page/:num"
+	Get.Posts = "/posts"
 	Get.Single = "/posts/:num"
 	Get.SingleRemove = "/posts/:num/delete"
+	Get.SingleJump = "/posts/:num/jump"
+	Get.Revisions = "/posts/:num/revisions"
+	Get.RevisionsDiff = "/posts/:num/revisions/diff"
 	Get.TotalPostCount = "/posts/count"
+	Get.PostsStream = "/posts/stream"
 	Get.Me = "/me"
 	Get.MeRevoke = "/me/revoke/:num"
 	Get.Forgot = "/forgot"
@@ -74,6 +175,20 @@ func init() {
 	Get.DisableTwoFactorAuthentication = "/me/disable-two-factor-authentication"
 	Get.EnterCode = "/enter-code"
 	Get.RecoveryCodes = "/me/recovery-codes"
+	Get.Search = "/search"
+	Get.Notifications = "/notifications"
+	Get.Attachment = "/attachments/:num"
+	Get.AttachmentThumbnail = "/attachments/:num/thumbnail"
+	Get.Avatar = "/avatars/:num"
+	Get.SmallAvatar = "/avatars/:num/small"
+	Get.Moderation = "/moderation"
+	Get.AdminUsers = "/admin/users"
+	Get.AdminUser = "/admin/users/:num"
+	Get.AdminLocks = "/admin/locks"
+	Get.Invites = "/invites"
+	Get.Invite = "/invite"
+	Get.User = "/users/:name"
+	Get.ConfirmEmail = "/confirm-email"
 
 	Post.SignIn = "/sign-in"
 	Post.Me = "/me"
@@ -82,6 +197,31 @@ func init() {
 	Post.ResetPassword = "/reset-password"
 	Post.EnableTwoFactorAuthentication = "/me/enable-two-factor-authentication"
 	Post.EnterCode = "/enter-code"
+	Post.Reactions = "/posts/:num/reactions"
+	Post.NotificationRead = "/notifications/:num/read"
+	Post.NotificationsRead = "/notifications/read"
+	Post.Attachments = "/attachments"
+	Post.SingleDeactivate = "/posts/:num/deactivate"
+	Post.SingleRestore = "/posts/:num/restore"
+	Post.SinglePurge = "/posts/:num/purge"
+	Post.AdminUsers = "/admin/users"
+	Post.AdminUser = "/admin/users/:num"
+	Post.AdminUserSuspend = "/admin/users/:num/suspend"
+	Post.AdminUserUnsuspend = "/admin/users/:num/unsuspend"
+	Post.AdminUserResetPassword = "/admin/users/:num/reset-password"
+	Post.AdminUserResetTwoFactor = "/admin/users/:num/reset-two-factor-authentication"
+	Post.AdminUserRevokeSessions = "/admin/users/:num/revoke-sessions"
+	Post.AdminLocksClear = "/admin/locks/clear"
+	Post.Invites = "/invites"
+	Post.InviteRevoke = "/invites/:num/revoke"
+	Post.Invite = "/invite"
+	Post.MeEmail = "/me/email"
+	Post.MeEmailCancel = "/me/email/cancel"
+	Post.MePassword = "/me/password"
+	Post.ConfirmEmail = "/confirm-email"
 
 	Patch.Single = "/posts/:num"
+	Patch.Drafts = "/drafts"
+
+	Delete.Reactions = "/posts/:num/reactions"
 }
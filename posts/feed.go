@@ -0,0 +1,145 @@
+package posts
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ChangeType describes how a post changed.
+type ChangeType int
+
+const (
+	// Created means a post was submitted or reactivated.
+	Created ChangeType = iota
+	// Edited means an active post's content changed.
+	Edited
+	// Deactivated means a post was deactivated (i.e., removed).
+	Deactivated
+)
+
+// Change is a single change to a post, as delivered by Subscribe.
+type Change struct {
+	Type ChangeType
+	Post Post
+}
+
+// changeFeeder is implemented by Stores that can report changes to posts themselves, including
+// changes made by other processes, as RethinkDB's changefeeds do. For Stores that can't, the
+// package-level functions report the changes they make.
+type changeFeeder interface {
+	// Changes returns a channel of changes, which is closed if the feed fails.
+	Changes() (<-chan Change, error)
+}
+
+// subscriberBuffer is the number of changes a subscriber may fall behind by before further changes
+// are dropped for it.
+const subscriberBuffer = 16
+
+// retryInterval is the time to wait before resubscribing to a failed changefeed.
+const retryInterval = 5 * time.Second
+
+var feed = struct {
+	sync.Mutex
+	subscribers map[chan Change]struct{}
+	watching    bool
+}{subscribers: make(map[chan Change]struct{})}
+
+// Subscribe returns a channel on which every subsequent change to a post is delivered, and a
+// function that unsubscribes and closes the channel. Changes are dropped, rather than delivered
+// late, for subscribers that fall too far behind.
+func Subscribe() (<-chan Change, func()) {
+	ch := make(chan Change, subscriberBuffer)
+
+	feed.Lock()
+	defer feed.Unlock()
+
+	feed.subscribers[ch] = struct{}{}
+
+	if f, ok := store.(changeFeeder); ok && !feed.watching {
+		feed.watching = true
+		go watch(f)
+	}
+
+	var once sync.Once
+
+	return ch, func() {
+		once.Do(func() {
+			feed.Lock()
+			defer feed.Unlock()
+
+			delete(feed.subscribers, ch)
+			close(ch)
+		})
+	}
+}
+
+// publish delivers `c` to every subscriber.
+func publish(c Change) {
+	feed.Lock()
+	defer feed.Unlock()
+
+	for ch := range feed.subscribers {
+		select {
+		case ch <- c:
+		default:
+			log.Printf("posts: dropping change to post %q for a slow subscriber", c.Post.ID)
+		}
+	}
+}
+
+// watch publishes every change from `f` for the life of the process, resubscribing if it fails.
+func watch(f changeFeeder) {
+	for {
+		changes, err := f.Changes()
+		if err != nil {
+			log.Printf("posts: subscribing to changes: %s", err)
+		} else {
+			for c := range changes {
+				publish(c)
+			}
+
+			log.Print("posts: change feed closed")
+		}
+
+		time.Sleep(retryInterval)
+	}
+}
+
+// notify publishes the change from `old` to `new`, unless the store reports its own changes.
+// Either may be nil if the post didn't exist before or doesn't after.
+func notify(old *Post, new *Post) {
+	if _, ok := store.(changeFeeder); ok {
+		return
+	}
+
+	if c, ok := classify(old, new); ok {
+		publish(c)
+	}
+}
+
+// classify describes the change from `old` to `new` as a Change, returning false if it's not one
+// subscribers would see, such as an edit to an inactive post.
+func classify(old *Post, new *Post) (Change, bool) {
+	wasActive := old != nil && old.Active
+	isActive := new != nil && new.Active
+
+	switch {
+	case isActive && !wasActive:
+		return Change{Type: Created, Post: *new}, true
+	case wasActive && !isActive:
+		// A deleted document leaves `new` nil, so we'll report the post as it was.
+		p := *old
+		if new != nil {
+			p = *new
+		}
+
+		p.Active = false
+
+		return Change{Type: Deactivated, Post: p}, true
+	case isActive && wasActive && old.Content != new.Content:
+		return Change{Type: Edited, Post: *new}, true
+	}
+
+	return Change{}, false
+}
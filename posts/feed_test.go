@@ -0,0 +1,100 @@
+package posts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receive waits briefly for a change on `ch`, failing the test if none arrives.
+func receive(t *testing.T, ch <-chan Change) Change {
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+
+	return Change{}
+}
+
+func TestSubscribe(t *testing.T) {
+	assert := assert.New(t)
+
+	// We'll use a store of our own so as not to disturb the test data.
+	prev := store
+	SetStore(NewMemoryStore())
+	defer SetStore(prev)
+
+	changes, unsubscribe := Subscribe()
+
+	p, _ := New("user", "content")
+
+	id, err := Submit(p)
+	assert.NoError(err)
+
+	c := receive(t, changes)
+	assert.Equal(Created, c.Type)
+	assert.Equal(id, c.Post.ID)
+
+	assert.NoError(Edit(id, "editor", "edited"))
+
+	c = receive(t, changes)
+	assert.Equal(Edited, c.Type)
+	assert.Equal("edited", c.Post.Content)
+
+	assert.NoError(Deactivate(id))
+
+	c = receive(t, changes)
+	assert.Equal(Deactivated, c.Type)
+	assert.False(c.Post.Active)
+
+	assert.NoError(Activate(id))
+
+	c = receive(t, changes)
+	assert.Equal(Created, c.Type)
+
+	unsubscribe()
+
+	// The channel is closed on unsubscribing, and nothing more is sent.
+	_, ok := <-changes
+	assert.False(ok)
+
+	assert.NoError(Deactivate(id))
+
+	// Unsubscribing again is harmless.
+	unsubscribe()
+}
+
+func TestClassify(t *testing.T) {
+	active := &Post{ID: "1", Active: true, Content: "a"}
+	edited := &Post{ID: "1", Active: true, Content: "b"}
+	inactive := &Post{ID: "1", Active: false, Content: "a"}
+
+	cases := []struct {
+		old    *Post
+		new    *Post
+		wantOK bool
+		want   ChangeType
+	}{
+		{nil, active, true, Created},
+		{inactive, active, true, Created},
+		{active, edited, true, Edited},
+		{active, inactive, true, Deactivated},
+		{active, nil, true, Deactivated},
+		{nil, inactive, false, 0},
+		{inactive, nil, false, 0},
+		{active, active, false, 0},
+	}
+
+	for _, c := range cases {
+		got, ok := classify(c.old, c.new)
+
+		assert.Equal(t, c.wantOK, ok)
+		if ok {
+			assert.Equal(t, c.want, got.Type)
+			assert.Equal(t, "1", got.Post.ID)
+		}
+	}
+}
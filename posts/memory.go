@@ -0,0 +1,493 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// memoryStore is a Store that keeps all posts in process memory. Nothing is persisted, so it's
+// useful only for development and tests.
+type memoryStore struct {
+	mu        sync.RWMutex
+	posts     map[string]Post
+	last      db.CountType // The last number allocated
+	revisions []Revision   // In the order they were inserted
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{posts: make(map[string]Post)}
+}
+
+// byTime sorts posts by time, then by ID.
+type byTime []Post
+
+func (ps byTime) Len() int      { return len(ps) }
+func (ps byTime) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
+func (ps byTime) Less(i, j int) bool {
+	if ps[i].Time.Equal(ps[j].Time) {
+		return ps[i].ID < ps[j].ID
+	}
+
+	return ps[i].Time.Before(ps[j].Time)
+}
+
+// byNumber sorts posts by number.
+type byNumber []Post
+
+func (ps byNumber) Len() int           { return len(ps) }
+func (ps byNumber) Swap(i, j int)      { ps[i], ps[j] = ps[j], ps[i] }
+func (ps byNumber) Less(i, j int) bool { return ps[i].Number < ps[j].Number }
+
+func (s *memoryStore) Count() (db.CountType, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n db.CountType
+	for _, p := range s.posts {
+		if p.Active {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *memoryStore) CountByUser(userID string) (db.CountType, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n db.CountType
+	for _, p := range s.posts {
+		if p.Active && p.Author == userID {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *memoryStore) GetByUser(userID string, offset db.CountType, limit db.CountType) ([]Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ps []Post
+	for _, p := range s.posts {
+		if p.Active && p.Author == userID {
+			ps = append(ps, p)
+		}
+	}
+
+	sort.Sort(sort.Reverse(byNumber(ps)))
+
+	if offset >= db.CountType(len(ps)) {
+		return nil, nil
+	}
+
+	ps = ps[offset:]
+	if db.CountType(len(ps)) > limit {
+		ps = ps[:limit]
+	}
+
+	return ps, nil
+}
+
+func (s *memoryStore) CountAll() (db.CountType, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return db.CountType(len(s.posts)), nil
+}
+
+func (s *memoryStore) All() ([]Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ps := make([]Post, 0, len(s.posts))
+	for _, p := range s.posts {
+		ps = append(ps, p)
+	}
+
+	sort.Sort(byTime(ps))
+
+	return ps, nil
+}
+
+func (s *memoryStore) GetRange(first db.CountType, limit db.CountType) ([]Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ps []Post
+
+	for _, p := range s.posts {
+		if p.Active && p.Number >= first && p.Number < first+limit {
+			ps = append(ps, p)
+		}
+	}
+
+	sort.Sort(byNumber(ps))
+
+	return ps, nil
+}
+
+func (s *memoryStore) GetRangeJoined(first db.CountType, limit db.CountType) ([]Zip, error) {
+	ps, err := s.GetRange(first, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	zs := make([]Zip, len(ps))
+	for i := range ps {
+		z, err := join(&ps[i])
+		if err != nil {
+			return nil, err
+		}
+
+		zs[i] = *z
+	}
+
+	return zs, nil
+}
+
+func (s *memoryStore) GetPage(q Query) ([]Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ps []Post
+
+	for _, p := range s.posts {
+		if !p.Active && !q.Inactive {
+			continue
+		}
+
+		c := p.Cursor()
+
+		if (q.After != nil && !q.After.before(c)) || (q.Before != nil && !c.before(*q.Before)) {
+			continue
+		}
+
+		ps = append(ps, p)
+	}
+
+	sort.Sort(byTime(ps))
+
+	n := int(q.Limit)
+	if n > len(ps) {
+		n = len(ps)
+	}
+
+	if q.Last {
+		return ps[len(ps)-n:], nil
+	}
+
+	return ps[:n], nil
+}
+
+func (s *memoryStore) GetByID(id string) (*Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.posts[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &p, nil
+}
+
+func (s *memoryStore) GetByIDJoined(id string) (*Zip, error) {
+	p, err := s.GetByID(id)
+	if err != nil || p == nil {
+		return nil, err
+	}
+
+	return join(p)
+}
+
+func (s *memoryStore) GetByNumber(n db.CountType) (*Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.posts {
+		if p.Number == n {
+			return &p, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *memoryStore) NearestByNumber(n db.CountType, up bool) (*Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var nearest *Post
+
+	for _, p := range s.posts {
+		if (up && p.Number < n) || (!up && p.Number > n) {
+			continue
+		}
+
+		if nearest == nil || (up && p.Number < nearest.Number) || (!up && p.Number > nearest.Number) {
+			p := p
+			nearest = &p
+		}
+	}
+
+	return nearest, nil
+}
+
+func (s *memoryStore) Last() (db.CountType, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.last, nil
+}
+
+func (s *memoryStore) Insert(p *Post) (string, error) {
+	if p == nil {
+		return "", errors.New("Cannot insert nil post")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *p
+	if cp.ID == "" {
+		cp.ID = utility.GenerateUUID()
+	}
+
+	cp.Attachments = append([]string(nil), p.Attachments...)
+
+	if _, ok := s.posts[cp.ID]; ok {
+		return "", fmt.Errorf("A post already exists with ID %q", cp.ID)
+	}
+
+	if cp.Number == 0 {
+		cp.Number = s.last + 1
+	}
+
+	for _, p := range s.posts {
+		if p.Number == cp.Number {
+			return "", fmt.Errorf("A post is already numbered %d", cp.Number)
+		}
+	}
+
+	cp.References = references(cp.Content, cp.Number)
+	p.References = append([]db.CountType(nil), cp.References...)
+
+	if cp.Number > s.last {
+		s.last = cp.Number
+	}
+
+	s.posts[cp.ID] = cp
+	p.Number = cp.Number
+
+	return cp.ID, nil
+}
+
+func (s *memoryStore) Edit(id string, content string, references []db.CountType, editorID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[id]
+	if !ok || p.Content == content {
+		// RethinkDB reports an unchanged document as skipped rather than replaced, which we also
+		// treat as a failure.
+		return errors.New("Unable to insert changes to document")
+	}
+
+	r := Revision{ID: utility.GenerateUUID(), PostID: id, Content: p.Content, EditorID: editorID, Time: at}
+	s.revisions = append(s.revisions, r)
+
+	p.Content = content
+	p.EditedAt = &at
+	p.References = append([]db.CountType(nil), references...)
+	s.posts[id] = p
+
+	return nil
+}
+
+func (s *memoryStore) SetActive(id string, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[id]
+	if !ok {
+		return fmt.Errorf("No post found with ID %q", id)
+	}
+
+	p.Active = active
+	s.posts[id] = p
+
+	return nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[id]; !ok {
+		return fmt.Errorf("No post found with ID %q", id)
+	}
+
+	delete(s.posts, id)
+
+	revisions := s.revisions[:0]
+	for _, r := range s.revisions {
+		if r.PostID != id {
+			revisions = append(revisions, r)
+		}
+	}
+
+	s.revisions = revisions
+
+	return nil
+}
+
+func (s *memoryStore) Revisions(id string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rs []Revision
+	for _, r := range s.revisions {
+		if r.PostID == id {
+			rs = append(rs, r)
+		}
+	}
+
+	sort.Sort(revisionsByTime(rs))
+
+	return rs, nil
+}
+
+func (s *memoryStore) Backlinks(numbers []db.CountType) (map[db.CountType][]db.CountType, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[db.CountType]bool, len(numbers))
+	for _, n := range numbers {
+		wanted[n] = true
+	}
+
+	links := make(map[db.CountType][]db.CountType)
+
+	for _, p := range s.posts {
+		if !p.Active {
+			continue
+		}
+
+		for _, n := range p.References {
+			if wanted[n] {
+				links[n] = append(links[n], p.Number)
+			}
+		}
+	}
+
+	for _, ns := range links {
+		sort.Slice(ns, func(i, j int) bool { return ns[i] < ns[j] })
+	}
+
+	return links, nil
+}
+
+func (s *memoryStore) AttachedTo(attachmentIDs []string) (map[string][]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		wanted[id] = true
+	}
+
+	attached := make(map[string][]string)
+
+	for _, p := range s.posts {
+		for _, a := range p.Attachments {
+			if wanted[a] {
+				attached[a] = append(attached[a], p.ID)
+			}
+		}
+	}
+
+	return attached, nil
+}
+
+func (s *memoryStore) AllRevisions() ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rs := make([]Revision, len(s.revisions))
+	copy(rs, s.revisions)
+
+	sort.Sort(revisionsByTime(rs))
+
+	return rs, nil
+}
+
+func (s *memoryStore) InsertRevision(r *Revision) error {
+	if r == nil {
+		return errors.New("Cannot insert nil revision")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *r
+	if cp.ID == "" {
+		cp.ID = utility.GenerateUUID()
+	}
+
+	for _, existing := range s.revisions {
+		if existing.ID == cp.ID {
+			return fmt.Errorf("A revision already exists with ID %q", cp.ID)
+		}
+	}
+
+	s.revisions = append(s.revisions, cp)
+
+	return nil
+}
+
+// revisionsByTime sorts revisions by time, then by ID.
+type revisionsByTime []Revision
+
+func (rs revisionsByTime) Len() int      { return len(rs) }
+func (rs revisionsByTime) Swap(i, j int) { rs[i], rs[j] = rs[j], rs[i] }
+func (rs revisionsByTime) Less(i, j int) bool {
+	if rs[i].Time.Equal(rs[j].Time) {
+		return rs[i].ID < rs[j].ID
+	}
+
+	return rs[i].Time.Before(rs[j].Time)
+}
+
+// join merges a post with its author's data as RethinkDB's EqJoin and Zip terms would.
+func join(p *Post) (*Zip, error) {
+	u, err := users.GetByID(p.Author)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Zip{
+		ID:            p.ID,
+		Active:        p.Active,
+		AuthorID:      p.Author,
+		Content:       p.Content,
+		Time:          p.Time,
+		EditedAt:      p.EditedAt,
+		Count:         p.Number,
+		Avatar:        u.Avatar,
+		AuthorName:    u.Name,
+		Title:         u.Title,
+		References:    p.References,
+		AttachmentIDs: p.Attachments,
+	}, nil
+}
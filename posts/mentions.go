@@ -0,0 +1,25 @@
+package posts
+
+import (
+	"log"
+
+	"github.com/boatilus/peppercorn/markdown"
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/users"
+)
+
+// notifyMentioned notifies each user mentioned by name in the content of post `p`, other than its
+// author, that the author mentioned them. Names that aren't those of users are ignored. A failure to
+// notify is logged rather than returned, as the post has already been saved by then.
+func notifyMentioned(p *Post) {
+	for _, name := range markdown.Mentions(p.Content) {
+		u, err := users.GetByName(name)
+		if err != nil || u.ID == p.Author {
+			continue
+		}
+
+		if err := notifications.Mention(u.ID, p.Author, p.ID, p.Number); err != nil {
+			log.Printf("Couldn't notify user %q of post with ID %q: %s", u.ID, p.ID, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package posts
+
+import (
+	"testing"
+
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyMentioned(t *testing.T) {
+	assert := assert.New(t)
+
+	// We'll use stores of our own so as not to disturb the test data.
+	prev := store
+	SetStore(NewMemoryStore())
+	defer SetStore(prev)
+
+	users.SetStore(users.NewMemoryStore())
+	notifications.SetStore(notifications.NewMemoryStore())
+
+	var ids []string
+	for _, name := range []string{"author", "ann", "ben"} {
+		u := users.User{Email: name + "@example.com", Name: name}
+		if !assert.NoError(users.Create(&u)) {
+			t.FailNow()
+		}
+
+		ids = append(ids, u.ID)
+	}
+
+	author, ann, ben := ids[0], ids[1], ids[2]
+
+	p, _ := New(author, "Hi @ann, @ghost and @author")
+
+	id, err := Submit(p)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	got, _ := notifications.ForUser(ann, 10)
+	if assert.Len(got, 1) {
+		assert.Equal(author, got[0].ActorID)
+		assert.Equal(id, got[0].PostID)
+		assert.False(got[0].Read)
+
+		assert.NoError(notifications.MarkRead(ann, got[0].ID))
+	}
+
+	// Those mentioned themselves aren't notified.
+	got, _ = notifications.ForUser(author, 10)
+	assert.Empty(got)
+
+	// Editing notifies only those not already notified, and leaves earlier notifications as they were.
+	assert.NoError(Edit(id, author, "Hi @ann and @ben"))
+
+	got, _ = notifications.ForUser(ann, 10)
+	if assert.Len(got, 1) {
+		assert.True(got[0].Read)
+	}
+
+	got, _ = notifications.ForUser(ben, 10)
+	assert.Len(got, 1)
+}
@@ -0,0 +1,183 @@
+package posts
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+)
+
+// Cursor is a position in the thread given by the time and ID of a post. Posts are ordered by time,
+// with ties broken by ID, so a cursor marks the boundary between the posts before and after it.
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+// Cursor returns the position of `p` in the thread.
+func (p *Post) Cursor() Cursor {
+	return Cursor{Time: p.Time, ID: p.ID}
+}
+
+// String encodes the cursor for use in URLs. The encoding is opaque to clients and may change.
+func (c Cursor) String() string {
+	s := strconv.FormatInt(c.Time.UnixNano(), 10) + ":" + c.ID
+
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// before reports whether `c` comes before `other` in the thread.
+func (c Cursor) before(other Cursor) bool {
+	if c.Time.Equal(other.Time) {
+		return c.ID < other.ID
+	}
+
+	return c.Time.Before(other.Time)
+}
+
+// ParseCursor decodes a cursor encoded by String.
+func ParseCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, errors.New("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Cursor{}, errors.New("invalid cursor")
+	}
+
+	ns, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, errors.New("invalid cursor")
+	}
+
+	return Cursor{Time: time.Unix(0, ns).UTC(), ID: parts[1]}, nil
+}
+
+// Query selects a page of posts by their position in the thread.
+type Query struct {
+	// After and Before, if non-nil, exclude the posts up to and including, and from, the given
+	// positions respectively.
+	After  *Cursor
+	Before *Cursor
+	// Limit is the greatest number of posts to return.
+	Limit db.CountType
+	// Last selects the last Limit posts in range rather than the first, for paging backwards.
+	Last bool
+	// Inactive includes inactive posts as well as active ones, as shown to admins.
+	Inactive bool
+}
+
+// Page is a page of posts, ordered by time, with cursors to the pages either side.
+type Page struct {
+	Posts []Post
+	// Prev and Next are cursors to pass as a Query's Before and After to fetch the neighbouring
+	// pages. Each is empty if there are no posts in that direction.
+	Prev string
+	Next string
+}
+
+// GetPage returns the page of posts selected by `q`. As with GetRange, the limit is at most 100.
+func GetPage(q Query) (*Page, error) {
+	if q.Limit < 1 {
+		return nil, errors.New("limit must be positive")
+	}
+
+	if q.Limit > 100 {
+		q.Limit = 100
+	}
+
+	ps, err := store.GetPage(q)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Posts: ps}
+
+	if len(ps) == 0 {
+		return page, nil
+	}
+
+	first := ps[0].Cursor()
+	last := ps[len(ps)-1].Cursor()
+
+	if page.Prev, err = cursorIfAny(Query{Before: &first, Limit: 1, Last: true, Inactive: q.Inactive}); err != nil {
+		return nil, err
+	}
+
+	if page.Next, err = cursorIfAny(Query{After: &last, Limit: 1, Inactive: q.Inactive}); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// cursorIfAny returns the encoded bound of `q` if there are any posts in range of it, and an empty
+// string otherwise.
+func cursorIfAny(q Query) (string, error) {
+	ps, err := store.GetPage(q)
+	if err != nil || len(ps) == 0 {
+		return "", err
+	}
+
+	if q.Before != nil {
+		return q.Before.String(), nil
+	}
+
+	return q.After.String(), nil
+}
+
+// reverse reverses the order of `ps` in place.
+func reverse(ps []Post) {
+	for i, j := 0, len(ps)-1; i < j; i, j = i+1, j-1 {
+		ps[i], ps[j] = ps[j], ps[i]
+	}
+}
+
+// PageQuery translates page `n`, with `perPage` posts to a page, into a Query, so that page numbers
+// can be served by GetPage. Page `n` holds the posts numbered from `(n-1)*perPage + 1` through
+// `n*perPage`, and so lies between the posts numbered either side of that range, whether or not
+// they're active. Numbers left unused, as by purged posts, are passed over in finding those posts.
+func PageQuery(n db.CountType, perPage db.CountType) (Query, error) {
+	if n < 1 || perPage < 1 {
+		return Query{}, errors.New("invalid page")
+	}
+
+	q := Query{Limit: perPage}
+
+	first := (n-1)*perPage + 1
+
+	var err error
+
+	if q.After, err = nearest(first-1, false); err != nil {
+		return Query{}, err
+	}
+
+	if q.Before, err = nearest(first+perPage, true); err != nil {
+		return Query{}, err
+	}
+
+	return q, nil
+}
+
+// nearest returns the position of the post numbered `number`, or if there's none, of the nearest
+// post numbered above it if `up` is true, or below it otherwise. It returns nil if there's no such
+// post.
+func nearest(number db.CountType, up bool) (*Cursor, error) {
+	if number < 1 {
+		return nil, nil
+	}
+
+	p, err := store.NearestByNumber(number, up)
+	if err != nil || p == nil {
+		return nil, err
+	}
+
+	c := p.Cursor()
+
+	return &c, nil
+}
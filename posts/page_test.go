@@ -0,0 +1,174 @@
+package posts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// contents returns the content of each of `ps`, for comparing pages to the test data.
+func contents(ps []Post) []string {
+	cs := make([]string, len(ps))
+	for i := range ps {
+		cs[i] = ps[i].Content
+	}
+
+	return cs
+}
+
+// docContents returns the content of the test posts at each of `is`.
+func docContents(is ...int) []string {
+	cs := make([]string, len(is))
+	for i := range is {
+		cs[i] = docs[is[i]].Content
+	}
+
+	return cs
+}
+
+func TestCursor(t *testing.T) {
+	assert := assert.New(t)
+
+	want := Cursor{Time: time.Unix(1464650198, 123456789).UTC(), ID: "some:id"}
+
+	got, err := ParseCursor(want.String())
+	assert.NoError(err)
+	assert.True(want.Time.Equal(got.Time))
+	assert.Equal(want.ID, got.ID)
+
+	for _, s := range []string{"", "!!!", Cursor{}.String()[:4], "MTIz"} {
+		_, err := ParseCursor(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestGetPage(t *testing.T) {
+	assert := assert.New(t)
+
+	first, err := GetPage(Query{Limit: 4})
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.Equal(docContents(0, 1, 2, 3), contents(first.Posts))
+	assert.Empty(first.Prev)
+	assert.NotEmpty(first.Next)
+
+	after, err := ParseCursor(first.Next)
+	assert.NoError(err)
+
+	// The inactive seventh post is skipped.
+	second, err := GetPage(Query{After: &after, Limit: 4})
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.Equal(docContents(4, 5), contents(second.Posts))
+	assert.NotEmpty(second.Prev)
+	assert.Empty(second.Next)
+
+	// Paging backwards from the second page gives the posts just before it.
+	before, err := ParseCursor(second.Prev)
+	assert.NoError(err)
+
+	back, err := GetPage(Query{Before: &before, Limit: 3, Last: true})
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.Equal(docContents(1, 2, 3), contents(back.Posts))
+
+	_, err = GetPage(Query{})
+	assert.Error(err)
+}
+
+func TestPageQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		n    db.CountType
+		want []string
+	}{
+		{1, docContents(0, 1, 2)},
+		{2, docContents(3, 4, 5)},
+		// The only post numbered on the third page is inactive.
+		{3, []string{}},
+	}
+
+	for _, c := range cases {
+		q, err := PageQuery(c.n, 3)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		page, err := GetPage(q)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		assert.Equal(c.want, contents(page.Posts), "page %d", c.n)
+	}
+
+	_, err := PageQuery(0, 3)
+	assert.Error(err)
+}
+
+func TestGetPage_inactive(t *testing.T) {
+	assert := assert.New(t)
+
+	page, err := GetPage(Query{Limit: 10, Inactive: true})
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	// Admins see the inactive seventh post where it falls.
+	assert.Equal(docContents(0, 1, 2, 3, 4, 5, 6), contents(page.Posts))
+	assert.False(page.Posts[6].Active)
+
+	q, err := PageQuery(3, 3)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	q.Inactive = true
+
+	page, err = GetPage(q)
+	if assert.NoError(err) {
+		assert.Equal(docContents(6), contents(page.Posts))
+	}
+}
+
+func TestNearestByNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	last := db.CountType(len(docs))
+
+	cases := []struct {
+		n    db.CountType
+		up   bool
+		want db.CountType
+	}{
+		{2, true, 2},
+		{2, false, 2},
+		{0, true, 1},
+		{last + 100, false, last},
+		// There's no post beyond either end.
+		{last + 1, true, 0},
+		{0, false, 0},
+	}
+
+	for _, c := range cases {
+		p, err := store.NearestByNumber(c.n, c.up)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		if c.want == 0 {
+			assert.Nil(p, "%d, up: %t", c.n, c.up)
+		} else if assert.NotNil(p, "%d, up: %t", c.n, c.up) {
+			assert.Equal(c.want, p.Number, "%d, up: %t", c.n, c.up)
+		}
+	}
+}
@@ -3,35 +3,63 @@ package posts
 import (
 	"errors"
 	"fmt"
+	"html/template"
 	"log"
 	"time"
 
+	"github.com/boatilus/peppercorn/attachments"
 	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/reactions"
 	"github.com/spf13/viper"
-	rethink "gopkg.in/dancannon/gorethink.v2"
 )
 
-// Post contains all the information stored for a single post.
+// Post contains all the information stored for a single post. A post's Number is allocated when
+// it's inserted and never changes, so it stays the same however many earlier posts are deactivated.
+// EditedAt is the time of the last edit, and is nil for a post that's never been edited. References
+// are the numbers of the earlier posts referred to in the post's content, in ascending order.
+// Attachments are the IDs of the files attached to the post, in the order they're shown.
 type Post struct {
-	ID      string    `gorethink:"id,omitempty"`
-	Active  bool      `gorethink:"active"`
-	Author  string    `gorethink:"user_id"`
-	Content string    `gorethink:"content"`
-	Time    time.Time `gorethink:"time"`
+	ID          string         `gorethink:"id,omitempty"`
+	Active      bool           `gorethink:"active"`
+	Number      db.CountType   `gorethink:"number"`
+	Author      string         `gorethink:"user_id"`
+	Content     string         `gorethink:"content"`
+	Time        time.Time      `gorethink:"time"`
+	EditedAt    *time.Time     `gorethink:"edited_at,omitempty"`
+	References  []db.CountType `gorethink:"references,omitempty"`
+	Attachments []string       `gorethink:"attachments,omitempty"`
 }
 
 // Zip is a concatenation of a Post and a User. We return this from GetAndJoin.
 type Zip struct {
-	ID         string    `gorethink:"id"`
-	Active     bool      `gorethink:"active"`
-	AuthorID   string    `gorethink:"user_id"`
-	Content    string    `gorethink:"content"`
-	Time       time.Time `gorethink:"time"`
-	Avatar     string    `gorethink:"avatar"`
-	AuthorName string    `gorethink:"name"`
-	Title      string    `gorethink:"title"`
-	Count      db.CountType
+	ID         string       `gorethink:"id"`
+	Active     bool         `gorethink:"active"`
+	AuthorID   string       `gorethink:"user_id"`
+	Content    string       `gorethink:"content"`
+	Time       time.Time    `gorethink:"time"`
+	EditedAt   *time.Time   `gorethink:"edited_at,omitempty"`
+	Avatar     string       `gorethink:"avatar"`
+	AuthorName string       `gorethink:"name"`
+	Title      string       `gorethink:"title"`
+	Count      db.CountType `gorethink:"number"` // The post's number
 	PrettyTime string
+	// PrettyEditedAt is EditedAt as displayed, and is empty if the post's never been edited.
+	PrettyEditedAt string
+	// HTML is Content rendered from Markdown, as given by HTML.
+	HTML       template.HTML
+	References []db.CountType `gorethink:"references,omitempty"`
+	// Backlinks are the numbers of the active posts referring to this one, as given by Backlinks.
+	Backlinks []db.CountType
+	// Reactions summarize the reactions to the post, as given by reactions.ForPosts.
+	Reactions     []reactions.Summary
+	AttachmentIDs []string `gorethink:"attachments,omitempty"`
+	// Attachments describe the files attached to the post, in the order of AttachmentIDs.
+	Attachments []attachments.Attachment `gorethink:"-"`
+	// DeactivatedBy and DeactivationReason are the name of the admin who deactivated an inactive
+	// post and why, as shown to admins. They're empty if its author deactivated it.
+	DeactivatedBy      string `gorethink:"-"`
+	DeactivationReason string `gorethink:"-"`
 }
 
 // GetTable returns the name of the posts table from Viper.
@@ -39,6 +67,23 @@ func GetTable() string {
 	return viper.GetString("db.posts_table")
 }
 
+// getCountersTable returns the name of the table holding the counter from which posts are numbered.
+func getCountersTable() string {
+	return viper.GetString("db.counters_table")
+}
+
+// getPostAttachmentsTable returns the name of the table recording the attachments of each post. Only
+// SQL databases have one, as RethinkDB keeps a post's attachments with the post.
+func getPostAttachmentsTable() string {
+	return viper.GetString("db.post_attachments_table")
+}
+
+// MaxContentLength is the longest, in bytes, a post's content can be.
+const MaxContentLength = 50000
+
+// errTooLong is returned when a post's content is longer than MaxContentLength.
+var errTooLong = fmt.Errorf("Posts cannot be longer than %d bytes", MaxContentLength)
+
 // New fills and returns a Post object given an author and a post. The `Active` property
 // is `true` by default, and `Time` is always `time.Now().UTC()`. RethinkDB will truncate .Time
 // to millisecond precision.
@@ -51,6 +96,10 @@ func New(author string, content string) (*Post, error) {
 		Time:    time.Now().UTC(),
 	}
 
+	if len(content) > MaxContentLength {
+		return nil, errTooLong
+	}
+
 	if !validate(&p) {
 		return nil, errors.New("invalid data supplied")
 	}
@@ -60,40 +109,63 @@ func New(author string, content string) (*Post, error) {
 
 // Count returns the number of active posts as a `count`.
 func Count() (db.CountType, error) {
-	cursor, err := db.Get().Table(GetTable()).GetAllByIndex("active", true).Count().Run(db.Session)
-	if err != nil {
-		return 0, err
-	}
+	return store.Count()
+}
 
-	defer cursor.Close()
+// CountAll returns the total number of posts, including inactive posts, as a `count`.
+func CountAll() (db.CountType, error) {
+	return store.CountAll()
+}
 
-	var n db.CountType
-	if err = cursor.One(&n); err != nil {
-		return 0, err
+// CountByUser returns the number of active posts by the user with `userID`.
+func CountByUser(userID string) (db.CountType, error) {
+	return store.CountByUser(userID)
+}
+
+// ByUser returns the page numbered `n` of the active posts by the user with `userID`, newest first,
+// with `perPage` posts to a page.
+func ByUser(userID string, n db.CountType, perPage db.CountType) ([]Post, error) {
+	if n < 1 {
+		return nil, errors.New("posts: page numbers begin at 1")
 	}
 
-	return n, nil
+	// As with ranges, enforce a limit of 100.
+	if perPage < 1 || perPage > 100 {
+		return nil, fmt.Errorf("posts: %d posts per page is out of range", perPage)
+	}
+
+	return store.GetByUser(userID, (n-1)*perPage, perPage)
 }
 
-// CountAll returns the total number of posts, including inactive posts, as a `count`.
-func CountAll() (db.CountType, error) {
-	cursor, err := db.Get().Table(GetTable()).Count().Run(db.Session)
-	if err != nil {
-		return 0, err
-	}
+// All returns every post, including inactive posts, ordered by time (ascending).
+func All() ([]Post, error) {
+	return store.All()
+}
+
+// Last returns the last number allocated to a post, which is the number of the newest post whether
+// or not it's active.
+func Last() (db.CountType, error) {
+	return store.Last()
+}
 
-	defer cursor.Close()
+// Restore inserts a post exactly as given, keeping its ID, number, time and status. A post without
+// a number is allocated the next one. It's intended for restoring posts from an archive.
+func Restore(p *Post) error {
+	if p == nil || p.ID == "" || !validate(p) {
+		return errors.New("invalid Post supplied")
+	}
 
-	var n db.CountType
-	if err = cursor.One(&n); err != nil {
-		return 0, err
+	if _, err := store.Insert(p); err != nil {
+		return err
 	}
 
-	return n, nil
+	index.reindex(p.ID)
+
+	return nil
 }
 
-// GetRange returns a range of posts specified by `first` -- the first post in the range --
-// and `limit`, the number of posts.
+// GetRange returns the active posts numbered from `first` through `first+limit-1`. As deactivated
+// posts keep their numbers, there may be fewer than `limit` posts, or none at all.
 func GetRange(first db.CountType, limit db.CountType) ([]Post, error) {
 	// Don't let users try to load any page prior to the, uh, first one.
 	if first < 1 {
@@ -105,50 +177,10 @@ func GetRange(first db.CountType, limit db.CountType) ([]Post, error) {
 		limit = 100
 	}
 
-	// We want to order displayed posts by time posted (ascending), showing only active posts,
-	// skipping inactive posts and limiting the number of results to `limit`.
-	table := db.Get().Table(GetTable())
-
-	// For the Between term, we need to filter to all active posts (`true`) and between the minimum
-	// date through the maximum possible date by querying against the `active_time` compound index.
-	// We're required to specify MinVal and MaxVal here.
-	btOpts := rethink.BetweenOpts{Index: "active_time"}
-	min := []interface{}{true, rethink.MinVal}
-	max := []interface{}{true, rethink.MaxVal}
-
-	// We'll similarly order by the `active_time` index...
-	oOpts := rethink.OrderByOpts{Index: rethink.Asc("active_time")}
-
-	// The Slice term gives us effective pagination of results, but must be performed after filtering
-	// and ordering.
-	//
-	// TODO: Consider whether moving the OrderBy term later in the chain can improve performance,
-	// as per: https://www.rethinkdb.com/docs/optimization/
-	begin := first - 1
-	end := begin + limit
-
-	// Zipping a user document into the post document without Excepting the user's ID field doesn't
-	// trample over the post document's ID field, so we don't need to do anything else but run
-	// the full query.
-	cursor, err := table.Between(min, max, btOpts).OrderBy(oOpts).Slice(begin, end).Run(db.Session)
-	if err != nil {
-		return nil, err
-	}
-
-	defer cursor.Close()
-
-	var posts []Post
-	if err = cursor.All(&posts); err != nil {
-		return nil, err
-	}
-
-	if len(posts) == 0 {
-		return nil, errors.New("empty_result")
-	}
-
-	return posts, nil
+	return store.GetRange(first, limit)
 }
 
+// GetRangeJoined is as GetRange, but merges the author's user data into each post.
 func GetRangeJoined(first db.CountType, limit db.CountType) ([]Zip, error) {
 	// Don't let users try to load any page prior to the, uh, first one.
 	if first < 1 {
@@ -160,115 +192,57 @@ func GetRangeJoined(first db.CountType, limit db.CountType) ([]Zip, error) {
 		limit = 100
 	}
 
-	// We want to order displayed posts by time posted (ascending), showing only active posts,
-	// skipping inactive posts and limiting the number of results to `limit`.
-	//
-	// This requires some pretty insane query machinery to be efficient, which follows...
-	table := db.Get().Table(GetTable())
-
-	// We'll join against the `id` primary index against docs in the users table.
-	usersTable := db.Get().Table("users")
-
-	// For the Between term, we need to filter to all active posts (`true`) and between the minimum
-	// date through the maximum possible date by querying against the `active_time` compound index.
-	// We're required to specify MinVal and MaxVal here.
-	btOpts := rethink.BetweenOpts{Index: "active_time"}
-	min := []interface{}{true, rethink.MinVal}
-	max := []interface{}{true, rethink.MaxVal}
-
-	// We'll similarly order by the `active_time` index...
-	oOpts := rethink.OrderByOpts{Index: rethink.Asc("active_time")}
-
-	// EqJoin will negate the ordering specified by OrderBy unless we specify the `Ordered` option.
-	eqjOpts := rethink.EqJoinOpts{Ordered: true}
-
-	// The Slice term gives us effective pagination of results, but must be performed after filtering
-	// and ordering.
-	//
-	// TODO: Consider whether moving the OrderBy term later in the chain can improve performance,
-	// as per: https://www.rethinkdb.com/docs/optimization/
-	begin := first - 1
-	end := begin + limit
-
-	t := table.Between(min, max, btOpts).OrderBy(oOpts).Slice(begin, end)
-
-	// Zipping a user document into the post document without Excepting the user's ID field doesn't
-	// trample over the post document's ID field, so we don't need to do anything else but run
-	// the full query.
-	cursor, err := t.EqJoin("user_id", usersTable, eqjOpts).Without(map[string]interface{}{
-		"right": "id",
-	}).Zip().Run(db.Session)
-	if err != nil {
-		return nil, err
-	}
-
-	// The above is equivalent to:
-	// r
-	//	.db("peppercorn")
-	//	.table("posts")
-	// 	.between([true, r.minval], [true, r.maxval], {index: "active_time" })
-	//	.orderBy({index: r.asc("active_time")})
-	//	.slice(0, 5)
-	//	.eqJoin("user_id", r.db("peppercorn").table("users"), { ordered: true})
-	//	.without({ right: "id" })
-	//	.zip()
-
-	defer cursor.Close()
+	return store.GetRangeJoined(first, limit)
+}
 
-	if cursor.IsNil() {
-		return nil, fmt.Errorf(`No posts found with first "%d" and limit "%d"`, first, limit)
+// GetOne returns the active post numbered `n`.
+func GetOne(n db.CountType) (*Post, error) {
+	if n < 1 {
+		return nil, errors.New("no_negative_allowed")
 	}
 
-	var posts []Zip
-	if err := cursor.All(&posts); err != nil {
+	p, err := store.GetByNumber(n)
+	if err != nil {
 		return nil, err
 	}
 
-	if len(posts) == 0 {
-		return nil, errors.New("empty_result")
-	}
-
-	// Add each post number, as we have the data we need to do so.
-	for i := range posts {
-		posts[i].Count = first + db.CountType(i)
+	if p == nil || !p.Active {
+		return nil, fmt.Errorf("No post found numbered %d", n)
 	}
 
-	return posts, nil
+	return p, nil
 }
 
-// GetOne simply returns a single Post, given a post number.
-func GetOne(n db.CountType) (*Post, error) {
+// GetAny returns the post numbered `n`, whether it's active or not, as admins see it.
+func GetAny(n db.CountType) (*Post, error) {
 	if n < 1 {
 		return nil, errors.New("no_negative_allowed")
 	}
 
-	posts, err := GetRange(n, 1)
+	p, err := store.GetByNumber(n)
 	if err != nil {
 		return nil, err
 	}
 
-	return &posts[0], nil
+	if p == nil {
+		return nil, fmt.Errorf("No post found numbered %d", n)
+	}
+
+	return p, nil
 }
 
 // GetByID returns a single post given its ID.
 func GetByID(id string) (*Post, error) {
-	cursor, err := db.Get().Table(GetTable()).Get(id).Run(db.Session)
+	p, err := store.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
 
-	defer cursor.Close()
-
-	if cursor.IsNil() {
+	if p == nil {
 		return nil, fmt.Errorf("No post found at index %q", id)
 	}
 
-	var p Post
-	if err := cursor.One(&p); err != nil {
-		return nil, err
-	}
-
-	return &p, nil
+	return p, nil
 }
 
 // GetByIDJoined returns a zipped struct containing post data and the merged user data for that
@@ -276,103 +250,120 @@ func GetByID(id string) (*Post, error) {
 func GetByIDJoined(id string) (*Zip, error) {
 	log.Printf("Getting post with ID %q and joining with field %q", id, "user_id")
 
-	cursor, err := db.Get().Table(GetTable()).GetAllByIndex("id", id).EqJoin("user_id", db.Get().Table("users")).Zip().Run(db.Session)
+	z, err := store.GetByIDJoined(id)
 	if err != nil {
 		return nil, err
 	}
 
-	defer cursor.Close()
-
-	if cursor.IsNil() {
+	if z == nil {
 		return nil, fmt.Errorf("No post found with ID %q", id)
 	}
 
-	var z Zip
-	if err := cursor.One(&z); err != nil {
-		return nil, err
-	}
-
-	return &z, nil
+	return z, nil
 }
 
-// GetOffset returns the page number on which the post would be seen, given the user's current
-// post count.
+// GetOffset returns the number of the post with `id`, from which the page on which it's seen can be
+// computed given the user's posts-per-page setting.
 func GetOffset(id string) (db.CountType, error) {
-	btOpts := rethink.BetweenOpts{Index: "active_time"}
-	min := []interface{}{true, rethink.MinVal}
-	max := []interface{}{true, rethink.MaxVal}
-
-	oOpts := rethink.OrderByOpts{Index: rethink.Asc("active_time")}
-
-	qp := rethink.Row.Field("id").Eq(id)
-
-	cursor, err := db.Get().Table(GetTable()).Between(min, max, btOpts).OrderBy(oOpts).OffsetsOf(qp).Run(db.Session)
+	p, err := GetByID(id)
 	if err != nil {
 		return 0, err
 	}
 
-	// The above is equivalent to:
-	// r
-	//	.db("peppercorn")
-	//	.table("posts")
-	// 	.between([true, r.minval], [true, r.maxval], {index: "active_time" })
-	//	.orderBy({index: r.asc("active_time")})
-	//	.offsetsOf(r.row("id").eq(id))
-
-	var n db.CountType
-	if cursor.One(&n); err != nil {
-		return 0, err
-	}
-
-	return n + 1, nil
+	return p.Number, nil
 }
 
-// Edit accepts a post ID and the content to update a post with. Errs if `id` is empty or if
-// content length is 0, and for any database error.
-func Edit(id string, newContent string) error {
+// Edit accepts a post ID, the ID of the user editing it and the content to update a post with. The
+// post's previous content is kept as a revision, its References are set from the new content, and
+// users newly mentioned in it are notified. Errs if `id` or `editorID` is empty or if content length
+// is 0, and for any database error.
+func Edit(id string, editorID string, newContent string) error {
 	if len(id) == 0 {
 		return errors.New("Empty ID supplied")
 	}
 
+	if len(editorID) == 0 {
+		return errors.New("Empty editor ID supplied")
+	}
+
 	if len(newContent) == 0 {
 		return errors.New("Post content length cannot be 0")
 	}
 
-	log.Printf("Editing post with ID %q..", id)
+	if len(newContent) > MaxContentLength {
+		return errTooLong
+	}
 
-	data := map[string]interface{}{"content": newContent}
+	log.Printf("Editing post with ID %q..", id)
 
-	res, err := db.Get().Table(GetTable()).Get(id).Update(data).RunWrite(db.Session)
+	p, err := store.GetByID(id)
 	if err != nil {
 		return err
 	}
 
-	if res.Replaced != 1 {
-		return errors.New("Unable to insert changes to document")
+	if p == nil {
+		return fmt.Errorf("No post found with ID %q", id)
+	}
+
+	old := snapshot(id)
+	now := time.Now().UTC()
+	refs := references(newContent, p.Number)
+
+	if err := store.Edit(id, newContent, refs, editorID, now); err != nil {
+		return err
+	}
+
+	index.reindex(id)
+
+	mentioned := *p
+	mentioned.Content = newContent
+
+	notifyMentioned(&mentioned)
+
+	if old != nil {
+		edited := *old
+		edited.Content = newContent
+		edited.EditedAt = &now
+		edited.References = refs
+
+		notify(old, &edited)
 	}
 
 	return nil
 }
 
 // Submit accepts a complete Post and inserts it into the database, returning the ID a nil error
-// on success, or an error on any failure.
+// on success, or an error on any failure. The post is allocated the next number, its References
+// are set from its content, and users mentioned in it are notified.
 func Submit(p *Post) (id string, err error) {
-	if p != nil && !validate(p) {
+	if p == nil || !validate(p) {
 		return "", errors.New("invalid Post supplied")
 	}
 
-	res, err := db.Get().Table(GetTable()).Insert(p).RunWrite(db.Session)
-	if err != nil {
+	if err := CheckAttachments(p.Attachments); err != nil {
 		return "", err
 	}
 
-	if res.Inserted == 0 {
-		return "", fmt.Errorf("Failure in inserting post by user %q", p.Author)
+	p.Number = 0
+
+	// The store sets the post's references once it's numbered, as only then is it known which posts
+	// are earlier.
+	id, err = store.Insert(p)
+	if err != nil {
+		return "", err
 	}
 
-	log.Printf("Inserted post with ID %q", res.GeneratedKeys[0])
+	log.Printf("Inserted post #%d with ID %q", p.Number, id)
+
+	index.reindex(id)
+
+	inserted := *p
+	inserted.ID = id
 
-	return res.GeneratedKeys[0], nil
+	notify(nil, &inserted)
+	notifyMentioned(&inserted)
+
+	return id, nil
 }
 
 func Activate(id string) error {
@@ -391,44 +382,142 @@ func Deactivate(id string) error {
 	return nil
 }
 
-func validate(p *Post) bool {
-	if len(p.Author) == 0 || len(p.Content) == 0 {
-		return false
+// AttachedTo returns, for each of `attachmentIDs` attached to any post, active or not, the IDs of the
+// posts it's attached to. Attachments attached to no post are left out.
+func AttachedTo(attachmentIDs []string) (map[string][]string, error) {
+	if len(attachmentIDs) == 0 {
+		return map[string][]string{}, nil
 	}
 
-	return true
+	return store.AttachedTo(attachmentIDs)
 }
 
-func update(p *Post) error {
-	io := rethink.InsertOpts{Conflict: "update"}
+// CheckAttachments returns an error if any of `attachmentIDs` is given more than once or is already
+// attached to a post, as each attachment can be attached to only one.
+func CheckAttachments(attachmentIDs []string) error {
+	seen := make(map[string]bool, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		if seen[id] {
+			return fmt.Errorf("Attachment %q is given more than once", id)
+		}
+
+		seen[id] = true
+	}
 
-	if _, err := db.Get().Table(GetTable()).Insert(p, io).Run(db.Session); err != nil {
+	attached, err := AttachedTo(attachmentIDs)
+	if err != nil {
 		return err
 	}
 
+	for _, id := range attachmentIDs {
+		if len(attached[id]) > 0 {
+			return fmt.Errorf("Attachment %q is already attached to a post", id)
+		}
+	}
+
 	return nil
 }
 
-func updateStatus(id string, status bool) error {
-	cursor, err := db.Get().Table(GetTable()).Get(id).Run(db.Session)
+// Purge deletes the post with `id` for good, along with its revisions, the reactions to it, the
+// notifications about it and those of its attachments attached to no other post.
+// Only inactive posts can be purged, so the post has already been removed from the thread, and
+// purging it changes nothing anyone but admins can see. Its number isn't reused.
+func Purge(id string) error {
+	p, err := store.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if p == nil {
+		return fmt.Errorf("No post found with ID %q", id)
+	}
+
+	if p.Active {
+		return errors.New("posts: only inactive posts can be purged")
+	}
+
+	// Delete what refers to the post first, so that should that fail, the post's left to purge again.
+	if err := reactions.RemoveAll(id); err != nil {
+		return err
+	}
+
+	if err := notifications.DeleteForPost(id); err != nil {
+		return err
+	}
+
+	attached, err := AttachedTo(p.Attachments)
 	if err != nil {
 		return err
 	}
 
-	var p Post
-	if err = cursor.One(&p); err != nil {
+	for _, a := range p.Attachments {
+		if attachedElsewhere(attached[a], id) {
+			continue
+		}
+
+		if err := attachments.Delete(a); err != nil {
+			return err
+		}
+	}
+
+	if err := store.Delete(id); err != nil {
 		return err
 	}
 
-	cursor.Close()
+	index.reindex(id)
 
-	p.Active = status
+	return nil
+}
 
-	io := rethink.InsertOpts{Conflict: "update"}
+// attachedElsewhere reports whether any of `postIDs` is other than `id`.
+func attachedElsewhere(postIDs []string, id string) bool {
+	for _, postID := range postIDs {
+		if postID != id {
+			return true
+		}
+	}
 
-	if _, err = db.Get().Table(GetTable()).Insert(&p, io).Run(db.Session); err != nil {
+	return false
+}
+
+func validate(p *Post) bool {
+	if len(p.Author) == 0 || len(p.Content) == 0 || len(p.Content) > MaxContentLength {
+		return false
+	}
+
+	return true
+}
+
+func updateStatus(id string, status bool) error {
+	old := snapshot(id)
+
+	if err := store.SetActive(id, status); err != nil {
 		return err
 	}
 
+	index.reindex(id)
+
+	if old != nil {
+		updated := *old
+		updated.Active = status
+
+		notify(old, &updated)
+	}
+
 	return nil
 }
+
+// snapshot returns the post with `id` as it is before a change, for passing to notify, or nil if
+// notify won't need it.
+func snapshot(id string) *Post {
+	if _, ok := store.(changeFeeder); ok {
+		return nil
+	}
+
+	p, err := store.GetByID(id)
+	if err != nil {
+		return nil
+	}
+
+	return p
+}
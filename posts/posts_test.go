@@ -2,18 +2,27 @@ package posts
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/boatilus/peppercorn/attachments"
 	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/db/dbtest"
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/reactions"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
-	rethink "gopkg.in/dancannon/gorethink.v2"
 )
 
 const tableName = "posts_test"
+const countersTable = "counters_test"
+const revisionsTable = "revisions_test"
+const referencesTable = "references_test"
+const postAttachmentsTable = "post_attachments_test"
 
 type doc struct {
 	Active  bool
@@ -33,57 +42,28 @@ func makePostFromDoc(d doc) Post {
 	}
 }
 
-func setupDB() {
-	if !db.Session.IsConnected() {
-		panic("No DB connected")
-	}
-
-	rethink.DBCreate("peppercorn").RunWrite(db.Session)
-
-	peppercorn := rethink.DB(db.Name)
-
-	c, err := peppercorn.TableList().Contains(tableName).Run(db.Session)
-	if err != nil {
-		panic(err)
-	}
-
-	var hasTable bool
-
-	err = c.One(&hasTable)
-	if err != nil {
-		panic(err)
-	}
-
-	table := peppercorn.Table(tableName)
-
-	if !hasTable {
-		_, err := peppercorn.TableCreate(tableName).RunWrite(db.Session)
-		if err != nil {
+// insertPosts inserts the test posts through the current store.
+func insertPosts() {
+	for _, p := range loadPosts() {
+		if _, err := store.Insert(&p); err != nil {
 			panic(err)
 		}
-
-		table.IndexCreate("active").RunWrite(db.Session)
-		table.IndexCreate("user_id").RunWrite(db.Session)
-
-		table.IndexCreateFunc("active_time", func(row rethink.Term) interface{} {
-			return []interface{}{row.Field("active"), row.Field("time")}
-		}).RunWrite(db.Session)
-
-		table.IndexWait().Run(db.Session)
-	} else {
-		// Due to a lack of mocking in gorethink, we'll tear down the test data and repopulate on each
-		// run of the tests.
-		table.Delete().RunWrite(db.Session)
 	}
+}
 
+// loadPosts reads in the test data from JSON and returns it as a slice of posts.
+func loadPosts() []Post {
 	bytes, err := ioutil.ReadFile("posts.test_data.json")
+	if err != nil {
+		panic(err)
+	}
 
 	if err := json.Unmarshal(bytes, &docs); err != nil {
 		panic(err)
 	}
 
 	if len(docs) != 7 {
-		panic(err)
+		panic("expected 7 test posts")
 	}
 
 	posts := make([]Post, len(docs))
@@ -95,38 +75,33 @@ func setupDB() {
 		posts[i].Time = time.Unix(docs[i].Time, 0)
 	}
 
-	if _, err := table.Insert(posts).RunWrite(db.Session); err != nil {
-		panic(err)
-	}
-
-	cursor, err := table.Count().Run(db.Session)
-
-	if err != nil {
-		panic(err)
-	}
-
-	var n int
-
-	cursor.One(&n)
-	cursor.Close()
-
-	if n != 7 {
-		panic(err)
-	}
+	return posts
 }
 
 func init() {
-	viper.Set("db.posts_table", "posts_test")
+	viper.Set("db.posts_table", tableName)
+	viper.Set("db.counters_table", countersTable)
+	viper.Set("db.revisions_table", revisionsTable)
+	viper.Set("db.references_table", referencesTable)
+	viper.Set("db.post_attachments_table", postAttachmentsTable)
 
-	var err error
+	log.SetOutput(ioutil.Discard)
 
-	if db.Session, err = rethink.Connect(rethink.ConnectOpts{Address: "localhost:28015"}); err != nil {
-		panic(err)
-	}
+	switch backend, conn := dbtest.Setup("posts", tableName, revisionsTable, referencesTable, postAttachmentsTable); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		// Numbering starts over with the emptied posts table.
+		if _, err := conn.Exec("UPDATE "+countersTable+" SET value = 0 WHERE name = ?", tableName); err != nil {
+			panic(err)
+		}
 
-	log.SetOutput(ioutil.Discard)
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
+	}
 
-	setupDB()
+	insertPosts()
 }
 
 ///////////
@@ -160,6 +135,7 @@ func TestNew(t *testing.T) {
 		{"", "content"},
 		{"user", ""},
 		{"", ""},
+		{"user", strings.Repeat("a", MaxContentLength+1)},
 	}
 
 	for _, c := range failCases {
@@ -196,12 +172,21 @@ func TestGetRange(t *testing.T) {
 		{2, 3, []Post{makePostFromDoc(docs[1]), makePostFromDoc(docs[2]), makePostFromDoc(docs[3])}},
 		// The 'first' argument is locked to 1 if < 1, so we should check that we get posts 1 and 2...
 		{0, 2, []Post{makePostFromDoc(docs[0]), makePostFromDoc(docs[1])}},
+		// Post 7 is inactive, so it's left out without shifting the range.
+		{6, 3, []Post{makePostFromDoc(docs[5])}},
+		{7, 1, []Post{}},
 	}
 
 	for _, c := range cases {
 		got, err := GetRange(c.first, c.limit)
 
 		assert.Nil(err)
+		assert.Len(got, len(c.want))
+
+		first := c.first
+		if first < 1 {
+			first = 1
+		}
 
 		for i := range got {
 			g := got[i]
@@ -211,10 +196,18 @@ func TestGetRange(t *testing.T) {
 			assert.Equal(g.Author, w.Author)
 			assert.Equal(g.Content, w.Content)
 			assert.True(g.Time.Equal(w.Time))
+			assert.Equal(first+db.CountType(i), g.Number)
 		}
 	}
 }
 
+func TestLast(t *testing.T) {
+	n, err := Last()
+
+	assert.Nil(t, err)
+	assert.Equal(t, db.CountType(7), n)
+}
+
 func TestGetOne(t *testing.T) {
 	assert := assert.New(t)
 
@@ -248,6 +241,22 @@ func TestGetOne(t *testing.T) {
 	}
 }
 
+func TestGetAny(t *testing.T) {
+	assert := assert.New(t)
+
+	// The seventh post is inactive, and so only found by GetAny.
+	got, err := GetAny(7)
+	if assert.NoError(err) {
+		assert.False(got.Active)
+		assert.Equal(docs[6].Content, got.Content)
+	}
+
+	for _, n := range []db.CountType{0, 12} {
+		_, err := GetAny(n)
+		assert.Error(err, n)
+	}
+}
+
 func TestGetByID(t *testing.T) {
 	assert := assert.New(t)
 
@@ -281,7 +290,7 @@ func TestEdit(t *testing.T) {
 
 	p, _ := GetOne(3)
 
-	err := Edit(p.ID, "edited content")
+	err := Edit(p.ID, "editor", "edited content")
 	assert.Nil(err)
 
 	pEdit, _ := GetByID(p.ID)
@@ -291,6 +300,22 @@ func TestEdit(t *testing.T) {
 	assert.Equal(pEdit.Author, p.Author)
 	assert.Equal("edited content", pEdit.Content)
 	assert.True(p.Time.Equal(pEdit.Time))
+	assert.Nil(p.EditedAt)
+	assert.NotNil(pEdit.EditedAt)
+
+	// The previous content is kept as a revision.
+	rs, err := Revisions(p.ID)
+	assert.Nil(err)
+
+	if assert.Len(rs, 1) {
+		assert.Equal(p.ID, rs[0].PostID)
+		assert.Equal(p.Content, rs[0].Content)
+		assert.Equal("editor", rs[0].EditorID)
+		assert.True(rs[0].Time.Equal(*pEdit.EditedAt))
+	}
+
+	assert.Error(Edit(p.ID, "", "no editor"))
+	assert.Error(Edit(p.ID, "editor", strings.Repeat("a", MaxContentLength+1)))
 }
 
 func TestSubmit(t *testing.T) {
@@ -306,7 +331,10 @@ func TestSubmit(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(n, db.CountType(7))
 
-	pt, err := GetOne(7)
+	// The inactive post keeps number 7, so this post is number 8.
+	assert.Equal(db.CountType(8), p.Number)
+
+	pt, err := GetOne(8)
 	assert.Nil(err)
 
 	assert.Equal(p.Active, pt.Active)
@@ -319,3 +347,210 @@ func TestSubmit(t *testing.T) {
 	assert.NotNil(err)
 	assert.Empty(id)
 }
+
+func TestDeactivate(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := GetOne(2)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.NoError(Deactivate(p.ID))
+
+	_, err = GetOne(2)
+	assert.Error(err)
+
+	// Later posts keep their numbers.
+	p3, err := GetOne(3)
+	assert.NoError(err)
+	assert.Equal(db.CountType(3), p3.Number)
+
+	n, err := GetOffset(p3.ID)
+	assert.NoError(err)
+	assert.Equal(db.CountType(3), n)
+
+	assert.NoError(Activate(p.ID))
+}
+
+func TestSubmit_attachments(t *testing.T) {
+	assert := assert.New(t)
+
+	ids := []string{"attachment-b", "attachment-a", "attachment-c"}
+
+	id, err := Submit(&Post{Active: true, Author: "attacher", Content: "files", Time: time.Now().UTC(), Attachments: ids})
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	// Attachments keep the order they were given in.
+	p, err := GetByID(id)
+	if assert.NoError(err) {
+		assert.Equal(ids, p.Attachments)
+	}
+
+	ps, err := GetRange(p.Number, 1)
+	if assert.NoError(err) && assert.Len(ps, 1) {
+		assert.Equal(ids, ps[0].Attachments)
+	}
+
+	// Each attachment can be attached to only one post, and only once.
+	attached, err := AttachedTo([]string{"attachment-a", "attachment-d"})
+	if assert.NoError(err) {
+		assert.Equal(map[string][]string{"attachment-a": {id}}, attached)
+	}
+
+	_, err = Submit(&Post{Active: true, Author: "attacher", Content: "again", Time: time.Now().UTC(), Attachments: []string{"attachment-d", "attachment-a"}})
+	assert.Error(err, "attachments already attached to a post can't be used again")
+
+	_, err = Submit(&Post{Active: true, Author: "attacher", Content: "twice", Time: time.Now().UTC(), Attachments: []string{"attachment-d", "attachment-d"}})
+	assert.Error(err, "attachments can't be given twice")
+
+	assert.NoError(CheckAttachments([]string{"attachment-d"}))
+	assert.NoError(CheckAttachments(nil))
+}
+
+func TestPurge(t *testing.T) {
+	assert := assert.New(t)
+
+	reactions.SetStore(reactions.NewMemoryStore())
+	notifications.SetStore(notifications.NewMemoryStore())
+	attachments.SetStore(attachments.NewMemoryStore())
+	attachments.SetBlobStore(attachments.NewMemoryBlobStore())
+	viper.Set("reactions", []string{"👍"})
+
+	now := time.Now().UTC()
+
+	var atts []string
+	for i := 0; i < 2; i++ {
+		a, err := attachments.Upload("purger", "notes.txt", strings.NewReader("notes"))
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+
+		atts = append(atts, a.ID)
+	}
+
+	ids := make([]string, 3)
+	for i := range ids {
+		p := &Post{Active: true, Author: "purger", Content: fmt.Sprintf("purge %d", i), Time: now.Add(time.Duration(i) * time.Second)}
+		if i == 1 {
+			p.Attachments = atts
+		}
+
+		id, err := Submit(p)
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+
+		ids[i] = id
+	}
+
+	// A post from before attachments could be used only once shares the second attachment.
+	if _, err := store.Insert(&Post{Active: false, Author: "purger", Content: "sharer", Time: now.Add(time.Minute), Attachments: atts[1:]}); err != nil {
+		t.Fatal(err)
+	}
+
+	middle, err := GetByID(ids[1])
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.NoError(reactions.Add(ids[1], "reactor", "👍"))
+	assert.NoError(Edit(ids[1], "purger", "purge 1, edited"))
+
+	assert.Error(Purge(ids[1]), "active posts cannot be purged")
+	assert.Error(Purge("missing"))
+
+	assert.NoError(Deactivate(ids[1]))
+	assert.NoError(Purge(ids[1]))
+
+	_, err = GetByID(ids[1])
+	assert.Error(err)
+
+	_, err = attachments.Get(atts[0])
+	assert.Error(err, "attachments of the purged post alone should be deleted")
+
+	_, err = attachments.Get(atts[1])
+	assert.NoError(err, "attachments shared with another post should be kept")
+
+	rs, err := reactions.ForPosts([]string{ids[1]}, "reactor")
+	if assert.NoError(err) && assert.Len(rs[ids[1]], 1) {
+		assert.Zero(rs[ids[1]][0].Count)
+	}
+
+	rev, err := store.Revisions(ids[1])
+	if assert.NoError(err) {
+		assert.Empty(rev)
+	}
+
+	// The purged post's number is left as a gap, which paging by number skips over.
+	q, err := PageQuery(middle.Number+1, 1)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	page, err := GetPage(q)
+	if assert.NoError(err) {
+		assert.Equal([]string{"purge 2"}, contents(page.Posts))
+	}
+
+	q, err = PageQuery(middle.Number, 1)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	page, err = GetPage(q)
+	if assert.NoError(err) {
+		assert.Empty(page.Posts)
+	}
+}
+
+func TestByUser(t *testing.T) {
+	assert := assert.New(t)
+
+	var ids []string
+	for _, content := range []string{"first", "second", "third"} {
+		id, err := Submit(&Post{Active: true, Author: "profiled", Content: content, Time: time.Now().UTC()})
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+
+		ids = append(ids, id)
+	}
+
+	// Inactive posts aren't counted or listed.
+	assert.NoError(Deactivate(ids[1]))
+
+	n, err := CountByUser("profiled")
+	assert.NoError(err)
+	assert.Equal(db.CountType(2), n)
+
+	ps, err := ByUser("profiled", 1, 1)
+	if assert.NoError(err) && assert.Len(ps, 1) {
+		assert.Equal(ids[2], ps[0].ID, "newest first")
+	}
+
+	ps, err = ByUser("profiled", 2, 1)
+	if assert.NoError(err) && assert.Len(ps, 1) {
+		assert.Equal(ids[0], ps[0].ID)
+	}
+
+	ps, err = ByUser("profiled", 3, 1)
+	assert.NoError(err)
+	assert.Empty(ps)
+
+	ps, err = ByUser("profiled", 1, 10)
+	assert.NoError(err)
+	assert.Len(ps, 2)
+
+	n, err = CountByUser("nobody")
+	assert.NoError(err)
+	assert.Zero(n)
+
+	_, err = ByUser("profiled", 0, 10)
+	assert.Error(err)
+
+	_, err = ByUser("profiled", 1, 0)
+	assert.Error(err)
+}
@@ -0,0 +1,41 @@
+package posts
+
+import (
+	"sort"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/markdown"
+	"github.com/spf13/viper"
+)
+
+// getReferencesTable returns the name of the table recording the posts each post refers to. Only
+// SQL databases have one, as RethinkDB keeps a post's references with the post.
+func getReferencesTable() string {
+	return viper.GetString("db.references_table")
+}
+
+// references returns the numbers of the posts referred to in `content`, in ascending order. Any not
+// numbered before `before` are left out, as a post can only refer to earlier posts.
+func references(content string, before db.CountType) []db.CountType {
+	var ns []db.CountType
+
+	for _, n := range markdown.References(content) {
+		if db.CountType(n) < before {
+			ns = append(ns, db.CountType(n))
+		}
+	}
+
+	sort.Slice(ns, func(i, j int) bool { return ns[i] < ns[j] })
+
+	return ns
+}
+
+// Backlinks returns, for each of `numbers` referred to by any active post, the numbers of the active
+// posts referring to it, in ascending order. Numbers that no active post refers to are left out.
+func Backlinks(numbers []db.CountType) (map[db.CountType][]db.CountType, error) {
+	if len(numbers) == 0 {
+		return map[db.CountType][]db.CountType{}, nil
+	}
+
+	return store.Backlinks(numbers)
+}
@@ -0,0 +1,118 @@
+package posts
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	submit := func(content string) *Post {
+		id, err := Submit(&Post{Active: true, Author: "referrer", Content: content, Time: time.Now().UTC()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := GetByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return p
+	}
+
+	first := submit("first")
+	second := submit("second")
+
+	// References to later posts, including the post itself, are left out.
+	reply := submit(fmt.Sprintf(">>%d and >>%d, then >>%d again and >>%d", second.Number, first.Number, second.Number, second.Number+1))
+	assert.Equal([]db.CountType{first.Number, second.Number}, reply.References)
+
+	other := submit(fmt.Sprintf("> # someone (>>%d):\n> second", second.Number))
+	assert.Equal([]db.CountType{second.Number}, other.References)
+
+	links, err := Backlinks([]db.CountType{first.Number, second.Number, reply.Number})
+	assert.NoError(err)
+	assert.Equal(map[db.CountType][]db.CountType{
+		first.Number:  {reply.Number},
+		second.Number: {reply.Number, other.Number},
+	}, links)
+
+	// Edits change references, but still only to earlier posts.
+	assert.NoError(Edit(first.ID, "editor", fmt.Sprintf(">>%d", second.Number)))
+	assert.NoError(Edit(reply.ID, "editor", fmt.Sprintf("only >>%d now", first.Number)))
+
+	p, err := GetByID(reply.ID)
+	assert.NoError(err)
+	assert.Equal([]db.CountType{first.Number}, p.References)
+
+	p, err = GetByID(first.ID)
+	assert.NoError(err)
+	assert.Empty(p.References)
+
+	// Inactive posts don't link back.
+	assert.NoError(Deactivate(other.ID))
+
+	links, err = Backlinks([]db.CountType{first.Number, second.Number})
+	assert.NoError(err)
+	assert.Equal(map[db.CountType][]db.CountType{first.Number: {reply.Number}}, links)
+
+	links, err = Backlinks(nil)
+	assert.NoError(err)
+	assert.Empty(links)
+}
+
+func TestReferences_concurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	const n = 20
+
+	last, err := Last()
+	if !assert.NoError(err) {
+		return
+	}
+
+	// Each post refers to every number any of them may be given, so each should keep only those
+	// before its own, whichever order they're numbered in.
+	var refs []string
+	for i := db.CountType(1); i <= n; i++ {
+		refs = append(refs, fmt.Sprintf(">>%d", last+i))
+	}
+
+	content := strings.Join(refs, " ")
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			id, err := Submit(&Post{Active: true, Author: "racer", Content: content, Time: time.Now().UTC()})
+			if !assert.NoError(err) {
+				return
+			}
+
+			p, err := GetByID(id)
+			if !assert.NoError(err) {
+				return
+			}
+
+			assert.Len(p.References, int(p.Number-last-1), "post %d", p.Number)
+
+			for _, ref := range p.References {
+				assert.True(ref < p.Number, "post %d refers to %d", p.Number, ref)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
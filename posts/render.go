@@ -0,0 +1,58 @@
+package posts
+
+import (
+	"html/template"
+	"log"
+	"sync"
+
+	"github.com/boatilus/peppercorn/markdown"
+)
+
+// renderCacheSize is the greatest number of posts whose HTML is kept in renderCache.
+const renderCacheSize = 1000
+
+// rendered is the HTML of a post as it read when rendered.
+type rendered struct {
+	content string
+	html    template.HTML
+}
+
+// renderCache holds the HTML of recently rendered posts by ID. An entry is only used while the
+// post's content is unchanged, so each revision of a post is rendered once.
+var renderCache = struct {
+	sync.Mutex
+	posts map[string]rendered
+}{posts: make(map[string]rendered)}
+
+// HTML returns the content of `p` rendered from Markdown to sanitized HTML. Should rendering fail,
+// it returns the escaped content instead.
+func HTML(p *Post) template.HTML {
+	renderCache.Lock()
+	r, ok := renderCache.posts[p.ID]
+	renderCache.Unlock()
+
+	if ok && r.content == p.Content {
+		return r.html
+	}
+
+	html, err := markdown.Render(p.Content)
+	if err != nil {
+		log.Printf("posts: rendering post %q: %s", p.ID, err)
+		return template.HTML(template.HTMLEscapeString(p.Content))
+	}
+
+	renderCache.Lock()
+	defer renderCache.Unlock()
+
+	if _, ok := renderCache.posts[p.ID]; !ok && len(renderCache.posts) >= renderCacheSize {
+		// Make room by evicting whichever post comes first.
+		for id := range renderCache.posts {
+			delete(renderCache.posts, id)
+			break
+		}
+	}
+
+	renderCache.posts[p.ID] = rendered{content: p.Content, html: html}
+
+	return html
+}
@@ -0,0 +1,22 @@
+package posts
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTML(t *testing.T) {
+	assert := assert.New(t)
+
+	p := Post{ID: "rendered", Content: "*first*"}
+
+	assert.Equal(template.HTML("<p><em>first</em></p>\n"), HTML(&p))
+	assert.Equal(template.HTML("<p><em>first</em></p>\n"), renderCache.posts[p.ID].html)
+
+	// An edited post is rendered again.
+	p.Content = "**second**"
+	assert.Equal(template.HTML("<p><strong>second</strong></p>\n"), HTML(&p))
+	assert.Equal(p.Content, renderCache.posts[p.ID].content)
+}
@@ -0,0 +1,636 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by GetTable.
+type rethinkStore struct{}
+
+func (rethinkStore) Changes() (<-chan Change, error) {
+	cursor, err := db.Get().Table(GetTable()).Changes().Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan Change)
+
+	go func() {
+		defer close(changes)
+		defer cursor.Close()
+
+		var res struct {
+			OldVal *Post `gorethink:"old_val"`
+			NewVal *Post `gorethink:"new_val"`
+		}
+
+		for cursor.Next(&res) {
+			if c, ok := classify(res.OldVal, res.NewVal); ok {
+				changes <- c
+			}
+
+			// Next won't reset a value that's absent from the next document.
+			res.OldVal, res.NewVal = nil, nil
+		}
+
+		if err := cursor.Err(); err != nil {
+			log.Printf("posts: change feed: %s", err)
+		}
+	}()
+
+	return changes, nil
+}
+
+func (rethinkStore) Count() (db.CountType, error) {
+	cursor, err := db.Get().Table(GetTable()).GetAllByIndex("active", true).Count().Run(db.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	defer cursor.Close()
+
+	var n db.CountType
+	if err = cursor.One(&n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (rethinkStore) CountAll() (db.CountType, error) {
+	cursor, err := db.Get().Table(GetTable()).Count().Run(db.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	defer cursor.Close()
+
+	var n db.CountType
+	if err = cursor.One(&n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// byUserTerm returns the active posts by the user with `userID`, found with the `user_id` index.
+func byUserTerm(userID string) rethink.Term {
+	return db.Get().Table(GetTable()).GetAllByIndex("user_id", userID).Filter(map[string]interface{}{"active": true})
+}
+
+func (rethinkStore) CountByUser(userID string) (db.CountType, error) {
+	cursor, err := byUserTerm(userID).Count().Run(db.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	defer cursor.Close()
+
+	var n db.CountType
+	if err = cursor.One(&n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (rethinkStore) GetByUser(userID string, offset db.CountType, limit db.CountType) ([]Post, error) {
+	cursor, err := byUserTerm(userID).OrderBy(rethink.Desc("number")).Skip(offset).Limit(limit).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var posts []Post
+	if err = cursor.All(&posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func (rethinkStore) All() ([]Post, error) {
+	// Ordering a whole table without an index is limited to 100,000 documents, so go by `time_id`.
+	cursor, err := db.Get().Table(GetTable()).OrderBy(rethink.OrderByOpts{Index: rethink.Asc("time_id")}).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var posts []Post
+	if err = cursor.All(&posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// rangeTerm returns the active posts numbered from `first` up to, but not including, `first+limit`,
+// ordered by number.
+func rangeTerm(first db.CountType, limit db.CountType) rethink.Term {
+	// We'll filter to active posts (`true`) in the range of numbers by querying against the
+	// `active_number` compound index, whose right bound is open by default, and similarly order by
+	// it.
+	btOpts := rethink.BetweenOpts{Index: "active_number"}
+	min := []interface{}{true, first}
+	max := []interface{}{true, first + limit}
+
+	oOpts := rethink.OrderByOpts{Index: rethink.Asc("active_number")}
+
+	return db.Get().Table(GetTable()).Between(min, max, btOpts).OrderBy(oOpts)
+}
+
+func (rethinkStore) GetRange(first db.CountType, limit db.CountType) ([]Post, error) {
+	cursor, err := rangeTerm(first, limit).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var posts []Post
+	if err = cursor.All(&posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func (rethinkStore) GetRangeJoined(first db.CountType, limit db.CountType) ([]Zip, error) {
+	// We'll join against the `id` primary index against docs in the users table.
+	usersTable := db.Get().Table("users")
+
+	// EqJoin will negate the ordering specified by OrderBy unless we specify the `Ordered` option.
+	eqjOpts := rethink.EqJoinOpts{Ordered: true}
+
+	// Zipping a user document into the post document without Excepting the user's ID field doesn't
+	// trample over the post document's ID field, so we don't need to do anything else but run
+	// the full query.
+	cursor, err := rangeTerm(first, limit).EqJoin("user_id", usersTable, eqjOpts).Without(map[string]interface{}{
+		"right": "id",
+	}).Zip().Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	// The above is equivalent to:
+	// r
+	//	.db("peppercorn")
+	//	.table("posts")
+	// 	.between([true, first], [true, first + limit], {index: "active_number" })
+	//	.orderBy({index: r.asc("active_number")})
+	//	.eqJoin("user_id", r.db("peppercorn").table("users"), { ordered: true})
+	//	.without({ right: "id" })
+	//	.zip()
+
+	defer cursor.Close()
+
+	var posts []Zip
+	if err := cursor.All(&posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func (rethinkStore) GetPage(q Query) ([]Post, error) {
+	// The `active_time_id` compound index orders active posts just as pages do, so we can find where
+	// a page begins or ends without counting the posts before it. The `time_id` index does the same
+	// for all posts.
+	index := "active_time_id"
+	key := func(t interface{}, id interface{}) []interface{} {
+		return []interface{}{true, t, id}
+	}
+
+	if q.Inactive {
+		index = "time_id"
+		key = func(t interface{}, id interface{}) []interface{} {
+			return []interface{}{t, id}
+		}
+	}
+
+	btOpts := rethink.BetweenOpts{Index: index, LeftBound: "open", RightBound: "open"}
+	min := key(rethink.MinVal, rethink.MinVal)
+	max := key(rethink.MaxVal, rethink.MaxVal)
+
+	if q.After != nil {
+		min = key(q.After.Time, q.After.ID)
+	}
+
+	if q.Before != nil {
+		max = key(q.Before.Time, q.Before.ID)
+	}
+
+	oOpts := rethink.OrderByOpts{Index: rethink.Asc(index)}
+	if q.Last {
+		oOpts = rethink.OrderByOpts{Index: rethink.Desc(index)}
+	}
+
+	cursor, err := db.Get().Table(GetTable()).Between(min, max, btOpts).OrderBy(oOpts).Limit(q.Limit).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var posts []Post
+	if err = cursor.All(&posts); err != nil {
+		return nil, err
+	}
+
+	if q.Last {
+		reverse(posts)
+	}
+
+	return posts, nil
+}
+
+func (rethinkStore) GetByID(id string) (*Post, error) {
+	cursor, err := db.Get().Table(GetTable()).Get(id).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var p Post
+	if err := cursor.One(&p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (rethinkStore) GetByIDJoined(id string) (*Zip, error) {
+	cursor, err := db.Get().Table(GetTable()).GetAllByIndex("id", id).EqJoin("user_id", db.Get().Table("users")).Zip().Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var z Zip
+	if err := cursor.One(&z); err != nil {
+		return nil, err
+	}
+
+	return &z, nil
+}
+
+func (rethinkStore) GetByNumber(n db.CountType) (*Post, error) {
+	cursor, err := db.Get().Table(GetTable()).GetAllByIndex("number", n).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var p Post
+	if err := cursor.One(&p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (rethinkStore) NearestByNumber(n db.CountType, up bool) (*Post, error) {
+	t := db.Get().Table(GetTable())
+
+	// The `number` index finds the nearest post in a single read, however many numbers between are
+	// unused.
+	if up {
+		t = t.Between(n, rethink.MaxVal, rethink.BetweenOpts{Index: "number"}).OrderBy(rethink.OrderByOpts{Index: rethink.Asc("number")})
+	} else {
+		t = t.Between(rethink.MinVal, n, rethink.BetweenOpts{Index: "number", RightBound: "closed"}).OrderBy(rethink.OrderByOpts{Index: rethink.Desc("number")})
+	}
+
+	cursor, err := t.Limit(1).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var p Post
+	if err := cursor.One(&p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// counter returns the document holding the last number allocated to a post. Its ID is the name of
+// the posts table.
+func counter() rethink.Term {
+	return db.Get().Table(getCountersTable()).Get(GetTable())
+}
+
+func (rethinkStore) Last() (db.CountType, error) {
+	cursor, err := counter().Field("value").Default(0).Run(db.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	defer cursor.Close()
+
+	var n db.CountType
+	if err = cursor.One(&n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// number returns the number for a post being inserted: `n` if the post already has one, and
+// otherwise the next from the counter. Updates to a single document are atomic, so concurrent
+// inserts are never allocated the same number.
+func (rethinkStore) number(n db.CountType) (db.CountType, error) {
+	value := rethink.Row.Field("value")
+
+	if n != 0 {
+		data := map[string]interface{}{"value": rethink.Branch(value.Lt(n), n, value)}
+
+		_, err := counter().Update(data).RunWrite(db.Session)
+
+		return n, err
+	}
+
+	data := map[string]interface{}{"value": value.Add(1)}
+
+	res, err := counter().Update(data, rethink.UpdateOpts{ReturnChanges: true}).RunWrite(db.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(res.Changes) != 1 {
+		return 0, fmt.Errorf("No counter found for table %q", GetTable())
+	}
+
+	c, _ := res.Changes[0].NewValue.(map[string]interface{})
+
+	v, ok := c["value"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("Invalid counter for table %q", GetTable())
+	}
+
+	return db.CountType(v), nil
+}
+
+func (r rethinkStore) Insert(p *Post) (string, error) {
+	n, err := r.number(p.Number)
+	if err != nil {
+		return "", err
+	}
+
+	p.Number = n
+	p.References = references(p.Content, n)
+
+	res, err := db.Get().Table(GetTable()).Insert(p).RunWrite(db.Session)
+	if err != nil {
+		return "", err
+	}
+
+	if res.Inserted == 0 {
+		return "", fmt.Errorf("Failure in inserting post by user %q", p.Author)
+	}
+
+	// RethinkDB only generates a key if the post didn't already have an ID.
+	if p.ID != "" {
+		return p.ID, nil
+	}
+
+	return res.GeneratedKeys[0], nil
+}
+
+func (r rethinkStore) Edit(id string, content string, references []db.CountType, editorID string, at time.Time) error {
+	p, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if p == nil || p.Content == content {
+		return errors.New("Unable to insert changes to document")
+	}
+
+	// Only replacing the content we read keeps a concurrent edit from going unrecorded.
+	data := rethink.Branch(
+		rethink.Row.Field("content").Eq(p.Content),
+		map[string]interface{}{"content": content, "edited_at": at, "references": references},
+		map[string]interface{}{},
+	)
+
+	res, err := db.Get().Table(GetTable()).Get(id).Update(data).RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Replaced != 1 {
+		return errors.New("Unable to insert changes to document")
+	}
+
+	return r.InsertRevision(&Revision{PostID: id, Content: p.Content, EditorID: editorID, Time: at})
+}
+
+func (rethinkStore) SetActive(id string, active bool) error {
+	cursor, err := db.Get().Table(GetTable()).Get(id).Run(db.Session)
+	if err != nil {
+		return err
+	}
+
+	var p Post
+	if err = cursor.One(&p); err != nil {
+		return err
+	}
+
+	cursor.Close()
+
+	p.Active = active
+
+	io := rethink.InsertOpts{Conflict: "update"}
+
+	if _, err = db.Get().Table(GetTable()).Insert(&p, io).Run(db.Session); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (rethinkStore) Delete(id string) error {
+	// A post's references and attachments are kept in its own document, so go with it.
+	res, err := db.Get().Table(GetTable()).Get(id).Delete().RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted != 1 {
+		return fmt.Errorf("No post found with ID %q", id)
+	}
+
+	_, err = db.Get().Table(getRevisionsTable()).GetAllByIndex("post_id", id).Delete().RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) Revisions(id string) ([]Revision, error) {
+	cursor, err := db.Get().Table(getRevisionsTable()).GetAllByIndex("post_id", id).OrderBy("time", "id").Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var rs []Revision
+	if err = cursor.All(&rs); err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+func (rethinkStore) Backlinks(numbers []db.CountType) (map[db.CountType][]db.CountType, error) {
+	keys := make([]interface{}, len(numbers))
+	for i, n := range numbers {
+		keys[i] = n
+	}
+
+	cursor, err := db.Get().Table(GetTable()).GetAllByIndex("references", keys...).
+		Filter(map[string]interface{}{"active": true}).
+		Pluck("id", "number", "references").
+		OrderBy("number").
+		Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var ps []Post
+	if err = cursor.All(&ps); err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[db.CountType]bool, len(numbers))
+	for _, n := range numbers {
+		wanted[n] = true
+	}
+
+	links := make(map[db.CountType][]db.CountType)
+
+	for i, p := range ps {
+		// A post is returned once for each of `numbers` it refers to.
+		if i > 0 && ps[i-1].ID == p.ID {
+			continue
+		}
+
+		for _, n := range p.References {
+			if wanted[n] {
+				links[n] = append(links[n], p.Number)
+			}
+		}
+	}
+
+	return links, nil
+}
+
+func (rethinkStore) AttachedTo(attachmentIDs []string) (map[string][]string, error) {
+	keys := make([]interface{}, len(attachmentIDs))
+	for i, id := range attachmentIDs {
+		keys[i] = id
+	}
+
+	cursor, err := db.Get().Table(GetTable()).GetAllByIndex("attachments", keys...).
+		Pluck("id", "attachments").
+		Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var ps []Post
+	if err = cursor.All(&ps); err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		wanted[id] = true
+	}
+
+	attached := make(map[string][]string)
+	seen := make(map[string]bool, len(ps))
+
+	for _, p := range ps {
+		// A post is returned once for each of `attachmentIDs` it has.
+		if seen[p.ID] {
+			continue
+		}
+
+		seen[p.ID] = true
+
+		for _, a := range p.Attachments {
+			if wanted[a] {
+				attached[a] = append(attached[a], p.ID)
+			}
+		}
+	}
+
+	return attached, nil
+}
+
+func (rethinkStore) AllRevisions() ([]Revision, error) {
+	// Ordering a whole table without an index is limited to 100,000 documents, so sort here instead.
+	cursor, err := db.Get().Table(getRevisionsTable()).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var rs []Revision
+	if err = cursor.All(&rs); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(revisionsByTime(rs))
+
+	return rs, nil
+}
+
+func (rethinkStore) InsertRevision(r *Revision) error {
+	res, err := db.Get().Table(getRevisionsTable()).Insert(r).RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Inserted == 0 {
+		return fmt.Errorf("Failure in inserting revision of post %q", r.PostID)
+	}
+
+	return nil
+}
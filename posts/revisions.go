@@ -0,0 +1,266 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Revision records what a post said before an edit, along with who made the edit and when.
+type Revision struct {
+	ID       string    `gorethink:"id,omitempty"`
+	PostID   string    `gorethink:"post_id"`
+	Content  string    `gorethink:"content"`
+	EditorID string    `gorethink:"editor_id"`
+	Time     time.Time `gorethink:"time"`
+}
+
+// getRevisionsTable returns the name of the revisions table from Viper.
+func getRevisionsTable() string {
+	return viper.GetString("db.revisions_table")
+}
+
+// Revisions returns the revisions of the post with `id`, oldest first.
+func Revisions(id string) ([]Revision, error) {
+	return store.Revisions(id)
+}
+
+// AllRevisions returns every revision of every post, ordered by time (ascending).
+func AllRevisions() ([]Revision, error) {
+	return store.AllRevisions()
+}
+
+// RestoreRevision inserts a revision exactly as given, keeping its ID. It's intended for restoring
+// revisions from an archive.
+func RestoreRevision(r *Revision) error {
+	if r == nil || r.ID == "" || r.PostID == "" {
+		return errors.New("invalid Revision supplied")
+	}
+
+	return store.InsertRevision(r)
+}
+
+// Version is the content of a post as it stood between edits.
+type Version struct {
+	// Number counts the versions of a post from 1, the post as first submitted.
+	Number  int
+	Content string
+	// EditorID is the ID of the user who wrote this version: the post's author for the first
+	// version, and the editor of each version after it.
+	EditorID string
+	Time     time.Time
+}
+
+// History returns every version of the post with `id`, from the post as it was submitted through to
+// its current content. Removed posts have no history.
+func History(id string) ([]Version, error) {
+	p, err := GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.Active {
+		return nil, fmt.Errorf("No post found at index %q", id)
+	}
+
+	rs, err := store.Revisions(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each revision holds the content from before an edit, so the first revision is the original
+	// post and the edit that produced each following version is recorded by the revision before it.
+	vs := make([]Version, len(rs)+1)
+	editorID, at := p.Author, p.Time
+
+	for i, r := range rs {
+		vs[i] = Version{Number: i + 1, Content: r.Content, EditorID: editorID, Time: at}
+		editorID, at = r.EditorID, r.Time
+	}
+
+	vs[len(rs)] = Version{Number: len(rs) + 1, Content: p.Content, EditorID: editorID, Time: at}
+
+	return vs, nil
+}
+
+// DiffOp describes how a line differs between two versions.
+type DiffOp int
+
+const (
+	// Unchanged lines are in both versions.
+	Unchanged DiffOp = iota
+	// Added lines are only in the later version.
+	Added
+	// Removed lines are only in the earlier version.
+	Removed
+)
+
+func (op DiffOp) String() string {
+	switch op {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	default:
+		return "unchanged"
+	}
+}
+
+// DiffLine is a single line of a diff.
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// MaxDiffLines is the most lines a version can have to be compared with another. Comparing takes
+// time in proportion to the product of the versions' lengths, so a limit keeps it quick.
+const MaxDiffLines = 2000
+
+// Diff returns the differences between versions `from` and `to` of the post with `id`.
+func Diff(id string, from int, to int) ([]DiffLine, error) {
+	vs, err := History(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if from < 1 || from > len(vs) || to < 1 || to > len(vs) {
+		return nil, fmt.Errorf("Post %q has versions 1 through %d", id, len(vs))
+	}
+
+	a, b := vs[from-1].Content, vs[to-1].Content
+
+	if strings.Count(a, "\n") >= MaxDiffLines || strings.Count(b, "\n") >= MaxDiffLines {
+		return nil, fmt.Errorf("Versions longer than %d lines cannot be compared", MaxDiffLines)
+	}
+
+	return DiffLines(a, b), nil
+}
+
+// DiffLines returns the line-by-line differences between `a` and `b`, keeping the longest common
+// subsequence of lines unchanged. Where lines are both removed and added, the removed lines come
+// first.
+func DiffLines(a string, b string) []DiffLine {
+	as := strings.Split(a, "\n")
+	bs := strings.Split(b, "\n")
+
+	// Lines in common at the start and end are unchanged, and usually make up most of an edit.
+	prefix := 0
+	for prefix < len(as) && prefix < len(bs) && as[prefix] == bs[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(as)-prefix && suffix < len(bs)-prefix && as[len(as)-1-suffix] == bs[len(bs)-1-suffix] {
+		suffix++
+	}
+
+	var lines []DiffLine
+
+	for _, l := range as[:prefix] {
+		lines = append(lines, DiffLine{Unchanged, l})
+	}
+
+	lines = diffMiddle(lines, as[prefix:len(as)-suffix], bs[prefix:len(bs)-suffix])
+
+	for _, l := range as[len(as)-suffix:] {
+		lines = append(lines, DiffLine{Unchanged, l})
+	}
+
+	return lines
+}
+
+// diffMiddle appends the differences between `as` and `bs` to `lines`, by Hirschberg's algorithm:
+// `as` is split in half, and `bs` where the longest common subsequences of each half with the
+// parts of `bs` either side sum longest, and each pair of halves is diffed in turn. It takes space
+// only in proportion to the length of `bs`.
+func diffMiddle(lines []DiffLine, as []string, bs []string) []DiffLine {
+	switch {
+	case len(as) == 0:
+		for _, l := range bs {
+			lines = append(lines, DiffLine{Added, l})
+		}
+
+		return lines
+	case len(as) == 1:
+		for k, l := range bs {
+			if l == as[0] {
+				for _, added := range bs[:k] {
+					lines = append(lines, DiffLine{Added, added})
+				}
+
+				lines = append(lines, DiffLine{Unchanged, l})
+
+				return diffMiddle(lines, nil, bs[k+1:])
+			}
+		}
+
+		lines = append(lines, DiffLine{Removed, as[0]})
+
+		return diffMiddle(lines, nil, bs)
+	}
+
+	mid := len(as) / 2
+
+	forward := lcsLengths(as[:mid], bs, false)
+	backward := lcsLengths(as[mid:], bs, true)
+
+	// forward[k] is the length of the LCS of the first half with bs[:k], and backward[k] that of the
+	// second half with bs[k:].
+	split, best := 0, -1
+	for k := 0; k <= len(bs); k++ {
+		if n := forward[k] + backward[k]; n > best {
+			split, best = k, n
+		}
+	}
+
+	lines = diffMiddle(lines, as[:mid], bs[:split])
+
+	return diffMiddle(lines, as[mid:], bs[split:])
+}
+
+// lcsLengths returns, for each k from 0 to len(bs), the length of the longest common subsequence of
+// `as` with bs[:k] or, if `reverse` is true, with bs[k:]. It keeps only two rows of the table.
+func lcsLengths(as []string, bs []string, reverse bool) []int {
+	prev := make([]int, len(bs)+1)
+	cur := make([]int, len(bs)+1)
+
+	for i := range as {
+		a := as[i]
+		if reverse {
+			a = as[len(as)-1-i]
+		}
+
+		for j := 1; j <= len(bs); j++ {
+			b := bs[j-1]
+			if reverse {
+				b = bs[len(bs)-j]
+			}
+
+			switch {
+			case a == b:
+				cur[j] = prev[j-1] + 1
+			case prev[j] >= cur[j-1]:
+				cur[j] = prev[j]
+			default:
+				cur[j] = cur[j-1]
+			}
+		}
+
+		prev, cur = cur, prev
+	}
+
+	if !reverse {
+		return prev
+	}
+
+	// Reversed, prev[j] counts the last j lines of bs, which start at len(bs)-j.
+	lengths := make([]int, len(bs)+1)
+	for j := range prev {
+		lengths[len(bs)-j] = prev[j]
+	}
+
+	return lengths
+}
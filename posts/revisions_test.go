@@ -0,0 +1,144 @@
+package posts
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	p, _ := New("author", "one\ntwo")
+
+	id, err := Submit(p)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.NoError(Edit(id, "first editor", "one\n2\nthree"))
+	assert.NoError(Edit(id, "second editor", "three"))
+
+	vs, err := History(id)
+	if !assert.NoError(err) || !assert.Len(vs, 3) {
+		t.FailNow()
+	}
+
+	assert.Equal([]string{"one\ntwo", "one\n2\nthree", "three"}, []string{vs[0].Content, vs[1].Content, vs[2].Content})
+	assert.Equal([]string{"author", "first editor", "second editor"}, []string{vs[0].EditorID, vs[1].EditorID, vs[2].EditorID})
+
+	for i := range vs {
+		assert.Equal(i+1, vs[i].Number)
+	}
+
+	assert.True(vs[0].Time.Equal(p.Time))
+	assert.False(vs[2].Time.Before(vs[1].Time))
+
+	lines, err := Diff(id, 1, 2)
+	assert.NoError(err)
+	assert.Equal([]DiffLine{
+		{Unchanged, "one"},
+		{Removed, "two"},
+		{Added, "2"},
+		{Added, "three"},
+	}, lines)
+
+	for _, r := range [][2]int{{0, 1}, {1, 4}} {
+		_, err := Diff(id, r[0], r[1])
+		assert.Error(err)
+	}
+
+	// Versions too long to compare quickly aren't compared at all.
+	assert.NoError(Edit(id, "third editor", strings.Repeat("x\n", MaxDiffLines)))
+
+	_, err = Diff(id, 3, 4)
+	assert.Error(err)
+
+	_, err = History("nonexistent")
+	assert.Error(err)
+}
+
+func TestDiffLines(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]DiffLine{{Unchanged, "a"}, {Unchanged, "b"}}, DiffLines("a\nb", "a\nb"))
+	assert.Equal([]DiffLine{{Removed, "a"}, {Added, "b"}}, DiffLines("a", "b"))
+	assert.Equal([]DiffLine{
+		{Added, "x"},
+		{Unchanged, "a"},
+		{Removed, "b"},
+		{Unchanged, "c"},
+		{Added, "d"},
+	}, DiffLines("a\nb\nc", "x\na\nc\nd"))
+
+	assert.Equal("added", Added.String())
+	assert.Equal("removed", Removed.String())
+	assert.Equal("unchanged", Unchanged.String())
+}
+
+// lcsLength returns the length of the longest common subsequence of `as` and `bs` the slow way, to
+// check DiffLines against.
+func lcsLength(as []string, bs []string) int {
+	table := make([][]int, len(as)+1)
+	for i := range table {
+		table[i] = make([]int, len(bs)+1)
+	}
+
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			switch {
+			case as[i] == bs[j]:
+				table[i][j] = table[i+1][j+1] + 1
+			case table[i+1][j] >= table[i][j+1]:
+				table[i][j] = table[i+1][j]
+			default:
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+
+	return table[0][0]
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	assert := assert.New(t)
+
+	r := rand.New(rand.NewSource(1))
+
+	randomLines := func() []string {
+		ls := make([]string, r.Intn(12))
+		for i := range ls {
+			ls[i] = string(rune('a' + r.Intn(4)))
+		}
+
+		return ls
+	}
+
+	for n := 0; n < 500; n++ {
+		as, bs := randomLines(), randomLines()
+
+		var before, after []string
+		unchanged := 0
+
+		for _, l := range DiffLines(strings.Join(as, "\n"), strings.Join(bs, "\n")) {
+			if l.Op != Added {
+				before = append(before, l.Text)
+			}
+
+			if l.Op != Removed {
+				after = append(after, l.Text)
+			}
+
+			if l.Op == Unchanged {
+				unchanged++
+			}
+		}
+
+		// The diff turns one into the other, keeping as many lines as can be kept.
+		assert.Equal(strings.Join(as, "\n"), strings.Join(before, "\n"))
+		assert.Equal(strings.Join(bs, "\n"), strings.Join(after, "\n"))
+		assert.Equal(lcsLength(strings.Split(strings.Join(as, "\n"), "\n"), strings.Split(strings.Join(bs, "\n"), "\n")), unchanged)
+	}
+}
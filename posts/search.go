@@ -0,0 +1,513 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// SearchQuery selects the active posts matching a search.
+type SearchQuery struct {
+	// Terms are words that must each appear in a post. A term ending in `*` matches any word
+	// beginning with the rest of it.
+	Terms []string
+	// Phrases are runs of words that must each appear in a post, word for word.
+	Phrases []string
+	// Author, if non-empty, is the ID of the user who must have written the post.
+	Author string
+	// AuthorName is the name given by a `from:` filter. As user names mean nothing to this package,
+	// callers resolve AuthorName to Author before searching.
+	AuthorName string
+	// After and Before, if non-zero, exclude posts submitted before After and from Before onwards.
+	After  time.Time
+	Before time.Time
+}
+
+// ParseSearch parses a search as typed by a user. Words are terms, text in double quotes is a
+// phrase, `from:name` filters by author, and `after:2006-01-02` and `before:2006-01-02` filter by
+// date, with each date starting at midnight in `loc`.
+func ParseSearch(s string, loc *time.Location) (SearchQuery, error) {
+	var q SearchQuery
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				end = len(s) - 1 // An unclosed phrase runs to the end of the search.
+			}
+
+			if phrase := strings.Join(words(s[1:end+1]), " "); phrase != "" {
+				q.Phrases = append(q.Phrases, phrase)
+			}
+
+			s = s[min(end+2, len(s)):]
+			continue
+		}
+
+		field := s
+		if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+			field = s[:i]
+		}
+
+		s = s[len(field):]
+
+		if err := q.parseField(field, loc); err != nil {
+			return SearchQuery{}, err
+		}
+	}
+
+	if q.empty() {
+		return SearchQuery{}, errors.New("Search for at least one word, phrase, author or date")
+	}
+
+	return q, nil
+}
+
+// parseField adds a single unquoted field of a search to `q`.
+func (q *SearchQuery) parseField(field string, loc *time.Location) error {
+	var err error
+
+	switch {
+	case strings.HasPrefix(field, "from:"):
+		q.AuthorName = field[len("from:"):]
+	case strings.HasPrefix(field, "after:"):
+		q.After, err = time.ParseInLocation("2006-01-02", field[len("after:"):], loc)
+	case strings.HasPrefix(field, "before:"):
+		q.Before, err = time.ParseInLocation("2006-01-02", field[len("before:"):], loc)
+	default:
+		ws := words(field)
+
+		if len(ws) > 0 && strings.HasSuffix(field, "*") {
+			ws[len(ws)-1] += "*"
+		}
+
+		q.Terms = append(q.Terms, ws...)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Expected a date like 2006-01-02 in %q", field)
+	}
+
+	return nil
+}
+
+// empty reports whether `q` would match every post.
+func (q *SearchQuery) empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0 && q.Author == "" && q.AuthorName == "" &&
+		q.After.IsZero() && q.Before.IsZero()
+}
+
+// SearchResults are the posts matching a search, newest first.
+type SearchResults struct {
+	Posts []Post
+	// Total is the number of matching posts, of which Posts holds up to the limit given to Search.
+	Total int
+}
+
+// Search returns up to `limit` of the newest active posts matching `q`. As with GetRange, the limit
+// is at most 100.
+func Search(q SearchQuery, limit int) (*SearchResults, error) {
+	if limit < 1 {
+		return nil, errors.New("limit must be positive")
+	}
+
+	if limit > 100 {
+		limit = 100
+	}
+
+	if q.empty() {
+		return nil, errors.New("empty search")
+	}
+
+	if q.AuthorName != "" && q.Author == "" {
+		return nil, errors.New("author name not resolved to an ID")
+	}
+
+	if err := index.build(); err != nil {
+		return nil, err
+	}
+
+	ids := index.search(&q)
+
+	results := &SearchResults{Total: len(ids)}
+
+	for _, id := range ids[:min(limit, len(ids))] {
+		p, err := store.GetByID(id)
+		if err != nil {
+			return nil, err
+		}
+
+		// The post may have been removed by another process since it was indexed.
+		if p == nil || !p.Active {
+			results.Total--
+			continue
+		}
+
+		results.Posts = append(results.Posts, *p)
+	}
+
+	return results, nil
+}
+
+// indexed is the part of a post kept in the search index.
+type indexed struct {
+	id     string
+	author string
+	time   time.Time
+	words  []string
+}
+
+// byNewest sorts indexed posts newest first, as they're ordered in the thread but reversed.
+type byNewest []*indexed
+
+func (ps byNewest) Len() int      { return len(ps) }
+func (ps byNewest) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
+func (ps byNewest) Less(i, j int) bool {
+	if ps[i].time.Equal(ps[j].time) {
+		return ps[i].id > ps[j].id
+	}
+
+	return ps[i].time.After(ps[j].time)
+}
+
+// searchIndex is an inverted index of the words in every active post. It's built from the store
+// on the first search, and kept up to date by the changes made through this package. Where the
+// store reports changes itself, as RethinkDB does, the index follows them too, so that changes
+// made by other processes are reflected as well.
+type searchIndex struct {
+	sync.RWMutex
+	built bool
+	posts map[string]*indexed
+	// words maps each word to the IDs of the posts containing it.
+	words map[string]map[string]struct{}
+	// done is closed to stop following the store's changes, once the index is discarded.
+	done chan struct{}
+}
+
+var index = &searchIndex{}
+
+// build loads every active post into the index, unless it's already been built, and starts
+// following the store's changes if it reports them.
+func (idx *searchIndex) build() error {
+	idx.RLock()
+	built := idx.built
+	idx.RUnlock()
+
+	if built {
+		return nil
+	}
+
+	idx.Lock()
+	defer idx.Unlock()
+
+	if idx.built {
+		return nil
+	}
+
+	f, feeds := store.(changeFeeder)
+
+	// Subscribe before loading the posts, so that no change made in between is missed.
+	var changes <-chan Change
+	if feeds {
+		var err error
+		if changes, err = f.Changes(); err != nil {
+			return err
+		}
+	}
+
+	ps, err := store.All()
+	if err != nil {
+		return err
+	}
+
+	idx.load(ps)
+	idx.built = true
+
+	if feeds {
+		idx.done = make(chan struct{})
+		go idx.follow(f, changes, idx.done)
+	}
+
+	return nil
+}
+
+// load replaces the contents of the index with the active posts of `ps`. The caller must hold the
+// write lock.
+func (idx *searchIndex) load(ps []Post) {
+	idx.posts = make(map[string]*indexed)
+	idx.words = make(map[string]map[string]struct{})
+
+	for i := range ps {
+		if ps[i].Active {
+			idx.put(&ps[i])
+		}
+	}
+}
+
+// follow applies every change from `changes` to the index until `done` is closed, resubscribing to
+// `f` if the feed fails. As changes may have been missed in the meantime, it reloads every post
+// each time it resubscribes.
+func (idx *searchIndex) follow(f changeFeeder, changes <-chan Change, done <-chan struct{}) {
+	for {
+		if changes != nil {
+			if !idx.apply(changes, done) {
+				return
+			}
+
+			log.Print("posts: search index change feed closed")
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(retryInterval):
+		}
+
+		var err error
+		if changes, err = f.Changes(); err != nil {
+			log.Printf("posts: subscribing to changes for the search index: %s", err)
+			changes = nil
+			continue
+		}
+
+		if ps, err := store.All(); err != nil {
+			log.Printf("posts: reloading the search index: %s", err)
+		} else {
+			idx.Lock()
+			idx.load(ps)
+			idx.Unlock()
+		}
+	}
+}
+
+// apply applies each change from `changes` to the index, returning true when `changes` is closed
+// and false if `done` is closed first.
+func (idx *searchIndex) apply(changes <-chan Change, done <-chan struct{}) bool {
+	for {
+		select {
+		case <-done:
+			return false
+		case c, ok := <-changes:
+			if !ok {
+				return true
+			}
+
+			idx.Lock()
+			idx.remove(c.Post.ID)
+
+			if c.Type != Deactivated {
+				idx.put(&c.Post)
+			}
+
+			idx.Unlock()
+		}
+	}
+}
+
+// stop stops the index following the store's changes.
+func (idx *searchIndex) stop() {
+	idx.Lock()
+	defer idx.Unlock()
+
+	if idx.done != nil {
+		close(idx.done)
+		idx.done = nil
+	}
+}
+
+// reindex brings the index up to date with the post with `id`, once the index has been built.
+func (idx *searchIndex) reindex(id string) {
+	idx.RLock()
+	built := idx.built
+	idx.RUnlock()
+
+	if !built {
+		return
+	}
+
+	p, err := store.GetByID(id)
+	if err != nil {
+		log.Printf("posts: reindexing post %q: %s", id, err)
+		return
+	}
+
+	idx.Lock()
+	defer idx.Unlock()
+
+	idx.remove(id)
+
+	if p != nil && p.Active {
+		idx.put(p)
+	}
+}
+
+// put adds `p` to the index. The caller must hold the write lock, and have removed any earlier
+// version of `p`.
+func (idx *searchIndex) put(p *Post) {
+	d := &indexed{id: p.ID, author: p.Author, time: p.Time, words: words(p.Content)}
+	idx.posts[p.ID] = d
+
+	for _, w := range d.words {
+		ids, ok := idx.words[w]
+		if !ok {
+			ids = make(map[string]struct{})
+			idx.words[w] = ids
+		}
+
+		ids[p.ID] = struct{}{}
+	}
+}
+
+// remove removes the post with `id` from the index. The caller must hold the write lock.
+func (idx *searchIndex) remove(id string) {
+	d, ok := idx.posts[id]
+	if !ok {
+		return
+	}
+
+	delete(idx.posts, id)
+
+	for _, w := range d.words {
+		delete(idx.words[w], id)
+
+		if len(idx.words[w]) == 0 {
+			delete(idx.words, w)
+		}
+	}
+}
+
+// search returns the IDs of the posts matching `q`, newest first.
+func (idx *searchIndex) search(q *SearchQuery) []string {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	// terms holds the posts containing each term, and so each word of each phrase too.
+	terms := make(map[string]map[string]struct{})
+	for _, t := range q.Terms {
+		terms[t] = idx.containing(t)
+	}
+
+	for _, p := range q.Phrases {
+		for _, w := range strings.Fields(p) {
+			terms[w] = idx.containing(w)
+		}
+	}
+
+	// Every term must appear in a match, so we'll only consider the posts containing the rarest.
+	var candidates map[string]struct{}
+	for _, ids := range terms {
+		if candidates == nil || len(ids) < len(candidates) {
+			candidates = ids
+		}
+	}
+
+	var matches []*indexed
+
+	consider := func(d *indexed) {
+		if idx.matches(d, q, terms) {
+			matches = append(matches, d)
+		}
+	}
+
+	if candidates == nil {
+		for _, d := range idx.posts {
+			consider(d)
+		}
+	} else {
+		for id := range candidates {
+			consider(idx.posts[id])
+		}
+	}
+
+	sort.Sort(byNewest(matches))
+
+	ids := make([]string, len(matches))
+	for i := range matches {
+		ids[i] = matches[i].id
+	}
+
+	return ids
+}
+
+// containing returns the IDs of the posts containing the word `w`, or, should it end in `*`, any
+// word beginning with the rest of it. The caller must hold the read lock.
+func (idx *searchIndex) containing(w string) map[string]struct{} {
+	if !strings.HasSuffix(w, "*") {
+		return idx.words[w]
+	}
+
+	prefix := strings.TrimSuffix(w, "*")
+	ids := make(map[string]struct{})
+
+	for word, wordIDs := range idx.words {
+		if strings.HasPrefix(word, prefix) {
+			for id := range wordIDs {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+
+	return ids
+}
+
+// matches reports whether `d` matches every part of `q`, given the posts containing each of its
+// terms. The caller must hold the read lock.
+func (idx *searchIndex) matches(d *indexed, q *SearchQuery, terms map[string]map[string]struct{}) bool {
+	if q.Author != "" && d.author != q.Author {
+		return false
+	}
+
+	if !q.After.IsZero() && d.time.Before(q.After) {
+		return false
+	}
+
+	if !q.Before.IsZero() && !d.time.Before(q.Before) {
+		return false
+	}
+
+	for _, ids := range terms {
+		if _, ok := ids[d.id]; !ok {
+			return false
+		}
+	}
+
+	for _, p := range q.Phrases {
+		if !containsPhrase(d.words, strings.Fields(p)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsPhrase reports whether `phrase` appears in `ws`, word for word.
+func containsPhrase(ws []string, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(ws); i++ {
+		match := true
+
+		for j := range phrase {
+			if ws[i+j] != phrase[j] {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+// words splits `s` into lowercase words of letters and digits, in order.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,177 @@
+package posts
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearch(t *testing.T) {
+	assert := assert.New(t)
+
+	loc, _ := time.LoadLocation("US/Pacific")
+
+	q, err := ParseSearch(`Router CONFIG* "last  Spring!" from:boat after:2017-03-01 before:2017-06-01 "unclosed phrase`, loc)
+	assert.NoError(err)
+	assert.Equal([]string{"router", "config*"}, q.Terms)
+	assert.Equal([]string{"last spring", "unclosed phrase"}, q.Phrases)
+	assert.Equal("boat", q.AuthorName)
+	assert.True(time.Date(2017, 3, 1, 0, 0, 0, 0, loc).Equal(q.After))
+	assert.True(time.Date(2017, 6, 1, 0, 0, 0, 0, loc).Equal(q.Before))
+
+	q, err = ParseSearch("foo-bar *", loc)
+	assert.NoError(err)
+	assert.Equal([]string{"foo", "bar"}, q.Terms)
+
+	for _, s := range []string{"", "   ", `""`, "*", "after:yesterday", "before:2017-13-01"} {
+		_, err := ParseSearch(s, loc)
+		assert.Error(err, s)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	assert := assert.New(t)
+
+	day := func(d int) time.Time { return time.Date(2017, 4, d, 12, 0, 0, 0, time.UTC) }
+
+	submit := func(author string, content string, at time.Time) string {
+		p := Post{Active: true, Author: author, Content: content, Time: at}
+
+		id, err := Submit(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return id
+	}
+
+	older := submit("searcher", "The router config lives in the wiki.", day(1))
+	newer := submit("searcher", "Configuring the router: see the wiki config page.", day(10))
+	other := submit("other searcher", "My router's config? It's fine.", day(20))
+
+	search := func(q SearchQuery) []string {
+		results, err := Search(q, 10)
+		if !assert.NoError(err) {
+			return nil
+		}
+
+		assert.Equal(len(results.Posts), results.Total)
+
+		ids := make([]string, len(results.Posts))
+		for i := range results.Posts {
+			ids[i] = results.Posts[i].ID
+		}
+
+		return ids
+	}
+
+	// Newest first
+	assert.Equal([]string{other, newer, older}, search(SearchQuery{Terms: []string{"router", "config"}}))
+	assert.Equal([]string{newer}, search(SearchQuery{Terms: []string{"configuring"}}))
+	assert.Equal([]string{other, newer, older}, search(SearchQuery{Terms: []string{"router", "config*"}}))
+	assert.Empty(search(SearchQuery{Terms: []string{"router", "nonexistent"}}))
+
+	assert.Equal([]string{older}, search(SearchQuery{Phrases: []string{"router config"}}))
+	assert.Equal([]string{newer, older}, search(SearchQuery{Terms: []string{"wiki"}, Phrases: []string{"the router"}}))
+	assert.Equal([]string{newer}, search(SearchQuery{Phrases: []string{"wiki config"}}))
+
+	assert.Equal([]string{newer, older}, search(SearchQuery{Terms: []string{"router"}, Author: "searcher"}))
+	assert.Equal([]string{newer}, search(SearchQuery{Terms: []string{"router"}, After: day(5), Before: day(20)}))
+	assert.Equal([]string{other}, search(SearchQuery{After: day(15), Before: day(21)}))
+
+	// The index follows edits and removals.
+	assert.NoError(Edit(older, "editor", "Nothing to see here."))
+	assert.Equal([]string{other, newer}, search(SearchQuery{Terms: []string{"router"}}))
+	assert.Equal([]string{older}, search(SearchQuery{Phrases: []string{"nothing to see"}}))
+
+	assert.NoError(Deactivate(newer))
+	assert.Equal([]string{other}, search(SearchQuery{Terms: []string{"router"}}))
+
+	assert.NoError(Activate(newer))
+	assert.Equal([]string{other, newer}, search(SearchQuery{Terms: []string{"router"}}))
+
+	// Only so many results are returned, but all are counted.
+	results, err := Search(SearchQuery{Terms: []string{"router"}}, 1)
+	assert.NoError(err)
+	assert.Len(results.Posts, 1)
+	assert.Equal(2, results.Total)
+
+	_, err = Search(SearchQuery{}, 10)
+	assert.Error(err)
+
+	_, err = Search(SearchQuery{AuthorName: "unresolved"}, 10)
+	assert.Error(err)
+}
+
+// feedStore is a Store that reports the changes sent on its channel, as though made by another
+// process.
+type feedStore struct {
+	Store
+	changes chan Change
+}
+
+func (s *feedStore) Changes() (<-chan Change, error) {
+	return s.changes, nil
+}
+
+func TestSearch_changeFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	prev := store
+	s := &feedStore{Store: NewMemoryStore(), changes: make(chan Change)}
+	SetStore(s)
+	defer SetStore(prev)
+
+	search := func(term string) []string {
+		results, err := Search(SearchQuery{Terms: []string{term}}, 10)
+		if !assert.NoError(err) {
+			return nil
+		}
+
+		ids := make([]string, len(results.Posts))
+		for i := range results.Posts {
+			ids[i] = results.Posts[i].ID
+		}
+
+		return ids
+	}
+
+	// eventually reports whether `term` finds `want` within a second.
+	eventually := func(term string, want []string) bool {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if strings.Join(search(term), ",") == strings.Join(want, ",") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	assert.Empty(search("elsewhere"))
+
+	// Posts written by another process reach the index only through the feed.
+	p := Post{Active: true, Author: "remote", Content: "Written elsewhere.", Time: time.Now().UTC()}
+
+	id, err := s.Store.Insert(&p)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	p.ID = id
+	s.changes <- Change{Type: Created, Post: p}
+
+	assert.True(eventually("elsewhere", []string{id}))
+
+	p.Content = "Rewritten far away."
+	s.changes <- Change{Type: Edited, Post: p}
+
+	assert.True(eventually("far", []string{id}))
+	assert.True(eventually("elsewhere", []string{}))
+
+	p.Active = false
+	s.changes <- Change{Type: Deactivated, Post: p}
+
+	assert.True(eventually("far", []string{}))
+}
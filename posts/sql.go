@@ -0,0 +1,720 @@
+package posts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by
+// GetTable.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+const postColumns = "p.id, p.active, p.number, p.user_id, p.content, p.time, p.edited_at"
+
+// zipQuery selects posts joined to their authors, ordered by number.
+func zipQuery(where string) string {
+	return fmt.Sprintf(`SELECT %s, u.avatar, u.name, u.title FROM %s p JOIN %s u ON u.id = p.user_id
+		WHERE %s ORDER BY p.number`, postColumns, GetTable(), users.GetTable(), where)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPost(row scanner) (*Post, error) {
+	var p Post
+	if err := row.Scan(&p.ID, &p.Active, &p.Number, &p.Author, &p.Content, &p.Time, &p.EditedAt); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func scanZip(row scanner) (*Zip, error) {
+	var z Zip
+	if err := row.Scan(&z.ID, &z.Active, &z.Count, &z.AuthorID, &z.Content, &z.Time, &z.EditedAt, &z.Avatar, &z.AuthorName, &z.Title); err != nil {
+		return nil, err
+	}
+
+	return &z, nil
+}
+
+func (s *sqlStore) count(where string, args ...interface{}) (db.CountType, error) {
+	var n db.CountType
+	if err := s.conn.QueryRow("SELECT COUNT(*) FROM "+GetTable()+" p"+where, args...).Scan(&n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (s *sqlStore) Count() (db.CountType, error) {
+	return s.count(" WHERE p.active = ?", true)
+}
+
+func (s *sqlStore) CountAll() (db.CountType, error) {
+	return s.count("")
+}
+
+func (s *sqlStore) CountByUser(userID string) (db.CountType, error) {
+	return s.count(" WHERE p.user_id = ? AND p.active = ?", userID, true)
+}
+
+func (s *sqlStore) GetByUser(userID string, offset db.CountType, limit db.CountType) ([]Post, error) {
+	q := fmt.Sprintf("SELECT %s FROM %s p WHERE p.user_id = ? AND p.active = ? ORDER BY p.number DESC LIMIT ? OFFSET ?", postColumns, GetTable())
+
+	return s.query(q, userID, true, limit, offset)
+}
+
+func (s *sqlStore) All() ([]Post, error) {
+	// Ordering by ID after time gives posts made at the same instant a stable order.
+	return s.query(fmt.Sprintf("SELECT %s FROM %s p ORDER BY p.time, p.id", postColumns, GetTable()))
+}
+
+// inRange is the condition selecting the active posts in a range of numbers. Its arguments are
+// given by rangeArgs.
+const inRange = "p.active = ? AND p.number >= ? AND p.number < ?"
+
+func rangeArgs(first db.CountType, limit db.CountType) []interface{} {
+	return []interface{}{true, first, first + limit}
+}
+
+func (s *sqlStore) GetRange(first db.CountType, limit db.CountType) ([]Post, error) {
+	q := fmt.Sprintf("SELECT %s FROM %s p WHERE %s ORDER BY p.number", postColumns, GetTable(), inRange)
+
+	return s.query(q, rangeArgs(first, limit)...)
+}
+
+// query returns the posts selected by `q`, which must select postColumns.
+func (s *sqlStore) query(q string, args ...interface{}) ([]Post, error) {
+	rows, err := s.conn.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ps []Post
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ps = append(ps, *p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(ps))
+	for i := range ps {
+		ids[i] = ps[i].ID
+	}
+
+	refs, atts, err := s.related(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ps {
+		ps[i].References = refs[ps[i].ID]
+		ps[i].Attachments = atts[ps[i].ID]
+	}
+
+	return ps, nil
+}
+
+func (s *sqlStore) GetRangeJoined(first db.CountType, limit db.CountType) ([]Zip, error) {
+	rows, err := s.conn.Query(zipQuery(inRange), rangeArgs(first, limit)...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var zs []Zip
+	for rows.Next() {
+		z, err := scanZip(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		zs = append(zs, *z)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(zs))
+	for i := range zs {
+		ids[i] = zs[i].ID
+	}
+
+	refs, atts, err := s.related(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range zs {
+		zs[i].References = refs[zs[i].ID]
+		zs[i].AttachmentIDs = atts[zs[i].ID]
+	}
+
+	return zs, nil
+}
+
+func (s *sqlStore) GetPage(q Query) ([]Post, error) {
+	var conds []string
+	var args []interface{}
+
+	if !q.Inactive {
+		conds = append(conds, "p.active = ?")
+		args = append(args, true)
+	}
+
+	if q.After != nil {
+		conds = append(conds, "(p.time > ? OR (p.time = ? AND p.id > ?))")
+		args = append(args, q.After.Time.UTC(), q.After.Time.UTC(), q.After.ID)
+	}
+
+	if q.Before != nil {
+		conds = append(conds, "(p.time < ? OR (p.time = ? AND p.id < ?))")
+		args = append(args, q.Before.Time.UTC(), q.Before.Time.UTC(), q.Before.ID)
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	order := "p.time, p.id"
+	if q.Last {
+		order = "p.time DESC, p.id DESC"
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s p%s ORDER BY %s LIMIT ?", postColumns, GetTable(), where, order)
+
+	ps, err := s.query(query, append(args, q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Last {
+		reverse(ps)
+	}
+
+	return ps, nil
+}
+
+func (s *sqlStore) GetByID(id string) (*Post, error) {
+	q := fmt.Sprintf("SELECT %s FROM %s p WHERE p.id = ?", postColumns, GetTable())
+
+	p, err := scanPost(s.conn.QueryRow(q, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	refs, atts, err := s.related([]string{p.ID})
+	p.References = refs[p.ID]
+	p.Attachments = atts[p.ID]
+
+	return p, err
+}
+
+func (s *sqlStore) GetByIDJoined(id string) (*Zip, error) {
+	z, err := scanZip(s.conn.QueryRow(zipQuery("p.id = ?"), id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	refs, atts, err := s.related([]string{z.ID})
+	z.References = refs[z.ID]
+	z.AttachmentIDs = atts[z.ID]
+
+	return z, err
+}
+
+func (s *sqlStore) GetByNumber(n db.CountType) (*Post, error) {
+	q := fmt.Sprintf("SELECT %s FROM %s p WHERE p.number = ?", postColumns, GetTable())
+
+	p, err := scanPost(s.conn.QueryRow(q, n))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	refs, atts, err := s.related([]string{p.ID})
+	p.References = refs[p.ID]
+	p.Attachments = atts[p.ID]
+
+	return p, err
+}
+
+func (s *sqlStore) NearestByNumber(n db.CountType, up bool) (*Post, error) {
+	clause := "p.number >= ? ORDER BY p.number"
+	if !up {
+		clause = "p.number <= ? ORDER BY p.number DESC"
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s p WHERE %s LIMIT 1", postColumns, GetTable(), clause)
+
+	p, err := scanPost(s.conn.QueryRow(q, n))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	refs, atts, err := s.related([]string{p.ID})
+	p.References = refs[p.ID]
+	p.Attachments = atts[p.ID]
+
+	return p, err
+}
+
+func (s *sqlStore) Last() (db.CountType, error) {
+	var n db.CountType
+
+	err := s.conn.QueryRow("SELECT value FROM "+getCountersTable()+" WHERE name = ?", GetTable()).Scan(&n)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return n, err
+}
+
+func (s *sqlStore) Insert(p *Post) (string, error) {
+	if p == nil {
+		return "", errors.New("Cannot insert nil post")
+	}
+
+	id := p.ID
+	if id == "" {
+		id = utility.GenerateUUID()
+	}
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	n, err := number(tx, p.Number)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	// Times are always stored in UTC so that they compare correctly as text in SQLite.
+	q := "INSERT INTO " + GetTable() + " (id, active, number, user_id, content, time, edited_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+
+	if _, err := tx.Exec(q, id, p.Active, n, p.Author, p.Content, p.Time.UTC(), utc(p.EditedAt)); err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("Failure in inserting post by user %q: %s", p.Author, err)
+	}
+
+	refs := references(p.Content, n)
+
+	if err := insertReferences(tx, id, refs); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := insertAttachments(tx, id, p.Attachments); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	p.Number = n
+	p.References = refs
+
+	return id, nil
+}
+
+// number returns the number for a post being inserted in `tx`: `n` if the post already has one, and
+// otherwise the next from the counter. Updating the counter locks its row until `tx` ends, so
+// concurrent inserts are never allocated the same number.
+func number(tx *db.Tx, n db.CountType) (db.CountType, error) {
+	counters := getCountersTable()
+
+	if n != 0 {
+		_, err := tx.Exec("UPDATE "+counters+" SET value = ? WHERE name = ? AND value < ?", n, GetTable(), n)
+
+		return n, err
+	}
+
+	res, err := tx.Exec("UPDATE "+counters+" SET value = value + 1 WHERE name = ?", GetTable())
+	if err != nil {
+		return 0, err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected != 1 {
+		return 0, fmt.Errorf("No counter found for table %q", GetTable())
+	}
+
+	err = tx.QueryRow("SELECT value FROM "+counters+" WHERE name = ?", GetTable()).Scan(&n)
+
+	return n, err
+}
+
+// utc returns `t` in UTC, or nil if `t` is nil.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	u := t.UTC()
+
+	return &u
+}
+
+func (s *sqlStore) Edit(id string, content string, references []db.CountType, editorID string, at time.Time) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	var previous string
+
+	// As with RethinkDB, leaving the content unchanged counts as a failure to edit.
+	err = tx.QueryRow("SELECT content FROM "+GetTable()+" WHERE id = ?", id).Scan(&previous)
+	if err != nil || previous == content {
+		tx.Rollback()
+		return errors.New("Unable to insert changes to document")
+	}
+
+	// Checking the content is still as we read it keeps a concurrent edit from going unrecorded.
+	res, err := tx.Exec("UPDATE "+GetTable()+" SET content = ?, edited_at = ? WHERE id = ? AND content = ?", content, at.UTC(), id, previous)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		tx.Rollback()
+		return errors.New("Unable to insert changes to document")
+	}
+
+	if _, err := tx.Exec("DELETE FROM "+getReferencesTable()+" WHERE post_id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := insertReferences(tx, id, references); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	r := Revision{PostID: id, Content: previous, EditorID: editorID, Time: at}
+
+	if err := insertRevision(tx, &r); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) SetActive(id string, active bool) error {
+	res, err := s.conn.Exec("UPDATE "+GetTable()+" SET active = ? WHERE id = ?", active, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return fmt.Errorf("No post found with ID %q", id)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) Delete(id string) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM "+GetTable()+" WHERE id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		tx.Rollback()
+		return fmt.Errorf("No post found with ID %q", id)
+	}
+
+	for _, table := range []string{getRevisionsTable(), getReferencesTable(), getPostAttachmentsTable()} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE post_id = ?", id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+const revisionColumns = "id, post_id, content, editor_id, time"
+
+func (s *sqlStore) Revisions(id string) ([]Revision, error) {
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE post_id = ? ORDER BY time, id", revisionColumns, getRevisionsTable())
+
+	return s.queryRevisions(q, id)
+}
+
+func (s *sqlStore) AllRevisions() ([]Revision, error) {
+	q := fmt.Sprintf("SELECT %s FROM %s ORDER BY time, id", revisionColumns, getRevisionsTable())
+
+	return s.queryRevisions(q)
+}
+
+// queryRevisions returns the revisions selected by `q`, which must select revisionColumns.
+func (s *sqlStore) queryRevisions(q string, args ...interface{}) ([]Revision, error) {
+	rows, err := s.conn.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var rs []Revision
+	for rows.Next() {
+		var r Revision
+		if err := rows.Scan(&r.ID, &r.PostID, &r.Content, &r.EditorID, &r.Time); err != nil {
+			return nil, err
+		}
+
+		rs = append(rs, r)
+	}
+
+	return rs, rows.Err()
+}
+
+func (s *sqlStore) InsertRevision(r *Revision) error {
+	if r == nil {
+		return errors.New("Cannot insert nil revision")
+	}
+
+	return insertRevision(s.conn, r)
+}
+
+// execer is satisfied by both db.SQL and db.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertRevision(tx execer, r *Revision) error {
+	id := r.ID
+	if id == "" {
+		id = utility.GenerateUUID()
+	}
+
+	q := "INSERT INTO " + getRevisionsTable() + " (" + revisionColumns + ") VALUES (?, ?, ?, ?, ?)"
+
+	if _, err := tx.Exec(q, id, r.PostID, r.Content, r.EditorID, r.Time.UTC()); err != nil {
+		return fmt.Errorf("Failure in inserting revision of post %q: %s", r.PostID, err)
+	}
+
+	return nil
+}
+
+// relatedBatch is the most posts whose references or attachments are read by a single query,
+// keeping well within the number of parameters SQLite allows in a statement.
+const relatedBatch = 500
+
+// queryRelated runs query `q` for the posts, or attachments, with `ids`, a batch at a time,
+// calling `fn` for each row. `q` is a format string taking the placeholders for a batch of IDs.
+func (s *sqlStore) queryRelated(ids []string, q string, fn func(rows *sql.Rows) error) error {
+	for len(ids) > 0 {
+		batch := ids[:min(relatedBatch, len(ids))]
+		ids = ids[len(batch):]
+
+		args := make([]interface{}, len(batch))
+		for i := range batch {
+			args[i] = batch[i]
+		}
+
+		rows, err := s.conn.Query(fmt.Sprintf(q, params(len(batch))), args...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			if err := fn(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// related returns the numbers each of the posts with `ids` refers to, in ascending order, and the
+// IDs of the attachments of each, in order, both keyed by post ID. Posts referring to none or with
+// no attachments are left out of each.
+func (s *sqlStore) related(ids []string) (map[string][]db.CountType, map[string][]string, error) {
+	refs := make(map[string][]db.CountType)
+	atts := make(map[string][]string)
+
+	q := "SELECT post_id, number FROM " + getReferencesTable() + " WHERE post_id IN (%s) ORDER BY post_id, number"
+
+	err := s.queryRelated(ids, q, func(rows *sql.Rows) error {
+		var id string
+		var n db.CountType
+
+		if err := rows.Scan(&id, &n); err != nil {
+			return err
+		}
+
+		refs[id] = append(refs[id], n)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q = "SELECT post_id, attachment_id FROM " + getPostAttachmentsTable() + " WHERE post_id IN (%s) ORDER BY post_id, position"
+
+	err = s.queryRelated(ids, q, func(rows *sql.Rows) error {
+		var id, attachmentID string
+
+		if err := rows.Scan(&id, &attachmentID); err != nil {
+			return err
+		}
+
+		atts[id] = append(atts[id], attachmentID)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return refs, atts, nil
+}
+
+// insertReferences records that the post with `id` refers to each of `numbers`.
+func insertReferences(tx execer, id string, numbers []db.CountType) error {
+	q := "INSERT INTO " + getReferencesTable() + " (post_id, number) VALUES (?, ?)"
+
+	for _, n := range numbers {
+		if _, err := tx.Exec(q, id, n); err != nil {
+			return fmt.Errorf("Failure in inserting references of post %q: %s", id, err)
+		}
+	}
+
+	return nil
+}
+
+// insertAttachments records that the post with `id` has each of `attachmentIDs`, in order.
+func insertAttachments(tx execer, id string, attachmentIDs []string) error {
+	q := "INSERT INTO " + getPostAttachmentsTable() + " (post_id, position, attachment_id) VALUES (?, ?, ?)"
+
+	for i, attachmentID := range attachmentIDs {
+		if _, err := tx.Exec(q, id, i, attachmentID); err != nil {
+			return fmt.Errorf("Failure in inserting attachments of post %q: %s", id, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) Backlinks(numbers []db.CountType) (map[db.CountType][]db.CountType, error) {
+	args := []interface{}{true}
+	for _, n := range numbers {
+		args = append(args, n)
+	}
+
+	q := fmt.Sprintf(`SELECT r.number, p.number FROM %s r JOIN %s p ON p.id = r.post_id
+		WHERE p.active = ? AND r.number IN (%s) ORDER BY r.number, p.number`, getReferencesTable(), GetTable(), params(len(numbers)))
+
+	rows, err := s.conn.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	links := make(map[db.CountType][]db.CountType)
+
+	for rows.Next() {
+		var n, from db.CountType
+		if err := rows.Scan(&n, &from); err != nil {
+			return nil, err
+		}
+
+		links[n] = append(links[n], from)
+	}
+
+	return links, rows.Err()
+}
+
+func (s *sqlStore) AttachedTo(attachmentIDs []string) (map[string][]string, error) {
+	attached := make(map[string][]string)
+
+	q := "SELECT attachment_id, post_id FROM " + getPostAttachmentsTable() + " WHERE attachment_id IN (%s)"
+
+	err := s.queryRelated(attachmentIDs, q, func(rows *sql.Rows) error {
+		var attachmentID, id string
+
+		if err := rows.Scan(&attachmentID, &id); err != nil {
+			return err
+		}
+
+		attached[attachmentID] = append(attached[attachmentID], id)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return attached, nil
+}
+
+// params returns a list of `n` placeholders, for use in an IN clause.
+func params(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,82 @@
+package posts
+
+import (
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+)
+
+// Store is the interface through which all post data is read and written. The package-level
+// functions validate their arguments and delegate to the current Store, so callers need never know
+// which backend is in use.
+//
+// Single-document lookups return a nil value and a nil error if no document matches, leaving it to
+// the caller to decide whether that's an error.
+type Store interface {
+	// Count returns the number of active posts.
+	Count() (db.CountType, error)
+	// CountAll returns the total number of posts, including inactive posts.
+	CountAll() (db.CountType, error)
+	// CountByUser returns the number of active posts by the user with `userID`.
+	CountByUser(userID string) (db.CountType, error)
+	// GetByUser returns up to `limit` of the active posts by the user with `userID`, newest first,
+	// skipping the first `offset`.
+	GetByUser(userID string, offset db.CountType, limit db.CountType) ([]Post, error)
+	// All returns every post, including inactive posts, ordered by time (ascending).
+	All() ([]Post, error)
+	// GetRange returns the active posts numbered from `first` up to, but not including,
+	// `first+limit`, ordered by number.
+	GetRange(first db.CountType, limit db.CountType) ([]Post, error)
+	// GetRangeJoined is as GetRange, but merges the author's user data into each post.
+	GetRangeJoined(first db.CountType, limit db.CountType) ([]Zip, error)
+	// GetPage returns up to `q.Limit` active posts after `q.After` and before `q.Before`, or all
+	// posts if `q.Inactive` is set, ordered by time, then by ID. It uses no offsets, so any page is
+	// as cheap to fetch as the first.
+	GetPage(q Query) ([]Post, error)
+	GetByID(id string) (*Post, error)
+	GetByIDJoined(id string) (*Zip, error)
+	// GetByNumber returns the post numbered `n`, whether or not it's active.
+	GetByNumber(n db.CountType) (*Post, error)
+	// NearestByNumber returns the post numbered `n` or, failing that, the post with the nearest
+	// number above `n` if `up` is true, or below it otherwise, whether or not it's active. It returns
+	// nil if there's no such post.
+	NearestByNumber(n db.CountType, up bool) (*Post, error)
+	// Last returns the last number allocated to a post, or 0 if there are no posts.
+	Last() (db.CountType, error)
+	// Insert adds a post, returning its ID and setting its Number. An ID is generated unless the
+	// post already has one. Likewise, the next number is allocated atomically unless the post
+	// already has one, in which case no later post is allocated a lower number. Once the post is
+	// numbered, its References are set from its content, leaving out any not before its number.
+	Insert(p *Post) (string, error)
+	// Edit replaces the content and references of the post with `id`, recording its previous content
+	// as a revision made by `editorID` at `at`, which also becomes the post's EditedAt.
+	Edit(id string, content string, references []db.CountType, editorID string, at time.Time) error
+	// SetActive sets the `active` field of the post with `id`.
+	SetActive(id string, active bool) error
+	// Delete deletes the post with `id`, along with its revisions and its records of the posts it
+	// refers to and the attachments it has. Its number isn't reused.
+	Delete(id string) error
+	// Revisions returns the revisions of the post with `id`, oldest first.
+	Revisions(id string) ([]Revision, error)
+	// AllRevisions returns every revision, ordered by time (ascending).
+	AllRevisions() ([]Revision, error)
+	// InsertRevision adds a revision. An ID is generated unless it already has one.
+	InsertRevision(r *Revision) error
+	// Backlinks returns, for each of `numbers` referred to by any active post, the numbers of the
+	// active posts referring to it, in ascending order.
+	Backlinks(numbers []db.CountType) (map[db.CountType][]db.CountType, error)
+	// AttachedTo returns, for each of `attachmentIDs` attached to any post, active or not, the IDs of
+	// the posts it's attached to.
+	AttachedTo(attachmentIDs []string) (map[string][]string, error)
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions, and discards the search index
+// built from the previous Store. It should be called before the server starts handling requests.
+func SetStore(s Store) {
+	store = s
+	index.stop()
+	index = &searchIndex{}
+}
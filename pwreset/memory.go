@@ -0,0 +1,79 @@
+package pwreset
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// memoryStore is a Store that keeps all password resets in process memory. Nothing is persisted,
+// so it's useful only for development and tests.
+type memoryStore struct {
+	mu     sync.RWMutex
+	resets map[string]PasswordReset
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{resets: make(map[string]PasswordReset)}
+}
+
+func (s *memoryStore) GetByUser(userID string) (*PasswordReset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, pwr := range s.resets {
+		if pwr.UserID == userID {
+			return &pwr, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *memoryStore) Get(id string) (*PasswordReset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pwr, ok := s.resets[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &pwr, nil
+}
+
+func (s *memoryStore) Insert(pwr *PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.resets[pwr.ID]; ok {
+		return fmt.Errorf("pwreset: a password reset already exists with ID %q", pwr.ID)
+	}
+
+	s.resets[pwr.ID] = *pwr
+
+	return nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.resets[id]; !ok {
+		return errors.New("pwreset: in Destroy(), res.Deleted is not 1")
+	}
+
+	delete(s.resets, id)
+
+	return nil
+}
+
+func (s *memoryStore) DeleteAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resets = make(map[string]PasswordReset)
+
+	return nil
+}
@@ -7,10 +7,6 @@ import (
 	"hash"
 	"hash/fnv"
 	"time"
-
-	"github.com/boatilus/peppercorn/db"
-	"github.com/spf13/viper"
-	gorethink "gopkg.in/dancannon/gorethink.v2"
 )
 
 // PasswordReset is a struct with all the fields required to store a password reset instance.
@@ -34,11 +30,6 @@ func init() {
 	hasher = fnv.New64a()
 }
 
-// getTable returns the table term for the password reset table.
-func getTable() gorethink.Term {
-	return db.Get().Table(viper.GetString("db.password_resets_table"))
-}
-
 // New constructs a `PasswordReset` from a user's ID. Returns a nil value and an error on any
 // failure.
 func New(userID, browser, os string) (*PasswordReset, error) {
@@ -87,47 +78,25 @@ func Create(pwr *PasswordReset) error {
 		return CreateError{Code: CreateErrorNilData, Msg: "pwr cannot be nil"}
 	}
 
-	if !db.Session.IsConnected() {
-		return CreateError{Code: CreateErrorDBUnconnected, Msg: "RethinkDB session not connected"}
-	}
-
-	cursor, err := getTable().GetAllByIndex("user_id", pwr.UserID).Run(db.Session)
+	found, err := store.GetByUser(pwr.UserID)
 	if err != nil {
-		return CreateError{Code: CreateErrorDBError, Msg: err.Error()}
-	}
-
-	defer cursor.Close()
-
-	// We want to err if we find any existing instances for `user_id` that have not expired.
-	if !cursor.IsNil() {
-		var found PasswordReset
-
-		// For now, we'll just get one, since we can rely on not more than reset request for this user
-		// to be in the database at any given time. However, more robust handling may be desired.
-		if err := cursor.One(&found); err != nil {
-			return CreateError{Code: CreateErrorDBError, Msg: err.Error()}
+		if _, ok := err.(CreateError); ok {
+			return err
 		}
 
-		// We should err if the old request hasn't yet expired. Otherwise, we can re-issue.
-		if !isExpired(&found) {
-			// The old request has not yet expired, so we can't issue a new request.
-			return CreateError{
-				Code: CreateErrorExists,
-				Msg:  fmt.Sprintf("a password reset request already exists for user %q", pwr.UserID),
-			}
-		}
-	}
-
-	res, err := getTable().Insert(pwr).RunWrite(db.Session)
-	if err != nil {
-		return err
+		return CreateError{Code: CreateErrorDBError, Msg: err.Error()}
 	}
 
-	if res.Inserted != 1 {
-		return CreateError{Code: CreateErrorDBError, Msg: "RethinkDB did not respond with Inserted"}
+	// We should err if the old request hasn't yet expired. Otherwise, we can re-issue.
+	if found != nil && !isExpired(found) {
+		// The old request has not yet expired, so we can't issue a new request.
+		return CreateError{
+			Code: CreateErrorExists,
+			Msg:  fmt.Sprintf("a password reset request already exists for user %q", pwr.UserID),
+		}
 	}
 
-	return nil
+	return store.Insert(pwr)
 }
 
 func Get(id string) (*PasswordReset, error) {
@@ -135,28 +104,16 @@ func Get(id string) (*PasswordReset, error) {
 		return nil, errors.New("pwreset: in Get(), id is empty")
 	}
 
-	if !db.Session.IsConnected() {
-		return nil, errors.New("pwreset: in Get(), RethinkDB session unconnected")
-	}
-
-	cursor, err := getTable().Get(id).Run(db.Session)
+	pwr, err := store.Get(id)
 	if err != nil {
 		return nil, err
 	}
 
-	defer cursor.Close()
-
-	if cursor.IsNil() {
-		return nil, errors.New("pwreset: in Get(), cursor is nil")
-	}
-
-	var pwr PasswordReset
-
-	if err := cursor.One(&pwr); err != nil {
-		return nil, err
+	if pwr == nil {
+		return nil, fmt.Errorf("pwreset: in Get(), no password reset exists with ID %q", id)
 	}
 
-	return &pwr, nil
+	return pwr, nil
 }
 
 // Destroy removes a password reset from the table by its ID.
@@ -165,38 +122,31 @@ func Destroy(id string) error {
 		return errors.New("pwreset: in Destroy(), id is empty")
 	}
 
-	if !db.Session.IsConnected() {
-		return errors.New("pwreset: in Destroy(), RethinkDB session unconnected")
+	return store.Delete(id)
+}
+
+// DestroyByUser removes the password reset of the user with `userID`, expired or not, so that
+// another can be created for them straight away. It does nothing if they have none.
+func DestroyByUser(userID string) error {
+	if len(userID) == 0 {
+		return errors.New("pwreset: in DestroyByUser(), userID is empty")
 	}
 
-	res, err := getTable().Get(id).Delete().RunWrite(db.Session)
+	pwr, err := store.GetByUser(userID)
 	if err != nil {
 		return err
 	}
 
-	if res.Deleted != 1 {
-		return errors.New("pwreset: in Destroy(), res.Deleted is not 1")
+	if pwr == nil {
+		return nil
 	}
 
-	return nil
+	return store.Delete(pwr.ID)
 }
 
 // DestroyAll deletes all password resets.
 func DestroyAll() error {
-	if !db.Session.IsConnected() {
-		return errors.New("pwreset: in Destroy(), RethinkDB session unconnected")
-	}
-
-	res, err := getTable().Delete().RunWrite(db.Session)
-	if err != nil {
-		return err
-	}
-
-	if res.Deleted != 1 {
-		return errors.New("pwreset: in Destroy(), res.Deleted is not 1")
-	}
-
-	return nil
+	return store.DeleteAll()
 }
 
 const (
@@ -3,13 +3,11 @@ package pwreset
 import (
 	"testing"
 
-	"log"
 	"time"
 
-	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/db/dbtest"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
-	rethink "gopkg.in/dancannon/gorethink.v2"
 )
 
 const tableName = "password_resets_test"
@@ -19,52 +17,13 @@ var validKeys []string
 func init() {
 	viper.Set("db.password_resets_table", tableName)
 
-	var err error
-
-	if db.Session, err = rethink.Connect(rethink.ConnectOpts{Address: "localhost:28015"}); err != nil {
-		panic(err)
-	}
-
-	setupDB()
-}
-
-func setupDB() {
-	if !db.Session.IsConnected() {
-		panic("No DB connected")
-	}
-
-	rethink.DBCreate(db.Name).RunWrite(db.Session)
-
-	peppercorn := rethink.DB(db.Name)
-
-	c, err := peppercorn.TableList().Contains(tableName).Run(db.Session)
-	if err != nil {
-		panic(err)
-	}
-
-	var hasTable bool
-
-	err = c.One(&hasTable)
-	if err != nil {
-		panic(err)
-	}
-
-	log.Print("hasTable: ", hasTable)
-
-	table := peppercorn.Table(tableName)
-
-	if !hasTable {
-		_, err := peppercorn.TableCreate(tableName).RunWrite(db.Session)
-		if err != nil {
-			panic(err)
-		}
-
-		table.IndexCreate("user_id").RunWrite(db.Session)
-		table.IndexWait().Run(db.Session)
-	} else {
-		// Due to a lack of mocking in gorethink, we'll tear down the test data and repopulate on each
-		// run of the tests.
-		table.Delete().RunWrite(db.Session)
+	switch backend, conn := dbtest.Setup("pwreset", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
 	}
 }
 
@@ -112,3 +71,28 @@ func TestCreate(t *testing.T) {
 	err = Create(pwr)
 	assert.NoError(err)
 }
+
+func TestDestroyByUser(t *testing.T) {
+	assert := assert.New(t)
+
+	userID := "destroy by user"
+
+	pwr, err := New(userID, "Google Chrome", "Windows 10")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.NoError(Create(pwr))
+
+	again, _ := New(userID, "Google Chrome", "Windows 10")
+	assert.Error(Create(again), "an unexpired reset should block another")
+
+	assert.Error(DestroyByUser(""))
+	assert.NoError(DestroyByUser(userID))
+	assert.NoError(DestroyByUser(userID), "destroying no reset shouldn't fail")
+
+	_, err = Get(pwr.ID)
+	assert.Error(err)
+
+	assert.NoError(Create(again))
+}
@@ -0,0 +1,116 @@
+package pwreset
+
+import (
+	"errors"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+	gorethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by the
+// `db.password_resets_table` config value.
+type rethinkStore struct{}
+
+// getTable returns the table term for the password reset table.
+func getTable() gorethink.Term {
+	return db.Get().Table(viper.GetString("db.password_resets_table"))
+}
+
+func (rethinkStore) GetByUser(userID string) (*PasswordReset, error) {
+	if !db.Session.IsConnected() {
+		return nil, CreateError{Code: CreateErrorDBUnconnected, Msg: "RethinkDB session not connected"}
+	}
+
+	cursor, err := getTable().GetAllByIndex("user_id", userID).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	// For now, we'll just get one, since we can rely on not more than reset request for this user
+	// to be in the database at any given time. However, more robust handling may be desired.
+	var found PasswordReset
+	if err := cursor.One(&found); err != nil {
+		return nil, err
+	}
+
+	return &found, nil
+}
+
+func (rethinkStore) Get(id string) (*PasswordReset, error) {
+	if !db.Session.IsConnected() {
+		return nil, errors.New("pwreset: in Get(), RethinkDB session unconnected")
+	}
+
+	cursor, err := getTable().Get(id).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var pwr PasswordReset
+
+	if err := cursor.One(&pwr); err != nil {
+		return nil, err
+	}
+
+	return &pwr, nil
+}
+
+func (rethinkStore) Insert(pwr *PasswordReset) error {
+	res, err := getTable().Insert(pwr).RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Inserted != 1 {
+		return CreateError{Code: CreateErrorDBError, Msg: "RethinkDB did not respond with Inserted"}
+	}
+
+	return nil
+}
+
+func (rethinkStore) Delete(id string) error {
+	if !db.Session.IsConnected() {
+		return errors.New("pwreset: in Destroy(), RethinkDB session unconnected")
+	}
+
+	res, err := getTable().Get(id).Delete().RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted != 1 {
+		return errors.New("pwreset: in Destroy(), res.Deleted is not 1")
+	}
+
+	return nil
+}
+
+func (rethinkStore) DeleteAll() error {
+	if !db.Session.IsConnected() {
+		return errors.New("pwreset: in Destroy(), RethinkDB session unconnected")
+	}
+
+	res, err := getTable().Delete().RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted != 1 {
+		return errors.New("pwreset: in Destroy(), res.Deleted is not 1")
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package pwreset
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by the
+// `db.password_resets_table` config value.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+func getTableName() string {
+	return viper.GetString("db.password_resets_table")
+}
+
+func (s *sqlStore) getBy(column string, value string) (*PasswordReset, error) {
+	var pwr PasswordReset
+
+	q := "SELECT id, user_id, browser, os, expires FROM " + getTableName() + " WHERE " + column + " = ?"
+
+	err := s.conn.QueryRow(q, value).Scan(&pwr.ID, &pwr.UserID, &pwr.Browser, &pwr.OS, &pwr.Expires)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pwr, nil
+}
+
+func (s *sqlStore) GetByUser(userID string) (*PasswordReset, error) {
+	return s.getBy("user_id", userID)
+}
+
+func (s *sqlStore) Get(id string) (*PasswordReset, error) {
+	return s.getBy("id", id)
+}
+
+func (s *sqlStore) Insert(pwr *PasswordReset) error {
+	q := "INSERT INTO " + getTableName() + " (id, user_id, browser, os, expires) VALUES (?, ?, ?, ?, ?)"
+
+	if _, err := s.conn.Exec(q, pwr.ID, pwr.UserID, pwr.Browser, pwr.OS, pwr.Expires.UTC()); err != nil {
+		return CreateError{Code: CreateErrorDBError, Msg: err.Error()}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) Delete(id string) error {
+	res, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return errors.New("pwreset: in Destroy(), no password reset was deleted")
+	}
+
+	return nil
+}
+
+func (s *sqlStore) DeleteAll() error {
+	_, err := s.conn.Exec("DELETE FROM " + getTableName())
+
+	return err
+}
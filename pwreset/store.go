@@ -0,0 +1,27 @@
+package pwreset
+
+// Store is the interface through which all password reset data is read and written. The
+// package-level functions validate their arguments and delegate to the current Store, so callers
+// need never know which backend is in use.
+//
+// Single-document lookups return a nil value and a nil error if no document matches, leaving it to
+// the caller to decide whether that's an error.
+type Store interface {
+	// GetByUser returns a password reset for the user with `userID`. We rely on there being no more
+	// than one per user at any given time.
+	GetByUser(userID string) (*PasswordReset, error)
+	Get(id string) (*PasswordReset, error)
+	Insert(pwr *PasswordReset) error
+	// Delete removes the password reset with `id`, returning an error if there was none to remove.
+	Delete(id string) error
+	DeleteAll() error
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
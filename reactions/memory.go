@@ -0,0 +1,104 @@
+package reactions
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// memoryStore is a Store that keeps all reactions in process memory. Nothing is persisted, so it's
+// useful only for development and tests.
+type memoryStore struct {
+	mu        sync.RWMutex
+	reactions map[string]Reaction
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{reactions: make(map[string]Reaction)}
+}
+
+// byTime sorts reactions oldest first, breaking ties by ID.
+type byTime []Reaction
+
+func (rs byTime) Len() int      { return len(rs) }
+func (rs byTime) Swap(i, j int) { rs[i], rs[j] = rs[j], rs[i] }
+func (rs byTime) Less(i, j int) bool {
+	if rs[i].Time.Equal(rs[j].Time) {
+		return rs[i].ID < rs[j].ID
+	}
+
+	return rs[i].Time.Before(rs[j].Time)
+}
+
+func (s *memoryStore) ForPosts(postIDs []string) ([]Reaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(postIDs))
+	for _, id := range postIDs {
+		wanted[id] = true
+	}
+
+	var rs []Reaction
+	for _, r := range s.reactions {
+		if wanted[r.PostID] {
+			rs = append(rs, r)
+		}
+	}
+
+	sort.Sort(byTime(rs))
+
+	return rs, nil
+}
+
+func (s *memoryStore) All() ([]Reaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rs := make([]Reaction, 0, len(s.reactions))
+	for _, r := range s.reactions {
+		rs = append(rs, r)
+	}
+
+	sort.Sort(byTime(rs))
+
+	return rs, nil
+}
+
+func (s *memoryStore) Insert(r *Reaction) error {
+	if r == nil {
+		return errors.New("reactions: cannot insert nil reaction")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reactions[r.ID]; !ok {
+		s.reactions[r.ID] = *r
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.reactions, id)
+
+	return nil
+}
+
+func (s *memoryStore) DeleteForPost(postID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, r := range s.reactions {
+		if r.PostID == postID {
+			delete(s.reactions, id)
+		}
+	}
+
+	return nil
+}
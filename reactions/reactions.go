@@ -0,0 +1,184 @@
+// Package reactions records users' reactions to posts. Users react with one of a small set of
+// emoji, given by the `reactions` config value, and can react to a post with each at most once.
+package reactions
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boatilus/peppercorn/users"
+	"github.com/spf13/viper"
+)
+
+// Reaction is a single user's reaction to a post.
+type Reaction struct {
+	// ID is derived from the post, the user and the reaction, so that a user's second reaction of a
+	// kind to a post is the same record as the first.
+	ID       string    `gorethink:"id"`
+	PostID   string    `gorethink:"post_id"`
+	UserID   string    `gorethink:"user_id"`
+	Reaction string    `gorethink:"reaction"`
+	Time     time.Time `gorethink:"time"`
+}
+
+// Default is the set of reactions offered unless the `reactions` config value gives another.
+var Default = []string{"👍", "👎", "😂", "😮", "😢", "❤️"}
+
+func init() {
+	viper.SetDefault("reactions", Default)
+}
+
+// Allowed returns the reactions users can make, in the order they're offered.
+func Allowed() []string {
+	return viper.GetStringSlice("reactions")
+}
+
+func isAllowed(reaction string) bool {
+	for _, r := range Allowed() {
+		if r == reaction {
+			return true
+		}
+	}
+
+	return false
+}
+
+// id returns the ID of the reaction `reaction` by the user with `userID` to the post with
+// `postID`.
+func id(postID string, userID string, reaction string) string {
+	sum := sha1.Sum([]byte(postID + "\x00" + userID + "\x00" + reaction))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Add records the user with `userID` reacting with `reaction` to the post with `postID`. The
+// reaction must be one of those allowed. Adding a reaction the user has already made does nothing.
+func Add(postID string, userID string, reaction string) error {
+	if len(postID) == 0 || len(userID) == 0 {
+		return errors.New("reactions: post and user IDs cannot be empty")
+	}
+
+	if !isAllowed(reaction) {
+		return fmt.Errorf("reactions: %q is not an allowed reaction", reaction)
+	}
+
+	r := Reaction{
+		ID:       id(postID, userID, reaction),
+		PostID:   postID,
+		UserID:   userID,
+		Reaction: reaction,
+		Time:     time.Now().UTC(),
+	}
+
+	return store.Insert(&r)
+}
+
+// Remove removes the reaction `reaction` by the user with `userID` to the post with `postID`.
+// Removing a reaction the user hasn't made does nothing.
+func Remove(postID string, userID string, reaction string) error {
+	if len(postID) == 0 || len(userID) == 0 {
+		return errors.New("reactions: post and user IDs cannot be empty")
+	}
+
+	return store.Delete(id(postID, userID, reaction))
+}
+
+// RemoveAll removes every reaction to the post with `postID`, as when it's purged.
+func RemoveAll(postID string) error {
+	if len(postID) == 0 {
+		return errors.New("reactions: post ID cannot be empty")
+	}
+
+	return store.DeleteForPost(postID)
+}
+
+// All returns every reaction to every post, oldest first.
+func All() ([]Reaction, error) {
+	return store.All()
+}
+
+// Restore inserts a reaction exactly as given, keeping its ID and time, whether or not it's still
+// allowed. It's intended for restoring reactions from an archive.
+func Restore(r *Reaction) error {
+	if r == nil || r.ID == "" || r.PostID == "" || r.UserID == "" || r.Reaction == "" {
+		return errors.New("reactions: invalid Reaction supplied")
+	}
+
+	return store.Insert(r)
+}
+
+// Summary describes the reactions of a single kind to a post.
+type Summary struct {
+	Reaction string `json:"reaction"`
+	Count    int    `json:"count"`
+	// Names are the names of the users who reacted, earliest first.
+	Names []string `json:"names"`
+	// Reacted is true if the user for whom the summary was made is among them.
+	Reacted bool `json:"reacted"`
+}
+
+// ForPosts returns summaries of the reactions to each of the posts with `postIDs`, keyed by post
+// ID, as given by Summarize for the user with `userID`. Posts without reactions are summarized too.
+func ForPosts(postIDs []string, userID string) (map[string][]Summary, error) {
+	summaries := make(map[string][]Summary, len(postIDs))
+
+	if len(postIDs) == 0 {
+		return summaries, nil
+	}
+
+	rs, err := store.ForPosts(postIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byPost := make(map[string][]Reaction, len(postIDs))
+	for _, r := range rs {
+		byPost[r.PostID] = append(byPost[r.PostID], r)
+	}
+
+	for _, postID := range postIDs {
+		summaries[postID] = Summarize(byPost[postID], userID)
+	}
+
+	return summaries, nil
+}
+
+// Summarize summarizes reactions `rs` to a single post, oldest first, for the user with `userID`.
+// There's a summary for every allowed reaction, in the order they're offered, including those no
+// one has made, followed by any reactions made that are no longer allowed.
+func Summarize(rs []Reaction, userID string) []Summary {
+	allowed := Allowed()
+
+	summaries := make([]Summary, len(allowed))
+	index := make(map[string]int, len(allowed))
+
+	for i, reaction := range allowed {
+		summaries[i] = Summary{Reaction: reaction, Names: []string{}}
+		index[reaction] = i
+	}
+
+	for _, r := range rs {
+		i, ok := index[r.Reaction]
+		if !ok {
+			i = len(summaries)
+			index[r.Reaction] = i
+			summaries = append(summaries, Summary{Reaction: r.Reaction, Names: []string{}})
+		}
+
+		s := &summaries[i]
+		s.Count++
+
+		if u, ok := users.Users.Get(r.UserID); ok {
+			s.Names = append(s.Names, u.Name)
+		}
+
+		if r.UserID == userID {
+			s.Reacted = true
+		}
+	}
+
+	return summaries
+}
@@ -0,0 +1,172 @@
+package reactions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/db/dbtest"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableName = "reactions_test"
+
+func init() {
+	viper.Set("db.reactions_table", tableName)
+	viper.Set("reactions", []string{"👍", "😂", "❤️"})
+
+	switch backend, conn := dbtest.Setup("reactions", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
+	}
+}
+
+func TestAdd(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(Add("", "user", "👍"))
+	assert.Error(Add("post", "", "👍"))
+	assert.Error(Add("add", "user", "🙃"), "reactions not configured should be refused")
+
+	if !assert.NoError(Add("add", "user", "👍")) {
+		t.FailNow()
+	}
+
+	// Reacting the same way twice keeps the first reaction.
+	first, err := store.ForPosts([]string{"add"})
+	if !assert.NoError(err) || !assert.Len(first, 1) {
+		t.FailNow()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	assert.NoError(Add("add", "user", "👍"))
+	assert.NoError(Add("add", "user", "😂"))
+
+	got, err := store.ForPosts([]string{"add"})
+	if !assert.NoError(err) || !assert.Len(got, 2) {
+		t.FailNow()
+	}
+
+	assert.Equal(first[0].ID, got[0].ID)
+	assert.True(first[0].Time.Equal(got[0].Time))
+	assert.Equal("😂", got[1].Reaction)
+}
+
+func TestRemove(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(Remove("", "user", "👍"))
+
+	assert.NoError(Add("remove", "user", "👍"))
+	assert.NoError(Add("remove", "other", "👍"))
+
+	assert.NoError(Remove("remove", "user", "👍"))
+	assert.NoError(Remove("remove", "user", "👍"), "removing a reaction twice shouldn't fail")
+
+	got, err := store.ForPosts([]string{"remove"})
+	if assert.NoError(err) && assert.Len(got, 1) {
+		assert.Equal("other", got[0].UserID)
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(RemoveAll(""))
+
+	assert.NoError(Add("remove-all", "user", "👍"))
+	assert.NoError(Add("remove-all", "other", "😂"))
+	assert.NoError(Add("remove-all-kept", "user", "👍"))
+
+	assert.NoError(RemoveAll("remove-all"))
+
+	got, err := store.ForPosts([]string{"remove-all", "remove-all-kept"})
+	if assert.NoError(err) && assert.Len(got, 1) {
+		assert.Equal("remove-all-kept", got[0].PostID)
+	}
+}
+
+func TestForPosts(t *testing.T) {
+	assert := assert.New(t)
+
+	users.Users.Set(users.User{ID: "summary-a", Name: "Alice"})
+	users.Users.Set(users.User{ID: "summary-b", Name: "Bob"})
+
+	assert.NoError(Add("summary-1", "summary-a", "❤️"))
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(Add("summary-1", "summary-b", "❤️"))
+	assert.NoError(Add("summary-1", "summary-b", "👍"))
+
+	got, err := ForPosts([]string{"summary-1", "summary-2"}, "summary-b")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	assert.Equal([]Summary{
+		{Reaction: "👍", Count: 1, Names: []string{"Bob"}, Reacted: true},
+		{Reaction: "😂", Count: 0, Names: []string{}},
+		{Reaction: "❤️", Count: 2, Names: []string{"Alice", "Bob"}, Reacted: true},
+	}, got["summary-1"])
+
+	// A post no one has reacted to still has every reaction on offer.
+	if assert.Len(got["summary-2"], 3) {
+		assert.Zero(got["summary-2"][0].Count)
+	}
+
+	empty, err := ForPosts(nil, "summary-b")
+	assert.NoError(err)
+	assert.Empty(empty)
+}
+
+func TestSummarize(t *testing.T) {
+	assert := assert.New(t)
+
+	rs := []Reaction{
+		{PostID: "p", UserID: "nobody", Reaction: "🙃"},
+		{PostID: "p", UserID: "nobody", Reaction: "😂"},
+	}
+
+	got := Summarize(rs, "someone")
+
+	// Reactions no longer allowed follow those that are, and unknown users go unnamed.
+	if assert.Len(got, 4) {
+		assert.Equal(Summary{Reaction: "😂", Count: 1, Names: []string{}}, got[1])
+		assert.Equal(Summary{Reaction: "🙃", Count: 1, Names: []string{}}, got[3])
+	}
+}
+
+func TestRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(Restore(nil))
+	assert.Error(Restore(&Reaction{ID: "restored"}))
+
+	at := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := Reaction{ID: "restored", PostID: "restore", UserID: "user", Reaction: "🙃", Time: at}
+
+	if !assert.NoError(Restore(&r)) {
+		t.FailNow()
+	}
+
+	all, err := All()
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	for _, got := range all {
+		if got.ID == r.ID {
+			assert.Equal(r.Reaction, got.Reaction)
+			assert.True(at.Equal(got.Time))
+
+			return
+		}
+	}
+
+	t.Errorf("restored reaction %q not found", r.ID)
+}
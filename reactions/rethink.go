@@ -0,0 +1,73 @@
+package reactions
+
+import (
+	"sort"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by the
+// `db.reactions_table` config value.
+type rethinkStore struct{}
+
+// getTable returns the table term for the reactions table.
+func getTable() rethink.Term {
+	return db.Get().Table(viper.GetString("db.reactions_table"))
+}
+
+func (rethinkStore) all(t rethink.Term) ([]Reaction, error) {
+	// Ordering a whole table without an index is limited to 100,000 documents, so sort here instead.
+	cursor, err := t.Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var rs []Reaction
+	if err := cursor.All(&rs); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(byTime(rs))
+
+	return rs, nil
+}
+
+func (s rethinkStore) ForPosts(postIDs []string) ([]Reaction, error) {
+	keys := make([]interface{}, len(postIDs))
+	for i := range postIDs {
+		keys[i] = postIDs[i]
+	}
+
+	return s.all(getTable().GetAllByIndex("post_id", keys...))
+}
+
+func (s rethinkStore) All() ([]Reaction, error) {
+	return s.all(getTable())
+}
+
+func (rethinkStore) Insert(r *Reaction) error {
+	// Keeping the existing document on a conflict leaves the time of the first reaction as it was.
+	keep := func(id rethink.Term, existing rethink.Term, inserted rethink.Term) interface{} {
+		return existing
+	}
+
+	_, err := getTable().Insert(r, rethink.InsertOpts{Conflict: keep}).RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) Delete(id string) error {
+	_, err := getTable().Get(id).Delete().RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) DeleteForPost(postID string) error {
+	_, err := getTable().GetAllByIndex("post_id", postID).Delete().RunWrite(db.Session)
+
+	return err
+}
@@ -0,0 +1,82 @@
+package reactions
+
+import (
+	"strings"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by the
+// `db.reactions_table` config value.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+func getTableName() string {
+	return viper.GetString("db.reactions_table")
+}
+
+const columns = "id, post_id, user_id, reaction, time"
+
+func (s *sqlStore) query(where string, args ...interface{}) ([]Reaction, error) {
+	rows, err := s.conn.Query("SELECT "+columns+" FROM "+getTableName()+where+" ORDER BY time, id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var rs []Reaction
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.ID, &r.PostID, &r.UserID, &r.Reaction, &r.Time); err != nil {
+			return nil, err
+		}
+
+		rs = append(rs, r)
+	}
+
+	return rs, rows.Err()
+}
+
+func (s *sqlStore) ForPosts(postIDs []string) ([]Reaction, error) {
+	args := make([]interface{}, len(postIDs))
+	for i := range postIDs {
+		args[i] = postIDs[i]
+	}
+
+	params := strings.TrimSuffix(strings.Repeat("?, ", len(postIDs)), ", ")
+
+	return s.query(" WHERE post_id IN ("+params+")", args...)
+}
+
+func (s *sqlStore) All() ([]Reaction, error) {
+	return s.query("")
+}
+
+func (s *sqlStore) Insert(r *Reaction) error {
+	// Both SQLite and PostgreSQL skip a row that conflicts with an existing one this way.
+	q := "INSERT INTO " + getTableName() + " (" + columns + ") VALUES (?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING"
+
+	_, err := s.conn.Exec(q, r.ID, r.PostID, r.UserID, r.Reaction, r.Time.UTC())
+
+	return err
+}
+
+func (s *sqlStore) Delete(id string) error {
+	_, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE id = ?", id)
+
+	return err
+}
+
+func (s *sqlStore) DeleteForPost(postID string) error {
+	_, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE post_id = ?", postID)
+
+	return err
+}
@@ -0,0 +1,26 @@
+package reactions
+
+// Store is the interface through which all reaction data is read and written. The package-level
+// functions validate their arguments and delegate to the current Store, so callers need never know
+// which backend is in use.
+type Store interface {
+	// ForPosts returns the reactions to any of the posts with `postIDs`, oldest first.
+	ForPosts(postIDs []string) ([]Reaction, error)
+	// All returns every reaction, oldest first.
+	All() ([]Reaction, error)
+	// Insert adds a reaction, doing nothing if there's already one with the same ID.
+	Insert(r *Reaction) error
+	// Delete removes the reaction with `id`, doing nothing if there's none.
+	Delete(id string) error
+	// DeleteForPost removes every reaction to the post with `postID`.
+	DeleteForPost(postID string) error
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
@@ -25,10 +25,10 @@ func Create() (http.Handler, error) {
 
 	r := chi.NewRouter()
 	r.Use(chiMiddleware.Recoverer)
-	r.Use(chiMiddleware.Timeout(30 * time.Second))
 	r.Use(chiMiddleware.CloseNotify) // TODO: investigate whether this is causing issues
 
 	r.Route("/static", func(r chi.Router) {
+		r.Use(chiMiddleware.Timeout(30 * time.Second))
 		r.Get("/*", serveFile)
 	})
 
@@ -37,37 +37,89 @@ func Create() (http.Handler, error) {
 		r.Use(chiMiddleware.RealIP)
 		r.Use(middleware.VisitorID)
 		r.Use(chiMiddleware.Logger)
-		r.Use(chiMiddleware.DefaultCompress)
 		r.Use(middleware.SetSecurity())
 
-		// GET
-		r.With(middleware.Validate).Get("/", routes.IndexGetHandler)
-		r.Get(paths.Get.SignIn, routes.SignInGetHandler)
-		r.Get(paths.Get.Forgot, routes.ForgotGetHandler)
-		r.Get(paths.Get.ResetPassword, routes.ResetPasswordGetHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.SignOut, routes.SignOutGetHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Page, routes.PageGetHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Single, routes.SingleGetHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.SingleRemove, routes.SingleRemoveGetHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.TotalPostCount, routes.CountGetHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Me, routes.MeGetHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.MeRevoke, routes.MeRevokeGetHandler)
-		r.With(middleware.Validate).Get(paths.Get.EnableTwoFactorAuthentication, routes.EnableTwoFactorAuthenticationGetHandler)
-		r.With(middleware.Validate).Get(paths.Get.EnterCode, routes.EnterCodeGetHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.DisableTwoFactorAuthentication, routes.DisableTwoFactorAuthenticationGetHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.RecoveryCodes, routes.RecoveryCodesGetHandler)
-
-		// POST
-		r.Post(paths.Post.SignIn, routes.SignInPostHandler)
-		r.Post(paths.Post.Forgot, routes.ForgotPostHandler)
-		r.Post(paths.Post.ResetPassword, routes.ResetPasswordPostHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.Me, routes.MePostHandler)
-		r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.SubmitPost, routes.PostsPostHandler)
-		r.With(middleware.Validate).Post(paths.Post.EnableTwoFactorAuthentication, routes.EnableTwoFactorAuthenticationPostHandler)
-		r.With(middleware.Validate).Post(paths.Post.EnterCode, routes.EnterCodePostHandler)
-
-		// PATCH
-		r.With(middleware.Validate).Patch(paths.Patch.Single, routes.SinglePatchHandler)
+		// The post stream is long-lived, so it's exempt from the timeout, and compression would
+		// buffer its events.
+		r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.PostsStream, routes.PostsStreamGetHandler)
+
+		r.Group(func(r chi.Router) {
+			r.Use(chiMiddleware.Timeout(30 * time.Second))
+			r.Use(chiMiddleware.DefaultCompress)
+
+			// GET
+			r.With(middleware.Validate).Get("/", routes.IndexGetHandler)
+			r.Get(paths.Get.SignIn, routes.SignInGetHandler)
+			r.Get(paths.Get.Forgot, routes.ForgotGetHandler)
+			r.Get(paths.Get.ResetPassword, routes.ResetPasswordGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.SignOut, routes.SignOutGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Page, routes.PageGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Posts, routes.PostsGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Single, routes.SingleGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.SingleRemove, routes.SingleRemoveGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.SingleJump, routes.SingleJumpGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Revisions, routes.RevisionsGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.RevisionsDiff, routes.RevisionsDiffGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.TotalPostCount, routes.CountGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Me, routes.MeGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.MeRevoke, routes.MeRevokeGetHandler)
+			r.With(middleware.Validate).Get(paths.Get.EnableTwoFactorAuthentication, routes.EnableTwoFactorAuthenticationGetHandler)
+			r.With(middleware.Validate).Get(paths.Get.EnterCode, routes.EnterCodeGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.DisableTwoFactorAuthentication, routes.DisableTwoFactorAuthenticationGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.RecoveryCodes, routes.RecoveryCodesGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Search, routes.SearchGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Notifications, routes.NotificationsGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Attachment, routes.AttachmentGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.AttachmentThumbnail, routes.AttachmentThumbnailGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Avatar, routes.AvatarGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.SmallAvatar, routes.SmallAvatarGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Get(paths.Get.Moderation, routes.ModerationGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Get(paths.Get.AdminUsers, routes.AdminUsersGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Get(paths.Get.AdminUser, routes.AdminUserGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Get(paths.Get.AdminLocks, routes.AdminLocksGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.Invites, routes.InvitesGetHandler)
+			r.Get(paths.Get.Invite, routes.InviteGetHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Get(paths.Get.User, routes.UserGetHandler)
+			r.Get(paths.Get.ConfirmEmail, routes.ConfirmEmailGetHandler)
+
+			// POST
+			r.Post(paths.Post.SignIn, routes.SignInPostHandler)
+			r.Post(paths.Post.Forgot, routes.ForgotPostHandler)
+			r.Post(paths.Post.ResetPassword, routes.ResetPasswordPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.Me, routes.MePostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.SubmitPost, routes.PostsPostHandler)
+			r.With(middleware.Validate).Post(paths.Post.EnableTwoFactorAuthentication, routes.EnableTwoFactorAuthenticationPostHandler)
+			r.With(middleware.Validate).Post(paths.Post.EnterCode, routes.EnterCodePostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.Reactions, routes.ReactionsPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.NotificationRead, routes.NotificationReadPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.NotificationsRead, routes.NotificationsReadPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.Attachments, routes.AttachmentsPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.SingleDeactivate, routes.SingleDeactivatePostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.SingleRestore, routes.SingleRestorePostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.SinglePurge, routes.SinglePurgePostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.AdminUsers, routes.AdminUsersPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.AdminUser, routes.AdminUserPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.AdminUserSuspend, routes.AdminUserSuspendPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.AdminUserUnsuspend, routes.AdminUserUnsuspendPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.AdminUserResetPassword, routes.AdminUserResetPasswordPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.AdminUserResetTwoFactor, routes.AdminUserResetTwoFactorPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.AdminUserRevokeSessions, routes.AdminUserRevokeSessionsPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA, middleware.RequireAdmin).Post(paths.Post.AdminLocksClear, routes.AdminLocksClearPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.Invites, routes.InvitesPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.InviteRevoke, routes.InviteRevokePostHandler)
+			r.Post(paths.Post.Invite, routes.InvitePostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.MeEmail, routes.MeEmailPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.MeEmailCancel, routes.MeEmailCancelPostHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Post(paths.Post.MePassword, routes.MePasswordPostHandler)
+			r.Post(paths.Post.ConfirmEmail, routes.ConfirmEmailPostHandler)
+
+			// PATCH
+			r.With(middleware.Validate).Patch(paths.Patch.Single, routes.SinglePatchHandler)
+			r.With(middleware.Validate, middleware.ValidateMFA).Patch(paths.Patch.Drafts, routes.DraftsPatchHandler)
+
+			// DELETE
+			r.With(middleware.Validate, middleware.ValidateMFA).Delete(paths.Delete.Reactions, routes.ReactionsDeleteHandler)
+		})
 	})
 
 	return r, nil
@@ -0,0 +1,272 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/boatilus/peppercorn/mail"
+	"github.com/boatilus/peppercorn/pwreset"
+	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/templates"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/pressly/chi"
+)
+
+// adminUserPath returns the path to the admin page for the user with `id`.
+func adminUserPath(id string) string {
+	return "/admin/users/" + id
+}
+
+// AdminUsersGetHandler is called for the `/admin/users` route and lists every user, with a form to
+// create another. It's seen only by admins.
+func AdminUsersGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	us, err := users.All()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(us, func(i, j int) bool {
+		return strings.ToLower(us[i].Name) < strings.ToLower(us[j].Name)
+	})
+
+	data := struct {
+		Flash string
+		Users []users.User
+	}{
+		Flash: session.GetFlash(u.ID),
+		Users: us,
+	}
+
+	templates.AdminUsers.Execute(w, data)
+}
+
+// AdminUsersPostHandler is called for the `/admin/users` route and creates a user from the
+// `email`, `name` and `title` form values. Rather than the admin choosing their password, the new
+// user is sent a link to set one.
+func AdminUsersPostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	opts := users.UserOpts{
+		Email: strings.TrimSpace(req.FormValue("email")),
+		Name:  strings.TrimSpace(req.FormValue("name")),
+		Title: strings.TrimSpace(req.FormValue("title")),
+	}
+
+	// The password is never told to anyone, and is replaced when the user follows their link.
+	created, err := users.New(opts, utility.GenerateRandomNonce())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := users.Create(created); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg, err := issueReset(req, created)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session.AddFlash(u.ID, fmt.Sprintf("Created %s. %s", created.Name, msg))
+
+	http.Redirect(w, req, adminUserPath(created.ID), http.StatusSeeOther)
+}
+
+// AdminUserGetHandler is called for the `/admin/users/{id}` route and shows a single user, with
+// forms to edit their details and to act on their account.
+func AdminUserGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// The `num` URL parameter holds the user's ID.
+	target, err := users.GetByID(chi.URLParam(req, "num"))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	// GetByUser errs when there are no sessions, which here simply means there are none to show.
+	ss, _ := session.GetByUser(target.ID)
+
+	data := struct {
+		Flash    string
+		User     *users.User
+		IsSelf   bool
+		Sessions int
+	}{
+		Flash:    session.GetFlash(u.ID),
+		User:     target,
+		IsSelf:   target.ID == u.ID,
+		Sessions: len(ss),
+	}
+
+	templates.AdminUser.Execute(w, data)
+}
+
+// AdminUserPostHandler is called for the `/admin/users/{id}` route and changes the user's email,
+// name and title to the form values of the same names.
+func AdminUserPostHandler(w http.ResponseWriter, req *http.Request) {
+	manageUser(w, req, func(target *users.User) (string, error) {
+		if _, err := users.Edit(target.ID, req.FormValue("email"), req.FormValue("name"), req.FormValue("title")); err != nil {
+			return "", err
+		}
+
+		return "Changes saved", nil
+	})
+}
+
+// AdminUserSuspendPostHandler is called for the `/admin/users/{id}/suspend` route and suspends the
+// user, signing them out everywhere. Admins can't suspend themselves.
+func AdminUserSuspendPostHandler(w http.ResponseWriter, req *http.Request) {
+	manageUser(w, req, func(target *users.User) (string, error) {
+		if u := users.FromContext(req.Context()); u != nil && u.ID == target.ID {
+			return "", fmt.Errorf("You can't suspend yourself")
+		}
+
+		if _, err := users.SetSuspended(target.ID, true); err != nil {
+			return "", err
+		}
+
+		if err := session.DestroyAll(target.ID); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s has been suspended and signed out", target.Name), nil
+	})
+}
+
+// AdminUserUnsuspendPostHandler is called for the `/admin/users/{id}/unsuspend` route and lifts
+// the user's suspension.
+func AdminUserUnsuspendPostHandler(w http.ResponseWriter, req *http.Request) {
+	manageUser(w, req, func(target *users.User) (string, error) {
+		if _, err := users.SetSuspended(target.ID, false); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s can sign in again", target.Name), nil
+	})
+}
+
+// AdminUserResetPasswordPostHandler is called for the `/admin/users/{id}/reset-password` route.
+// It clears the user's password and signs them out everywhere, then sends them a link to choose a
+// new one.
+func AdminUserResetPasswordPostHandler(w http.ResponseWriter, req *http.Request) {
+	manageUser(w, req, func(target *users.User) (string, error) {
+		if _, err := users.ClearPassword(target.ID); err != nil {
+			return "", err
+		}
+
+		if err := session.DestroyAll(target.ID); err != nil {
+			return "", err
+		}
+
+		msg, err := issueReset(req, target)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s's password has been cleared and they've been signed out. %s", target.Name, msg), nil
+	})
+}
+
+// AdminUserResetTwoFactorPostHandler is called for the
+// `/admin/users/{id}/reset-two-factor-authentication` route, and turns off the user's two-factor
+// authentication, as when they've lost their authenticator and recovery codes.
+func AdminUserResetTwoFactorPostHandler(w http.ResponseWriter, req *http.Request) {
+	manageUser(w, req, func(target *users.User) (string, error) {
+		if _, err := users.ResetTwoFactor(target.ID); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("Two-factor authentication has been reset for %s", target.Name), nil
+	})
+}
+
+// AdminUserRevokeSessionsPostHandler is called for the `/admin/users/{id}/revoke-sessions` route
+// and signs the user out everywhere.
+func AdminUserRevokeSessionsPostHandler(w http.ResponseWriter, req *http.Request) {
+	manageUser(w, req, func(target *users.User) (string, error) {
+		if err := session.DestroyAll(target.ID); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s has been signed out everywhere", target.Name), nil
+	})
+}
+
+// manageUser runs `change` on the user whose ID is held by the `num` URL parameter, then redirects
+// back to their admin page with the message it returns.
+func manageUser(w http.ResponseWriter, req *http.Request, change func(target *users.User) (string, error)) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	target, err := users.GetByID(chi.URLParam(req, "num"))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	msg, err := change(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Admin %q [%s] managed user %q [%s]: %s", u.ID, u.Name, target.ID, target.Name, msg)
+
+	session.AddFlash(u.ID, msg)
+
+	http.Redirect(w, req, adminUserPath(target.ID), http.StatusSeeOther)
+}
+
+// issueReset replaces any password reset `target` has with a new one and emails them the link,
+// returning a message for the admin. Should the email fail, the message gives the link instead, so
+// the admin can pass it on.
+func issueReset(req *http.Request, target *users.User) (string, error) {
+	if err := pwreset.DestroyByUser(target.ID); err != nil {
+		return "", err
+	}
+
+	ua := utility.ParseUserAgent(req.UserAgent())
+
+	pwr, err := pwreset.New(target.ID, ua.Browser, ua.OS)
+	if err != nil {
+		return "", err
+	}
+
+	if err := pwreset.Create(pwr); err != nil {
+		return "", err
+	}
+
+	if err := mail.SendForgottenPassword(target.Email, pwr.ID); err != nil {
+		log.Printf("Could not email a password reset link to user %q: %s", target.ID, err)
+
+		return fmt.Sprintf("The password reset email couldn't be sent, so pass on this link, which expires in an hour: %s", mail.ResetLink(pwr.ID)), nil
+	}
+
+	return fmt.Sprintf("A password reset link was sent to %s.", target.Email), nil
+}
@@ -0,0 +1,292 @@
+package routes
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boatilus/peppercorn/attachments"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/pressly/chi"
+)
+
+// jsonAttachment describes an attachment to clients, both in response to its upload and with the
+// post it's attached to.
+type jsonAttachment struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Size       int64  `json:"size"`
+	PrettySize string `json:"pretty_size"`
+	// Width and Height are omitted for anything but images.
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	URL    string `json:"url"`
+	// ThumbnailURL is omitted if there's no thumbnail.
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+func newJSONAttachment(a *attachments.Attachment) jsonAttachment {
+	return jsonAttachment{
+		ID:           a.ID,
+		Name:         a.Name,
+		Type:         a.Type,
+		Size:         a.Size,
+		PrettySize:   a.PrettySize(),
+		Width:        a.Width,
+		Height:       a.Height,
+		URL:          a.URL(),
+		ThumbnailURL: a.ThumbnailURL(),
+	}
+}
+
+// loadAttachments sets the Attachments of each of `zs` from its AttachmentIDs. Attachments that
+// can't be found are left out.
+func loadAttachments(zs []posts.Zip) error {
+	var ids []string
+	for i := range zs {
+		ids = append(ids, zs[i].AttachmentIDs...)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	as, err := attachments.GetMany(ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range zs {
+		zs[i].Attachments = nil
+
+		for _, id := range zs[i].AttachmentIDs {
+			if a, ok := as[id]; ok {
+				zs[i].Attachments = append(zs[i].Attachments, a)
+			}
+		}
+	}
+
+	return nil
+}
+
+// maxFormMemory is the most of a multipart form kept in memory as it's parsed. Larger files are
+// spooled to temporary files.
+const maxFormMemory = 32 << 20
+
+// uploadOverhead is allowed for in the size of a request carrying uploads, beyond the size of the
+// files themselves, for the rest of the form and the multipart encoding.
+const uploadOverhead = 1 << 20
+
+// AttachmentsPostHandler is called for the `/attachments` route, to which a single file is POSTed
+// as the `file` field of a multipart form. It responds with the new attachment as JSON, whose ID can
+// then be given as an `attachment` field when submitting a post.
+func AttachmentsPostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, attachments.MaxSize()+uploadOverhead)
+
+	// Reading the parts as they come means the file needn't be spooled to disk first.
+	mr, err := req.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if part.FormName() != "file" {
+			continue
+		}
+
+		a, err := attachments.Upload(u.ID, part.FileName(), part)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, newJSONAttachment(a))
+
+		return
+	}
+
+	http.Error(w, "No file supplied", http.StatusBadRequest)
+}
+
+// formAttachments uploads the files POSTed as the `file` fields of multipart form `req`, which must
+// already be parsed, as attachments by `u`, and returns the IDs of the attachments given as
+// `attachment` fields followed by those of the files uploaded. Browsers send an empty `file` field when no file
+// is chosen, which is ignored. An ID given more than once is used once, while one already attached
+// to a post is refused.
+func formAttachments(req *http.Request, u *users.User) ([]string, error) {
+	var ids []string
+
+	seen := make(map[string]bool)
+	for _, id := range req.Form["attachment"] {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if req.MultipartForm == nil {
+		return ids, checkFormAttachments(u, ids)
+	}
+
+	var files []*multipart.FileHeader
+	for _, fh := range req.MultipartForm.File["file"] {
+		if fh.Filename == "" && fh.Size == 0 {
+			continue
+		}
+
+		files = append(files, fh)
+	}
+
+	// Check what we can before uploading anything, so that a post we'd refuse leaves nothing behind.
+	if err := checkFormAttachments(u, ids); err != nil {
+		return nil, err
+	}
+
+	if max := attachments.MaxPerPost(); len(ids)+len(files) > max {
+		return nil, fmt.Errorf("A post can't have more than %d attachments", max)
+	}
+
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		a, err := attachments.Upload(u.ID, fh.Filename, f)
+		f.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, a.ID)
+	}
+
+	return ids, nil
+}
+
+// checkFormAttachments returns an error unless each of `ids` is an attachment uploaded by `u` and
+// not yet attached to a post.
+func checkFormAttachments(u *users.User, ids []string) error {
+	if err := attachments.CheckOwner(u.ID, ids); err != nil {
+		return err
+	}
+
+	return posts.CheckAttachments(ids)
+}
+
+// AttachmentGetHandler is called for the `/attachments/{id}` route and serves an attachment's
+// contents. Images and plain text are shown in the browser, while anything else is downloaded.
+func AttachmentGetHandler(w http.ResponseWriter, req *http.Request) {
+	serveAttachment(w, req, false)
+}
+
+// AttachmentThumbnailGetHandler is called for the `/attachments/{id}/thumbnail` route and serves the
+// thumbnail of an image attachment.
+func AttachmentThumbnailGetHandler(w http.ResponseWriter, req *http.Request) {
+	serveAttachment(w, req, true)
+}
+
+func serveAttachment(w http.ResponseWriter, req *http.Request, thumbnail bool) {
+	// The `num` URL parameter holds the attachment's ID.
+	a, err := attachments.Get(chi.URLParam(req, "num"))
+	if err != nil || (thumbnail && !a.Thumbnail) {
+		http.NotFound(w, req)
+		return
+	}
+
+	open, contentType, disposition := attachments.Open, a.Type, "attachment"
+	if thumbnail {
+		open, contentType = attachments.OpenThumbnail, a.ThumbnailType()
+	}
+
+	if thumbnail || a.IsImage() || strings.HasPrefix(a.Type, "text/plain") {
+		disposition = "inline"
+	}
+
+	f, err := open(a.ID)
+	if os.IsNotExist(err) {
+		http.NotFound(w, req)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer f.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	if d := mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}); d != "" {
+		disposition = d
+	}
+
+	h.Set("Content-Disposition", disposition)
+	// Keep browsers from taking an attachment for anything other than its type, and from running
+	// anything in it should they try.
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'; sandbox")
+	// An attachment's contents never change, but only signed-in users may see them.
+	h.Set("Cache-Control", "private, max-age=31536000, immutable")
+
+	http.ServeContent(w, req, "", a.Time, f)
+}
+
+// AvatarGetHandler is called for the `/avatars/{id}` route and serves an avatar.
+func AvatarGetHandler(w http.ResponseWriter, req *http.Request) {
+	serveAvatar(w, req, false)
+}
+
+// SmallAvatarGetHandler is called for the `/avatars/{id}/small` route and serves the small size of
+// an avatar.
+func SmallAvatarGetHandler(w http.ResponseWriter, req *http.Request) {
+	serveAvatar(w, req, true)
+}
+
+func serveAvatar(w http.ResponseWriter, req *http.Request, small bool) {
+	// The `num` URL parameter holds the avatar's ID.
+	f, err := attachments.OpenAvatar(chi.URLParam(req, "num"), small)
+	if err != nil {
+		// Malformed IDs are refused by the blob store, and are as missing as any other.
+		http.NotFound(w, req)
+		return
+	}
+
+	defer f.Close()
+
+	// The type is left for ServeContent to sniff, as avatars are kept as either JPEGs or PNGs.
+	h := w.Header()
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	// A new avatar is given a new ID, so an avatar's contents never change.
+	h.Set("Cache-Control", "private, max-age=31536000, immutable")
+
+	http.ServeContent(w, req, "", time.Time{}, f)
+}
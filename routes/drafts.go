@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/boatilus/peppercorn/drafts"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// jsonDraft is the user's draft as saved, in response to a PATCH to `/drafts`.
+type jsonDraft struct {
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DraftsPatchHandler is called for PATCH requests to the `/drafts` route, and saves the `content`
+// field of the JSON body as the user's draft, replacing any they had. It responds with the draft as
+// saved, or with 204 No Content if the draft was blank and so deleted.
+func DraftsPatchHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	var data struct {
+		Content string `json:"content"`
+	}
+
+	// Allow for the JSON encoding of the longest draft, and then some.
+	req.Body = http.MaxBytesReader(w, req.Body, 8*drafts.MaxLength)
+	defer req.Body.Close()
+
+	if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d, err := drafts.Save(u.ID, utility.RemoveCRs(data.Content))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if d == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(w, jsonDraft{Content: d.Content, UpdatedAt: d.UpdatedAt})
+}
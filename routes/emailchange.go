@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/boatilus/peppercorn/emailchange"
+	"github.com/boatilus/peppercorn/mail"
+	"github.com/boatilus/peppercorn/paths"
+	"github.com/boatilus/peppercorn/pwreset"
+	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/templates"
+	"github.com/boatilus/peppercorn/users"
+)
+
+// emailChangeErrors gives the messages shown for the codes emailchange.Request errs with.
+var emailChangeErrors = map[string]string{
+	"invalid_password": "Your current password was incorrect",
+	"invalid_email":    "Please enter a valid email address other than your current one",
+}
+
+// MeEmailPostHandler is called for the `/me/email` route, to which the user POSTs the new `email`
+// they'd like to sign in with and their current `password`. A link to confirm it is sent to the new
+// address, and a notice to the current one.
+func MeEmailPostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	c, err := emailchange.Request(u, req.FormValue("password"), req.FormValue("email"))
+	if err != nil {
+		msg, ok := emailChangeErrors[err.Error()]
+		if !ok {
+			msg = err.Error()
+		}
+
+		session.AddFlash(u.ID, msg)
+		http.Redirect(w, req, paths.Get.Me, http.StatusSeeOther)
+
+		return
+	}
+
+	// Unlike an invite's link, the link mustn't be shown here should it not be sent, as following it
+	// is how the new address is shown to be the user's.
+	if err := mail.SendEmailChangeConfirmation(c.Email, c.ID); err != nil {
+		log.Printf("Could not email confirmation of email change %q: %s", c.ID, err)
+
+		if err := emailchange.Cancel(u.ID); err != nil {
+			log.Printf("Could not cancel email change %q: %s", c.ID, err)
+		}
+
+		session.AddFlash(u.ID, fmt.Sprintf("A confirmation couldn't be sent to %s. Please try again later.", c.Email))
+		http.Redirect(w, req, paths.Get.Me, http.StatusSeeOther)
+
+		return
+	}
+
+	if err := mail.SendEmailChangeNotice(u.Email, c.Email); err != nil {
+		log.Printf("Could not email notice of email change %q: %s", c.ID, err)
+	}
+
+	session.AddFlash(u.ID, fmt.Sprintf("A link to confirm your new email was sent to %s. Your email won't change until it's followed.", c.Email))
+
+	http.Redirect(w, req, paths.Get.Me, http.StatusSeeOther)
+}
+
+// MeEmailCancelPostHandler is called for the `/me/email/cancel` route and withdraws the user's
+// pending change of email, should they have one.
+func MeEmailCancelPostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	if err := emailchange.Cancel(u.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session.AddFlash(u.ID, "Your change of email was cancelled")
+
+	http.Redirect(w, req, paths.Get.Me, http.StatusSeeOther)
+}
+
+// confirmEmailData is the data the email confirmation page is rendered with. Without a Token,
+// there's no form, only the message saying why.
+type confirmEmailData struct {
+	FlashMessage string
+	Token        string
+	Email        string
+}
+
+// ConfirmEmailGetHandler is called for the `/confirm-email` route, which is followed from the email
+// sent to a user's new address with the change in the `token` query parameter. It asks them to
+// confirm the change, rather than making it straight away, so that it isn't made by anything that
+// merely fetches the link, such as a mail scanner.
+func ConfirmEmailGetHandler(w http.ResponseWriter, req *http.Request) {
+	c, err := emailchange.Usable(req.FormValue("token"))
+	if err != nil {
+		templates.ConfirmEmail.Execute(w, confirmEmailData{FlashMessage: err.Error()})
+		return
+	}
+
+	templates.ConfirmEmail.Execute(w, confirmEmailData{Token: c.ID, Email: c.Email})
+}
+
+// ConfirmEmailPostHandler is called for the `/confirm-email` route, to which the `token` of a
+// change of email is POSTed to make it. Any password reset sent to the old address is withdrawn.
+func ConfirmEmailPostHandler(w http.ResponseWriter, req *http.Request) {
+	token := req.FormValue("token")
+	if token == "" {
+		http.Error(w, "No token submitted in form", http.StatusBadRequest)
+		return
+	}
+
+	u, err := emailchange.Confirm(token)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		templates.ConfirmEmail.Execute(w, confirmEmailData{FlashMessage: err.Error()})
+
+		return
+	}
+
+	if err := pwreset.DestroyByUser(u.ID); err != nil {
+		log.Printf("Could not withdraw password reset of user %q: %s", u.ID, err)
+	}
+
+	msg := fmt.Sprintf("Your email is now %s. Use it to sign in from now on.", u.Email)
+
+	templates.ConfirmEmail.Execute(w, confirmEmailData{FlashMessage: msg})
+}
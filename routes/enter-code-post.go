@@ -7,6 +7,7 @@ import (
 
 	"github.com/boatilus/peppercorn/paths"
 	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/throttle"
 	"github.com/boatilus/peppercorn/users"
 	"github.com/pquerna/otp/totp"
 )
@@ -46,6 +47,19 @@ func EnterCodePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The attempt is recorded before the code is validated, and counts as failed unless it's right.
+	attempt, wait, err := tryThrottled(r, throttle.Code, u.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if wait > 0 {
+		session.AddFlash(s.ID, waitMessage(wait))
+		http.Redirect(w, r, paths.Get.EnterCode, http.StatusSeeOther)
+		return
+	}
+
 	log.Printf("routes: validating TOTP code %q for user %q [%q]..", code, u.ID, u.Name)
 
 	// Validate the code submitted against the user's secret.
@@ -55,6 +69,8 @@ func EnterCodePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordSuccess(attempt)
+
 	log.Printf("routes: TOTP code for user %q [%s] successfully validated", u.ID, u.Name)
 
 	// Extend the user's MFA session expiry.
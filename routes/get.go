@@ -9,8 +9,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/boatilus/peppercorn/attachments"
 	"github.com/boatilus/peppercorn/cookie"
 	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/drafts"
+	"github.com/boatilus/peppercorn/emailchange"
+	"github.com/boatilus/peppercorn/invites"
+	"github.com/boatilus/peppercorn/notifications"
 	"github.com/boatilus/peppercorn/paths"
 	"github.com/boatilus/peppercorn/posts"
 	"github.com/boatilus/peppercorn/pwreset"
@@ -91,6 +96,9 @@ func PageGetHandler(w http.ResponseWriter, req *http.Request) {
 		Posts       []posts.Zip
 		PageNum     db.CountType
 		TotalPages  db.CountType
+		Unread      int
+		Draft       *drafts.Draft
+		CanInvite   bool
 	}
 
 	data.CurrentUser = users.FromContext(req.Context())
@@ -99,6 +107,8 @@ func PageGetHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	data.CanInvite = invites.CanInvite(data.CurrentUser)
+
 	var err error
 
 	// TODO: We can run these following two queries in parallel.
@@ -108,7 +118,21 @@ func PageGetHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	data.TotalPages = utility.ComputePage(data.PostCount, data.CurrentUser.PPP)
+	// Pages are ranges of post numbers, so the number of pages depends on the last number rather
+	// than the number of active posts.
+	lastNumber, err := posts.Last()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data.TotalPages = utility.ComputePage(lastNumber, data.CurrentUser.PPP)
+
+	// A forum with no posts yet still has a page, empty but for the reply box, on which to make the
+	// first post.
+	if data.TotalPages < 1 {
+		data.TotalPages = 1
+	}
 
 	num := chi.URLParam(req, "num")
 
@@ -124,49 +148,46 @@ func PageGetHandler(w http.ResponseWriter, req *http.Request) {
 		data.PageNum = db.CountType(pageNum)
 	}
 
-	// To get the first post to load for this page, we must take into account the user's
-	// posts-per-page setting.
-	begin := ((data.PageNum * data.CurrentUser.PPP) - data.CurrentUser.PPP) + 1
+	if data.PageNum < 1 || data.PageNum > data.TotalPages {
+		http.NotFound(w, req)
+		return
+	}
 
-	ps, err := posts.GetRange(begin, data.CurrentUser.PPP)
+	// Page numbers are translated to cursors, so that pages are loaded just as they are by
+	// PostsGetHandler.
+	q, err := posts.PageQuery(data.PageNum, data.CurrentUser.PPP)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Load the user's timezone setting so we can provide correct post timestamps.
-	loc, err := time.LoadLocation(data.CurrentUser.Timezone)
+	data.Posts, _, err = loadPage(data.CurrentUser, q)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	now := time.Now()
-
-	for _, p := range ps {
-		u := users.Users[p.Author]
-
-		zip := posts.Zip{
-			ID:         p.ID,
-			AuthorID:   p.Author,
-			Content:    p.Content,
-			Time:       p.Time,
-			Avatar:     u.Avatar,
-			AuthorName: u.Name,
-			Title:      u.Title,
-			Count:      begin,
-			PrettyTime: utility.FormatTime(p.Time.In(loc), now),
-		}
-
-		data.Posts = append(data.Posts, zip)
+	// The count of unread notifications in the header is non-essential, so simply log the error.
+	if data.Unread, err = notifications.Unread(data.CurrentUser.ID); err != nil {
+		log.Printf("Could not count unread notifications for user %q: %s", data.CurrentUser.ID, err)
+	}
 
-		begin++
+	// Restore the user's draft to the reply box, which is likewise non-essential.
+	if data.Draft, err = drafts.Get(data.CurrentUser.ID); err != nil {
+		log.Printf("Could not get the draft of user %q: %s", data.CurrentUser.ID, err)
 	}
 
 	// Now that we've successfully gathered the data needed to render, we want to mark the most
 	// recent post the user's seen. For now, we'll do this even if it's far back in time, but ideally,
 	// we should only do so if it's newer than what the `LastViewed` property currently reflects.
 	numPosts := len(data.Posts)
+
+	// Every post on this page may have been deactivated.
+	if numPosts == 0 {
+		templates.Index.Execute(w, data)
+		return
+	}
+
 	last := data.Posts[numPosts-1]
 
 	if data.CurrentUser.LastViewed != last.ID {
@@ -181,7 +202,7 @@ func PageGetHandler(w http.ResponseWriter, req *http.Request) {
 }
 
 // SingleHandler is called for GET requests for the `/post/{num}` route and renders a single post
-// by its computed post number.
+// by its number.
 func SingleGetHandler(w http.ResponseWriter, req *http.Request) {
 	num := chi.URLParam(req, "num")
 
@@ -202,6 +223,48 @@ func SingleGetHandler(w http.ResponseWriter, req *http.Request) {
 	io.WriteString(w, p.Content)
 }
 
+// SingleJumpGetHandler is called for the `/posts/{num}/jump` route, and redirects to the post
+// numbered `num` on the page on which it's seen, however far back that is.
+func SingleJumpGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	num := chi.URLParam(req, "num")
+
+	n, err := strconv.ParseInt(num, 10, 32)
+	if err != nil {
+		msg := fmt.Sprintf("Bad request for route '/posts/%v/jump'. Expected '%v' to be a positive integer", num, num)
+
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// Admins can jump to inactive posts, as they see them in place.
+	get := posts.GetOne
+	if u.IsAdmin {
+		get = posts.GetAny
+	}
+
+	p, err := get(db.CountType(n))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	offset, err := posts.GetOffset(p.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := utility.ComputePage(offset, u.PPP)
+
+	http.Redirect(w, req, fmt.Sprintf("/page/%d#%s", page, p.ID), http.StatusSeeOther)
+}
+
 // SingleRemoveGetHandler is called for GET requests for the `/post/{num}/delete` route and removes
 // a single post, if the user is authorized to do so.
 func SingleRemoveGetHandler(w http.ResponseWriter, req *http.Request) {
@@ -242,6 +305,76 @@ func SingleRemoveGetHandler(w http.ResponseWriter, req *http.Request) {
 	http.Redirect(w, req, "/page/latest", http.StatusSeeOther)
 }
 
+// PostsGetHandler is called for the `/posts` route and returns a page of posts as JSON, along with
+// the cursors to the pages either side. The page holds the posts after the `after` cursor and
+// before the `before` cursor, either of which may be omitted, up to `limit` posts or the user's
+// posts-per-page setting. Unless `after` is given, it's the last of those posts, so a request with
+// no cursors returns the newest posts.
+func PostsGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	params := req.URL.Query()
+
+	q := posts.Query{Limit: u.PPP, Last: true}
+
+	if s := params.Get("after"); s != "" {
+		c, err := posts.ParseCursor(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		q.After = &c
+		q.Last = false
+	}
+
+	if s := params.Get("before"); s != "" {
+		c, err := posts.ParseCursor(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		q.Before = &c
+	}
+
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil || n < 1 {
+			http.Error(w, "routes: limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+
+		q.Limit = db.CountType(n)
+	}
+
+	zs, page, err := loadPage(u, q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Posts []jsonPost `json:"posts"`
+		Prev  string     `json:"prev,omitempty"`
+		Next  string     `json:"next,omitempty"`
+	}{
+		Posts: make([]jsonPost, len(zs)),
+		Prev:  page.Prev,
+		Next:  page.Next,
+	}
+
+	for i := range zs {
+		data.Posts[i] = newJSONPost(&zs[i])
+	}
+
+	writeJSON(w, data)
+}
+
 func CountGetHandler(w http.ResponseWriter, _ *http.Request) {
 	n, err := posts.Count()
 	if err != nil {
@@ -323,9 +456,18 @@ func MeGetHandler(w http.ResponseWriter, req *http.Request) {
 
 	currentDuration := time.Duration(u.AuthDuration) * time.Second
 
+	var pendingEmail string
+
+	if c, err := emailchange.Pending(u.ID); err != nil {
+		log.Printf("Could not load pending email change of user %q: %s", u.ID, err)
+	} else if c != nil {
+		pendingEmail = c.Email
+	}
+
 	o := struct {
 		Flash           string
 		ObfuscatedEmail string
+		PendingEmail    string
 		Name            string
 		Title           string
 		Avatar          string
@@ -340,9 +482,10 @@ func MeGetHandler(w http.ResponseWriter, req *http.Request) {
 	}{
 		Flash:           session.GetFlash(u.ID),
 		ObfuscatedEmail: obEmail,
+		PendingEmail:    pendingEmail,
 		Name:            u.Name,
 		Title:           u.Title,
-		Avatar:          u.Avatar,
+		Avatar:          attachments.SmallAvatarURL(u.Avatar),
 		PPPOptions:      pppOptions,
 		PPP:             strconv.FormatInt(int64(u.PPP), 10),
 		Has2FAEnabled:   u.Has2FAEnabled,
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/boatilus/peppercorn/drafts"
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/reactions"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/pressly/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageGetHandler_noPosts(t *testing.T) {
+	assert := assert.New(t)
+
+	posts.SetStore(posts.NewMemoryStore())
+	reactions.SetStore(reactions.NewMemoryStore())
+	notifications.SetStore(notifications.NewMemoryStore())
+	drafts.SetStore(drafts.NewMemoryStore())
+	users.SetStore(users.NewMemoryStore())
+
+	u, err := users.New(users.UserOpts{Email: "first@example.com", Name: "first"}, "password")
+	if !assert.NoError(err) || !assert.NoError(users.Create(u)) {
+		return
+	}
+
+	r := chi.NewRouter()
+	r.Get("/page/:num", PageGetHandler)
+
+	for _, num := range []string{"1", "latest"} {
+		req := httptest.NewRequest("GET", "/page/"+num, nil)
+		req = req.WithContext(users.NewContext(req.Context(), u))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(http.StatusOK, w.Code, num)
+		assert.True(strings.Contains(w.Body.String(), `<form id="reply"`), num)
+	}
+
+	req := httptest.NewRequest("GET", "/page/2", nil)
+	req = req.WithContext(users.NewContext(req.Context(), u))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,253 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/boatilus/peppercorn/cookie"
+	"github.com/boatilus/peppercorn/invites"
+	"github.com/boatilus/peppercorn/mail"
+	"github.com/boatilus/peppercorn/paths"
+	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/templates"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/pressly/chi"
+)
+
+// inviteItem is a single invite as it's listed, with the names of who sent it and who joined with
+// it.
+type inviteItem struct {
+	ID           string
+	Email        string
+	InviterName  string
+	RedeemerName string
+	Status       invites.Status
+	Time         time.Time
+	PrettyTime   string
+	CanRevoke    bool
+}
+
+// InvitesGetHandler is called for the `/invites` route and lists the invites the user can see,
+// newest first, with a form to send another. Admins see every invite; anyone else allowed to
+// invite sees their own.
+func InvitesGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	if !invites.CanInvite(u) {
+		http.Error(w, "You can't send invites", http.StatusForbidden)
+		return
+	}
+
+	// Load the user's timezone setting so we can provide correct timestamps.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var is []invites.Invite
+	if u.IsAdmin {
+		is, err = invites.All()
+	} else {
+		is, err = invites.ByInviter(u.ID)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Flash   string
+		IsAdmin bool
+		Invites []inviteItem
+	}{
+		Flash:   session.GetFlash(u.ID),
+		IsAdmin: u.IsAdmin,
+	}
+
+	now := time.Now()
+
+	for i := range is {
+		inv := &is[i]
+
+		inviter, _ := users.Users.Get(inv.InviterID)
+		redeemer, _ := users.Users.Get(inv.RedeemedBy)
+		status := inv.Status(now)
+
+		data.Invites = append(data.Invites, inviteItem{
+			ID:           inv.ID,
+			Email:        inv.Email,
+			InviterName:  inviter.Name,
+			RedeemerName: redeemer.Name,
+			Status:       status,
+			Time:         inv.Created.In(loc),
+			PrettyTime:   utility.FormatTime(inv.Created.In(loc), now),
+			CanRevoke:    status == invites.StatusPending,
+		})
+	}
+
+	templates.Invites.Execute(w, data)
+}
+
+// InvitesPostHandler is called for the `/invites` route and invites the `email` form value,
+// emailing them a link to join.
+func InvitesPostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	if !invites.CanInvite(u) {
+		http.Error(w, "You can't send invites", http.StatusForbidden)
+		return
+	}
+
+	inv, err := invites.New(u.ID, req.FormValue("email"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg := fmt.Sprintf("An invite was sent to %s.", inv.Email)
+
+	if err := mail.SendInvite(inv.Email, u.Name, inv.ID); err != nil {
+		log.Printf("Could not email invite %q: %s", inv.ID, err)
+
+		msg = fmt.Sprintf("The invite to %s couldn't be emailed, so pass on this link: %s", inv.Email, mail.InviteLink(inv.ID))
+	}
+
+	session.AddFlash(u.ID, msg)
+
+	http.Redirect(w, req, paths.Get.Invites, http.StatusSeeOther)
+}
+
+// InviteRevokePostHandler is called for the `/invites/{id}/revoke` route and withdraws the pending
+// invite with that ID. Admins can revoke any invite; anyone else only those they sent.
+func InviteRevokePostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// The `num` URL parameter holds the invite's ID.
+	inv, err := invites.Get(chi.URLParam(req, "num"))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	if !u.IsAdmin && inv.InviterID != u.ID {
+		http.Error(w, "You can only revoke your own invites", http.StatusForbidden)
+		return
+	}
+
+	if err := invites.Revoke(inv.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session.AddFlash(u.ID, fmt.Sprintf("The invite to %s was revoked.", inv.Email))
+
+	http.Redirect(w, req, paths.Get.Invites, http.StatusSeeOther)
+}
+
+// inviteErrors gives the messages shown for the codes users.New errs with when validating a new
+// user's choices, besides those of the password policy.
+var inviteErrors = map[string]string{
+	"invalid_name": "Names must be between 1 and 24 characters long",
+}
+
+// inviteData is the data the invite page is rendered with. Without a Token, there's no form, only
+// the message saying why.
+type inviteData struct {
+	FlashMessage string
+	Token        string
+	Email        string
+	InviterName  string
+}
+
+// usableInviteData returns the data to render the invite page with for the invite with `token`.
+func usableInviteData(token string) inviteData {
+	inv, err := invites.Usable(token)
+	if err != nil {
+		return inviteData{FlashMessage: err.Error()}
+	}
+
+	inviter, _ := users.Users.Get(inv.InviterID)
+
+	return inviteData{Token: inv.ID, Email: inv.Email, InviterName: inviter.Name}
+}
+
+// InviteGetHandler is called for the `/invite` route, which is followed from an invite email with
+// the invite in the `token` query parameter. It asks the new user to choose a name and password.
+func InviteGetHandler(w http.ResponseWriter, req *http.Request) {
+	token := req.FormValue("token")
+	if token == "" {
+		templates.Invite.Execute(w, inviteData{FlashMessage: "Invalid invite."})
+		return
+	}
+
+	templates.Invite.Execute(w, usableInviteData(token))
+}
+
+// InvitePostHandler is called for the `/invite` route, to which the new user POSTs the `token` of
+// their invite with their chosen `name`, `password1` and `password2`. The account is created and
+// signed in.
+func InvitePostHandler(w http.ResponseWriter, req *http.Request) {
+	token := req.FormValue("token")
+	if token == "" {
+		http.Error(w, "No token submitted in form", http.StatusBadRequest)
+		return
+	}
+
+	// A mistake in the form is shown on the form, so it can be corrected.
+	retry := func(msg string) {
+		data := usableInviteData(token)
+		if data.Token != "" {
+			data.FlashMessage = msg
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		templates.Invite.Execute(w, data)
+	}
+
+	password := req.FormValue("password1")
+	if password != req.FormValue("password2") {
+		retry("Passwords do not match")
+		return
+	}
+
+	u, err := invites.Redeem(token, req.FormValue("name"), password)
+	if err != nil {
+		retry(formErrorMessage(err, inviteErrors))
+		return
+	}
+
+	ip := req.RemoteAddr // chi's RealIP middleware should set this to the user's actual IP
+	ua := req.Header.Get("User-Agent")
+
+	id, err := session.Create(u, ip, ua)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c, err := cookie.Create(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, c)
+	http.Redirect(w, req, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/boatilus/peppercorn/moderation"
+	"github.com/boatilus/peppercorn/templates"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/pressly/chi"
+)
+
+// moderationLimit is the greatest number of moderation log entries shown.
+const moderationLimit = 100
+
+// moderationVerbs describe each action in the moderation log.
+var moderationVerbs = map[moderation.Action]string{
+	moderation.ActionDeactivate: "deactivated",
+	moderation.ActionRestore:    "restored",
+	moderation.ActionPurge:      "purged",
+}
+
+// moderationItem is a single moderation log entry as it's shown, with the names of the admin and
+// the post's author. Link is empty once the post has been purged.
+type moderationItem struct {
+	ModeratorName string
+	Verb          string
+	Number        string
+	Link          string
+	AuthorName    string
+	Reason        string
+	Time          time.Time
+	PrettyTime    string
+}
+
+// ModerationGetHandler is called for the `/moderation` route and lists the newest entries in the
+// moderation log. It's seen only by admins.
+func ModerationGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// Load the user's timezone setting so we can provide correct timestamps.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	es, err := moderation.Log(moderationLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Purged posts can no longer be jumped to, even from the entries before they were purged.
+	purged := make(map[string]bool)
+	for i := range es {
+		if es[i].Action == moderation.ActionPurge {
+			purged[es[i].PostID] = true
+		}
+	}
+
+	var data struct {
+		Entries []moderationItem
+	}
+
+	now := time.Now()
+
+	for i := range es {
+		e := &es[i]
+
+		moderator, _ := users.Users.Get(e.ModeratorID)
+		author, _ := users.Users.Get(e.AuthorID)
+
+		item := moderationItem{
+			ModeratorName: moderator.Name,
+			Verb:          moderationVerbs[e.Action],
+			Number:        utility.CommifyCountType(e.Number),
+			AuthorName:    author.Name,
+			Reason:        e.Reason,
+			Time:          e.Time.In(loc),
+			PrettyTime:    utility.FormatTime(e.Time.In(loc), now),
+		}
+
+		if !purged[e.PostID] {
+			item.Link = fmt.Sprintf("/posts/%d/jump", e.Number)
+		}
+
+		data.Entries = append(data.Entries, item)
+	}
+
+	templates.Moderation.Execute(w, data)
+}
+
+// SingleDeactivatePostHandler is called for the `/posts/{id}/deactivate` route and deactivates
+// the post of any user on behalf of an admin, for the reason given in the `reason` form value.
+func SingleDeactivatePostHandler(w http.ResponseWriter, req *http.Request) {
+	moderate(w, req, moderation.Deactivate)
+}
+
+// SingleRestorePostHandler is called for the `/posts/{id}/restore` route and restores a
+// deactivated post on behalf of an admin.
+func SingleRestorePostHandler(w http.ResponseWriter, req *http.Request) {
+	moderate(w, req, func(moderatorID string, postID string, _ string) (*moderation.Entry, error) {
+		return moderation.Restore(moderatorID, postID)
+	})
+}
+
+// SinglePurgePostHandler is called for the `/posts/{id}/purge` route and deletes a deactivated
+// post for good on behalf of an admin, for the reason given in the optional `reason` form value.
+func SinglePurgePostHandler(w http.ResponseWriter, req *http.Request) {
+	moderate(w, req, moderation.Purge)
+}
+
+// moderate takes the moderation action `act` on the post whose ID is held by the `num` URL
+// parameter, then redirects the admin back to where the post is, or was, seen.
+func moderate(w http.ResponseWriter, req *http.Request, act func(moderatorID string, postID string, reason string) (*moderation.Entry, error)) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// As with SingleRemoveGetHandler, the `num` URL parameter holds the post's ID.
+	id := chi.URLParam(req, "num")
+
+	if len(id) == 0 {
+		http.Error(w, "routes: ID cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	e, err := act(u.ID, id, req.FormValue("reason"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	uri := fmt.Sprintf("/posts/%d/jump", e.Number)
+
+	// A purged post can't be jumped to, so go to the page it was on.
+	if e.Action == moderation.ActionPurge {
+		uri = fmt.Sprintf("/page/%d", utility.ComputePage(e.Number, u.PPP))
+	}
+
+	http.Redirect(w, req, uri, http.StatusSeeOther)
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/paths"
+	"github.com/boatilus/peppercorn/templates"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/pressly/chi"
+)
+
+// notificationsLimit is the greatest number of notifications shown.
+const notificationsLimit = 50
+
+// notificationItem is a single notification as it's shown, with the name of the user who mentioned
+// the current user and when.
+type notificationItem struct {
+	ID         string
+	ActorName  string
+	Number     string
+	Link       string
+	Time       time.Time
+	PrettyTime string
+	Read       bool
+}
+
+// NotificationsGetHandler is called for the `/notifications` route and lists the user's newest
+// notifications, unread or not.
+func NotificationsGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// Load the user's timezone setting so we can provide correct timestamps.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ns, err := notifications.ForUser(u.ID, notificationsLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var data struct {
+		Unread        int
+		Notifications []notificationItem
+	}
+
+	now := time.Now()
+
+	for i := range ns {
+		n := &ns[i]
+
+		actor, _ := users.Users.Get(n.ActorID)
+
+		if !n.Read {
+			data.Unread++
+		}
+
+		data.Notifications = append(data.Notifications, notificationItem{
+			ID:         n.ID,
+			ActorName:  actor.Name,
+			Number:     utility.CommifyCountType(n.Number),
+			Link:       n.Link(),
+			Time:       n.Time.In(loc),
+			PrettyTime: utility.FormatTime(n.Time.In(loc), now),
+			Read:       n.Read,
+		})
+	}
+
+	templates.Notifications.Execute(w, data)
+}
+
+// NotificationReadPostHandler is called for the `/notifications/{id}/read` route and marks a single
+// notification to the user as read.
+func NotificationReadPostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// The `num` URL parameter holds the notification's ID.
+	if err := notifications.MarkRead(u.ID, chi.URLParam(req, "num")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, req, paths.Get.Notifications, http.StatusSeeOther)
+}
+
+// NotificationsReadPostHandler is called for the `/notifications/read` route and marks every
+// notification to the user as read.
+func NotificationsReadPostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	if err := notifications.MarkAllRead(u.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, req, paths.Get.Notifications, http.StatusSeeOther)
+}
@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/boatilus/peppercorn/mail"
+	"github.com/boatilus/peppercorn/paths"
+	"github.com/boatilus/peppercorn/pwreset"
+	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/users"
+)
+
+// passwordErrors gives the messages shown for the codes users.ChangePassword errs with, besides
+// those of the password policy.
+var passwordErrors = map[string]string{
+	"invalid_password": "Your current password was incorrect",
+}
+
+// passwordPolicyMessage returns the message shown for `code`, if it's one of the codes
+// users.CheckPassword errs with when a new password breaks the password policy.
+func passwordPolicyMessage(code string) (string, bool) {
+	switch code {
+	case "invalid_hash":
+		return fmt.Sprintf("Passwords must be at least %d characters long", users.MinPasswordLength()), true
+	case "personal_password":
+		return "Passwords cannot contain your name or email address", true
+	case "weak_password":
+		return "That password is too easy to guess. Try a longer one, or mix in capitals, numbers or symbols", true
+	case "breached_password":
+		return "That password has appeared in a data breach, so it's among the first to be guessed. Please choose another", true
+	}
+
+	return "", false
+}
+
+// formErrorMessage returns the message shown for `err` when a form is submitted: the one `messages`
+// gives for it, else that of the password policy, else the error itself.
+func formErrorMessage(err error, messages map[string]string) string {
+	if msg, ok := messages[err.Error()]; ok {
+		return msg
+	}
+
+	if msg, ok := passwordPolicyMessage(err.Error()); ok {
+		return msg
+	}
+
+	return err.Error()
+}
+
+// MePasswordPostHandler is called for the `/me/password` route, to which the user POSTs their
+// `current_password` and a new one as `password1` and `password2`. If `revoke_sessions` is set,
+// every other session is signed out. The user is emailed to say their password changed.
+func MePasswordPostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// A mistake in the form is shown on the account page, so it can be corrected.
+	retry := func(msg string) {
+		session.AddFlash(u.ID, msg)
+		http.Redirect(w, req, paths.Get.Me, http.StatusSeeOther)
+	}
+
+	password := req.FormValue("password1")
+	if password != req.FormValue("password2") {
+		retry("New passwords do not match")
+		return
+	}
+
+	changed, err := users.ChangePassword(u.ID, req.FormValue("current_password"), password)
+	if err != nil {
+		retry(formErrorMessage(err, passwordErrors))
+		return
+	}
+
+	msg := "Your password was changed."
+
+	if req.FormValue("revoke_sessions") != "" {
+		var sid string
+		if s := session.FromContext(req.Context()); s != nil {
+			sid = s.ID
+		}
+
+		n, err := session.DestroyOthers(u.ID, sid)
+		if err != nil {
+			log.Printf("Could not sign out other sessions of user %q: %s", u.ID, err)
+			msg = "Your password was changed, but your other sessions couldn't all be signed out."
+		} else {
+			sessions := "sessions were"
+			if n == 1 {
+				sessions = "session was"
+			}
+
+			msg = fmt.Sprintf("Your password was changed, and %d other %s signed out.", n, sessions)
+		}
+	}
+
+	// A reset link sent before the change would otherwise still let the old password be replaced.
+	if err := pwreset.DestroyByUser(u.ID); err != nil {
+		log.Printf("Could not withdraw password reset of user %q: %s", u.ID, err)
+	}
+
+	if err := mail.SendPasswordChanged(changed.Email); err != nil {
+		log.Printf("Could not email password change notice to user %q: %s", u.ID, err)
+	}
+
+	session.AddFlash(u.ID, msg)
+
+	http.Redirect(w, req, paths.Get.Me, http.StatusSeeOther)
+}
@@ -3,13 +3,23 @@ package routes
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"github.com/boatilus/peppercorn/db"
 	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/users"
 	"github.com/pressly/chi"
 )
 
-// SinglePatchHandler is the route called when a user submits a post edit.
+// SinglePatchHandler is the route called when a user submits a post edit. It responds with the
+// edited post, as described by PostsGetHandler.
 func SinglePatchHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
 	id := chi.URLParam(req, "num")
 	if len(id) == 0 {
 		http.Error(w, "len(id) == 0", http.StatusBadRequest)
@@ -29,13 +39,37 @@ func SinglePatchHandler(w http.ResponseWriter, req *http.Request) {
 
 	defer req.Body.Close()
 
-	if err := posts.Edit(id, data.Content); err != nil {
+	if err := posts.Edit(id, u.ID, data.Content); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	//w.Header().Set("Content-Type", "application/json")
-	//json.NewEncoder(w).Encode(struct{ Content string }{"hello"})
-	w.Write(nil)
+	// Respond with the edited post, so the client can show it as rendered here, references and all.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p, err := posts.GetByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	backlinks, err := posts.Backlinks([]db.CountType{p.Number})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	zs := []posts.Zip{zip(p, loc, time.Now())}
+	zs[0].Backlinks = backlinks[p.Number]
+
+	if err := loadAttachments(zs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, newJSONPost(&zs[0]))
 }
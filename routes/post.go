@@ -2,17 +2,21 @@ package routes
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/boatilus/peppercorn/attachments"
 	"github.com/boatilus/peppercorn/cookie"
 	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/drafts"
 	"github.com/boatilus/peppercorn/mail"
 	"github.com/boatilus/peppercorn/paths"
 	"github.com/boatilus/peppercorn/posts"
 	"github.com/boatilus/peppercorn/pwreset"
 	"github.com/boatilus/peppercorn/session"
 	"github.com/boatilus/peppercorn/templates"
+	"github.com/boatilus/peppercorn/throttle"
 	"github.com/boatilus/peppercorn/users"
 	"github.com/boatilus/peppercorn/utility"
 )
@@ -60,6 +64,19 @@ func SignInPostHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// The attempt is recorded before the email is looked up, so that an account is locked out the
+	// same whether or not it exists. It counts as failed unless the password is right.
+	attempt, wait, err := tryThrottled(req, throttle.SignIn, emails[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if wait > 0 {
+		http.Error(w, refuseAttempt(w, wait), http.StatusTooManyRequests)
+		return
+	}
+
 	u, err := users.GetByEmail(emails[0])
 	if err != nil {
 		http.Error(w, "Invalid credentials supplied", http.StatusUnauthorized)
@@ -71,7 +88,14 @@ func SignInPostHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	ip := req.RemoteAddr // chi's RealIP middleware should set this to the user's actual IP
+	recordSuccess(attempt)
+
+	if u.IsSuspended {
+		http.Error(w, "This account has been suspended", http.StatusForbidden)
+		return
+	}
+
+	ip := clientIP(req) // chi's RealIP middleware should set this to the user's actual IP
 	ua := req.Header.Get("User-Agent")
 
 	// We're ready to create the session and set the session cookie.
@@ -129,6 +153,21 @@ func ForgotPostHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Every request counts, as each may send an email, and it counts before the email is looked up,
+	// so that an account is locked out the same whether or not it exists.
+	_, wait, err := tryThrottled(req, throttle.Forgot, email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if wait > 0 {
+		msg := refuseAttempt(w, wait)
+		w.WriteHeader(http.StatusTooManyRequests)
+		templates.Forgot.Execute(w, Data{msg})
+		return
+	}
+
 	defaultMessage := fmt.Sprintf("An email was sent to %q if an account with that email address exists.", emails[0])
 
 	//session.AddFlash("", "An email was sent to %q if an account for it exists")
@@ -165,17 +204,36 @@ func MePostHandler(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
 	}
 
-	if err := req.ParseForm(); err != nil {
+	// The form is sent as a multipart form, so that it can carry a new avatar.
+	req.Body = http.MaxBytesReader(w, req.Body, attachments.MaxSize()+uploadOverhead)
+
+	if err := req.ParseMultipartForm(maxFormMemory); err != nil && err != http.ErrNotMultipart {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if req.MultipartForm != nil {
+		defer req.MultipartForm.RemoveAll()
+	}
+
 	// If there are no changes to make, skip DB update OP entirely.
 	modified := false
 
-	if avatar := req.Form["avatar"]; u.Avatar != avatar[0] {
+	// The avatar being replaced, if any, which is deleted once the change is saved.
+	oldAvatar := u.Avatar
+
+	avatar, err := formAvatar(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if avatar != "" {
 		modified = true
-		u.Avatar = avatar[0]
+		u.Avatar = avatar
+	} else if req.FormValue("remove_avatar") != "" && u.Avatar != "" {
+		modified = true
+		u.Avatar = ""
 	}
 
 	if name := req.Form["name"]; u.Name != name[0] {
@@ -198,7 +256,6 @@ func MePostHandler(w http.ResponseWriter, req *http.Request) {
 	// We need to coerce `ppp` into a uint64, then coerce that into a uint32.
 	var ppp32 db.CountType
 	var ppp64 int64
-	var err error
 
 	if len(ppp) == 1 {
 		ppp64, err = strconv.ParseInt(ppp[0], 10, 32)
@@ -221,15 +278,47 @@ func MePostHandler(w http.ResponseWriter, req *http.Request) {
 	}
 
 	if err := users.Update(u); err != nil {
+		if avatar != "" {
+			attachments.DeleteAvatar(avatar)
+		}
+
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if oldAvatar != "" && oldAvatar != u.Avatar {
+		if err := attachments.DeleteAvatar(oldAvatar); err != nil {
+			log.Printf("Could not delete avatar %q: %s", oldAvatar, err)
+		}
+	}
+
 	session.AddFlash(u.ID, "Changes saved")
 
 	http.Redirect(w, req, paths.Get.Me, http.StatusSeeOther)
 }
 
+// formAvatar makes an avatar of the file POSTed as the `avatar` field of multipart form `req`,
+// which must already be parsed, and returns its ID. It returns an empty ID if no file was chosen.
+func formAvatar(req *http.Request) (string, error) {
+	if req.MultipartForm == nil {
+		return "", nil
+	}
+
+	fhs := req.MultipartForm.File["avatar"]
+	if len(fhs) == 0 || (fhs[0].Filename == "" && fhs[0].Size == 0) {
+		return "", nil
+	}
+
+	f, err := fhs[0].Open()
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	return attachments.UploadAvatar(f)
+}
+
 // PostsPostHandler handles the form a user submits in creating a new post.
 func PostsPostHandler(w http.ResponseWriter, req *http.Request) {
 	u := users.FromContext(req.Context())
@@ -237,11 +326,19 @@ func PostsPostHandler(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
 	}
 
-	if err := req.ParseForm(); err != nil {
+	// Replies may come with files attached, in which case they're sent as a multipart form.
+	max := int64(attachments.MaxPerPost())*attachments.MaxSize() + uploadOverhead
+	req.Body = http.MaxBytesReader(w, req.Body, max)
+
+	if err := req.ParseMultipartForm(maxFormMemory); err != nil && err != http.ErrNotMultipart {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if req.MultipartForm != nil {
+		defer req.MultipartForm.RemoveAll()
+	}
+
 	r := req.Form["reply"]
 	if len(r) == 0 {
 		http.Error(w, "Post length cannot be 0", http.StatusBadRequest)
@@ -253,7 +350,12 @@ func PostsPostHandler(w http.ResponseWriter, req *http.Request) {
 
 	p, err := posts.New(u.ID, s)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if p.Attachments, err = formAttachments(req, u); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -263,6 +365,12 @@ func PostsPostHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// The reply's been posted, so its draft is no longer needed. Failing to delete it is no reason to
+	// fail the request.
+	if err := drafts.Delete(u.ID); err != nil {
+		log.Printf("Could not delete the draft of user %q: %s", u.ID, err)
+	}
+
 	http.Redirect(w, req, "/page/latest#bottom", http.StatusSeeOther)
 }
 
@@ -308,22 +416,20 @@ func ResetPasswordPostHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	u, err := users.GetByID(pwr.UserID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	hash, err := users.CreateHash(p1)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	if _, err := users.SetPassword(pwr.UserID, p1); err != nil {
+		msg, ok := passwordPolicyMessage(err.Error())
+		if !ok {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	u.Hash = hash
+		// The password breaks the policy, so the form's shown again for another to be chosen.
+		w.WriteHeader(http.StatusBadRequest)
+		templates.ResetPassword.Execute(w, struct {
+			FlashMessage string
+			Token        string
+		}{msg, token})
 
-	if err := users.Update(u); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/boatilus/peppercorn/attachments"
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/moderation"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/reactions"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// jsonPost describes a post to clients, both in the pages returned by PostsGetHandler and in the
+// events sent by PostsStreamGetHandler.
+type jsonPost struct {
+	ID         string       `json:"id"`
+	Number     db.CountType `json:"number"`
+	AuthorID   string       `json:"author_id"`
+	AuthorName string       `json:"author_name"`
+	Title      string       `json:"title"`
+	Content    string       `json:"content"`
+	HTML       string       `json:"html"` // The content, rendered from Markdown
+	Time       string       `json:"time"`
+	PrettyTime string       `json:"pretty_time"`
+	// Avatar and SmallAvatar are the paths to the author's avatar, and are empty if they have none.
+	Avatar      string `json:"avatar"`
+	SmallAvatar string `json:"small_avatar"`
+	// EditedAt and PrettyEditedAt are omitted if the post's never been edited.
+	EditedAt       string `json:"edited_at,omitempty"`
+	PrettyEditedAt string `json:"pretty_edited_at,omitempty"`
+	// References are the numbers of the posts this one refers to, and Backlinks those of the posts
+	// referring to it. Either is omitted if there are none.
+	References []db.CountType `json:"references,omitempty"`
+	Backlinks  []db.CountType `json:"backlinks,omitempty"`
+	// Reactions are omitted for posts loaded without them, such as those sent for edits.
+	Reactions []reactions.Summary `json:"reactions,omitempty"`
+	// Attachments are omitted if there are none.
+	Attachments []jsonAttachment `json:"attachments,omitempty"`
+	// Inactive is set only for the deactivated posts admins see, with who deactivated each and why,
+	// should an admin have done so.
+	Inactive           bool   `json:"inactive,omitempty"`
+	DeactivatedBy      string `json:"deactivated_by,omitempty"`
+	DeactivationReason string `json:"deactivation_reason,omitempty"`
+}
+
+func newJSONPost(z *posts.Zip) jsonPost {
+	p := jsonPost{
+		ID:          z.ID,
+		Number:      z.Count,
+		AuthorID:    z.AuthorID,
+		AuthorName:  z.AuthorName,
+		Title:       z.Title,
+		Avatar:      attachments.AvatarURL(z.Avatar),
+		SmallAvatar: attachments.SmallAvatarURL(z.Avatar),
+		Content:     z.Content,
+		HTML:        string(z.HTML),
+		Time:        utility.GetISO8601String(&z.Time),
+		PrettyTime:  z.PrettyTime,
+		References:  z.References,
+		Backlinks:   z.Backlinks,
+		Reactions:   z.Reactions,
+
+		Inactive:           !z.Active,
+		DeactivatedBy:      z.DeactivatedBy,
+		DeactivationReason: z.DeactivationReason,
+	}
+
+	if z.EditedAt != nil {
+		p.EditedAt = utility.GetISO8601String(z.EditedAt)
+		p.PrettyEditedAt = z.PrettyEditedAt
+	}
+
+	for i := range z.Attachments {
+		p.Attachments = append(p.Attachments, newJSONAttachment(&z.Attachments[i]))
+	}
+
+	return p
+}
+
+// zip merges `p` with its author's data from the user cache, giving its time in `loc`.
+func zip(p *posts.Post, loc *time.Location, now time.Time) posts.Zip {
+	u, _ := users.Users.Get(p.Author)
+	t := p.Time.In(loc)
+
+	z := posts.Zip{
+		ID:            p.ID,
+		Active:        p.Active,
+		AuthorID:      p.Author,
+		Content:       p.Content,
+		HTML:          posts.HTML(p),
+		Time:          t,
+		Avatar:        u.Avatar,
+		AuthorName:    u.Name,
+		Title:         u.Title,
+		Count:         p.Number,
+		PrettyTime:    utility.FormatTime(t, now),
+		References:    p.References,
+		AttachmentIDs: p.Attachments,
+	}
+
+	if p.EditedAt != nil {
+		edited := p.EditedAt.In(loc)
+
+		z.EditedAt = &edited
+		z.PrettyEditedAt = utility.FormatTime(edited, now)
+	}
+
+	return z
+}
+
+// loadPage loads the page of posts selected by `q`, with times given in `u`'s timezone, their
+// attachments, and the backlinks and reactions to each post as seen by `u`. Admins see inactive
+// posts in place, along with why they were deactivated. Pages are loaded through here whether
+// they're rendered or returned as JSON.
+func loadPage(u *users.User, q posts.Query) ([]posts.Zip, *posts.Page, error) {
+	// Load the user's timezone setting so we can provide correct post timestamps.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q.Inactive = u.IsAdmin
+
+	page, err := posts.GetPage(q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	numbers := make([]db.CountType, len(page.Posts))
+	ids := make([]string, len(page.Posts))
+	for i := range page.Posts {
+		numbers[i] = page.Posts[i].Number
+		ids[i] = page.Posts[i].ID
+	}
+
+	backlinks, err := posts.Backlinks(numbers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summaries, err := reactions.ForPosts(ids, u.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+
+	zs := make([]posts.Zip, len(page.Posts))
+	for i := range page.Posts {
+		zs[i] = zip(&page.Posts[i], loc, now)
+		zs[i].Backlinks = backlinks[zs[i].Count]
+		zs[i].Reactions = summaries[zs[i].ID]
+	}
+
+	if err := loadAttachments(zs); err != nil {
+		return nil, nil, err
+	}
+
+	if u.IsAdmin {
+		if err := loadDeactivations(zs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return zs, page, nil
+}
+
+// loadDeactivations sets who deactivated each inactive post of `zs` and why, where an admin did so.
+func loadDeactivations(zs []posts.Zip) error {
+	entries, err := moderation.Deactivations(zs)
+	if err != nil {
+		return err
+	}
+
+	for i := range zs {
+		e, ok := entries[zs[i].ID]
+		if !ok {
+			continue
+		}
+
+		moderator, _ := users.Users.Get(e.ModeratorID)
+
+		zs[i].DeactivatedBy = moderator.Name
+		zs[i].DeactivationReason = e.Reason
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/templates"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/pressly/chi"
+)
+
+// profilePost is a single post listed on a profile, with a link to its place in the thread.
+type profilePost struct {
+	Post posts.Zip
+	Link string
+}
+
+// UserGetHandler is called for the `/users/{name}` route and shows the user's profile: who they
+// are, when they joined and were last seen, and their posts, newest first. The posts are paged
+// by the viewer's posts-per-page setting, with the page in the `page` query parameter.
+func UserGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := users.GetByName(chi.URLParam(req, "name"))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	// Load the viewer's timezone setting so we can provide correct timestamps.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var data struct {
+		User       *users.User
+		Joined     string
+		LastSeen   string
+		PostCount  db.CountType
+		Posts      []profilePost
+		PageNum    db.CountType
+		TotalPages db.CountType
+	}
+
+	data.User = profile
+
+	now := time.Now()
+
+	if profile.Joined != nil {
+		data.Joined = utility.FormatTime(profile.Joined.In(loc), now)
+	}
+
+	if profile.LastSeen != nil {
+		data.LastSeen = utility.FormatTime(profile.LastSeen.In(loc), now)
+	}
+
+	data.PostCount, err = posts.CountByUser(profile.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data.PageNum = 1
+	if p := req.URL.Query().Get("page"); p != "" {
+		n, err := strconv.ParseInt(p, 10, 32)
+		if err != nil || n < 1 {
+			http.Error(w, fmt.Sprintf("Expected page %q to be a positive integer", p), http.StatusBadRequest)
+			return
+		}
+
+		data.PageNum = db.CountType(n)
+	}
+
+	data.TotalPages = utility.ComputePage(data.PostCount, u.PPP)
+
+	// Someone with no posts still has a first page to show, but there's no page past the last.
+	if data.PageNum > 1 && data.PageNum > data.TotalPages {
+		http.NotFound(w, req)
+		return
+	}
+
+	ps, err := posts.ByUser(profile.ID, data.PageNum, u.PPP)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range ps {
+		p := &ps[i]
+
+		data.Posts = append(data.Posts, profilePost{
+			Post: zip(p, loc, now),
+			Link: fmt.Sprintf("/posts/%d/jump", p.Number),
+		})
+	}
+
+	templates.Profile.Execute(w, data)
+}
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/reactions"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/pressly/chi"
+)
+
+// ReactionsPostHandler is called for POST requests to the `/posts/{id}/reactions` route, and adds
+// the reaction given by the `reaction` field of the JSON body to the post. It responds with the
+// post's reactions, as summarized for the user.
+func ReactionsPostHandler(w http.ResponseWriter, req *http.Request) {
+	changeReaction(w, req, reactions.Add)
+}
+
+// ReactionsDeleteHandler is called for DELETE requests to the `/posts/{id}/reactions` route, and
+// removes the user's reaction given by the `reaction` field of the JSON body from the post. It
+// responds as ReactionsPostHandler does.
+func ReactionsDeleteHandler(w http.ResponseWriter, req *http.Request) {
+	changeReaction(w, req, reactions.Remove)
+}
+
+// changeReaction makes the change to the user's reactions requested by `req` through `change`.
+func changeReaction(w http.ResponseWriter, req *http.Request, change func(postID string, userID string, reaction string) error) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// As with SingleRemoveGetHandler, the param is named "num" but holds a post ID.
+	id := chi.URLParam(req, "num")
+
+	var data struct {
+		Reaction string `json:"reaction"`
+	}
+
+	defer req.Body.Close()
+
+	if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, err := posts.GetByID(id)
+	if err != nil || !p.Active {
+		http.NotFound(w, req)
+		return
+	}
+
+	if err := change(p.ID, u.ID, data.Reaction); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summaries, err := reactions.ForPosts([]string{p.ID}, u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, struct {
+		Reactions []reactions.Summary `json:"reactions"`
+	}{summaries[p.ID]})
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/pressly/chi"
+)
+
+// jsonVersion describes a version of a post to clients.
+type jsonVersion struct {
+	Number     int    `json:"number"`
+	EditorID   string `json:"editor_id"`
+	EditorName string `json:"editor_name"`
+	Content    string `json:"content"`
+	Time       string `json:"time"`
+	PrettyTime string `json:"pretty_time"`
+}
+
+// jsonDiffLine describes a line of a diff to clients. `op` is one of "unchanged", "added" or
+// "removed".
+type jsonDiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// RevisionsGetHandler is called for the `/posts/{id}/revisions` route and returns every version of
+// a post as JSON, from the post as it was submitted through to its current content.
+func RevisionsGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// As with SingleRemoveGetHandler, the param is named "num" but holds a post ID.
+	id := chi.URLParam(req, "num")
+
+	vs, err := posts.History(id)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	// Load the user's timezone setting so we can provide correct timestamps.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+
+	data := struct {
+		Versions []jsonVersion `json:"versions"`
+	}{make([]jsonVersion, len(vs))}
+
+	for i, v := range vs {
+		editor, _ := users.Users.Get(v.EditorID)
+		t := v.Time.In(loc)
+
+		data.Versions[i] = jsonVersion{
+			Number:     v.Number,
+			EditorID:   v.EditorID,
+			EditorName: editor.Name,
+			Content:    v.Content,
+			Time:       utility.GetISO8601String(&t),
+			PrettyTime: utility.FormatTime(t, now),
+		}
+	}
+
+	writeJSON(w, data)
+}
+
+// RevisionsDiffGetHandler is called for the `/posts/{id}/revisions/diff` route and returns the
+// line-by-line differences between the versions of a post numbered by the `from` and `to` query
+// parameters, as JSON.
+func RevisionsDiffGetHandler(w http.ResponseWriter, req *http.Request) {
+	id := chi.URLParam(req, "num")
+
+	params := req.URL.Query()
+
+	from, err := strconv.Atoi(params.Get("from"))
+	if err != nil {
+		http.Error(w, "routes: from must be a version number", http.StatusBadRequest)
+		return
+	}
+
+	to, err := strconv.Atoi(params.Get("to"))
+	if err != nil {
+		http.Error(w, "routes: to must be a version number", http.StatusBadRequest)
+		return
+	}
+
+	lines, err := posts.Diff(id, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	data := struct {
+		From  int            `json:"from"`
+		To    int            `json:"to"`
+		Lines []jsonDiffLine `json:"lines"`
+	}{from, to, make([]jsonDiffLine, len(lines))}
+
+	for i, l := range lines {
+		data.Lines[i] = jsonDiffLine{Op: l.Op.String(), Text: l.Text}
+	}
+
+	writeJSON(w, data)
+}
+
+// writeJSON writes `v` to `w` as JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("routes: writing JSON response: %s", err)
+	}
+}
@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/templates"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// searchLimit is the greatest number of results shown for a search.
+const searchLimit = 50
+
+// searchResult is a single post found by a search, with a link to it on the page it's seen on.
+type searchResult struct {
+	Post posts.Zip
+	Link string
+}
+
+// SearchGetHandler is called for the `/search` route and lists the newest posts matching the search
+// given by the `q` query parameter, each linking to the page on which it's seen.
+func SearchGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	var data struct {
+		Query    string
+		Flash    string
+		Searched bool
+		Total    int
+		Results  []searchResult
+	}
+
+	data.Query = req.URL.Query().Get("q")
+
+	if data.Query == "" {
+		templates.Search.Execute(w, data)
+		return
+	}
+
+	// Load the user's timezone setting so we can interpret dates and provide correct timestamps.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	q, err := posts.ParseSearch(data.Query, loc)
+	if err != nil {
+		data.Flash = err.Error()
+		templates.Search.Execute(w, data)
+		return
+	}
+
+	if q.AuthorName != "" {
+		author, err := users.GetByName(q.AuthorName)
+		if err != nil {
+			data.Flash = err.Error()
+			templates.Search.Execute(w, data)
+			return
+		}
+
+		q.Author = author.ID
+	}
+
+	found, err := posts.Search(q, searchLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data.Searched = true
+	data.Total = found.Total
+
+	now := time.Now()
+
+	for i := range found.Posts {
+		p := &found.Posts[i]
+
+		n, err := posts.GetOffset(p.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		link := fmt.Sprintf("/page/%d#%s", utility.ComputePage(n, u.PPP), p.ID)
+
+		data.Results = append(data.Results, searchResult{Post: zip(p, loc, now), Link: link})
+	}
+
+	templates.Search.Execute(w, data)
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/reactions"
+	"github.com/boatilus/peppercorn/users"
+)
+
+// streamKeepAlive is how often PostsStreamGetHandler writes a comment to an idle stream, so that
+// proxies don't close the connection.
+const streamKeepAlive = 30 * time.Second
+
+// streamEvents maps each kind of change to the name of the event sent for it.
+var streamEvents = map[posts.ChangeType]string{
+	posts.Created:     "new",
+	posts.Edited:      "edit",
+	posts.Deactivated: "deactivate",
+}
+
+// PostsStreamGetHandler is called for the `/posts/stream` route and streams changes to posts as
+// Server-Sent Events: `new` when a post is submitted or restored, `edit` when one's edited and
+// `deactivate` when one's removed. Each event's data is a JSON object describing the post.
+func PostsStreamGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "routes: streaming is unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Load the user's timezone setting so we can provide correct post timestamps.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	changes, unsubscribe := posts.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Ask nginx not to buffer the stream, should we be behind it.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case c, ok := <-changes:
+			if !ok {
+				return
+			}
+
+			if err := writeChange(w, c, u, loc); err != nil {
+				log.Printf("routes: writing change to post %q to stream: %s", c.Post.ID, err)
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+// writeChange writes `c` to `w` as a single event for `u`, with times given in `loc`. New posts
+// are sent with their reactions, as a restored post may already have some.
+func writeChange(w io.Writer, c posts.Change, u *users.User, loc *time.Location) error {
+	z := zip(&c.Post, loc, time.Now())
+
+	if c.Type == posts.Created {
+		summaries, err := reactions.ForPosts([]string{c.Post.ID}, u.ID)
+		if err != nil {
+			return err
+		}
+
+		z.Reactions = summaries[c.Post.ID]
+	}
+
+	zs := []posts.Zip{z}
+	if err := loadAttachments(zs); err != nil {
+		return err
+	}
+
+	z = zs[0]
+
+	b, err := json.Marshal(newJSONPost(&z))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", streamEvents[c.Type], b)
+
+	return err
+}
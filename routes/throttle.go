@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boatilus/peppercorn/paths"
+	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/templates"
+	"github.com/boatilus/peppercorn/throttle"
+	"github.com/boatilus/peppercorn/users"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// recentAttemptsLimit is the most failed attempts listed on the locks page.
+const recentAttemptsLimit = 100
+
+// throttleNouns describes each throttle.Action, for the locks page.
+var throttleNouns = map[throttle.Action]string{
+	throttle.SignIn: "Signing in",
+	throttle.Code:   "Two-factor codes",
+	throttle.Forgot: "Password resets",
+}
+
+// clientIP returns the address the request came from. chi's RealIP middleware puts the address
+// given by a proxy in RemoteAddr as it is, while otherwise it's the peer's, with a port.
+func clientIP(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+
+	return req.RemoteAddr
+}
+
+// waitMessage returns a message asking to wait `d` before trying again, in whole minutes.
+func waitMessage(d time.Duration) string {
+	minutes := int(math.Ceil(d.Minutes()))
+
+	unit := "minutes"
+	if minutes == 1 {
+		unit = "minute"
+	}
+
+	return fmt.Sprintf("Too many attempts. Please wait %d %s before trying again.", minutes, unit)
+}
+
+// tryThrottled records an attempt at `action` on `account` from the address of `req`, returning it
+// and how long is left before it can be made. Unless that's zero, the attempt is nil and must not
+// be made. Otherwise, it counts as failed unless passed to recordSuccess.
+func tryThrottled(req *http.Request, action throttle.Action, account string) (*throttle.Attempt, time.Duration, error) {
+	return throttle.Try(action, account, clientIP(req))
+}
+
+// refuseAttempt sets the Retry-After header to `wait`, returning the message to show. The caller
+// responds with a 429 Too Many Requests status.
+func refuseAttempt(w http.ResponseWriter, wait time.Duration) string {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+	return waitMessage(wait)
+}
+
+// recordSuccess withdraws `a`, which succeeded, and forgets the failed attempts on its account.
+// Failing to do so is no reason to fail the request.
+func recordSuccess(a *throttle.Attempt) {
+	if err := throttle.Succeed(a); err != nil {
+		log.Printf("Could not clear failed attempts at %s on %q: %s", a.Action, a.Account, err)
+	}
+}
+
+// lockItem is a lock as shown on the locks page.
+type lockItem struct {
+	Noun       string
+	Account    string
+	IP         string
+	Failures   int
+	Until      string
+	LastPretty string
+}
+
+// attemptItem is a failed attempt as shown on the locks page.
+type attemptItem struct {
+	Noun       string
+	Account    string
+	IP         string
+	Time       time.Time
+	PrettyTime string
+}
+
+// AdminLocksGetHandler is called for the `/admin/locks` route and lists the accounts and addresses
+// locked out after too many failed attempts, with a form to clear each, and the latest failed
+// attempts. It's seen only by admins.
+func AdminLocksGetHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	// Load the user's timezone setting so we can provide correct timestamps.
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ls, err := throttle.Locks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	as, err := throttle.Recent(recentAttemptsLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Flash    string
+		Locks    []lockItem
+		Attempts []attemptItem
+	}{
+		Flash: session.GetFlash(u.ID),
+	}
+
+	now := time.Now()
+
+	for _, l := range ls {
+		data.Locks = append(data.Locks, lockItem{
+			Noun:       throttleNouns[l.Action],
+			Account:    l.Account,
+			IP:         l.IP,
+			Failures:   l.Failures,
+			Until:      l.Until.In(loc).Format("Jan 2, 3:04 PM"),
+			LastPretty: utility.FormatTime(l.Last.In(loc), now),
+		})
+	}
+
+	for _, a := range as {
+		data.Attempts = append(data.Attempts, attemptItem{
+			Noun:       throttleNouns[a.Action],
+			Account:    a.Account,
+			IP:         a.IP,
+			Time:       a.Created.In(loc),
+			PrettyTime: utility.FormatTime(a.Created.In(loc), now),
+		})
+	}
+
+	templates.AdminLocks.Execute(w, data)
+}
+
+// AdminLocksClearPostHandler is called for the `/admin/locks/clear` route and forgets the failed
+// attempts on the `account` form value or, failing that, from the `ip` form value, lifting any lock
+// on it.
+func AdminLocksClearPostHandler(w http.ResponseWriter, req *http.Request) {
+	u := users.FromContext(req.Context())
+	if u == nil {
+		http.Error(w, "Could not read user data from request context", http.StatusInternalServerError)
+		return
+	}
+
+	var cleared string
+	var err error
+
+	if account := strings.TrimSpace(req.FormValue("account")); account != "" {
+		cleared, err = account, throttle.ClearAccount(account)
+	} else if ip := strings.TrimSpace(req.FormValue("ip")); ip != "" {
+		cleared, err = ip, throttle.ClearIP(ip)
+	} else {
+		http.Error(w, "No account or address supplied", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %q [%s] cleared the failed attempts of %q", u.ID, u.Name, cleared)
+
+	session.AddFlash(u.ID, fmt.Sprintf("Failed attempts for %s were cleared.", cleared))
+
+	http.Redirect(w, req, paths.Get.AdminLocks, http.StatusSeeOther)
+}
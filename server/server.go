@@ -15,10 +15,11 @@ import (
 func Start(handler http.Handler) error {
 	useTLS := viper.GetBool("use_tls")
 
+	// There's no WriteTimeout, as it would cut off the post stream, whose responses are long-lived.
+	// Other routes are bounded by the router's Timeout middleware instead.
 	s := http.Server{
-		Handler:      handler,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		Handler:     handler,
+		ReadTimeout: 30 * time.Second,
 	}
 
 	if useTLS {
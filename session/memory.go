@@ -0,0 +1,174 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// memoryStore is a Store that keeps all sessions in process memory. Nothing is persisted, so it's
+// useful only for development and tests.
+type memoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{sessions: make(map[string]Session)}
+}
+
+// byUser returns all of a user's sessions, newest first. The caller must hold the lock.
+func (s *memoryStore) byUser(userID string) []Session {
+	var ss []Session
+
+	for _, e := range s.sessions {
+		if e.UserID == userID {
+			ss = append(ss, e)
+		}
+	}
+
+	sort.Sort(newestFirst(ss))
+
+	return ss
+}
+
+// newestFirst sorts sessions by timestamp in descending order.
+type newestFirst []Session
+
+func (ss newestFirst) Len() int           { return len(ss) }
+func (ss newestFirst) Swap(i, j int)      { ss[i], ss[j] = ss[j], ss[i] }
+func (ss newestFirst) Less(i, j int) bool { return ss[i].Timestamp.After(ss[j].Timestamp) }
+
+func (s *memoryStore) Insert(e *Session) (string, error) {
+	if e == nil {
+		return "", errors.New("Cannot insert nil session")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *e
+	if cp.ID == "" {
+		cp.ID = utility.GenerateUUID()
+	}
+
+	if _, ok := s.sessions[cp.ID]; ok {
+		return "", fmt.Errorf("A session already exists with SID %q", cp.ID)
+	}
+
+	s.sessions[cp.ID] = cp
+
+	return cp.ID, nil
+}
+
+func (s *memoryStore) All() ([]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ss := make([]Session, 0, len(s.sessions))
+	for _, e := range s.sessions {
+		ss = append(ss, e)
+	}
+
+	sort.Sort(sort.Reverse(newestFirst(ss)))
+
+	return ss, nil
+}
+
+func (s *memoryStore) Get(sid string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.sessions[sid]
+	if !ok {
+		return nil, nil
+	}
+
+	return &e, nil
+}
+
+func (s *memoryStore) GetByUser(userID string, from time.Time, to time.Time) ([]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ss []Session
+
+	for _, e := range s.byUser(userID) {
+		if !e.Timestamp.Before(from) && e.Timestamp.Before(to) {
+			ss = append(ss, e)
+		}
+	}
+
+	return ss, nil
+}
+
+func (s *memoryStore) GetByIndex(userID string, index db.CountType) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ss := s.byUser(userID)
+	if index < 0 || int(index) >= len(ss) {
+		return nil, nil
+	}
+
+	return &ss[index], nil
+}
+
+func (s *memoryStore) Delete(sid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[sid]; !ok {
+		return fmt.Errorf("No session to delete with SID %q", sid)
+	}
+
+	delete(s.sessions, sid)
+
+	return nil
+}
+
+func (s *memoryStore) DeleteByIndex(userID string, index db.CountType) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss := s.byUser(userID)
+	if index < 0 || int(index) >= len(ss) {
+		return fmt.Errorf("Failed to delete session for user %q at index %d", userID, index)
+	}
+
+	delete(s.sessions, ss[index].ID)
+
+	return nil
+}
+
+func (s *memoryStore) DeleteByUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sid, e := range s.sessions {
+		if e.UserID == userID {
+			delete(s.sessions, sid)
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Update(e *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[e.ID]; !ok {
+		return fmt.Errorf("session: failed to update session with SID %q", e.ID)
+	}
+
+	s.sessions[e.ID] = *e
+
+	return nil
+}
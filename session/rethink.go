@@ -0,0 +1,201 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by GetTable.
+type rethinkStore struct{}
+
+func (rethinkStore) Insert(s *Session) (string, error) {
+	if !db.Session.IsConnected() {
+		return "", errors.New("RethinkDB session not connected")
+	}
+
+	res, err := db.Get().Table(GetTable()).Insert(s).RunWrite(db.Session)
+	if err != nil {
+		return "", err
+	}
+
+	// RethinkDB only generates a key if the session didn't already have an ID.
+	if s.ID != "" {
+		return s.ID, nil
+	}
+
+	return res.GeneratedKeys[0], nil
+}
+
+func (rethinkStore) All() ([]Session, error) {
+	if !db.Session.IsConnected() {
+		return nil, errors.New("RethinkDB session not connected")
+	}
+
+	// Ordering a whole table without an index is limited to 100,000 documents, so sort here instead.
+	cursor, err := db.Get().Table(GetTable()).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var ss []Session
+	if err = cursor.All(&ss); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(sort.Reverse(newestFirst(ss)))
+
+	return ss, nil
+}
+
+func (rethinkStore) Get(sid string) (*Session, error) {
+	if !db.Session.IsConnected() {
+		return nil, errors.New("RethinkDB session not connected")
+	}
+
+	cursor, err := db.Get().Table(GetTable()).Get(sid).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var s Session
+	if err := cursor.One(&s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (rethinkStore) GetByUser(userID string, from time.Time, to time.Time) ([]Session, error) {
+	if !db.Session.IsConnected() {
+		return nil, errors.New("RethinkDB session not connected")
+	}
+
+	table := db.Get().Table(GetTable())
+
+	t := table.GetAllByIndex("user_id", userID).Filter(func(row rethink.Term) rethink.Term {
+		return row.Field("timestamp").During(from, to)
+	}).OrderBy(rethink.Desc("timestamp"))
+
+	cursor, err := t.Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var ss []Session
+	if err = cursor.All(&ss); err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+func (rethinkStore) GetByIndex(userID string, index db.CountType) (*Session, error) {
+	t := db.Get().Table(GetTable()).GetAllByIndex("user_id", userID).OrderBy(rethink.Desc("timestamp")).Nth(index)
+
+	cursor, err := t.Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var s Session
+	if err = cursor.One(&s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (rethinkStore) Delete(sid string) error {
+	if !db.Session.IsConnected() {
+		return errors.New("RethinkDB session not connected")
+	}
+
+	res, err := db.Get().Table(GetTable()).Get(sid).Delete().RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted != 1 {
+		return fmt.Errorf("No session to delete with SID %q", sid)
+	}
+
+	return nil
+}
+
+func (rethinkStore) DeleteByIndex(userID string, index db.CountType) error {
+	if !db.Session.IsConnected() {
+		return errors.New("RethinkDB session not connected")
+	}
+
+	t := db.Get().Table(GetTable()).GetAllByIndex("user_id", userID).OrderBy(rethink.Desc("timestamp")).Nth(index).Delete()
+
+	res, err := t.RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted != 1 {
+		return fmt.Errorf("Failed to delete session for user %q at index %d", userID, index)
+	}
+
+	return nil
+}
+
+func (rethinkStore) DeleteByUser(userID string) error {
+	if !db.Session.IsConnected() {
+		return errors.New("RethinkDB session not connected")
+	}
+
+	_, err := db.Get().Table(GetTable()).GetAllByIndex("user_id", userID).Delete().RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) Update(s *Session) error {
+	if !db.Session.IsConnected() {
+		return errors.New("session: RethinkDB session not connected")
+	}
+
+	res, err := db.Get().Table(GetTable()).Get(s.ID).Update(s).RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Skipped == 1 {
+		log.Printf("session: no changes made to session with SID %q", s.ID)
+
+		return nil
+	}
+
+	if res.Replaced != 1 {
+		return fmt.Errorf("session: failed to update session with SID %q", s.ID)
+	}
+
+	return nil
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/boatilus/peppercorn/db"
 	"github.com/boatilus/peppercorn/users"
 	"github.com/spf13/viper"
-	rethink "gopkg.in/dancannon/gorethink.v2"
 )
 
 // Session maintains a session key (the RethinkDB ID), the user's IP address and the user agent for
@@ -47,10 +46,6 @@ func GetTable() string {
 // the current time in the Timestamp field and inserts it into the sessions table. The return value
 // is the ID of the session document in the DB. Returns a blank string and an error on any failure.
 func Create(user *users.User, ip string, userAgent string) (string, error) {
-	if !db.Session.IsConnected() {
-		return "", errors.New("RethinkDB session not connected")
-	}
-
 	log.Printf("Creating session for user %q [%s]..", user.ID, ip)
 
 	// We'll set the expiration time of the multi-factor session to the user's desired authentication
@@ -66,14 +61,14 @@ func Create(user *users.User, ip string, userAgent string) (string, error) {
 		MFAExpiresAt: now.Add(mfaExpires),
 	}
 
-	res, err := db.Get().Table(GetTable()).Insert(&s).RunWrite(db.Session)
+	id, err := store.Insert(&s)
 	if err != nil {
 		return "", err
 	}
 
 	log.Printf("Session for user %q created at %s", user.ID, s.Timestamp)
 
-	return res.GeneratedKeys[0], nil
+	return id, nil
 }
 
 // HasMFAExpired returns true if the MFA expiration time has exceeded the current time and false
@@ -90,27 +85,16 @@ func (s *Session) HasMFAExpired() bool {
 // Get queries the DB for a session with a given SID and returns it. Returns nil and an error
 // on failure.
 func Get(sid string) (*Session, error) {
-	if !db.Session.IsConnected() {
-		return nil, errors.New("RethinkDB session not connected")
-	}
-
-	cursor, err := db.Get().Table(GetTable()).Get(sid).Run(db.Session)
+	s, err := store.Get(sid)
 	if err != nil {
 		return nil, err
 	}
 
-	defer cursor.Close()
-
-	if cursor.IsNil() {
+	if s == nil {
 		return nil, fmt.Errorf("No session exists with SID %q", sid)
 	}
 
-	var s Session
-	if err := cursor.One(&s); err != nil {
-		return nil, err
-	}
-
-	return &s, nil
+	return s, nil
 }
 
 // GetByUser queries the DB for any valid, unexpired sessions for a given user and returns them,
@@ -119,10 +103,6 @@ func Get(sid string) (*Session, error) {
 //
 // TODO: Consider paginating results?
 func GetByUser(userID string) ([]Session, error) {
-	if !db.Session.IsConnected() {
-		return nil, errors.New("RethinkDB session not connected")
-	}
-
 	log.Printf("Retrieving sessions for user %q..", userID)
 
 	maxAge := viper.GetInt("cookie.max_age")
@@ -133,28 +113,15 @@ func GetByUser(userID string) ([]Session, error) {
 	from := time.Now().UTC().Add(-(time.Duration(maxAge) * time.Second))
 	to := time.Now().UTC()
 
-	table := db.Get().Table(GetTable())
-
-	t := table.GetAllByIndex("user_id", userID).Filter(func(row rethink.Term) rethink.Term {
-		return row.Field("timestamp").During(from, to)
-	}).OrderBy(rethink.Desc("timestamp"))
-
-	cursor, err := t.Run(db.Session)
+	ss, err := store.GetByUser(userID, from, to)
 	if err != nil {
 		return nil, err
 	}
 
-	defer cursor.Close()
-
-	if cursor.IsNil() {
+	if len(ss) == 0 {
 		return nil, fmt.Errorf("No session(s) exist for user %q", userID)
 	}
 
-	var ss []Session
-	if err = cursor.All(&ss); err != nil {
-		return nil, err
-	}
-
 	log.Printf("Retrieved %v session(s) for user %q", len(ss), userID)
 
 	return ss, nil
@@ -165,70 +132,76 @@ func GetByUser(userID string) ([]Session, error) {
 func GetByIndex(userID string, index db.CountType) (*Session, error) {
 	log.Printf("Retrieving session for user %q at index %d..", userID, index)
 
-	t := db.Get().Table(GetTable()).GetAllByIndex("user_id", userID).OrderBy(rethink.Desc("timestamp")).Nth(index)
-
-	cursor, err := t.Run(db.Session)
+	s, err := store.GetByIndex(userID, index)
 	if err != nil {
 		return nil, err
 	}
 
-	defer cursor.Close()
-
-	if cursor.IsNil() {
+	if s == nil {
 		return nil, fmt.Errorf("No session(s) exist for user %q", userID)
 	}
 
-	var s Session
-	if err = cursor.One(&s); err != nil {
-		return nil, err
-	}
-
 	log.Printf("Retrieved session %q for user %q", s, userID)
 
-	return &s, nil
+	return s, nil
 }
 
 // Destroy removes a session from the database, thereby preventing a user from accessing that
 // session. Returns nil on success; an error on failure.
 func Destroy(sid string) error {
-	if !db.Session.IsConnected() {
-		return errors.New("RethinkDB session not connected")
-	}
-
 	log.Printf("Destroying session %q..", sid)
 
-	res, err := db.Get().Table(GetTable()).Get(sid).Delete().RunWrite(db.Session)
-	if err != nil {
-		return err
-	}
-
-	if res.Deleted != 1 {
-		return fmt.Errorf("No session to delete with SID %q", sid)
-	}
-
-	return nil
+	return store.Delete(sid)
 }
 
 // DestroyByIndex deletes a session from the database for a given user, given its index.
 func DestroyByIndex(userID string, index db.CountType) error {
-	if !db.Session.IsConnected() {
-		return errors.New("RethinkDB session not connected")
+	log.Printf("Destroy session for user %q at index %d..", userID, index)
+
+	return store.DeleteByIndex(userID, index)
+}
+
+// DestroyAll deletes every session of the user with `userID`, signing them out everywhere.
+func DestroyAll(userID string) error {
+	if len(userID) == 0 {
+		return errors.New("session: user ID cannot be empty")
 	}
 
-	log.Printf("Destroy session for user %q at index %d..", userID, index)
+	log.Printf("Destroying all sessions for user %q..", userID)
+
+	return store.DeleteByUser(userID)
+}
 
-	t := db.Get().Table(GetTable()).GetAllByIndex("user_id", userID).OrderBy(rethink.Desc("timestamp")).Nth(index).Delete()
+// DestroyOthers deletes every session of the user with `userID` but the one with `sid`, signing
+// them out everywhere else, and returns how many were deleted.
+func DestroyOthers(userID string, sid string) (int, error) {
+	if len(userID) == 0 {
+		return 0, errors.New("session: user ID cannot be empty")
+	}
+
+	log.Printf("Destroying other sessions for user %q..", userID)
 
-	res, err := t.RunWrite(db.Session)
+	// GetByUser errs when there are no sessions, in which case there are none to destroy.
+	ss, err := GetByUser(userID)
 	if err != nil {
-		return err
+		return 0, nil
 	}
 
-	if res.Deleted != 1 {
-		return fmt.Errorf("Failed to delete session for user %q at index %d", userID, index)
+	n := 0
+
+	for _, s := range ss {
+		if s.ID == sid {
+			continue
+		}
+
+		if err := store.Delete(s.ID); err != nil {
+			return n, err
+		}
+
+		n++
 	}
 
-	return nil
+	return n, nil
 }
 
 // IsAuthenticated queries the session table for a valid session matching the ID stored as the
@@ -236,57 +209,48 @@ func DestroyByIndex(userID string, index db.CountType) error {
 // authenticated, and an error. The boolean is false if unauthenticated, and the error is non-nil
 // if there was some issue talking to the DB (or, perhaps, because the user no longer exists)
 func IsAuthenticated(sid string) (authenticated bool, userID string, err error) {
-	if !db.Session.IsConnected() {
-		return false, "", errors.New("RethinkDB session not connected")
-	}
-
 	log.Printf("Authenticating SID %q..", sid)
 
 	// If there's a document in the DB for this ID, the session must be good. We'll pull the document
-	// from the cursor and get the user ID
-	cursor, err := db.Get().Table(GetTable()).Get(sid).Run(db.Session)
+	// and get the user ID
+	s, err := store.Get(sid)
 	if err != nil {
 		return false, "", err
 	}
 
-	defer cursor.Close()
-
-	if cursor.IsNil() {
+	if s == nil {
 		return false, "", nil
 	}
 
-	var s Session
-	if err := cursor.One(&s); err != nil {
-		return false, "", err
-	}
-
 	log.Printf("Session for user %q authenticated", s.UserID)
 
 	// If the record was found, the session is good, as we remove invalid sessions from the DB
 	return true, s.UserID, nil
 }
 
-// Update accepts a session with (potentially) modified values and updates the record in the DB.
-func Update(s *Session) error {
-	if !db.Session.IsConnected() {
-		return errors.New("session: RethinkDB session not connected")
-	}
-
-	log.Printf("session: updating session with SID %q..", s.ID)
+// All returns every session, oldest first.
+func All() ([]Session, error) {
+	return store.All()
+}
 
-	res, err := db.Get().Table(GetTable()).Get(s.ID).Update(s).RunWrite(db.Session)
-	if err != nil {
-		return err
+// Restore inserts a session exactly as given, keeping its ID. It's intended for restoring sessions
+// from an archive.
+func Restore(s *Session) error {
+	if s == nil || s.ID == "" {
+		return errors.New("session: cannot restore a session without an ID")
 	}
 
-	if res.Skipped == 1 {
-		log.Printf("session: no changes made to session with SID %q", s.ID)
+	_, err := store.Insert(s)
 
-		return nil
-	}
+	return err
+}
+
+// Update accepts a session with (potentially) modified values and updates the record in the DB.
+func Update(s *Session) error {
+	log.Printf("session: updating session with SID %q..", s.ID)
 
-	if res.Replaced != 1 {
-		return fmt.Errorf("session: failed to update session with SID %q", s.ID)
+	if err := store.Update(s); err != nil {
+		return err
 	}
 
 	log.Printf("session: updated session with SID %q", s.ID)
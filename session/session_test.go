@@ -6,11 +6,10 @@ import (
 	"testing"
 	"time"
 
-	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/db/dbtest"
 	"github.com/boatilus/peppercorn/users"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
-	rethink "gopkg.in/dancannon/gorethink.v2"
 )
 
 const tableName = "sessions_test"
@@ -23,63 +22,43 @@ func init() {
 	viper.Set("db.sessions_table", tableName)
 	viper.Set("session_key", sKey)
 
-	var err error
-
-	if db.Session, err = rethink.Connect(rethink.ConnectOpts{Address: "localhost:28015"}); err != nil {
-		panic(err)
-	}
-
 	log.SetOutput(ioutil.Discard)
-	setupDB()
-}
 
-func setupDB() {
-	if !db.Session.IsConnected() {
-		panic("No DB connected")
+	switch backend, conn := dbtest.Setup("session", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
 	}
 
-	rethink.DBCreate("peppercorn").Run(db.Session)
-
-	peppercorn := rethink.DB("peppercorn")
-
-	// Due to a lack of mocking in gorethink, we'll tear down the test data and repopulate on each
-	// run of the tests
-	peppercorn.TableDrop(tableName).Run(db.Session)
-	if _, err := peppercorn.TableCreate(tableName).Run(db.Session); err != nil {
-		panic(err)
-	}
+	insertSessions()
+}
 
-	table := peppercorn.Table(tableName)
+// insertSessions inserts the test sessions through the current store.
+func insertSessions() {
+	sessions = makeSessions()
+	validKeys = make([]string, len(sessions))
 
-	// Create indices on "user_id" and "timestamp" fields
-	if _, err := table.IndexCreate("user_id").RunWrite(db.Session); err != nil {
-		panic(err)
-	}
+	for i := range sessions {
+		id, err := store.Insert(&sessions[i])
+		if err != nil {
+			panic(err)
+		}
 
-	if _, err := table.IndexCreate("timestamp").RunWrite(db.Session); err != nil {
-		panic(err)
+		validKeys[i] = id
 	}
+}
 
-	table.IndexWait().RunWrite(db.Session)
-
+func makeSessions() []Session {
 	now := time.Now().UTC()
 
-	sessions = []Session{
+	return []Session{
 		{UserID: "user1", IP: "108.213.25.224", UserAgent: "UA", Timestamp: now},
 		{UserID: "user1", IP: "39.391.49.193", UserAgent: "UA2", Timestamp: now.Add(-4 * time.Hour)},
 		{UserID: "user2", IP: "193.31.49.118", UserAgent: "UA3", Timestamp: now},
 	}
-
-	res, err := peppercorn.Table(tableName).Insert(&sessions).RunWrite(db.Session)
-	if err != nil {
-		panic(err)
-	}
-
-	validKeys = make([]string, 3)
-
-	for i := range res.GeneratedKeys {
-		validKeys[i] = res.GeneratedKeys[i]
-	}
 }
 
 func TestGetKey(t *testing.T) {
@@ -194,6 +173,71 @@ func TestDestoyByIndex(t *testing.T) {
 	assert.NoError(err)
 }
 
+func TestDestroyAll(t *testing.T) {
+	assert := assert.New(t)
+
+	u := &users.User{ID: "destroy-all"}
+	other := &users.User{ID: "destroy-all-other"}
+
+	for _, e := range []*users.User{u, u, other} {
+		if _, err := Create(e, "108.213.25.224", "UA"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert.Error(DestroyAll(""))
+	assert.NoError(DestroyAll(u.ID))
+	assert.NoError(DestroyAll(u.ID), "destroying no sessions shouldn't fail")
+
+	_, err := GetByUser(u.ID)
+	assert.Error(err, "every session of the user should be gone")
+
+	ss, err := GetByUser(other.ID)
+	if assert.NoError(err) {
+		assert.Len(ss, 1, "other users' sessions should be kept")
+	}
+}
+
+func TestDestroyOthers(t *testing.T) {
+	assert := assert.New(t)
+
+	u := &users.User{ID: "destroy-others"}
+	other := &users.User{ID: "destroy-others-other"}
+
+	var sids []string
+
+	for _, e := range []*users.User{u, u, u, other} {
+		sid, err := Create(e, "108.213.25.224", "UA")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sids = append(sids, sid)
+	}
+
+	_, err := DestroyOthers("", sids[0])
+	assert.Error(err)
+
+	n, err := DestroyOthers(u.ID, sids[0])
+	if assert.NoError(err) {
+		assert.Equal(2, n)
+	}
+
+	ss, err := GetByUser(u.ID)
+	if assert.NoError(err) && assert.Len(ss, 1, "only the kept session should remain") {
+		assert.Equal(sids[0], ss[0].ID)
+	}
+
+	ss, err = GetByUser(other.ID)
+	if assert.NoError(err) {
+		assert.Len(ss, 1, "other users' sessions should be kept")
+	}
+
+	n, err = DestroyOthers("destroy-others-nobody", "")
+	assert.NoError(err, "destroying no sessions shouldn't fail")
+	assert.Equal(0, n)
+}
+
 func TestAddFlash(t *testing.T) {
 	sid := validKeys[1]
 
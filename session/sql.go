@@ -0,0 +1,157 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by
+// GetTable.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+const sessionColumns = "id, user_id, ip, user_agent, timestamp, mfa_expires"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row scanner) (*Session, error) {
+	var s Session
+	if err := row.Scan(&s.ID, &s.UserID, &s.IP, &s.UserAgent, &s.Timestamp, &s.MFAExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *sqlStore) Insert(sess *Session) (string, error) {
+	if sess == nil {
+		return "", errors.New("Cannot insert nil session")
+	}
+
+	id := sess.ID
+	if id == "" {
+		id = utility.GenerateUUID()
+	}
+
+	q := "INSERT INTO " + GetTable() + " (" + sessionColumns + ") VALUES (?, ?, ?, ?, ?, ?)"
+
+	_, err := s.conn.Exec(q, id, sess.UserID, sess.IP, sess.UserAgent, sess.Timestamp.UTC(), sess.MFAExpiresAt.UTC())
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (s *sqlStore) All() ([]Session, error) {
+	return s.query("SELECT " + sessionColumns + " FROM " + GetTable() + " ORDER BY timestamp")
+}
+
+// query returns the sessions selected by `q`, which must select sessionColumns.
+func (s *sqlStore) query(q string, args ...interface{}) ([]Session, error) {
+	rows, err := s.conn.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ss []Session
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		ss = append(ss, *sess)
+	}
+
+	return ss, rows.Err()
+}
+
+func (s *sqlStore) Get(sid string) (*Session, error) {
+	sess, err := scanSession(s.conn.QueryRow("SELECT "+sessionColumns+" FROM "+GetTable()+" WHERE id = ?", sid))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return sess, err
+}
+
+func (s *sqlStore) GetByUser(userID string, from time.Time, to time.Time) ([]Session, error) {
+	q := "SELECT " + sessionColumns + " FROM " + GetTable() + ` WHERE user_id = ? AND timestamp >= ? AND timestamp < ?
+		ORDER BY timestamp DESC`
+
+	return s.query(q, userID, from.UTC(), to.UTC())
+}
+
+func (s *sqlStore) GetByIndex(userID string, index db.CountType) (*Session, error) {
+	q := "SELECT " + sessionColumns + " FROM " + GetTable() + " WHERE user_id = ? ORDER BY timestamp DESC LIMIT 1 OFFSET ?"
+
+	sess, err := scanSession(s.conn.QueryRow(q, userID, index))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return sess, err
+}
+
+func (s *sqlStore) Delete(sid string) error {
+	res, err := s.conn.Exec("DELETE FROM "+GetTable()+" WHERE id = ?", sid)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return fmt.Errorf("No session to delete with SID %q", sid)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) DeleteByIndex(userID string, index db.CountType) error {
+	sess, err := s.GetByIndex(userID, index)
+	if err != nil {
+		return err
+	}
+
+	if sess == nil {
+		return fmt.Errorf("Failed to delete session for user %q at index %d", userID, index)
+	}
+
+	return s.Delete(sess.ID)
+}
+
+func (s *sqlStore) DeleteByUser(userID string) error {
+	_, err := s.conn.Exec("DELETE FROM "+GetTable()+" WHERE user_id = ?", userID)
+
+	return err
+}
+
+func (s *sqlStore) Update(sess *Session) error {
+	q := "UPDATE " + GetTable() + " SET user_id = ?, ip = ?, user_agent = ?, timestamp = ?, mfa_expires = ? WHERE id = ?"
+
+	res, err := s.conn.Exec(q, sess.UserID, sess.IP, sess.UserAgent, sess.Timestamp.UTC(), sess.MFAExpiresAt.UTC(), sess.ID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return fmt.Errorf("session: failed to update session with SID %q", sess.ID)
+	}
+
+	return nil
+}
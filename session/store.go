@@ -0,0 +1,42 @@
+package session
+
+import (
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+)
+
+// Store is the interface through which all session data is read and written. The package-level
+// functions validate their arguments and delegate to the current Store, so callers need never know
+// which backend is in use.
+//
+// Single-document lookups return a nil value and a nil error if no document matches, leaving it to
+// the caller to decide whether that's an error.
+type Store interface {
+	// Insert adds a session, returning its ID. An ID is generated unless the session already has one.
+	Insert(s *Session) (string, error)
+	// All returns every session, oldest first.
+	All() ([]Session, error)
+	Get(sid string) (*Session, error)
+	// GetByUser returns a user's sessions created in [from, to), newest first.
+	GetByUser(userID string, from time.Time, to time.Time) ([]Session, error)
+	// GetByIndex returns the user's session at `index`, with sessions ordered newest first.
+	GetByIndex(userID string, index db.CountType) (*Session, error)
+	// Delete removes the session with `sid`, returning an error if there was none to remove.
+	Delete(sid string) error
+	// DeleteByIndex removes the user's session at `index`, with sessions ordered newest first.
+	DeleteByIndex(userID string, index db.CountType) error
+	// DeleteByUser removes every session of the user with `userID`, doing nothing if they have none.
+	DeleteByUser(userID string) error
+	// Update replaces the stored data for the session with the ID of `s`.
+	Update(s *Session) error
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+
+	"github.com/boatilus/peppercorn/attachments"
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/drafts"
+	"github.com/boatilus/peppercorn/emailchange"
+	"github.com/boatilus/peppercorn/invites"
+	"github.com/boatilus/peppercorn/moderation"
+	"github.com/boatilus/peppercorn/notifications"
+	"github.com/boatilus/peppercorn/posts"
+	"github.com/boatilus/peppercorn/pwreset"
+	"github.com/boatilus/peppercorn/reactions"
+	"github.com/boatilus/peppercorn/session"
+	"github.com/boatilus/peppercorn/throttle"
+	"github.com/boatilus/peppercorn/users"
+)
+
+// useSQLStores connects to the SQL database given by `driver` and `dsn` and swaps every package's
+// store for one backed by it.
+func useSQLStores(driver string, dsn string) (*db.SQL, error) {
+	conn, err := db.ConnectSQL(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	posts.SetStore(posts.NewSQLStore(conn))
+	users.SetStore(users.NewSQLStore(conn))
+	session.SetStore(session.NewSQLStore(conn))
+	pwreset.SetStore(pwreset.NewSQLStore(conn))
+	reactions.SetStore(reactions.NewSQLStore(conn))
+	notifications.SetStore(notifications.NewSQLStore(conn))
+	attachments.SetStore(attachments.NewSQLStore(conn))
+	drafts.SetStore(drafts.NewSQLStore(conn))
+	moderation.SetStore(moderation.NewSQLStore(conn))
+	invites.SetStore(invites.NewSQLStore(conn))
+	emailchange.SetStore(emailchange.NewSQLStore(conn))
+	throttle.SetStore(throttle.NewSQLStore(conn))
+
+	log.Printf("Using %s database", driver)
+
+	return conn, nil
+}
@@ -1,5 +1,11 @@
 const spoilerReg = new RegExp(/^spoiler\s+(.*)$/);
 
+// Matches a `>>1234` reference to another post at the start of a string, as the server does.
+const referenceReg = new RegExp(/^>>\d+(?![\w\u0080-\uffff])/);
+
+// Matches the link for a reference, capturing the number of the post referred to.
+const referenceLinkReg = new RegExp(/^\/posts\/(\d+)\/jump$/);
+
 const md = new markdownit({
   html: true,
   linkify: true,    // Automatically convert URLs to links.
@@ -88,6 +94,9 @@ const rightArrow = 39;
 const downArrow  = 40;
 const hKey       = 72;
 
+// How long, in milliseconds, typing in the reply box must pause before the draft is saved.
+const draftDelay = 1000;
+
 let isAdmin     = false;
 let currentUser = '';
 
@@ -100,6 +109,9 @@ let bottom = null;
 let modal  = null;
 let blank  = null;
 
+let draftStatus = null;
+let draftTimer  = null;
+
 // Retrieve the nearest ancestor that matches `tag`, returning `null` if it hits the <html> element.
 Element.prototype.getAncestorByTagName = function(tag) {
   let e = this;
@@ -132,8 +144,8 @@ const stripQuotes = function(text) {
   for (let i = 0; i < lines.length; i++) {
     let line = lines[i].trim();
 
-    // We know this line is blockquotes if it begins with `>`.
-    if (line.charAt(0) !== '>') {
+    // We know this line is blockquotes if it begins with `>`, unless it's a reference to a post.
+    if (line.charAt(0) !== '>' || referenceReg.test(line)) {
       newlines.push(line);
     }
   }
@@ -146,10 +158,11 @@ const stripQuotes = function(text) {
 };
 
 // Given a potentially multi-line string of text, return a version of that text with a `>`
-// prepended to each line for a Markdown blockquote.
-const quote = function(user, text) {
+// prepended to each line for a Markdown blockquote, attributed to `user` and referring to the post
+// numbered `number`.
+const quote = function(user, number, text) {
   let lines = text.split(/\r?\n/);
-  let newlines = [`> # ${user}:`];
+  let newlines = [`> # ${user} (>>${number}):`];
 
   for (let i = 0; i < lines.length; i++) {
     let line = lines[i].trim();
@@ -328,15 +341,56 @@ const handleReplyClick = function(event) {
   }
 
   const author = article.dataset['author'];
+  const number = article.dataset['number'];
 
   const trimmedContent = getTrimmedContent(article);
-  const strippedAndQuoted = quote(author, stripQuotes(trimmedContent));
+  const strippedAndQuoted = quote(author, number, stripQuotes(trimmedContent));
 
   const oldValue = bottom.value;
 
   bottom.value = '';
   bottom.value = oldValue + strippedAndQuoted;
   bottom.focus();
+
+  scheduleDraftSave();
+};
+
+// Saves the contents of the reply box as the user's draft, replacing the one saved before, or
+// deleting it if the box is empty. As it may be called while the page is being hidden or closed,
+// the request is made to outlive the page.
+const saveDraft = function() {
+  cancelDraftSave();
+
+  const content = bottom.value;
+
+  fetch('/drafts', {
+    method:      'PATCH',
+    credentials: 'same-origin',
+    keepalive:   true,
+    headers:     { 'Content-Type': 'application/json' },
+    body:        JSON.stringify({ content: content }),
+  }).then(function(res) {
+    if (!res.ok) return res.text().then(text => Promise.reject(text));
+
+    draftStatus.textContent = content.trim() === '' ? '' : 'Draft saved';
+  }).catch(function(err) {
+    console.error(`saveDraft: saving draft failed: ${err}`);
+  });
+};
+
+// Saves the draft once typing in the reply box pauses for `draftDelay`.
+const scheduleDraftSave = function() {
+  cancelDraftSave();
+
+  draftTimer = setTimeout(saveDraft, draftDelay);
+};
+
+// Cancels any pending save of the draft, as when the reply's being submitted.
+const cancelDraftSave = function() {
+  if (draftTimer === null) return;
+
+  clearTimeout(draftTimer);
+  draftTimer = null;
 };
 
 // handleEditClick is the handler called for the Edit button `click` event. It replaces the post's
@@ -451,16 +505,22 @@ const handleEditClick = function(event) {
 
       content.innerHTML  = val;
 
-      // Keep the new Markdown in `article-content`, and render it to `article-rendered`.
-      rendered.remove();
-      rendered = null; // To mark for collection.
-      
-      rendered = document.createElement('div');
-      rendered.className = 'article-rendered';
-      rendered.innerHTML = md.render(val);
+      // Keep the new Markdown in `article-content`, and show it in `article-rendered` as rendered
+      // by the server. Should the response not include the post, we'll render it here.
+      let post = null;
+      if (xhr.status === 200) {
+        try {
+          post = JSON.parse(xhr.responseText);
+        } catch (e) {
+          console.error('handleEditClick: could not parse response: ' + e);
+        }
+      }
+
+      rendered.innerHTML = (post !== null) ? post.html : md.render(val);
+
+      if (post !== null) updateBacklinks(post.number, post.references || []);
 
       bindSpoilersFor(rendered);
-      article.appendChild(rendered);
 
       displayViewState();
     });
@@ -520,7 +580,16 @@ const handleDeleteClick = function(event) {
     return false;
   }
 
-  if (window.confirm('Are you sure you want to delete this post?')) {
+  // Admins removing another user's post must say why, and the removal is logged.
+  if (isAdmin && currentUser !== article.dataset['author']) {
+    const reason = window.prompt('Why is this post being removed?');
+
+    if (reason !== null && reason.trim() === '') {
+      window.alert('A reason is required to remove another user\'s post.');
+    } else if (reason !== null) {
+      submitModeration(article.id, 'deactivate', reason);
+    }
+  } else if (window.confirm('Are you sure you want to delete this post?')) {
     window.location.href = `/posts/${article.id}/delete`;
   }
 
@@ -530,6 +599,31 @@ const handleDeleteClick = function(event) {
   document.body.removeEventListener('touchmove', preventEvent);
 };
 
+// Submits the moderation `action` on the post with `id`, as the forms shown on inactive posts do.
+const submitModeration = function(id, action, reason) {
+  let form = document.createElement('form');
+  form.method = 'post';
+  form.action = `/posts/${id}/${action}`;
+
+  let input = document.createElement('input');
+  input.type  = 'hidden';
+  input.name  = 'reason';
+  input.value = reason;
+
+  form.appendChild(input);
+  document.body.appendChild(form);
+  form.submit();
+};
+
+// Asks an admin to confirm purging a post, as it can't be undone.
+const handlePurgeSubmit = function(event) {
+  if (!event.target.classList.contains('article-purge')) return;
+
+  if (!window.confirm('Are you sure you want to purge this post? It will be deleted for good.')) {
+    event.preventDefault();
+  }
+};
+
 const handleCancelClick = function() {
   modal.style.display = 'none';
   blank.style.display = 'none';
@@ -542,6 +636,509 @@ const handleSpoilerClick = function() {
   this.nextSibling.style.display = 'block';
 }
 
+// Scrolls to the post a clicked reference links to if it's on this page, rather than have the
+// server redirect us to the page it's on.
+const handleReferenceClick = function(event) {
+  // Leave clicks meant to open the link elsewhere to the browser.
+  if (event.ctrlKey || event.metaKey || !(event.target instanceof Element)) return;
+
+  const link = event.target.closest('a.article-reference');
+  if (link === null) return;
+
+  const m = link.getAttribute('href').match(referenceLinkReg);
+  if (m === null) return;
+
+  const article = document.querySelector(`article[data-number="${m[1]}"]`);
+  if (article === null) return;
+
+  event.preventDefault();
+  window.location.hash = article.id;
+};
+
+// Replaces the reactions shown for <article> element `article` with those summarized by
+// `summaries`, matching those rendered by the page template.
+const setReactions = function(article, summaries) {
+  let bar = article.getFirstElementByClassName('article-reactions');
+  if (bar === null) {
+    bar = document.createElement('div');
+    bar.className = 'article-reactions';
+
+    const rendered = article.getFirstElementByClassName('article-rendered');
+    article.insertBefore(bar, rendered !== null ? rendered.nextSibling : null);
+  }
+
+  for (; bar.children.length; ) {
+    bar.children.item(0).remove();
+  }
+
+  for (let i = 0; i < summaries.length; i++) {
+    const s = summaries[i];
+
+    let button = document.createElement('button');
+    button.className             = 'article-reaction';
+    button.dataset['reaction']   = s.reaction;
+    button.title                 = s.names.join(', ');
+    button.textContent           = s.count ? `${s.reaction} ${s.count}` : s.reaction;
+
+    if (s.reacted) button.classList.add('article-reaction-reacted');
+    if (!s.count) button.classList.add('article-reaction-unused');
+
+    bar.appendChild(button);
+  }
+};
+
+// Shows the files in `attachments` under the post in <article> element `article`, matching those
+// rendered by the page template. Images with thumbnails are shown as such, and the rest as links.
+const setAttachments = function(article, attachments) {
+  if (attachments.length === 0) return;
+
+  let list = document.createElement('ul');
+  list.className = 'article-attachments';
+
+  for (let i = 0; i < attachments.length; i++) {
+    const a = attachments[i];
+
+    let item = document.createElement('li');
+    let link = document.createElement('a');
+    link.href = a.url;
+
+    if (a.thumbnail_url) {
+      let img = document.createElement('img');
+      img.src    = a.thumbnail_url;
+      img.alt    = a.name;
+      img.title  = `${a.name}, ${a.pretty_size}`;
+
+      link.target = '_blank';
+      link.appendChild(img);
+      item.appendChild(link);
+    } else {
+      link.textContent = a.name;
+
+      let size = document.createElement('small');
+      size.textContent = a.pretty_size;
+
+      item.appendChild(link);
+      item.appendChild(document.createTextNode(' '));
+      item.appendChild(size);
+    }
+
+    list.appendChild(item);
+  }
+
+  const rendered = article.getFirstElementByClassName('article-rendered');
+  article.insertBefore(list, rendered !== null ? rendered.nextSibling : null);
+};
+
+// Adds the clicked reaction to its post, or removes it if the user's already reacted so, then shows
+// the post's reactions as they are afterwards.
+const handleReactionClick = function(event) {
+  if (!(event.target instanceof Element)) return;
+
+  const button = event.target.closest('button.article-reaction');
+  if (button === null) return;
+
+  const article = button.getAncestorByTagName('article');
+  if (article === null) return;
+
+  const method = button.classList.contains('article-reaction-reacted') ? 'DELETE' : 'POST';
+
+  let xhr = new XMLHttpRequest();
+  xhr.open(method, `/posts/${article.id}/reactions`, true);
+  xhr.setRequestHeader('Content-type', 'application/json');
+  xhr.addEventListener('load', function() {
+    if (xhr.status !== 200) {
+      console.error(`handleReactionClick: ${method} request for "${article.id}" failed: ${xhr.responseText}`);
+      return;
+    }
+
+    setReactions(article, JSON.parse(xhr.responseText).reactions);
+  });
+  xhr.send(JSON.stringify({ reaction: button.dataset['reaction'] }));
+};
+
+// Returns the numbers of the posts shown as linking back to <article> element `article`.
+const getBacklinks = function(article) {
+  const footer = article.getFirstElementByClassName('article-backlinks');
+  if (footer === null) return [];
+
+  return Array.from(footer.getElementsByTagName('a'), a => parseInt(a.dataset['number'], 10));
+};
+
+// Replaces the backlinks shown for <article> element `article` with links to the posts numbered
+// `numbers`, matching those rendered by the page template.
+const setBacklinks = function(article, numbers) {
+  let footer = article.getFirstElementByClassName('article-backlinks');
+  if (footer !== null) footer.remove();
+
+  if (numbers.length === 0) return;
+
+  numbers.sort((a, b) => a - b);
+
+  footer = document.createElement('footer');
+  footer.className = 'article-backlinks';
+  footer.appendChild(document.createTextNode('Replied to by '));
+
+  for (let i = 0; i < numbers.length; i++) {
+    if (i > 0) footer.appendChild(document.createTextNode(', '));
+
+    let link = document.createElement('a');
+    link.className          = 'article-reference';
+    link.href               = `/posts/${numbers[i]}/jump`;
+    link.dataset['number']  = numbers[i];
+    link.textContent        = '#' + numbers[i].toLocaleString('en-US');
+
+    footer.appendChild(link);
+  }
+
+  article.appendChild(footer);
+};
+
+// Shows the backlink from the post numbered `from` on each post on this page that it refers to, as
+// given by `references`, and removes it from the rest.
+const updateBacklinks = function(from, references) {
+  const articles = document.getElementsByTagName('article');
+
+  for (let i = 0; i < articles.length; i++) {
+    const number  = parseInt(articles[i].dataset['number'], 10);
+    const numbers = getBacklinks(articles[i]);
+
+    const shown  = numbers.indexOf(from) >= 0;
+    const refers = references.indexOf(number) >= 0;
+    if (shown === refers) continue;
+
+    setBacklinks(articles[i], refers ? numbers.concat(from) : numbers.filter(n => n !== from));
+  }
+};
+
+// Greys out <article> element `article` as an inactive post seen by an admin, and adds the forms
+// to restore or purge it, as rendered by the page template. Its action buttons are removed.
+const setInactive = function(article, post) {
+  article.classList.add('article-inactive');
+
+  let actions = article.getFirstElementByClassName('article-actions');
+  if (actions !== null) actions.innerHTML = '';
+
+  if (article.getFirstElementByClassName('article-moderation') !== null) return;
+
+  let moderation = document.createElement('div');
+  moderation.className = 'article-moderation';
+
+  let status = document.createElement('small');
+  status.textContent = 'Deactivated';
+  if (post.deactivated_by) status.textContent += ` by ${post.deactivated_by}`;
+  if (post.deactivation_reason) status.textContent += `: ${post.deactivation_reason}`;
+  moderation.appendChild(status);
+
+  for (const [action, label] of [['restore', 'Restore'], ['purge', 'Purge']]) {
+    let form = document.createElement('form');
+    form.method = 'post';
+    form.action = `/posts/${article.id}/${action}`;
+    if (action === 'purge') form.className = 'article-purge';
+
+    let button = document.createElement('button');
+    button.type        = 'submit';
+    button.textContent = label;
+
+    form.appendChild(document.createTextNode(' '));
+    form.appendChild(button);
+    moderation.appendChild(form);
+  }
+
+  article.insertBefore(moderation, article.getFirstElementByClassName('article-content'));
+};
+
+// Builds an <article> element for `post`, as received from the post stream, matching those
+// rendered by the page template.
+const buildArticle = function(post) {
+  let article = document.createElement('article');
+  article.id                 = post.id;
+  article.dataset['author']  = post.author_name;
+  article.dataset['number']  = post.number;
+
+  if (post.avatar) {
+    let picture = document.createElement('picture');
+    picture.className = 'article-avatar';
+
+    let source = document.createElement('source');
+    source.media  = '(min-width: 960px)';
+    source.srcset = post.avatar;
+
+    let img = document.createElement('img');
+    img.src = post.small_avatar;
+    img.alt = '';
+
+    picture.appendChild(source);
+    picture.appendChild(img);
+    article.appendChild(picture);
+  }
+
+  let actions = document.createElement('div');
+  actions.className = 'article-actions';
+  article.appendChild(actions);
+
+  let header = document.createElement('header');
+  let hgroup = document.createElement('hgroup');
+
+  let name = document.createElement('h1');
+  let profile = document.createElement('a');
+  profile.href        = '/users/' + encodeURIComponent(post.author_name);
+  profile.rel         = 'author';
+  profile.textContent = post.author_name;
+  name.appendChild(profile);
+  hgroup.appendChild(name);
+
+  if (post.title) {
+    let title = document.createElement('h2');
+    title.textContent = post.title;
+    hgroup.appendChild(title);
+  }
+
+  let meta = document.createElement('div');
+  meta.className = 'article-meta';
+
+  let small = document.createElement('small');
+
+  let time = document.createElement('time');
+  time.setAttribute('datetime', post.time);
+  time.textContent = post.pretty_time;
+
+  let link = document.createElement('a');
+  link.className   = 'article-link';
+  link.textContent = post.number.toLocaleString('en-US');
+
+  small.appendChild(time);
+  small.appendChild(document.createTextNode(' '));
+  setEdited(small, post);
+  small.appendChild(link);
+  meta.appendChild(small);
+
+  header.appendChild(hgroup);
+  header.appendChild(meta);
+  article.appendChild(header);
+
+  let content = document.createElement('section');
+  content.className   = 'article-content';
+  content.hidden      = true;
+  content.textContent = post.content;
+  article.appendChild(content);
+
+  let rendered = document.createElement('div');
+  rendered.className = 'article-rendered';
+  rendered.innerHTML = post.html;
+  article.appendChild(rendered);
+
+  setReactions(article, post.reactions || []);
+  setAttachments(article, post.attachments || []);
+  setBacklinks(article, post.backlinks || []);
+
+  if (post.inactive) setInactive(article, post);
+
+  return article;
+};
+
+// Adds or updates the "edited" marker in the article metadata `small`, if `post` has been edited.
+// The marker sits between the post's time and its link, as rendered by the page template.
+const setEdited = function(small, post) {
+  if (!post.edited_at) return;
+
+  let edited = small.getFirstElementByClassName('article-edited');
+
+  if (edited === null) {
+    edited = document.createElement('time');
+    edited.className = 'article-edited';
+
+    small.insertBefore(edited, small.getFirstElementByClassName('article-link'));
+    small.insertBefore(document.createTextNode(' '), edited.nextSibling);
+  }
+
+  edited.setAttribute('datetime', post.edited_at);
+  edited.textContent = `edited ${post.pretty_edited_at}`;
+};
+
+// Adds a link to the next page to the page navigation, if there isn't one already.
+const showNextPage = function() {
+  if (next !== null) return;
+
+  const page = parseInt(document.body.dataset['page'], 10);
+
+  const items = document.querySelectorAll('header nav li');
+  if (items.length === 0) return;
+
+  next = document.createElement('a');
+  next.id          = 'nav-next';
+  next.href        = `/page/${page + 1}`;
+  next.textContent = page + 1;
+
+  items[items.length - 1].appendChild(next);
+
+  document.getElementById('page-next').className = 'page-next-enabled';
+};
+
+// Handles a `new` event from the post stream, adding the post if it belongs at the end of this
+// page, or linking to the next page if it belongs there. Either way, the posts it refers to on
+// this page link back to it. A restored post an admin sees greyed out here is shown afresh.
+const handleStreamNew = function(event) {
+  const post = JSON.parse(event.data);
+
+  let existing = document.getElementById(post.id);
+  if (existing !== null) {
+    if (existing.classList.contains('article-inactive')) {
+      let article = buildArticle(post);
+      existing.parentNode.replaceChild(article, existing);
+
+      setupArticle(article);
+    }
+
+    return;
+  }
+
+  updateBacklinks(post.number, post.references || []);
+
+  const page = parseInt(document.body.dataset['page'], 10);
+  const ppp  = parseInt(document.body.dataset['postsPerPage'], 10);
+  const postPage = Math.ceil(post.number / ppp);
+
+  if (postPage > page) {
+    showNextPage();
+    return;
+  }
+
+  // We'll only add posts that follow the last on the page, such as new replies, rather than try to
+  // slot in posts restored further back.
+  const articles = document.getElementsByTagName('article');
+  const last = articles.length ? parseInt(articles[articles.length - 1].dataset['number'], 10) : 0;
+
+  if (postPage !== page || post.number <= last) return;
+
+  let article = buildArticle(post);
+
+  const end = document.getElementById('articles-end');
+  end.parentNode.insertBefore(article, end);
+
+  setupArticle(article);
+};
+
+// Handles an `edit` event from the post stream, re-rendering the post if it's on this page, and
+// updating the backlinks to it.
+const handleStreamEdit = function(event) {
+  const post = JSON.parse(event.data);
+
+  updateBacklinks(post.number, post.references || []);
+
+  let article = document.getElementById(post.id);
+  if (article === null) return;
+
+  let small = article.querySelector('.article-meta small');
+  if (small !== null) setEdited(small, post);
+
+  // Leave the post alone if it's being edited here.
+  if (article.getFirstElementByClassName('article-editable') !== null) return;
+
+  let content  = article.getFirstElementByClassName('article-content');
+  let rendered = article.getFirstElementByClassName('article-rendered');
+  if (content === null || rendered === null) return;
+
+  content.textContent = post.content;
+  rendered.innerHTML  = post.html;
+
+  bindSpoilersFor(rendered);
+};
+
+// Handles a `deactivate` event from the post stream, removing the post if it's on this page, or
+// greying it out for admins. The posts after it keep their numbers.
+const handleStreamDeactivate = function(event) {
+  const post = JSON.parse(event.data);
+
+  updateBacklinks(post.number, []);
+
+  let article = document.getElementById(post.id);
+  if (article === null) return;
+
+  if (isAdmin) {
+    setInactive(article, post);
+  } else {
+    article.remove();
+  }
+};
+
+// Subscribes to the post stream so that new, edited and removed posts are reflected on the page
+// without a reload. The browser reconnects on its own should the connection drop.
+const openStream = function() {
+  if (typeof EventSource === 'undefined') return;
+
+  let stream = new EventSource('/posts/stream');
+  stream.addEventListener('new', handleStreamNew);
+  stream.addEventListener('edit', handleStreamEdit);
+  stream.addEventListener('deactivate', handleStreamDeactivate);
+};
+
+// Binds the spoilers in the rendered content of <article> element `thisPost` and adds its action
+// buttons. Posts are rendered on the server, but should one arrive without its rendered content,
+// we'll render its Markdown here.
+const setupArticle = function(thisPost) {
+  const author = thisPost.dataset.author;
+
+  let actions = thisPost.getElementsByClassName('article-actions').item(0);
+  let content = thisPost.getElementsByClassName('article-content').item(0);
+
+  let rendered = thisPost.getFirstElementByClassName('article-rendered');
+  if (rendered === null) {
+    rendered = document.createElement('div');
+    rendered.className = 'article-rendered';
+    rendered.innerHTML = md.render(content.textContent);
+
+    content.parentNode.insertBefore(rendered, content.nextSibling);
+  }
+
+  content.style.display = 'none';
+
+  let menuButton = document.createElement('button');
+  menuButton.className = 'article-menu';
+  menuButton.innerHTML = menuIcon;
+  menuButton.dataset['id'] = thisPost.id;
+  menuButton.addEventListener('click', handleMenuClick);
+
+  // Add 'Reply' and 'Menu' buttons to each post, attaching handlers to them.
+  let replyButton = document.createElement('button');
+  replyButton.className = 'article-reply';
+  replyButton.innerHTML = replyIcon;
+  replyButton.addEventListener('click', handleReplyClick);
+
+  // Inactive posts, seen only by admins, can only be restored or purged.
+  if (thisPost.classList.contains('article-inactive')) {
+    bindSpoilersFor(thisPost);
+    return;
+  }
+
+  let fragment = document.createDocumentFragment();
+  if (isAdmin || (currentUser === author)) {
+    fragment.appendChild(menuButton);
+  }
+  
+  fragment.appendChild(replyButton);
+
+  if (isAdmin || (currentUser === author)) {
+    let editButton = document.createElement('button');
+    editButton.className = 'article-edit';
+    editButton.innerHTML = editIcon;
+    editButton.dataset['id'] = thisPost.id;
+    editButton.addEventListener('click', handleEditClick);
+
+    let deleteButton = document.createElement('button');
+    deleteButton.className = 'article-delete';
+    deleteButton.innerHTML = deleteIcon;
+    deleteButton.dataset['id'] = thisPost.id;
+    deleteButton.addEventListener('click', handleDeleteClick);
+
+    fragment.appendChild(deleteButton);
+    fragment.appendChild(editButton);
+  }
+
+  actions.appendChild(fragment);
+
+  bindSpoilersFor(thisPost);
+};
+
 document.addEventListener('DOMContentLoaded', function() {
   isAdmin     = (document.body.dataset['isAdmin'] === 'true');
   currentUser = document.body.dataset['currentUser'];
@@ -551,6 +1148,8 @@ document.addEventListener('DOMContentLoaded', function() {
   reply  = document.getElementById('reply');
   bottom = document.getElementById('bottom');
 
+  draftStatus = document.getElementById('reply-draft');
+
   let prevArrow = document.createElement('div');
   prevArrow.id = 'page-prev';
   if (prev !== null) {
@@ -564,14 +1163,27 @@ document.addEventListener('DOMContentLoaded', function() {
   }
 
   document.addEventListener('click', handleDocumentClick);
+  document.addEventListener('click', handleReferenceClick);
+  document.addEventListener('click', handleReactionClick);
+  document.addEventListener('submit', handlePurgeSubmit);
 
   // Add a listener to submit a reply on Ctrl+Enter/Option+Enter
   bottom.addEventListener('keydown', function(e) {
     if (bottom.value != "" && e.isModified() && (e.keyCode === returnKey)) {
+      cancelDraftSave();
       reply.submit();
     }
   })
 
+  // Keep a draft of the reply on the server, so it isn't lost if the page is closed. Submitting the
+  // reply deletes the draft, so there's nothing left to save then.
+  bottom.addEventListener('input', scheduleDraftSave);
+  reply.addEventListener('submit', cancelDraftSave);
+
+  document.addEventListener('visibilitychange', function() {
+    if (document.visibilityState === 'hidden' && draftTimer !== null) saveDraft();
+  });
+
   // Add a div to contain the post menu, which we'll show/hide and move around as necessary.
   modal = document.createElement('ul');
   modal.id = 'article-menu-modal';
@@ -595,63 +1207,10 @@ document.addEventListener('DOMContentLoaded', function() {
   let posts = document.getElementsByTagName('article');
 
   for (let i = 0; i < posts.length; i++) {
-    const thisPost = posts[i];
-    const author = thisPost.dataset.author;
-
-    let actions = thisPost.getElementsByClassName('article-actions').item(0);
-    let content = thisPost.getElementsByClassName('article-content').item(0);
-
-    // Get the post's Markdown content, parsing it and replacing it with the rendered HTML.
-    const trimmedContent = content.textContent;
-    
-    let rendered = document.createElement('div');
-    rendered.className = 'article-rendered';
-    rendered.innerHTML = md.render(trimmedContent);
-    
-    content.style.display = 'none';
-
-    thisPost.appendChild(rendered);
-
-    let menuButton = document.createElement('button');
-    menuButton.className = 'article-menu';
-    menuButton.innerHTML = menuIcon;
-    menuButton.dataset['id'] = thisPost.id;
-    menuButton.addEventListener('click', handleMenuClick);
-
-    // Add 'Reply' and 'Menu' buttons to each post, attaching handlers to them.
-    let replyButton = document.createElement('button');
-    replyButton.className = 'article-reply';
-    replyButton.innerHTML = replyIcon;
-    replyButton.addEventListener('click', handleReplyClick);
-
-    let fragment = document.createDocumentFragment();
-    if (isAdmin || (currentUser === author)) {
-      fragment.appendChild(menuButton);
-    }
-    
-    fragment.appendChild(replyButton);
-
-    if (isAdmin || (currentUser === author)) {
-      let editButton = document.createElement('button');
-      editButton.className = 'article-edit';
-      editButton.innerHTML = editIcon;
-      editButton.dataset['id'] = thisPost.id;
-      editButton.addEventListener('click', handleEditClick);
-
-      let deleteButton = document.createElement('button');
-      deleteButton.className = 'article-delete';
-      deleteButton.innerHTML = deleteIcon;
-      deleteButton.dataset['id'] = thisPost.id;
-      deleteButton.addEventListener('click', handleDeleteClick);
-
-      fragment.appendChild(deleteButton);
-      fragment.appendChild(editButton);
-    }
-
-    actions.appendChild(fragment);
-
-    bindSpoilersFor(thisPost);
+    setupArticle(posts[i]);
   }
 
   console.timeEnd('DOM_begin');
+
+  openStream();
 });
\ No newline at end of file
@@ -3,7 +3,10 @@ package templates
 import (
 	"html/template"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/boatilus/peppercorn/attachments"
 	"github.com/boatilus/peppercorn/db"
 	"github.com/boatilus/peppercorn/utility"
 )
@@ -17,6 +20,16 @@ var ResetPassword *template.Template
 var EnableTwoFactorAuthentication *template.Template
 var EnterCode *template.Template
 var RecoveryCodes *template.Template
+var Search *template.Template
+var Notifications *template.Template
+var Moderation *template.Template
+var AdminUsers *template.Template
+var AdminUser *template.Template
+var AdminLocks *template.Template
+var Invites *template.Template
+var Invite *template.Template
+var Profile *template.Template
+var ConfirmEmail *template.Template
 
 var sep string
 var dir string
@@ -25,14 +38,17 @@ var funcMap template.FuncMap
 
 func init() {
 	funcMap = template.FuncMap{
-		"inc":          func(n db.CountType) db.CountType { return n + 1 },
-		"dec":          func(n db.CountType) db.CountType { return n - 1 },
-		"prettyTime":   utility.FormatTime,
-		"toISO8601":    utility.GetISO8601String,
-		"commify":      utility.CommifyCountType,
-		"getVersion":   utility.GetVersionString,
-		"getTitle":     utility.GetTitle,
-		"getTitleWith": utility.GetTitleWith,
+		"inc":            func(n db.CountType) db.CountType { return n + 1 },
+		"dec":            func(n db.CountType) db.CountType { return n - 1 },
+		"prettyTime":     utility.FormatTime,
+		"toISO8601":      utility.GetISO8601String,
+		"commify":        utility.CommifyCountType,
+		"getVersion":     utility.GetVersionString,
+		"getTitle":       utility.GetTitle,
+		"getTitleWith":   utility.GetTitleWith,
+		"join":           strings.Join,
+		"avatarURL":      attachments.AvatarURL,
+		"smallAvatarURL": attachments.SmallAvatarURL,
 	}
 
 	cwd, err := os.Getwd()
@@ -41,7 +57,7 @@ func init() {
 	}
 
 	sep = string(os.PathSeparator)
-	dir = cwd
+	dir = findDir(cwd)
 
 	// TODO: Async these
 	Index = parseTemplate("index")
@@ -53,6 +69,30 @@ func init() {
 	EnableTwoFactorAuthentication = parseTemplate("enable-two-factor-authentication")
 	EnterCode = parseTemplate("enter-code")
 	RecoveryCodes = parseTemplate("recovery-codes")
+	Search = parseTemplate("search")
+	Notifications = parseTemplate("notifications")
+	Moderation = parseTemplate("moderation")
+	AdminUsers = parseTemplate("admin-users")
+	AdminUser = parseTemplate("admin-user")
+	AdminLocks = parseTemplate("admin-locks")
+	Invites = parseTemplate("invites")
+	Invite = parseTemplate("invite")
+	Profile = parseTemplate("profile")
+	ConfirmEmail = parseTemplate("confirm-email")
+}
+
+// findDir returns the directory holding the `templates` directory: `cwd`, or failing that, the
+// nearest of its parents that holds one, as when running the tests of a package.
+func findDir(cwd string) string {
+	for d := cwd; ; d = filepath.Dir(d) {
+		if info, err := os.Stat(filepath.Join(d, "templates")); err == nil && info.IsDir() {
+			return d
+		}
+
+		if filepath.Dir(d) == d {
+			return cwd
+		}
+	}
 }
 
 func parseTemplate(name string) *template.Template {
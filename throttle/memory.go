@@ -0,0 +1,138 @@
+package throttle
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store that keeps failed attempts in process memory. Nothing is persisted, so
+// it's useful only for development and tests.
+type memoryStore struct {
+	mu       sync.RWMutex
+	attempts []Attempt
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) Insert(a *Attempt) error {
+	if a == nil {
+		return errors.New("throttle: cannot insert nil attempt")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts = append(s.attempts, *a)
+
+	return nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.remove(func(a *Attempt) bool {
+		return a.ID == id
+	})
+
+	return nil
+}
+
+// filter returns the attempts for which `keep` returns true.
+func (s *memoryStore) filter(keep func(a *Attempt) bool) []Attempt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var as []Attempt
+	for i := range s.attempts {
+		if keep(&s.attempts[i]) {
+			as = append(as, s.attempts[i])
+		}
+	}
+
+	return as
+}
+
+// update runs `change` on every attempt.
+func (s *memoryStore) update(change func(a *Attempt)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.attempts {
+		change(&s.attempts[i])
+	}
+}
+
+// remove deletes the attempts for which `drop` returns true.
+func (s *memoryStore) remove(drop func(a *Attempt) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.attempts[:0]
+	for _, a := range s.attempts {
+		if !drop(&a) {
+			kept = append(kept, a)
+		}
+	}
+
+	s.attempts = kept
+}
+
+func (s *memoryStore) ListByAccount(action Action, account string, since time.Time) ([]Attempt, error) {
+	return s.filter(func(a *Attempt) bool {
+		return a.Action == action && a.Account == account && !a.AccountCleared && !a.Created.Before(since)
+	}), nil
+}
+
+func (s *memoryStore) ListByIP(action Action, ip string, since time.Time) ([]Attempt, error) {
+	return s.filter(func(a *Attempt) bool {
+		return a.Action == action && a.IP == ip && !a.IPCleared && !a.Created.Before(since)
+	}), nil
+}
+
+func (s *memoryStore) ListSince(since time.Time) ([]Attempt, error) {
+	as := s.filter(func(a *Attempt) bool {
+		return !a.Created.Before(since)
+	})
+
+	// Newest first, breaking ties by ID.
+	sort.Slice(as, func(i, j int) bool {
+		if as[i].Created.Equal(as[j].Created) {
+			return as[i].ID > as[j].ID
+		}
+
+		return as[i].Created.After(as[j].Created)
+	})
+
+	return as, nil
+}
+
+func (s *memoryStore) ClearAccount(action Action, account string) error {
+	s.update(func(a *Attempt) {
+		if a.Action == action && a.Account == account {
+			a.AccountCleared = true
+		}
+	})
+
+	return nil
+}
+
+func (s *memoryStore) ClearIP(action Action, ip string) error {
+	s.update(func(a *Attempt) {
+		if a.Action == action && a.IP == ip {
+			a.IPCleared = true
+		}
+	})
+
+	return nil
+}
+
+func (s *memoryStore) DeleteBefore(before time.Time) error {
+	s.remove(func(a *Attempt) bool {
+		return a.Created.Before(before)
+	})
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package throttle
+
+import (
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by the
+// `db.failed_attempts_table` config value. Attempts are looked up through the compound
+// `action_account_created` and `action_ip_created` indices, and listed by the `created` index.
+type rethinkStore struct{}
+
+// getTable returns the table term for the failed attempts table.
+func getTable() rethink.Term {
+	return db.Get().Table(viper.GetString("db.failed_attempts_table"))
+}
+
+// all runs `t`, reading every attempt it yields.
+func (rethinkStore) all(t rethink.Term) ([]Attempt, error) {
+	cursor, err := t.Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close()
+
+	var as []Attempt
+	if err := cursor.All(&as); err != nil {
+		return nil, err
+	}
+
+	return as, nil
+}
+
+// between returns the attempts at `action` whose `field` is `value`, made since `since`, through
+// the index on action, `field` and time.
+func between(field string, action Action, value string, since interface{}) rethink.Term {
+	return getTable().Between(
+		[]interface{}{action, value, since},
+		[]interface{}{action, value, rethink.MaxVal},
+		rethink.BetweenOpts{Index: "action_" + field + "_created"},
+	)
+}
+
+func (rethinkStore) Insert(a *Attempt) error {
+	_, err := getTable().Insert(a).RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) Delete(id string) error {
+	_, err := getTable().Get(id).Delete().RunWrite(db.Session)
+
+	return err
+}
+
+func (s rethinkStore) ListByAccount(action Action, account string, since time.Time) ([]Attempt, error) {
+	return s.all(between("account", action, account, since).Filter(map[string]interface{}{"account_cleared": false}))
+}
+
+func (s rethinkStore) ListByIP(action Action, ip string, since time.Time) ([]Attempt, error) {
+	return s.all(between("ip", action, ip, since).Filter(map[string]interface{}{"ip_cleared": false}))
+}
+
+func (s rethinkStore) ListSince(since time.Time) ([]Attempt, error) {
+	t := getTable().Between(since, rethink.MaxVal, rethink.BetweenOpts{Index: "created"})
+
+	return s.all(t.OrderBy(rethink.OrderByOpts{Index: rethink.Desc("created")}))
+}
+
+func (rethinkStore) ClearAccount(action Action, account string) error {
+	t := between("account", action, account, rethink.MinVal)
+
+	_, err := t.Update(map[string]interface{}{"account_cleared": true}).RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) ClearIP(action Action, ip string) error {
+	t := between("ip", action, ip, rethink.MinVal)
+
+	_, err := t.Update(map[string]interface{}{"ip_cleared": true}).RunWrite(db.Session)
+
+	return err
+}
+
+func (rethinkStore) DeleteBefore(before time.Time) error {
+	t := getTable().Between(rethink.MinVal, before, rethink.BetweenOpts{Index: "created"})
+
+	_, err := t.Delete().RunWrite(db.Session)
+
+	return err
+}
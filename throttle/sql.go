@@ -0,0 +1,95 @@
+package throttle
+
+import (
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/spf13/viper"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by the
+// `db.failed_attempts_table` config value.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+func getTableName() string {
+	return viper.GetString("db.failed_attempts_table")
+}
+
+const columns = "id, action, account, ip, created, account_cleared, ip_cleared"
+
+// query runs a SELECT of every column with `clause` appended, scanning each row into an Attempt.
+func (s *sqlStore) query(clause string, args ...interface{}) ([]Attempt, error) {
+	rows, err := s.conn.Query("SELECT "+columns+" FROM "+getTableName()+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var as []Attempt
+	for rows.Next() {
+		var a Attempt
+		if err := rows.Scan(&a.ID, &a.Action, &a.Account, &a.IP, &a.Created, &a.AccountCleared, &a.IPCleared); err != nil {
+			return nil, err
+		}
+
+		as = append(as, a)
+	}
+
+	return as, rows.Err()
+}
+
+func (s *sqlStore) Insert(a *Attempt) error {
+	q := "INSERT INTO " + getTableName() + " (" + columns + ") VALUES (?, ?, ?, ?, ?, ?, ?)"
+
+	_, err := s.conn.Exec(q, a.ID, string(a.Action), a.Account, a.IP, a.Created.UTC(), a.AccountCleared, a.IPCleared)
+
+	return err
+}
+
+func (s *sqlStore) Delete(id string) error {
+	_, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE id = ?", id)
+
+	return err
+}
+
+func (s *sqlStore) ListByAccount(action Action, account string, since time.Time) ([]Attempt, error) {
+	return s.query(" WHERE action = ? AND account = ? AND NOT account_cleared AND created >= ?", string(action), account, since.UTC())
+}
+
+func (s *sqlStore) ListByIP(action Action, ip string, since time.Time) ([]Attempt, error) {
+	return s.query(" WHERE action = ? AND ip = ? AND NOT ip_cleared AND created >= ?", string(action), ip, since.UTC())
+}
+
+func (s *sqlStore) ListSince(since time.Time) ([]Attempt, error) {
+	return s.query(" WHERE created >= ? ORDER BY created DESC, id DESC", since.UTC())
+}
+
+func (s *sqlStore) ClearAccount(action Action, account string) error {
+	q := "UPDATE " + getTableName() + " SET account_cleared = ? WHERE action = ? AND account = ?"
+
+	_, err := s.conn.Exec(q, true, string(action), account)
+
+	return err
+}
+
+func (s *sqlStore) ClearIP(action Action, ip string) error {
+	q := "UPDATE " + getTableName() + " SET ip_cleared = ? WHERE action = ? AND ip = ?"
+
+	_, err := s.conn.Exec(q, true, string(action), ip)
+
+	return err
+}
+
+func (s *sqlStore) DeleteBefore(before time.Time) error {
+	_, err := s.conn.Exec("DELETE FROM "+getTableName()+" WHERE created < ?", before.UTC())
+
+	return err
+}
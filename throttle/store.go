@@ -0,0 +1,38 @@
+package throttle
+
+import "time"
+
+// Store is the interface through which attempts are read and written. The package-level
+// functions validate their arguments and delegate to the current Store, so callers need never know
+// which backend is in use.
+type Store interface {
+	// Insert records an attempt.
+	Insert(a *Attempt) error
+	// Delete removes the attempt with `id`, doing nothing if there's none.
+	Delete(id string) error
+	// ListByAccount returns the attempts at `action` on `account` made since `since` that still
+	// count against it, in no particular order.
+	ListByAccount(action Action, account string, since time.Time) ([]Attempt, error)
+	// ListByIP returns the attempts at `action` from `ip` made since `since` that still count
+	// against it, in no particular order.
+	ListByIP(action Action, ip string, since time.Time) ([]Attempt, error)
+	// ListSince returns every attempt made since `since`, cleared or not, newest first.
+	ListSince(since time.Time) ([]Attempt, error)
+	// ClearAccount sets AccountCleared on every attempt at `action` on `account`, doing nothing if
+	// there are none.
+	ClearAccount(action Action, account string) error
+	// ClearIP sets IPCleared on every attempt at `action` from `ip`, doing nothing if there are
+	// none.
+	ClearIP(action Action, ip string) error
+	// DeleteBefore removes every attempt made before `before`.
+	DeleteBefore(before time.Time) error
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
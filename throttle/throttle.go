@@ -0,0 +1,336 @@
+// Package throttle slows down the guessing of passwords and two-factor codes, and the sending of
+// password reset emails. Each failed attempt is recorded against the account it was for and the
+// address it came from. Past a few free attempts, each further one locks the account or address
+// out for twice as long as the last, up to a limit, so that guessing soon becomes hopeless while
+// someone who's only forgotten is kept waiting a minute or two.
+package throttle
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/spf13/viper"
+)
+
+// Action is what was attempted. Attempts at each are counted apart, so that, say, asking for
+// password resets doesn't lock a user out of signing in.
+type Action string
+
+// SignIn is an attempt to sign in with an email and password, Code an attempt to enter a two-factor
+// authentication code, and Forgot a request for a password reset email. Sign-ins and codes stop
+// counting when they succeed, but every reset request counts, as each sends an email.
+const (
+	SignIn Action = "sign_in"
+	Code   Action = "code"
+	Forgot Action = "forgot"
+)
+
+// Actions lists every Action.
+var Actions = []Action{SignIn, Code, Forgot}
+
+// Attempt is an attempt at Action on Account, made from IP. It's recorded before it's made, and
+// counts as failed unless it succeeds.
+type Attempt struct {
+	ID     string `gorethink:"id"`
+	Action Action `gorethink:"action"`
+	// Account is the email the attempt was for, in lowercase. It's whatever was given, whether or
+	// not it belongs to a user, so that lockouts say nothing of which emails do.
+	Account string    `gorethink:"account"`
+	IP      string    `gorethink:"ip"`
+	Created time.Time `gorethink:"created"`
+	// AccountCleared and IPCleared are set once the attempt no longer counts against its account
+	// or its address, as when the user signs in or an admin lifts a lock. The attempt itself is
+	// kept, to be listed, until it's forgotten.
+	AccountCleared bool `gorethink:"account_cleared"`
+	IPCleared      bool `gorethink:"ip_cleared"`
+}
+
+// Defaults for the policy, unless overridden by the `throttle.*` config values. An account can be
+// attempted DefaultFreeAttempts times, and an address DefaultIPFreeAttempts times, since many users
+// may share one, before having to wait DefaultDelay. Each attempt after that doubles the wait, up
+// to DefaultMaxDelay. Attempts are forgotten after DefaultWindow.
+const (
+	DefaultFreeAttempts   = 5
+	DefaultIPFreeAttempts = 20
+	DefaultDelay          = time.Minute
+	DefaultMaxDelay       = time.Hour
+	DefaultWindow         = 24 * time.Hour
+)
+
+func init() {
+	viper.SetDefault("throttle.free_attempts", DefaultFreeAttempts)
+	viper.SetDefault("throttle.ip_free_attempts", DefaultIPFreeAttempts)
+	viper.SetDefault("throttle.delay", DefaultDelay)
+	viper.SetDefault("throttle.max_delay", DefaultMaxDelay)
+	viper.SetDefault("throttle.window", DefaultWindow)
+}
+
+// Lock is an account or address locked out of Action until Until, after Failures attempts, the
+// last at Last. Exactly one of Account and IP is set.
+type Lock struct {
+	Action   Action
+	Account  string
+	IP       string
+	Failures int
+	Last     time.Time
+	Until    time.Time
+}
+
+// normalize returns `account` as it's recorded, so that the same email in another case or with
+// stray spaces counts as the same account.
+func normalize(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+// window returns how long attempts are remembered for.
+func window() time.Duration {
+	return viper.GetDuration("throttle.window")
+}
+
+// delay returns how long to wait after the last of `failures` attempts, when `free` attempts can be
+// made without waiting.
+func delay(failures int, free int) time.Duration {
+	if failures < free {
+		return 0
+	}
+
+	d := viper.GetDuration("throttle.delay")
+	max := viper.GetDuration("throttle.max_delay")
+
+	for i := free; i < failures && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		return max
+	}
+
+	return d
+}
+
+// lockFrom returns the lock `attempts` make, which are all for the same account or address, or
+// nil if they make none that lasts beyond `now`.
+func lockFrom(attempts []Attempt, free int, now time.Time) *Lock {
+	if len(attempts) == 0 {
+		return nil
+	}
+
+	var last time.Time
+	for _, a := range attempts {
+		if a.Created.After(last) {
+			last = a.Created
+		}
+	}
+
+	until := last.Add(delay(len(attempts), free))
+	if !until.After(now) {
+		return nil
+	}
+
+	return &Lock{Failures: len(attempts), Last: last, Until: until}
+}
+
+// waitFor returns how long is left at `now` before `action` can be attempted on `account` from
+// `ip`, counting only the attempts for which `counts` returns true. The wait is the longer of that
+// of the account and that of the address, and doesn't depend on whether `account` belongs to a
+// user.
+func waitFor(action Action, account string, ip string, now time.Time, counts func(a *Attempt) bool) (time.Duration, error) {
+	since := now.Add(-window())
+
+	// keep returns those of `as` that count.
+	keep := func(as []Attempt) []Attempt {
+		kept := as[:0]
+		for i := range as {
+			if counts(&as[i]) {
+				kept = append(kept, as[i])
+			}
+		}
+
+		return kept
+	}
+
+	var wait time.Duration
+
+	if account != "" {
+		as, err := store.ListByAccount(action, account, since)
+		if err != nil {
+			return 0, err
+		}
+
+		if l := lockFrom(keep(as), viper.GetInt("throttle.free_attempts"), now); l != nil {
+			wait = l.Until.Sub(now)
+		}
+	}
+
+	if ip != "" {
+		as, err := store.ListByIP(action, ip, since)
+		if err != nil {
+			return 0, err
+		}
+
+		if l := lockFrom(keep(as), viper.GetInt("throttle.ip_free_attempts"), now); l != nil && l.Until.Sub(now) > wait {
+			wait = l.Until.Sub(now)
+		}
+	}
+
+	return wait, nil
+}
+
+// Try records an attempt at `action` on `account` from `ip`, before it's made, and returns how long
+// is left before it can be made. If that's zero, the attempt goes ahead and counts as failed until
+// it's passed to Succeed. Otherwise, it's withdrawn and nil is returned in its place.
+//
+// Every other attempt recorded by the time this one is counted counts towards the wait. Of any
+// two attempts made at once, the one counted last counts the other, so no more than the free ones
+// go ahead. Attempts old enough to be forgotten are deleted while we're at it.
+func Try(action Action, account string, ip string) (*Attempt, time.Duration, error) {
+	now := time.Now().UTC()
+
+	a := &Attempt{
+		ID:      utility.GenerateUUID(),
+		Action:  action,
+		Account: normalize(account),
+		IP:      ip,
+		Created: now,
+	}
+
+	if err := store.Insert(a); err != nil {
+		return nil, 0, err
+	}
+
+	wait, err := waitFor(action, a.Account, ip, now, func(b *Attempt) bool {
+		return b.ID != a.ID
+	})
+	if err == nil && wait > 0 {
+		err = store.Delete(a.ID)
+	}
+
+	if err != nil || wait > 0 {
+		return nil, wait, err
+	}
+
+	return a, 0, store.DeleteBefore(now.Add(-window()))
+}
+
+// Succeed withdraws `a`, which succeeded, and stops the failed attempts at its action on its
+// account counting against it, as when its user signs in. They still count against the addresses
+// they came from, lest someone guessing at other accounts clear their address by signing in to
+// their own.
+func Succeed(a *Attempt) error {
+	if a == nil {
+		return errors.New("throttle: cannot succeed nil attempt")
+	}
+
+	if err := store.Delete(a.ID); err != nil {
+		return err
+	}
+
+	return store.ClearAccount(a.Action, a.Account)
+}
+
+// Recent returns up to `limit` failed attempts, newest first.
+func Recent(limit int) ([]Attempt, error) {
+	if limit < 1 {
+		return nil, errors.New("throttle: limit must be at least 1")
+	}
+
+	as, err := store.ListSince(time.Now().UTC().Add(-window()))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(as) > limit {
+		as = as[:limit]
+	}
+
+	return as, nil
+}
+
+// Locks returns every account and address now locked out of anything, the longest-lasting first.
+func Locks() ([]Lock, error) {
+	now := time.Now().UTC()
+
+	as, err := store.ListSince(now.Add(-window()))
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		action  Action
+		account string
+		ip      string
+	}
+
+	// Each attempt counts against both its account and its address, where it has them.
+	groups := make(map[key][]Attempt)
+	for _, a := range as {
+		if a.Account != "" && !a.AccountCleared {
+			byAccount := key{action: a.Action, account: a.Account}
+			groups[byAccount] = append(groups[byAccount], a)
+		}
+
+		if a.IP != "" && !a.IPCleared {
+			byIP := key{action: a.Action, ip: a.IP}
+			groups[byIP] = append(groups[byIP], a)
+		}
+	}
+
+	var ls []Lock
+
+	for k, group := range groups {
+		free := viper.GetInt("throttle.free_attempts")
+		if k.ip != "" {
+			free = viper.GetInt("throttle.ip_free_attempts")
+		}
+
+		if l := lockFrom(group, free, now); l != nil {
+			l.Action, l.Account, l.IP = k.action, k.account, k.ip
+			ls = append(ls, *l)
+		}
+	}
+
+	sort.Slice(ls, func(i, j int) bool {
+		if ls[i].Until.Equal(ls[j].Until) {
+			return ls[i].Account+ls[i].IP < ls[j].Account+ls[j].IP
+		}
+
+		return ls[i].Until.After(ls[j].Until)
+	})
+
+	return ls, nil
+}
+
+// ClearAccount stops every failed attempt on `account` counting against it, lifting any lock on
+// it.
+func ClearAccount(account string) error {
+	account = normalize(account)
+	if len(account) == 0 {
+		return errors.New("throttle: account cannot be empty")
+	}
+
+	for _, action := range Actions {
+		if err := store.ClearAccount(action, account); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClearIP stops every failed attempt from `ip` counting against it, lifting any lock on it.
+func ClearIP(ip string) error {
+	if len(ip) == 0 {
+		return errors.New("throttle: IP cannot be empty")
+	}
+
+	for _, action := range Actions {
+		if err := store.ClearIP(action, ip); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,296 @@
+package throttle
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/boatilus/peppercorn/db/dbtest"
+	"github.com/boatilus/peppercorn/utility"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const tableName = "failed_attempts_test"
+
+func init() {
+	viper.Set("db.failed_attempts_table", tableName)
+
+	switch backend, conn := dbtest.Setup("throttle", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
+	}
+}
+
+// failAt records a failed attempt at `action` on `account` from `ip`, as though made at `at`.
+func failAt(t *testing.T, action Action, account string, ip string, at time.Time) {
+	a := Attempt{
+		ID:      utility.GenerateUUID(),
+		Action:  action,
+		Account: normalize(account),
+		IP:      ip,
+		Created: at.UTC(),
+	}
+
+	if err := store.Insert(&a); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fail makes `n` attempts at `action` on `account` from `ip`, each of which fails.
+func fail(t *testing.T, n int, action Action, account string, ip string) {
+	for i := 0; i < n; i++ {
+		a, wait, err := Try(action, account, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a == nil || wait > 0 {
+			t.Fatalf("attempt %d at %s on %q was refused", i+1, action, account)
+		}
+	}
+}
+
+// check returns how long is left before `action` can be attempted on `account` from `ip`, without
+// attempting it.
+func check(action Action, account string, ip string) (time.Duration, error) {
+	return waitFor(action, normalize(account), ip, time.Now().UTC(), func(*Attempt) bool {
+		return true
+	})
+}
+
+func TestDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(time.Duration(0), delay(0, 5))
+	assert.Equal(time.Duration(0), delay(4, 5))
+	assert.Equal(DefaultDelay, delay(5, 5))
+	assert.Equal(2*DefaultDelay, delay(6, 5))
+	assert.Equal(4*DefaultDelay, delay(7, 5))
+	assert.Equal(DefaultMaxDelay, delay(20, 5))
+	assert.Equal(DefaultMaxDelay, delay(1000, 5), "the wait shouldn't overflow")
+}
+
+func TestCheckAccount(t *testing.T) {
+	assert := assert.New(t)
+
+	// The free attempts come from all over, so that only the account is locked.
+	for i := 0; i < DefaultFreeAttempts-1; i++ {
+		fail(t, 1, SignIn, "Guessed@Example.com", fmt.Sprintf("10.0.0.%d", i))
+	}
+
+	wait, err := check(SignIn, "guessed@example.com", "10.0.1.1")
+	if assert.NoError(err) {
+		assert.Zero(wait, "there are attempts to spare")
+	}
+
+	attempt, wait, err := Try(SignIn, " guessed@example.com", "10.0.1.1")
+	if !assert.NoError(err) || !assert.NotNil(attempt) {
+		return
+	}
+
+	assert.Zero(wait, "the last free attempt should go ahead")
+
+	wait, err = check(SignIn, "GUESSED@example.com", "10.0.1.2")
+	if assert.NoError(err) {
+		assert.True(wait > 0 && wait <= DefaultDelay, "the account should be locked in any case")
+	}
+
+	refused, wait, err := Try(SignIn, "guessed@example.com", "10.0.1.2")
+	if assert.NoError(err) {
+		assert.Nil(refused)
+		assert.True(wait > 0, "an attempt on a locked account should be refused")
+	}
+
+	wait, err = check(Code, "guessed@example.com", "10.0.1.2")
+	if assert.NoError(err) {
+		assert.Zero(wait, "other actions should be counted apart")
+	}
+
+	wait, err = check(SignIn, "other@example.com", "10.0.1.1")
+	if assert.NoError(err) {
+		assert.Zero(wait, "other accounts should be unaffected")
+	}
+
+	failAt(t, SignIn, "guessed@example.com", "10.0.1.1", time.Now())
+	failAt(t, SignIn, "guessed@example.com", "10.0.1.1", time.Now())
+
+	wait, err = check(SignIn, "guessed@example.com", "10.0.1.1")
+	if assert.NoError(err) {
+		assert.True(wait > 2*DefaultDelay, "each attempt should double the wait")
+	}
+
+	// Succeeding clears the account, but not the addresses it was attempted from, and the attempt
+	// that succeeded no longer counts at all.
+	assert.NoError(Succeed(attempt))
+	assert.Error(Succeed(nil))
+
+	wait, err = check(SignIn, "guessed@example.com", "10.0.1.1")
+	if assert.NoError(err) {
+		assert.Zero(wait)
+	}
+
+	as, err := store.ListByIP(SignIn, "10.0.1.1", time.Now().Add(-time.Hour))
+	if assert.NoError(err) {
+		assert.Len(as, 2)
+	}
+}
+
+func TestTry_concurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	const n = 50
+
+	went := make(chan bool, n)
+
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			a, _, err := Try(SignIn, "raced@example.com", fmt.Sprintf("10.0.5.%d", i))
+			assert.NoError(err)
+
+			went <- a != nil
+		}(i)
+	}
+
+	var ahead int
+	for i := 0; i < n; i++ {
+		if <-went {
+			ahead++
+		}
+	}
+
+	assert.Equal(DefaultFreeAttempts, ahead, "only the free attempts should go ahead, however many are made at once")
+
+	as, err := store.ListByAccount(SignIn, "raced@example.com", time.Now().Add(-time.Hour))
+	if assert.NoError(err) {
+		assert.Len(as, DefaultFreeAttempts, "refused attempts shouldn't be recorded")
+	}
+}
+
+func TestCheckIP(t *testing.T) {
+	assert := assert.New(t)
+
+	for i := 0; i < DefaultIPFreeAttempts; i++ {
+		fail(t, 1, Forgot, fmt.Sprintf("sprayed%d@example.com", i), "10.0.2.1")
+	}
+
+	wait, err := check(Forgot, "fresh@example.com", "10.0.2.1")
+	if assert.NoError(err) {
+		assert.True(wait > 0, "the address should be locked for any account")
+	}
+
+	wait, err = check(Forgot, "fresh@example.com", "10.0.2.2")
+	if assert.NoError(err) {
+		assert.Zero(wait, "other addresses should be unaffected")
+	}
+
+	wait, err = check(Forgot, "", "")
+	if assert.NoError(err) {
+		assert.Zero(wait)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	old := time.Now().Add(-DefaultWindow - time.Hour)
+	for i := 0; i < DefaultFreeAttempts*2; i++ {
+		failAt(t, SignIn, "forgotten@example.com", "10.0.3.1", old)
+	}
+
+	wait, err := check(SignIn, "forgotten@example.com", "10.0.3.1")
+	if assert.NoError(err) {
+		assert.Zero(wait, "attempts outside the window should be forgotten")
+	}
+
+	// An attempt long enough ago that its wait has passed doesn't lock anything either.
+	for i := 0; i < DefaultFreeAttempts; i++ {
+		failAt(t, SignIn, "waited@example.com", "10.0.3.2", time.Now().Add(-2*DefaultDelay))
+	}
+
+	wait, err = check(SignIn, "waited@example.com", "10.0.3.2")
+	if assert.NoError(err) {
+		assert.Zero(wait)
+	}
+
+	// Recording another failure prunes those outside the window.
+	fail(t, 1, SignIn, "forgotten@example.com", "10.0.3.1")
+
+	as, err := store.ListByAccount(SignIn, "forgotten@example.com", old.Add(-time.Hour))
+	if assert.NoError(err) {
+		assert.Len(as, 1)
+	}
+}
+
+func TestLocksAndClear(t *testing.T) {
+	assert := assert.New(t)
+
+	fail(t, DefaultFreeAttempts, Code, "locked@example.com", "10.0.4.1")
+	fail(t, DefaultIPFreeAttempts, SignIn, "", "10.0.4.2")
+
+	ls, err := Locks()
+	if !assert.NoError(err) {
+		return
+	}
+
+	var account, ip *Lock
+	for i := range ls {
+		if ls[i].Account == "locked@example.com" {
+			account = &ls[i]
+		}
+
+		if ls[i].IP == "10.0.4.2" {
+			ip = &ls[i]
+		}
+
+		assert.True(ls[i].Account == "" || ls[i].IP == "", "a lock is on an account or an address")
+	}
+
+	if assert.NotNil(account) {
+		assert.Equal(Code, account.Action)
+		assert.Equal(DefaultFreeAttempts, account.Failures)
+		assert.True(account.Until.After(time.Now()))
+	}
+
+	if assert.NotNil(ip) {
+		assert.Equal(SignIn, ip.Action)
+		assert.Equal(DefaultIPFreeAttempts, ip.Failures)
+	}
+
+	as, err := Recent(3)
+	if assert.NoError(err) {
+		assert.Len(as, 3)
+		assert.False(as[0].Created.Before(as[2].Created), "attempts should be newest first")
+	}
+
+	_, err = Recent(0)
+	assert.Error(err)
+
+	assert.Error(ClearAccount(" "))
+	assert.Error(ClearIP(""))
+
+	assert.NoError(ClearAccount("Locked@Example.com"))
+	assert.NoError(ClearIP("10.0.4.2"))
+
+	wait, err := check(Code, "locked@example.com", "10.0.4.3")
+	if assert.NoError(err) {
+		assert.Zero(wait)
+	}
+
+	wait, err = check(SignIn, "anyone@example.com", "10.0.4.2")
+	if assert.NoError(err) {
+		assert.Zero(wait)
+	}
+
+	ls, err = Locks()
+	if assert.NoError(err) {
+		for _, l := range ls {
+			assert.NotEqual("locked@example.com", l.Account)
+			assert.NotEqual("10.0.4.2", l.IP)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The functions here are those through which admins manage other users' accounts. Each loads the
+// user with `id` afresh, changes it, and returns it as stored.
+
+// Edit changes the email, name and title of the user with `id`. Errs if the email or name is
+// invalid or already belongs to another user.
+func Edit(id string, email string, name string, title string) (*User, error) {
+	email = strings.TrimSpace(email)
+	name = strings.TrimSpace(name)
+	title = strings.TrimSpace(title)
+
+	if len(email) == 0 || !strings.Contains(email, "@") {
+		return nil, errors.New("invalid_email")
+	}
+
+	if len(name) == 0 || len(name) > 24 {
+		return nil, errors.New("invalid_name")
+	}
+
+	u, err := GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if email != u.Email {
+		other, err := store.GetByEmail(email)
+		if err != nil {
+			return nil, err
+		}
+
+		if other != nil {
+			return nil, fmt.Errorf("A user already exists with email %q", email)
+		}
+	}
+
+	if name != u.Name {
+		other, err := store.GetByName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if other != nil {
+			return nil, fmt.Errorf("A user already exists with name %q", name)
+		}
+	}
+
+	u.Email = email
+	u.Name = name
+	u.Title = title
+
+	if err := Update(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// SetSuspended suspends the user with `id`, or lifts their suspension. Suspending a user doesn't
+// end their sessions, but they're turned away on their next request all the same.
+func SetSuspended(id string, suspended bool) (*User, error) {
+	u, err := GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	u.IsSuspended = suspended
+
+	if err := Update(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// ResetTwoFactor turns off two-factor authentication for the user with `id` and discards their
+// secret and recovery codes, as when they've lost their authenticator. They can then sign in with
+// their password alone, and set it up again from scratch.
+func ResetTwoFactor(id string) (*User, error) {
+	u, err := GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Has2FAEnabled = false
+	u.TOTPSecret = ""
+	u.RecoveryCodes = nil
+
+	if err := Update(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// ClearPassword removes the password of the user with `id`, so that no password signs them in
+// until they've reset it.
+func ClearPassword(id string) (*User, error) {
+	u, err := GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Hash = ""
+
+	if err := Update(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
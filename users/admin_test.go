@@ -0,0 +1,124 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createManaged creates a user for the admin functions to manage, returning its ID.
+func createManaged(t *testing.T, name string) string {
+	u := User{
+		Email:         name + "@managed.com",
+		Name:          name,
+		PPP:           10,
+		Hash:          "$2a$08$ALb1nD4nfIpBXKgBdWc.meAOkaE4g7jXPzBq/W1zZLvWtVmtfprW6",
+		Has2FAEnabled: true,
+		TOTPSecret:    "secret",
+		RecoveryCodes: []string{"a", "b"},
+	}
+
+	if err := Create(&u); err != nil {
+		t.Fatal(err)
+	}
+
+	return u.ID
+}
+
+func TestEdit(t *testing.T) {
+	assert := assert.New(t)
+
+	id := createManaged(t, "edited")
+	createManaged(t, "taken")
+
+	u, err := Edit(id, " renamed@managed.com ", " renamed ", " A title ")
+	if assert.NoError(err) {
+		assert.Equal("renamed@managed.com", u.Email)
+		assert.Equal("renamed", u.Name)
+		assert.Equal("A title", u.Title)
+	}
+
+	got, err := GetByID(id)
+	if assert.NoError(err) {
+		assert.Equal("renamed", got.Name)
+	}
+
+	cached, _ := Users.Get(id)
+	assert.Equal("renamed", cached.Name, "the cache should be kept up to date")
+
+	// Keeping the same email and name isn't a conflict.
+	_, err = Edit(id, "renamed@managed.com", "renamed", "")
+	assert.NoError(err)
+
+	_, err = Edit(id, "taken@managed.com", "renamed", "")
+	assert.Error(err, "another user's email can't be taken")
+
+	_, err = Edit(id, "renamed@managed.com", "taken", "")
+	assert.Error(err, "another user's name can't be taken")
+
+	_, err = Edit(id, "not an email", "renamed", "")
+	assert.Error(err)
+
+	_, err = Edit(id, "renamed@managed.com", "", "")
+	assert.Error(err)
+
+	_, err = Edit("nonexistent", "x@managed.com", "x", "")
+	assert.Error(err)
+}
+
+func TestSetSuspended(t *testing.T) {
+	assert := assert.New(t)
+
+	id := createManaged(t, "suspended")
+
+	u, err := SetSuspended(id, true)
+	if assert.NoError(err) {
+		assert.True(u.IsSuspended)
+	}
+
+	got, err := GetByID(id)
+	if assert.NoError(err) {
+		assert.True(got.IsSuspended)
+	}
+
+	if _, err := SetSuspended(id, false); assert.NoError(err) {
+		got, _ := GetByID(id)
+		assert.False(got.IsSuspended)
+	}
+
+	_, err = SetSuspended("nonexistent", true)
+	assert.Error(err)
+}
+
+func TestResetTwoFactor(t *testing.T) {
+	assert := assert.New(t)
+
+	id := createManaged(t, "twofactor")
+
+	if _, err := ResetTwoFactor(id); !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	got, err := GetByID(id)
+	if assert.NoError(err) {
+		assert.False(got.Has2FAEnabled)
+		assert.Empty(got.TOTPSecret)
+		assert.Empty(got.RecoveryCodes)
+	}
+}
+
+func TestClearPassword(t *testing.T) {
+	assert := assert.New(t)
+
+	id := createManaged(t, "cleared")
+
+	if _, err := ClearPassword(id); !assert.NoError(err) {
+		t.FailNow()
+	}
+
+	got, err := GetByID(id)
+	if assert.NoError(err) {
+		assert.Empty(got.Hash)
+		assert.False(Validate(got.Hash, ""), "no password should match a cleared one")
+	}
+}
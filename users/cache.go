@@ -0,0 +1,240 @@
+package users
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Cache is a concurrency-safe copy of every user, kept so that we needn't join users into posts
+// in the database. It's kept current by the package-level functions that write users, and by
+// Watch for changes made by other processes.
+type Cache struct {
+	mu    sync.RWMutex
+	users map[string]User
+	// misses holds when each ID with no user was last looked up, so that it isn't looked up in the
+	// store again until missTTL has passed.
+	misses map[string]time.Time
+}
+
+// missTTL is how long an ID with no user is remembered as having none.
+const missTTL = 10 * time.Second
+
+// NewCache returns an empty Cache.
+func NewCache() *Cache {
+	return &Cache{users: make(map[string]User), misses: make(map[string]time.Time)}
+}
+
+// Users is the cache of all users, filled by Populate.
+var Users = NewCache()
+
+// Get returns the user with `id`, loading it from the store if it's not cached. It returns false
+// if `id` is empty, there's no such user, or it couldn't be loaded. That there's no user with `id`
+// is itself cached briefly, so that looking up a missing user again and again doesn't each time
+// reach the store.
+func (c *Cache) Get(id string) (User, bool) {
+	if id == "" {
+		return User{}, false
+	}
+
+	c.mu.RLock()
+	u, ok := c.users[id]
+	missed, isMiss := c.misses[id]
+	c.mu.RUnlock()
+
+	if ok {
+		return u, true
+	}
+
+	if isMiss && time.Since(missed) < missTTL {
+		return User{}, false
+	}
+
+	found, err := store.GetByID(id)
+	if err != nil {
+		log.Printf("users: loading user %q into cache: %s", id, err)
+		return User{}, false
+	}
+
+	if found == nil {
+		c.miss(id)
+		return User{}, false
+	}
+
+	c.Set(*found)
+
+	return *found, true
+}
+
+// miss records that there's no user with `id`, forgetting any earlier misses that have expired so
+// that lookups of many missing IDs don't fill the cache.
+func (c *Cache) miss(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	for missed, at := range c.misses {
+		if now.Sub(at) >= missTTL {
+			delete(c.misses, missed)
+		}
+	}
+
+	c.misses[id] = now
+}
+
+// Set adds or replaces `u` in the cache.
+func (c *Cache) Set(u User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.users[u.ID] = u
+	delete(c.misses, u.ID)
+}
+
+// Invalidate removes the user with `id` from the cache, so that it's loaded afresh on next Get.
+func (c *Cache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.users, id)
+	delete(c.misses, id)
+}
+
+// Len returns the number of cached users.
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.users)
+}
+
+// Refresh replaces the contents of the cache with every user in the store.
+func (c *Cache) Refresh() error {
+	us, err := store.All()
+	if err != nil {
+		return err
+	}
+
+	fresh := make(map[string]User, len(us))
+	for _, u := range us {
+		fresh[u.ID] = u
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.users = fresh
+	c.misses = make(map[string]time.Time)
+
+	return nil
+}
+
+// Change is a single change to a user, as reported by a Store that implements changeFeeder. Old is
+// nil for a new user, and New is nil for a deleted one.
+type Change struct {
+	Old *User
+	New *User
+}
+
+// changeFeeder is implemented by Stores that can report changes to users themselves, including
+// changes made by other processes, as RethinkDB's changefeeds do.
+type changeFeeder interface {
+	// Changes returns a channel of changes, which is closed if the feed fails.
+	Changes() (<-chan Change, error)
+}
+
+// retryInterval is the time to wait before resubscribing to a failed changefeed.
+const retryInterval = 5 * time.Second
+
+// DefaultRefreshInterval is how often the cache is refreshed by default, for stores that can't
+// report their own changes.
+const DefaultRefreshInterval = time.Minute
+
+// Watch keeps the cache current with changes made by other processes until the returned function
+// is called. If the store can report its own changes, the cache follows them. Otherwise, the cache
+// is refreshed every `interval`, unless `interval` is zero.
+func (c *Cache) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() { close(done) })
+	}
+
+	if f, ok := store.(changeFeeder); ok {
+		go c.follow(f, done)
+		return stop
+	}
+
+	if interval <= 0 {
+		return stop
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := c.Refresh(); err != nil {
+					log.Printf("users: refreshing cache: %s", err)
+				}
+			}
+		}
+	}()
+
+	return stop
+}
+
+// follow applies every change from `f` to the cache until `done` is closed, resubscribing if the
+// feed fails. As changes may have been missed in the meantime, it refreshes the whole cache each
+// time it subscribes.
+func (c *Cache) follow(f changeFeeder, done <-chan struct{}) {
+	for {
+		changes, err := f.Changes()
+		if err != nil {
+			log.Printf("users: subscribing to changes: %s", err)
+		} else {
+			if err := c.Refresh(); err != nil {
+				log.Printf("users: refreshing cache: %s", err)
+			}
+
+			if !c.apply(changes, done) {
+				return
+			}
+
+			log.Print("users: change feed closed")
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// apply applies each change from `changes` to the cache, returning true when `changes` is closed
+// and false if `done` is closed first.
+func (c *Cache) apply(changes <-chan Change, done <-chan struct{}) bool {
+	for {
+		select {
+		case <-done:
+			return false
+		case ch, ok := <-changes:
+			if !ok {
+				return true
+			}
+
+			if ch.New != nil {
+				c.Set(*ch.New)
+			} else if ch.Old != nil {
+				c.Invalidate(ch.Old.ID)
+			}
+		}
+	}
+}
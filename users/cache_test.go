@@ -0,0 +1,213 @@
+package users
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useStore swaps in `s` for the duration of a test, returning a function that restores the
+// previous store.
+func useStore(s Store) func() {
+	prev := store
+	SetStore(s)
+
+	return func() { SetStore(prev) }
+}
+
+func TestCache_Get(t *testing.T) {
+	assert := assert.New(t)
+
+	defer useStore(NewMemoryStore())()
+
+	id, err := store.Insert(&User{Email: "cache@example.com", Name: "cache"})
+	assert.NoError(err)
+
+	c := NewCache()
+
+	// A miss is loaded from the store and cached.
+	u, ok := c.Get(id)
+	assert.True(ok)
+	assert.Equal("cache", u.Name)
+	assert.Equal(1, c.Len())
+
+	_, ok = c.Get("nobody")
+	assert.False(ok)
+	assert.Equal(1, c.Len())
+}
+
+// countingStore is a Store that counts the users looked up by ID.
+type countingStore struct {
+	Store
+	gets int
+}
+
+func (s *countingStore) GetByID(id string) (*User, error) {
+	s.gets++
+	return s.Store.GetByID(id)
+}
+
+func TestCache_GetMissing(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &countingStore{Store: NewMemoryStore()}
+	defer useStore(s)()
+
+	c := NewCache()
+
+	// An empty ID never reaches the store.
+	_, ok := c.Get("")
+	assert.False(ok)
+	assert.Zero(s.gets)
+
+	// A missing user is looked up once, then remembered as missing for a while.
+	for i := 0; i < 3; i++ {
+		_, ok = c.Get("nobody")
+		assert.False(ok)
+	}
+
+	assert.Equal(1, s.gets)
+	assert.Equal(0, c.Len())
+
+	// Setting or invalidating a user forgets that it was missing.
+	c.Set(User{ID: "nobody", Name: "somebody"})
+
+	u, ok := c.Get("nobody")
+	assert.True(ok)
+	assert.Equal("somebody", u.Name)
+
+	c.Invalidate("nobody")
+
+	_, ok = c.Get("nobody")
+	assert.False(ok)
+	assert.Equal(2, s.gets)
+
+	c.Invalidate("nobody")
+
+	_, ok = c.Get("nobody")
+	assert.False(ok)
+	assert.Equal(3, s.gets)
+}
+
+func TestCache_SetInvalidate(t *testing.T) {
+	assert := assert.New(t)
+
+	defer useStore(NewMemoryStore())()
+
+	id, err := store.Insert(&User{Email: "cache@example.com", Name: "stored"})
+	assert.NoError(err)
+
+	c := NewCache()
+	c.Set(User{ID: id, Name: "cached"})
+
+	u, _ := c.Get(id)
+	assert.Equal("cached", u.Name)
+
+	c.Invalidate(id)
+	assert.Equal(0, c.Len())
+
+	u, _ = c.Get(id)
+	assert.Equal("stored", u.Name)
+}
+
+func TestCache_Refresh(t *testing.T) {
+	assert := assert.New(t)
+
+	defer useStore(NewMemoryStore())()
+
+	c := NewCache()
+	c.Set(User{ID: "gone", Name: "gone"})
+
+	_, err := store.Insert(&User{Email: "1@example.com", Name: "1"})
+	assert.NoError(err)
+	_, err = store.Insert(&User{Email: "2@example.com", Name: "2"})
+	assert.NoError(err)
+
+	assert.NoError(c.Refresh())
+	assert.Equal(2, c.Len())
+
+	c.mu.RLock()
+	_, ok := c.users["gone"]
+	c.mu.RUnlock()
+
+	assert.False(ok)
+}
+
+// eventually retries `cond` until it's true or a second has passed.
+func eventually(cond func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return false
+}
+
+func TestCache_Watch(t *testing.T) {
+	assert := assert.New(t)
+
+	defer useStore(NewMemoryStore())()
+
+	u := User{Email: "watch@example.com", Name: "before"}
+
+	id, err := store.Insert(&u)
+	assert.NoError(err)
+
+	u.ID = id
+
+	c := NewCache()
+	assert.NoError(c.Refresh())
+
+	stop := c.Watch(10 * time.Millisecond)
+	defer stop()
+
+	// Change the user behind the cache's back, as another process would.
+	u.Name = "after"
+	assert.NoError(store.Update(&u))
+
+	assert.True(eventually(func() bool {
+		got, _ := c.Get(id)
+		return got.Name == "after"
+	}))
+}
+
+// feedStore is a Store that reports the changes sent on its channel.
+type feedStore struct {
+	Store
+	changes chan Change
+}
+
+func (s *feedStore) Changes() (<-chan Change, error) {
+	return s.changes, nil
+}
+
+func TestCache_Watch_changeFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &feedStore{Store: NewMemoryStore(), changes: make(chan Change)}
+	defer useStore(s)()
+
+	c := NewCache()
+
+	stop := c.Watch(0)
+	defer stop()
+
+	s.changes <- Change{New: &User{ID: "1", Name: "new"}}
+
+	assert.True(eventually(func() bool {
+		got, _ := c.Get("1")
+		return got.Name == "new"
+	}))
+
+	s.changes <- Change{Old: &User{ID: "1", Name: "new"}}
+
+	assert.True(eventually(func() bool {
+		return c.Len() == 0
+	}))
+}
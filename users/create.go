@@ -2,6 +2,7 @@ package users
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/boatilus/peppercorn/db"
 	"github.com/spf13/viper"
@@ -97,18 +98,34 @@ func Create(u *User) error {
 		return fmt.Errorf("A user already exists with email %q or name %q", u.Email, u.Name)
 	}
 
-	res, err := db.Get().Table(GetTable()).Insert(u).RunWrite(db.Session)
+	if u.Joined == nil {
+		now := time.Now().UTC()
+		u.Joined = &now
+	}
+
+	id, err := store.Insert(u)
 	if err != nil {
 		return err
 	}
 
-	if res.Inserted != 1 {
-		return fmt.Errorf("Could not insert user [%s]", u.Email)
+	u.ID = id
+	Users.Set(*u)
+
+	return nil
+}
+
+// Restore inserts a user exactly as given, keeping its ID. It's intended for restoring users from
+// an archive, so unlike Create, it doesn't check for an existing user with the same email or name.
+func Restore(u *User) error {
+	if u == nil || u.ID == "" {
+		return fmt.Errorf("Cannot restore a user without an ID")
 	}
 
-	id := res.GeneratedKeys[0]
+	if _, err := store.Insert(u); err != nil {
+		return err
+	}
 
-	Users[id] = *u
+	Users.Set(*u)
 
 	return nil
 }
@@ -0,0 +1,131 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// memoryStore is a Store that keeps all users in process memory. Nothing is persisted, so it's
+// useful only for development and tests.
+type memoryStore struct {
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+// NewMemoryStore returns an empty, in-memory Store.
+func NewMemoryStore() Store {
+	return &memoryStore{users: make(map[string]User)}
+}
+
+func (s *memoryStore) All() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	us := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		us = append(us, u)
+	}
+
+	return us, nil
+}
+
+func (s *memoryStore) Exists(u *User) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, e := range s.users {
+		if e.Email == u.Email || e.Name == u.Name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *memoryStore) GetByID(id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &u, nil
+}
+
+func (s *memoryStore) GetByEmail(email string) (*User, error) {
+	return s.find(func(u *User) bool { return u.Email == email })
+}
+
+func (s *memoryStore) GetByName(name string) (*User, error) {
+	return s.find(func(u *User) bool { return u.Name == name })
+}
+
+func (s *memoryStore) Insert(u *User) (string, error) {
+	if u == nil {
+		return "", errors.New("Cannot insert nil user")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *u
+	if cp.ID == "" {
+		cp.ID = utility.GenerateUUID()
+	}
+
+	if _, ok := s.users[cp.ID]; ok {
+		return "", fmt.Errorf("Could not insert user [%s]", u.Email)
+	}
+
+	s.users[cp.ID] = cp
+
+	return cp.ID, nil
+}
+
+func (s *memoryStore) Update(u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[u.ID]; !ok {
+		return fmt.Errorf("Failed to update user %q with new data", u.ID)
+	}
+
+	s.users[u.ID] = *u
+
+	return nil
+}
+
+// find returns a copy of the first user for which `match` returns true.
+func (s *memoryStore) find(match func(u *User) bool) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if match(&u) {
+			return &u, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *memoryStore) SetLastSeen(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return fmt.Errorf("Failed to update user %q with new data", id)
+	}
+
+	u.LastSeen = &at
+	s.users[id] = u
+
+	return nil
+}
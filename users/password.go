@@ -0,0 +1,264 @@
+package users
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultMinPasswordLength is the fewest characters a password can have unless the
+// `password.min_length` config value gives another number.
+const DefaultMinPasswordLength = 8
+
+// DefaultMinPasswordEntropy is the fewest bits of entropy a password is estimated to have unless
+// the `password.min_entropy` config value gives another number.
+const DefaultMinPasswordEntropy = 30
+
+func init() {
+	viper.SetDefault("password.min_length", DefaultMinPasswordLength)
+	viper.SetDefault("password.min_entropy", DefaultMinPasswordEntropy)
+	viper.SetDefault("password.breached_file", "")
+}
+
+// MinPasswordLength returns the fewest characters a password can have.
+func MinPasswordLength() int {
+	return viper.GetInt("password.min_length")
+}
+
+// CheckPassword returns an error if `password` can't be used as the password of the user with
+// `email` and `name`. The error is one of the following codes, for the caller to explain:
+//
+//   - "invalid_hash" if it's shorter than MinPasswordLength
+//   - "personal_password" if it contains the user's name or the name part of their email
+//   - "weak_password" if it's estimated to have fewer bits of entropy than `password.min_entropy`
+//   - "breached_password" if it's in the corpus of breached passwords in `password.breached_file`
+func CheckPassword(password string, email string, name string) error {
+	if len([]rune(password)) < MinPasswordLength() {
+		return errors.New("invalid_hash")
+	}
+
+	if isPersonal(password, email, name) {
+		return errors.New("personal_password")
+	}
+
+	if estimateEntropy(password) < viper.GetFloat64("password.min_entropy") {
+		return errors.New("weak_password")
+	}
+
+	if path := viper.GetString("password.breached_file"); path != "" {
+		breached, err := isBreached(path, password)
+		if err != nil {
+			return err
+		}
+
+		if breached {
+			return errors.New("breached_password")
+		}
+	}
+
+	return nil
+}
+
+// isPersonal returns true if `password` is the user's email, or contains their name or the part of
+// their email before the `@`. Parts shorter than three characters are too likely to turn up by
+// chance to be held against a password.
+func isPersonal(password string, email string, name string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if email != "" && password == email {
+		return true
+	}
+
+	parts := []string{strings.ToLower(strings.TrimSpace(name))}
+	if at := strings.LastIndex(email, "@"); at > 0 {
+		parts = append(parts, email[:at])
+	}
+
+	for _, part := range parts {
+		if len([]rune(part)) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// estimateEntropy returns a rough estimate of the bits of entropy in `password`, as though each
+// character were chosen at random from the classes of characters it uses. Characters that repeat
+// or neighbor the one before, as in "aaaa" or "1234", add only a bit each, as runs like these are
+// among the first things guessed.
+func estimateEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(pool))
+
+	var bits float64
+	var prev rune
+
+	for i, r := range []rune(password) {
+		if d := r - prev; i > 0 && d >= -1 && d <= 1 {
+			bits++
+		} else {
+			bits += perChar
+		}
+
+		prev = r
+	}
+
+	return bits
+}
+
+// isBreached returns true if the SHA-1 hash of `password` is among those listed in the file at
+// `path`. The file has a hash in hexadecimal on each line, optionally followed by a colon and a
+// count, and is sorted by hash: the format of the Pwned Passwords list, ordered by hash. It's
+// searched in place, so it can be far larger than memory.
+func isBreached(path string, password string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	sum := sha1.Sum([]byte(password))
+
+	return searchHashes(f, info.Size(), strings.ToUpper(hex.EncodeToString(sum[:])))
+}
+
+// searchHashes binary searches the sorted lines of `r`, which is `size` bytes long, for one whose
+// hash is `hash`. The search narrows a range of byte offsets in which the line sought must start.
+func searchHashes(r io.ReaderAt, size int64, hash string) (bool, error) {
+	lo, hi := int64(0), size
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := lineFrom(r, size, mid)
+		if err != nil {
+			return false, err
+		}
+
+		// No line starts between the middle and the end of the range, so it's in the first half.
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		got := line
+		if colon := strings.IndexByte(got, ':'); colon >= 0 {
+			got = got[:colon]
+		}
+
+		switch c := strings.Compare(strings.ToUpper(strings.TrimSpace(got)), hash); {
+		case c == 0:
+			return true, nil
+		case c < 0:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+
+	return false, nil
+}
+
+// lineFrom returns the first line of `r` starting at or after `offset`, without its line ending,
+// and where it starts. A line past the end of `r` starts at `size` and is empty.
+func lineFrom(r io.ReaderAt, size int64, offset int64) (int64, string, error) {
+	start := offset
+
+	// Unless the offset is the start of `r`, or just after a line ending, it's within a line, and
+	// the line wanted is the next.
+	if offset > 0 {
+		i, err := indexNewline(r, size, offset-1)
+		if err != nil {
+			return 0, "", err
+		}
+
+		start = i + 1
+	}
+
+	if start >= size {
+		return size, "", nil
+	}
+
+	end, err := indexNewline(r, size, start)
+	if err != nil {
+		return 0, "", err
+	}
+
+	buf := make([]byte, end-start)
+	if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+		return 0, "", err
+	}
+
+	return start, strings.TrimRight(string(buf), "\r"), nil
+}
+
+// indexNewline returns the offset of the first newline in `r` at or after `offset`, or `size` if
+// there's none.
+func indexNewline(r io.ReaderAt, size int64, offset int64) (int64, error) {
+	buf := make([]byte, 128)
+
+	for offset < size {
+		n, err := r.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return offset + int64(i), nil
+		}
+
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if n == 0 {
+			break
+		}
+
+		offset += int64(n)
+	}
+
+	return size, nil
+}
@@ -0,0 +1,154 @@
+package users
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeBreachedFile writes a breached password file listing `passwords`, sorted by hash and with a
+// count after each as in the Pwned Passwords list, returning its path.
+func writeBreachedFile(t *testing.T, passwords ...string) string {
+	var lines []string
+	for i, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":"+strings.Repeat("9", i+1))
+	}
+
+	sort.Strings(lines)
+
+	dir, err := ioutil.TempDir("", "peppercorn-breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "breached.txt")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(0.0, estimateEntropy(""))
+	assert.True(estimateEntropy("12345678") < 12, "a run should count for little")
+	assert.True(estimateEntropy("aaaaaaaaaaaa") < 17, "repeats should count for little")
+	assert.True(estimateEntropy("password") > DefaultMinPasswordEntropy)
+	assert.True(estimateEntropy("Tr0ub4dor&3") > estimateEntropy("troubadour"), "mixing classes should count for more")
+}
+
+func TestCheckPassword(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		password string
+		want     string
+	}{
+		{"short", "invalid_hash"},
+		{"12345678", "weak_password"},
+		{"aaaaaaaaaaaa", "weak_password"},
+		{"Mallory1999", "personal_password"},
+		{"mallory.smith@example.com", "personal_password"},
+		{"xx-mallory.smith-xx", "personal_password"},
+		{"correct horse", ""},
+	}
+
+	for _, c := range cases {
+		err := CheckPassword(c.password, "mallory.smith@example.com", "Mallory")
+		if c.want == "" {
+			assert.NoError(err, c.password)
+		} else {
+			assert.EqualError(err, c.want, c.password)
+		}
+	}
+
+	// Short names and emails are too likely to turn up by chance to count.
+	assert.NoError(CheckPassword("go fly a kite", "go@example.com", "go"))
+
+	viper.Set("password.min_length", 16)
+	defer viper.Set("password.min_length", DefaultMinPasswordLength)
+
+	assert.EqualError(CheckPassword("correct horse", "", ""), "invalid_hash")
+}
+
+func TestCheckPasswordBreached(t *testing.T) {
+	assert := assert.New(t)
+
+	breached := []string{"correct horse", "battery staple", "hunter2hunter2", "letmein please", "qwertyuiop[]"}
+	path := writeBreachedFile(t, breached...)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	viper.Set("password.breached_file", path)
+	defer viper.Set("password.breached_file", "")
+
+	for _, p := range breached {
+		assert.EqualError(CheckPassword(p, "", ""), "breached_password", p)
+	}
+
+	assert.NoError(CheckPassword("never breached", "", ""))
+
+	viper.Set("password.breached_file", filepath.Join(filepath.Dir(path), "missing.txt"))
+	assert.Error(CheckPassword("never breached", "", ""), "a missing file should be reported")
+}
+
+func TestSearchHashes(t *testing.T) {
+	assert := assert.New(t)
+
+	// Every line of a file, however it's split, should be found, and nothing between them.
+	hashes := []string{"0A", "1B", "2C", "3D", "4E", "5F", "6A", "7B", "8C"}
+	file := strings.Join(hashes, "\n")
+	r := strings.NewReader(file)
+
+	for _, h := range hashes {
+		found, err := searchHashes(r, int64(len(file)), h)
+		if assert.NoError(err) {
+			assert.True(found, h)
+		}
+	}
+
+	for _, h := range []string{"00", "0B", "45", "8D", "FF"} {
+		found, err := searchHashes(r, int64(len(file)), h)
+		if assert.NoError(err) {
+			assert.False(found, h)
+		}
+	}
+
+	found, err := searchHashes(strings.NewReader(""), 0, "0A")
+	assert.NoError(err)
+	assert.False(found)
+}
+
+func TestSetPassword(t *testing.T) {
+	assert := assert.New(t)
+
+	u, err := New(UserOpts{Email: "setter@example.com", Name: "setter"}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Create(u); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = SetPassword(u.ID, "setter setter")
+	assert.EqualError(err, "personal_password")
+
+	set, err := SetPassword(u.ID, "new password")
+	if assert.NoError(err) {
+		assert.True(Validate(set.Hash, "new password"))
+	}
+
+	_, err = SetPassword("nonexistent", "new password")
+	assert.Error(err)
+}
@@ -0,0 +1,201 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	rethink "gopkg.in/dancannon/gorethink.v2"
+)
+
+// rethinkStore is the RethinkDB-backed Store, and reads and writes the table named by GetTable.
+type rethinkStore struct{}
+
+func (rethinkStore) All() ([]User, error) {
+	if !db.Session.IsConnected() {
+		return nil, errors.New("RethinkDB session not connected")
+	}
+
+	cursor, err := db.Get().Table(GetTable()).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	if cursor.IsNil() {
+		return nil, errors.New("users: in Populate(), RethinkDB cursor is nil")
+	}
+
+	defer cursor.Close()
+
+	var us []User
+	var res User
+	for cursor.Next(&res) {
+		us = append(us, res)
+	}
+
+	return us, cursor.Err() // get any error encountered during iteration
+}
+
+func (rethinkStore) Exists(u *User) (bool, error) {
+	if !db.Session.IsConnected() {
+		return false, errors.New("RethinkDB session not connected")
+	}
+
+	t := rethink.Or(rethink.Row.Field("email").Eq(u.Email), rethink.Row.Field("name").Eq(u.Name))
+
+	cursor, err := db.Get().Table(GetTable()).Filter(t).Run(db.Session)
+	if err != nil {
+		return false, err
+	}
+
+	defer cursor.Close()
+
+	return !cursor.IsNil(), nil
+}
+
+func (rethinkStore) GetByID(id string) (*User, error) {
+	if !db.Session.IsConnected() {
+		return nil, errors.New("RethinkDB session not connected")
+	}
+
+	cursor, err := db.Get().Table(GetTable()).Get(id).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	return one(cursor)
+}
+
+func (rethinkStore) GetByEmail(email string) (*User, error) {
+	if !db.Session.IsConnected() {
+		return nil, errors.New("RethinkDB session not connected")
+	}
+
+	f := rethink.Row.Field("email").Eq(email)
+
+	cursor, err := db.Get().Table(GetTable()).Filter(f).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	return one(cursor)
+}
+
+func (rethinkStore) GetByName(name string) (*User, error) {
+	if !db.Session.IsConnected() {
+		return nil, errors.New("RethinkDB session not connected")
+	}
+
+	f := rethink.Row.Field("name").Eq(name)
+
+	cursor, err := db.Get().Table(GetTable()).Filter(f).Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	return one(cursor)
+}
+
+func (rethinkStore) Insert(u *User) (string, error) {
+	res, err := db.Get().Table(GetTable()).Insert(u).RunWrite(db.Session)
+	if err != nil {
+		return "", err
+	}
+
+	if res.Inserted != 1 {
+		return "", fmt.Errorf("Could not insert user [%s]", u.Email)
+	}
+
+	// RethinkDB only generates a key if the user didn't already have an ID.
+	if u.ID != "" {
+		return u.ID, nil
+	}
+
+	return res.GeneratedKeys[0], nil
+}
+
+func (rethinkStore) Update(u *User) error {
+	if !db.Session.IsConnected() {
+		return errors.New("RethinkDB session not connected")
+	}
+
+	res, err := db.Get().Table(GetTable()).Get(u.ID).Update(u).RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	// An update returns a WriteResponse with a value for `Replaced`, not `Updated`
+	if res.Replaced != 1 {
+		return fmt.Errorf("Failed to update user %q with new data", u.ID)
+	}
+
+	return nil
+}
+
+func (rethinkStore) SetLastSeen(id string, at time.Time) error {
+	if !db.Session.IsConnected() {
+		return errors.New("RethinkDB session not connected")
+	}
+
+	res, err := db.Get().Table(GetTable()).Get(id).Update(map[string]interface{}{"last_seen": at}).RunWrite(db.Session)
+	if err != nil {
+		return err
+	}
+
+	if res.Replaced+res.Unchanged != 1 {
+		return fmt.Errorf("Failed to update user %q with new data", id)
+	}
+
+	return nil
+}
+
+func (rethinkStore) Changes() (<-chan Change, error) {
+	cursor, err := db.Get().Table(GetTable()).Changes().Run(db.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan Change)
+
+	go func() {
+		defer close(changes)
+		defer cursor.Close()
+
+		var res struct {
+			OldVal *User `gorethink:"old_val"`
+			NewVal *User `gorethink:"new_val"`
+		}
+
+		for cursor.Next(&res) {
+			changes <- Change{Old: res.OldVal, New: res.NewVal}
+
+			// Next won't reset a value that's absent from the next document.
+			res.OldVal, res.NewVal = nil, nil
+		}
+
+		if err := cursor.Err(); err != nil {
+			log.Printf("users: change feed: %s", err)
+		}
+	}()
+
+	return changes, nil
+}
+
+// one reads a single user from `cursor` and closes it, returning a nil user if the cursor is
+// empty.
+func one(cursor *rethink.Cursor) (*User, error) {
+	defer cursor.Close()
+
+	if cursor.IsNil() {
+		return nil, nil
+	}
+
+	var u User
+	if err := cursor.One(&u); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
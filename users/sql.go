@@ -0,0 +1,187 @@
+package users
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/utility"
+)
+
+// sqlStore is a Store backed by SQLite or PostgreSQL, and reads and writes the table named by
+// GetTable.
+type sqlStore struct {
+	conn *db.SQL
+}
+
+// NewSQLStore returns a Store that reads and writes through `conn`.
+func NewSQLStore(conn *db.SQL) Store {
+	return &sqlStore{conn: conn}
+}
+
+const userColumns = `id, avatar, email, name, posts_per_page, title, timezone, last_viewed, hash,
+	has_2fa_enabled, auth_duration, totp_secret, recovery_codes, is_admin, is_suspended, joined, last_seen`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads a row of userColumns. Recovery codes are stored as a JSON array, since SQLite has
+// no array type.
+func scanUser(row scanner) (*User, error) {
+	var u User
+	var codes string
+
+	err := row.Scan(&u.ID, &u.Avatar, &u.Email, &u.Name, &u.PPP, &u.Title, &u.Timezone, &u.LastViewed,
+		&u.Hash, &u.Has2FAEnabled, &u.AuthDuration, &u.TOTPSecret, &codes, &u.IsAdmin, &u.IsSuspended,
+		&u.Joined, &u.LastSeen)
+	if err != nil {
+		return nil, err
+	}
+
+	if codes != "" {
+		if err := json.Unmarshal([]byte(codes), &u.RecoveryCodes); err != nil {
+			return nil, err
+		}
+	}
+
+	return &u, nil
+}
+
+// utc returns `t` in UTC, or nil if `t` is nil.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	u := t.UTC()
+
+	return &u
+}
+
+// values returns the fields of `u` in the order of userColumns.
+func values(u *User) ([]interface{}, error) {
+	codes, err := json.Marshal(u.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{u.ID, u.Avatar, u.Email, u.Name, u.PPP, u.Title, u.Timezone, u.LastViewed,
+		u.Hash, u.Has2FAEnabled, u.AuthDuration, u.TOTPSecret, string(codes), u.IsAdmin, u.IsSuspended,
+		utc(u.Joined), utc(u.LastSeen)}, nil
+}
+
+func (s *sqlStore) All() ([]User, error) {
+	rows, err := s.conn.Query("SELECT " + userColumns + " FROM " + GetTable())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var us []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		us = append(us, *u)
+	}
+
+	return us, rows.Err()
+}
+
+func (s *sqlStore) Exists(u *User) (bool, error) {
+	var n int
+	err := s.conn.QueryRow("SELECT COUNT(*) FROM "+GetTable()+" WHERE email = ? OR name = ?", u.Email, u.Name).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// getBy returns the user whose `column` equals `value`.
+func (s *sqlStore) getBy(column string, value string) (*User, error) {
+	u, err := scanUser(s.conn.QueryRow("SELECT "+userColumns+" FROM "+GetTable()+" WHERE "+column+" = ?", value))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return u, err
+}
+
+func (s *sqlStore) GetByID(id string) (*User, error) {
+	return s.getBy("id", id)
+}
+
+func (s *sqlStore) GetByEmail(email string) (*User, error) {
+	return s.getBy("email", email)
+}
+
+func (s *sqlStore) GetByName(name string) (*User, error) {
+	return s.getBy("name", name)
+}
+
+func (s *sqlStore) Insert(u *User) (string, error) {
+	if u == nil {
+		return "", errors.New("Cannot insert nil user")
+	}
+
+	cp := *u
+	if cp.ID == "" {
+		cp.ID = utility.GenerateUUID()
+	}
+
+	vs, err := values(&cp)
+	if err != nil {
+		return "", err
+	}
+
+	q := "INSERT INTO " + GetTable() + " (" + userColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	if _, err := s.conn.Exec(q, vs...); err != nil {
+		return "", fmt.Errorf("Could not insert user [%s]: %s", u.Email, err)
+	}
+
+	return cp.ID, nil
+}
+
+func (s *sqlStore) Update(u *User) error {
+	vs, err := values(u)
+	if err != nil {
+		return err
+	}
+
+	q := "UPDATE " + GetTable() + ` SET avatar = ?, email = ?, name = ?, posts_per_page = ?, title = ?,
+		timezone = ?, last_viewed = ?, hash = ?, has_2fa_enabled = ?, auth_duration = ?, totp_secret = ?,
+		recovery_codes = ?, is_admin = ?, is_suspended = ?, joined = ?, last_seen = ? WHERE id = ?`
+
+	res, err := s.conn.Exec(q, append(vs[1:], u.ID)...)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return fmt.Errorf("Failed to update user %q with new data", u.ID)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) SetLastSeen(id string, at time.Time) error {
+	res, err := s.conn.Exec("UPDATE "+GetTable()+" SET last_seen = ? WHERE id = ?", at.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return fmt.Errorf("Failed to update user %q with new data", id)
+	}
+
+	return nil
+}
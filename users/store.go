@@ -0,0 +1,35 @@
+package users
+
+import "time"
+
+// Store is the interface through which all user data is read and written. The package-level
+// functions validate their arguments and delegate to the current Store, so callers need never know
+// which backend is in use.
+//
+// Single-document lookups return a nil value and a nil error if no document matches, leaving it to
+// the caller to decide whether that's an error.
+type Store interface {
+	// All returns every user.
+	All() ([]User, error)
+	// Exists returns true if a user exists with either the email or the name of `u`.
+	Exists(u *User) (bool, error)
+	GetByID(id string) (*User, error)
+	GetByEmail(email string) (*User, error)
+	GetByName(name string) (*User, error)
+	// Insert adds a user, returning its ID. An ID is generated unless the user already has one.
+	Insert(u *User) (string, error)
+	// Update replaces the stored data for the user with the ID of `u`.
+	Update(u *User) error
+	// SetLastSeen sets only the LastSeen time of the user with `id`, so that it can't undo a
+	// concurrent Update.
+	SetLastSeen(id string, at time.Time) error
+}
+
+// store is the Store used by the package-level functions. It defaults to RethinkDB.
+var store Store = rethinkStore{}
+
+// SetStore replaces the Store used by the package-level functions. It should be called before the
+// server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
@@ -1,6 +1,12 @@
 package users
 
-import "github.com/boatilus/peppercorn/utility"
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/boatilus/peppercorn/utility"
+)
 
 // GenerateRecoveryCodes creates a set of 10 new MFA recovery codes on the user.
 func (u *User) GenerateRecoveryCodes() {
@@ -9,3 +15,85 @@ func (u *User) GenerateRecoveryCodes() {
 		u.RecoveryCodes[i] = utility.GenerateRandomRecoveryCode()
 	}
 }
+
+// SetEmail changes the email of the user with `id`, returning the user as stored. Errs if the email
+// is invalid or already belongs to a user.
+func SetEmail(id string, email string) (*User, error) {
+	email = strings.TrimSpace(email)
+
+	if len(email) == 0 || !strings.Contains(email, "@") {
+		return nil, errors.New("invalid_email")
+	}
+
+	// Names are never empty, so this matches on the email alone.
+	exists, err := Exists(&User{Email: email})
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, fmt.Errorf("A user already exists with email %q", email)
+	}
+
+	u, err := GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Email = email
+
+	if err := Update(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// ChangePassword changes the password of the user with `id` from `current` to `password`,
+// returning the user as stored. Errs with "invalid_password" if `current` is wrong, or as
+// CheckPassword does if `password` can't be used.
+func ChangePassword(id string, current string, password string) (*User, error) {
+	u, err := GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !Validate(u.Hash, current) {
+		return nil, errors.New("invalid_password")
+	}
+
+	return setPassword(u, password)
+}
+
+// SetPassword sets the password of the user with `id` to `password`, without asking for the
+// current one, returning the user as stored. Errs as CheckPassword does if `password` can't be
+// used.
+func SetPassword(id string, password string) (*User, error) {
+	u, err := GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return setPassword(u, password)
+}
+
+// setPassword checks `password` against the password policy and, if it passes, stores its hash on
+// `u`.
+func setPassword(u *User, password string) (*User, error) {
+	if err := CheckPassword(password, u.Email, u.Name); err != nil {
+		return nil, err
+	}
+
+	hash, err := CreateHash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Hash = hash
+
+	if err := Update(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
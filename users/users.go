@@ -2,7 +2,7 @@ package users
 
 import (
 	"errors"
-	"fmt"
+	"time"
 
 	"github.com/boatilus/peppercorn/db"
 	"github.com/spf13/viper"
@@ -30,6 +30,16 @@ type User struct {
 	RecoveryCodes []string `gorethink:"recovery_codes"`
 
 	IsAdmin bool `gorethink:"is_admin,omitempty"`
+	// IsSuspended is set by an admin to keep the user from signing in or using any page that needs
+	// them signed in.
+	IsSuspended bool `gorethink:"is_suspended,omitempty"`
+
+	// Joined is when the user was created, or for users created before it was recorded, the time of
+	// their first post. It's nil if neither is known.
+	Joined *time.Time `gorethink:"joined,omitempty"`
+	// LastSeen is when the user last used a page needing them signed in, to within
+	// LastSeenInterval. It's nil if they haven't since it was first recorded.
+	LastSeen *time.Time `gorethink:"last_seen,omitempty"`
 }
 
 // GetTable returns the value of db.users_table from the config file.
@@ -37,36 +47,15 @@ func GetTable() string {
 	return viper.GetString("db.users_table")
 }
 
-// As a workaround to faulty sorting with joins in RethinkDB, we'll maintain a local state of the
-// users at all times. This sucks, but for now it's necessary.
-var Users map[string]User
-
-func init() {
-	Users = make(map[string]User)
+// All returns every user from the store, rather than from the Users cache.
+func All() ([]User, error) {
+	return store.All()
 }
 
+// Populate fills the Users cache with every user. As a workaround to faulty sorting with joins in
+// RethinkDB, we'll maintain a local state of the users at all times.
 func Populate() error {
-	if !db.Session.IsConnected() {
-		return errors.New("RethinkDB session not connected")
-	}
-
-	cursor, err := db.Get().Table(GetTable()).Run(db.Session)
-	if err != nil {
-		return err
-	}
-
-	if cursor.IsNil() {
-		return errors.New("users: in Populate(), RethinkDB cursor is nil")
-	}
-
-	defer cursor.Close()
-
-	var res User
-	for cursor.Next(&res) {
-		Users[res.ID] = res
-	}
-
-	return cursor.Err() // get any error encountered during iteration
+	return Users.Refresh()
 }
 
 // CreateHash creates a Bcrypt hash for a given password. Returns a non-nil error on any failure.
@@ -93,21 +82,37 @@ func Validate(hash string, password string) bool {
 // Update accepts a `User` and updates the document for that user. Returns a non-nil error on any
 // failure.
 func Update(u *User) error {
-	if !db.Session.IsConnected() {
-		return errors.New("RethinkDB session not connected")
+	if err := store.Update(u); err != nil {
+		return err
 	}
 
-	res, err := db.Get().Table(GetTable()).Get(u.ID).Update(u).RunWrite(db.Session)
-	if err != nil {
-		return err
+	Users.Set(*u)
+
+	return nil
+}
+
+// LastSeenInterval is how often LastSeen is brought up to date while a user is active, so that not
+// every request needs a write.
+const LastSeenInterval = 5 * time.Minute
+
+// Seen records that `u` was active at `at`, unless that's within LastSeenInterval of when they were
+// last seen.
+func Seen(u *User, at time.Time) error {
+	if u.LastSeen != nil && at.Sub(*u.LastSeen) < LastSeenInterval {
+		return nil
 	}
 
-	// An update returns a WriteResponse with a value for `Replaced`, not `Updated`
-	if res.Replaced != 1 {
-		return fmt.Errorf("Failed to update user %q with new data", u.ID)
+	if err := store.SetLastSeen(u.ID, at); err != nil {
+		return err
 	}
 
-	Users[u.ID] = *u
+	u.LastSeen = &at
+
+	// As only the one field is written, the rest of the cached user is left as it was.
+	if cached, ok := Users.Get(u.ID); ok {
+		cached.LastSeen = &at
+		Users.Set(cached)
+	}
 
 	return nil
 }
@@ -149,9 +154,5 @@ func validateData(email string, name string, ppp db.CountType, password string)
 		return errors.New("invalid_ppp")
 	}
 
-	if len(password) < 8 { // Should be 60?
-		return errors.New("invalid_hash")
-	}
-
-	return nil
+	return CheckPassword(password, email, name)
 }
@@ -4,11 +4,12 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/boatilus/peppercorn/db"
+	"github.com/boatilus/peppercorn/db/dbtest"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
-	rethink "gopkg.in/dancannon/gorethink.v2"
 )
 
 type doc struct {
@@ -31,13 +32,16 @@ func init() {
 	viper.Set("db.users_table", tableName)
 	viper.Set("bcrypt_cost", 10)
 
-	var err error
-
-	if db.Session, err = rethink.Connect(rethink.ConnectOpts{Address: "localhost:28015"}); err != nil {
-		panic(err)
+	switch backend, conn := dbtest.Setup("users", tableName); backend {
+	case dbtest.Rethink:
+		SetStore(rethinkStore{})
+	case dbtest.SQL:
+		SetStore(NewSQLStore(conn))
+	case dbtest.Memory:
+		SetStore(NewMemoryStore())
 	}
 
-	setupDB()
+	insertUsers()
 }
 
 func makeUserFromDoc(d doc) User {
@@ -53,29 +57,20 @@ func makeUserFromDoc(d doc) User {
 	}
 }
 
-func setupDB() {
-	if !db.Session.IsConnected() {
-		panic("No DB connected")
-	}
-
-	rethink.DBCreate(db.Name).Run(db.Session)
-
-	peppercorn := rethink.DB(db.Name)
-
-	// Due to a lack of mocking in gorethink, we'll tear down the test data and repopulate on each
-	// run of the tests
-	peppercorn.TableDrop(tableName).Run(db.Session)
+// insertUsers inserts the test users through the current store.
+func insertUsers() {
+	for _, u := range loadUsers() {
+		id, err := store.Insert(&u)
+		if err != nil {
+			panic(err)
+		}
 
-	if _, err := peppercorn.TableCreate(tableName).Run(db.Session); err != nil {
-		panic(err)
+		validKeys = append(validKeys, id)
 	}
+}
 
-	table := peppercorn.Table(tableName)
-
-	table.IndexCreate("email").Run(db.Session)
-	table.IndexCreate("name").Run(db.Session)
-	table.IndexWait().Run(db.Session)
-
+// loadUsers reads in the test data from JSON and returns it as a slice of users.
+func loadUsers() []User {
 	bytes, err := ioutil.ReadFile("users.test_data.json")
 
 	if err := json.Unmarshal(bytes, &docs); err != nil {
@@ -99,16 +94,7 @@ func setupDB() {
 		users[i].IsAdmin = docs[i].IsAdmin
 	}
 
-	res, err := table.Insert(users).RunWrite(db.Session)
-	if err != nil {
-		panic(err)
-	}
-
-	if res.Inserted == 0 {
-		panic("Inserted 0 docs")
-	}
-
-	validKeys = res.GeneratedKeys
+	return users
 }
 
 func TestGetTable(t *testing.T) {
@@ -178,7 +164,7 @@ func TestNew(t *testing.T) {
 		IsAdmin: want.IsAdmin,
 	}
 
-	pass := "12345678"
+	pass := "correct horse"
 
 	got, err := New(opts, pass)
 	assert.Nil(err)
@@ -204,7 +190,7 @@ func TestNewFromDefaults(t *testing.T) {
 		IsAdmin: false,
 	}
 
-	pass := "12345678"
+	pass := "correct horse"
 
 	got, err := NewFromDefaults(want.Email, want.Name, pass)
 	assert.Nil(err)
@@ -231,6 +217,12 @@ func TestCreate(t *testing.T) {
 
 	err := Create(&want)
 	assert.Nil(t, err)
+	assert.NotNil(t, want.Joined, "the time a user joins should be recorded")
+
+	got, err := GetByID(want.ID)
+	if assert.NoError(t, err) && assert.NotNil(t, got.Joined) {
+		assert.WithinDuration(t, *want.Joined, *got.Joined, time.Millisecond)
+	}
 }
 
 func TestGetByID(t *testing.T) {
@@ -344,6 +336,46 @@ func TestGetAuthDuration(t *testing.T) {
 	assert.Equal(t, db.CountType(3600), u.GetAuthDuration())
 }
 
+func TestSeen(t *testing.T) {
+	assert := assert.New(t)
+
+	id := createManaged(t, "seen")
+
+	u, err := GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(u.LastSeen)
+
+	first := time.Now().UTC().Truncate(time.Millisecond)
+	assert.NoError(Seen(u, first))
+
+	got, err := GetByID(id)
+	if assert.NoError(err) && assert.NotNil(got.LastSeen) {
+		assert.True(first.Equal(*got.LastSeen))
+	}
+
+	cached, _ := Users.Get(id)
+	if assert.NotNil(cached.LastSeen, "the cache should be kept up to date") {
+		assert.True(first.Equal(*cached.LastSeen))
+	}
+
+	// Being seen again so soon isn't recorded.
+	assert.NoError(Seen(got, first.Add(LastSeenInterval/2)))
+
+	got, _ = GetByID(id)
+	assert.True(first.Equal(*got.LastSeen))
+
+	later := first.Add(LastSeenInterval)
+	assert.NoError(Seen(got, later))
+
+	got, _ = GetByID(id)
+	assert.True(later.Equal(*got.LastSeen))
+
+	assert.Error(Seen(&User{ID: "missing"}, later))
+}
+
 func TestGenerateRecoveryCodes(t *testing.T) {
 	u, _ := GetByName("user1")
 	u.GenerateRecoveryCodes()
@@ -354,3 +386,65 @@ func TestGenerateRecoveryCodes(t *testing.T) {
 		assert.Len(t, e, 12)
 	}
 }
+
+func TestSetEmail(t *testing.T) {
+	assert := assert.New(t)
+
+	id := createManaged(t, "moving")
+	createManaged(t, "staying")
+
+	u, err := SetEmail(id, " moved@managed.com ")
+	if assert.NoError(err) {
+		assert.Equal("moved@managed.com", u.Email)
+	}
+
+	got, err := GetByID(id)
+	if assert.NoError(err) {
+		assert.Equal("moved@managed.com", got.Email)
+	}
+
+	cached, _ := Users.Get(id)
+	assert.Equal("moved@managed.com", cached.Email, "the cache should be kept up to date")
+
+	_, err = SetEmail(id, "staying@managed.com")
+	assert.Error(err, "another user's email can't be taken")
+
+	_, err = SetEmail(id, "not an email")
+	assert.EqualError(err, "invalid_email")
+
+	_, err = SetEmail("nonexistent", "nobody@managed.com")
+	assert.Error(err)
+}
+
+func TestChangePassword(t *testing.T) {
+	assert := assert.New(t)
+
+	u, err := New(UserOpts{Email: "changer@example.com", Name: "changer"}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Create(u); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ChangePassword(u.ID, "wrong password", "new password")
+	assert.EqualError(err, "invalid_password")
+
+	_, err = ChangePassword(u.ID, "password", "short")
+	assert.EqualError(err, "invalid_hash")
+
+	changed, err := ChangePassword(u.ID, "password", "new password")
+	if assert.NoError(err) {
+		assert.True(Validate(changed.Hash, "new password"))
+		assert.False(Validate(changed.Hash, "password"))
+	}
+
+	got, err := GetByID(u.ID)
+	if assert.NoError(err) {
+		assert.True(Validate(got.Hash, "new password"), "the new hash should be stored")
+	}
+
+	_, err = ChangePassword("nonexistent", "password", "new password")
+	assert.Error(err)
+}
@@ -237,3 +237,19 @@ func GenerateRandomRecoveryCode() string {
 
 	return string(b1[0:6]) + string(b2[0:6])
 }
+
+// GenerateUUID returns a random (version 4) UUID in its canonical 36-character string form, which
+// matches the format of the primary keys RethinkDB generates for us on insert.
+func GenerateUUID() string {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -245,3 +245,10 @@ func TestGenerateRandomRecoveryCode(t *testing.T) {
 	assert.NotEmpty(t, got)
 	assert.Len(t, got, 12)
 }
+
+func TestGenerateUUID(t *testing.T) {
+	got := GenerateUUID()
+	assert.Len(t, got, 36)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), got)
+	assert.NotEqual(t, got, GenerateUUID())
+}